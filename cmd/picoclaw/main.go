@@ -18,6 +18,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
@@ -35,6 +36,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/migrate"
 	"github.com/sipeed/picoclaw/pkg/plugins"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/sandbox"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
@@ -121,6 +123,9 @@ func copyDirectory(src, dst string) error {
 }
 
 func main() {
+	// Runs the exec sandbox helper instead when started as one
+	sandbox.Init()
+
 	if len(os.Args) < 2 {
 		printHelp()
 		os.Exit(1)
@@ -143,6 +148,8 @@ func main() {
 		authCmd()
 	case "cron":
 		cronCmd()
+	case "models":
+		modelsCmd()
 	case "skills":
 		if len(os.Args) < 3 {
 			skillsHelp()
@@ -158,7 +165,7 @@ func main() {
 		}
 
 		workspace := cfg.WorkspacePath()
-		installer := skills.NewSkillInstaller(workspace)
+		installer := skills.NewSkillInstaller(workspace, cfg.Tools.Network)
 		// 获取全局配置目录和内置 skills 目录
 		globalDir := filepath.Dir(getConfigPath())
 		globalSkillsDir := filepath.Join(globalDir, "skills")
@@ -214,6 +221,7 @@ func printHelp() {
 	fmt.Println("  gateway     Start picoclaw gateway")
 	fmt.Println("  status      Show picoclaw status")
 	fmt.Println("  cron        Manage scheduled tasks")
+	fmt.Println("  models      Manage local models (list, pull)")
 	fmt.Println("  migrate     Migrate from OpenClaw to PicoClaw")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
 	fmt.Println("  plugin      Manage plugins (install, list, remove)")
@@ -408,6 +416,7 @@ func agentCmd() {
 		fmt.Printf("Error creating provider: %v\n", err)
 		os.Exit(1)
 	}
+	provider = providers.WithRateLimit(provider, cfg)
 
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
@@ -543,6 +552,7 @@ func gatewayCmd() {
 		fmt.Printf("Error creating provider: %v\n", err)
 		os.Exit(1)
 	}
+	provider = providers.WithRateLimit(provider, cfg)
 
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
@@ -602,6 +612,9 @@ func gatewayCmd() {
 	// Inject channel manager into agent loop for command handling
 	agentLoop.SetChannelManager(channelManager)
 
+	// Let allow-lists match accounts linked via /link
+	channelManager.SetIdentityResolver(agentLoop.Identities())
+
 	var transcriber *voice.GroqTranscriber
 	if cfg.Providers.Groq.APIKey != "" {
 		transcriber = voice.NewGroqTranscriber(cfg.Providers.Groq.APIKey)
@@ -677,6 +690,11 @@ func gatewayCmd() {
 	}
 
 	healthServer := health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port)
+	if reporter, ok := provider.(providers.CircuitReporter); ok {
+		healthServer.RegisterCheck("providers", func() (bool, string) {
+			return providerCircuitsHealthy(reporter.Circuits())
+		})
+	}
 	go func() {
 		if err := healthServer.Start(); err != nil && err != http.ErrServerClosed {
 			logger.ErrorCF("health", "Health server error", map[string]interface{}{"error": err.Error()})
@@ -701,6 +719,21 @@ func gatewayCmd() {
 	fmt.Println("✓ Gateway stopped")
 }
 
+// providerCircuitsHealthy fails the readiness check while any provider circuit is open.
+func providerCircuitsHealthy(circuits map[string]string) (bool, string) {
+	var open []string
+	for name, state := range circuits {
+		if state == providers.CircuitOpen {
+			open = append(open, name)
+		}
+	}
+	if len(open) == 0 {
+		return true, ""
+	}
+	sort.Strings(open)
+	return false, "circuit open: " + strings.Join(open, ", ")
+}
+
 func statusCmd() {
 	cfg, err := loadConfig()
 	if err != nil {
@@ -759,6 +792,12 @@ func statusCmd() {
 		} else {
 			fmt.Println("vLLM/Local: not set")
 		}
+		if cfg.Providers.Azure.Endpoint != "" {
+			fmt.Printf("Azure OpenAI: ✓ %s\n", cfg.Providers.Azure.Endpoint)
+		}
+		for _, e := range cfg.Providers.List {
+			fmt.Printf("%s (%s): ✓ %s\n", e.Name, e.Protocol, e.APIBase)
+		}
 
 		store, _ := auth.LoadStore()
 		if store != nil && len(store.Credentials) > 0 {
@@ -789,6 +828,8 @@ func authCmd() {
 		authLogoutCmd()
 	case "status":
 		authStatusCmd()
+	case "rotate-key":
+		authRotateKeyCmd()
 	default:
 		fmt.Printf("Unknown auth command: %s\n", os.Args[2])
 		authHelp()
@@ -800,22 +841,33 @@ func authHelp() {
 	fmt.Println("  login       Login via OAuth or paste token")
 	fmt.Println("  logout      Remove stored credentials")
 	fmt.Println("  status      Show current auth status")
+	fmt.Println("  rotate-key  Re-encrypt stored credentials with a new key")
 	fmt.Println()
 	fmt.Println("Login options:")
 	fmt.Println("  --provider <name>    Provider to login with (openai, anthropic)")
 	fmt.Println("  --device-code        Use device code flow (for headless environments)")
+	fmt.Println("  --token              Paste an API key or session token instead of OAuth")
+	fmt.Println("  --profile <name>     Store the credential as an extra profile; profiles are rotated")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  picoclaw auth login --provider openai")
 	fmt.Println("  picoclaw auth login --provider openai --device-code")
 	fmt.Println("  picoclaw auth login --provider anthropic")
+	fmt.Println("  picoclaw auth login --provider anthropic --token")
+	fmt.Println("  picoclaw auth login --provider anthropic --token --profile work")
 	fmt.Println("  picoclaw auth logout --provider openai")
+	fmt.Println("  picoclaw auth logout --provider anthropic --profile work")
 	fmt.Println("  picoclaw auth status")
+	fmt.Println("  picoclaw auth rotate-key --passphrase")
+	fmt.Println()
+	fmt.Printf("Credentials are encrypted with ~/.picoclaw/auth.key, or with a passphrase when %s is set.\n", auth.PassphraseEnv)
 }
 
 func authLoginCmd() {
 	provider := ""
+	profile := ""
 	useDeviceCode := false
+	useToken := false
 
 	args := os.Args[3:]
 	for i := 0; i < len(args); i++ {
@@ -825,8 +877,15 @@ func authLoginCmd() {
 				provider = args[i+1]
 				i++
 			}
+		case "--profile":
+			if i+1 < len(args) {
+				profile = args[i+1]
+				i++
+			}
 		case "--device-code":
 			useDeviceCode = true
+		case "--token":
+			useToken = true
 		}
 	}
 
@@ -836,27 +895,40 @@ func authLoginCmd() {
 		return
 	}
 
-	switch provider {
-	case "openai":
-		authLoginOpenAI(useDeviceCode)
-	case "anthropic":
-		authLoginPasteToken(provider)
-	default:
+	switch {
+	case provider != "openai" && provider != "anthropic":
 		fmt.Printf("Unsupported provider: %s\n", provider)
 		fmt.Println("Supported providers: openai, anthropic")
+	case useToken:
+		authLoginPasteToken(provider, profile)
+	default:
+		authLoginOAuth(provider, profile, useDeviceCode)
 	}
 }
 
-func authLoginOpenAI(useDeviceCode bool) {
+func authLoginOAuth(provider, profile string, useDeviceCode bool) {
+	appCfg, cfgErr := loadConfig()
+
 	cfg := auth.OpenAIOAuthConfig()
+	if provider == "anthropic" {
+		var clientID string
+		if cfgErr == nil {
+			clientID = appCfg.Providers.Anthropic.OAuthClientID
+		}
+		cfg = auth.AnthropicOAuthConfig(clientID)
+	}
 
 	var cred *auth.AuthCredential
 	var err error
 
-	if useDeviceCode {
-		cred, err = auth.LoginDeviceCode(cfg)
-	} else {
-		cred, err = auth.LoginBrowser(cfg)
+	switch {
+	case useDeviceCode && provider == "anthropic":
+		// Anthropic has no device flow; it shows a code to paste instead
+		cred, err = auth.LoginManualCode(context.Background(), cfg, os.Stdin)
+	case useDeviceCode:
+		cred, err = auth.LoginDeviceCode(context.Background(), cfg)
+	default:
+		cred, err = auth.LoginBrowser(context.Background(), cfg)
 	}
 
 	if err != nil {
@@ -864,14 +936,18 @@ func authLoginOpenAI(useDeviceCode bool) {
 		os.Exit(1)
 	}
 
-	if err := auth.SetCredential("openai", cred); err != nil {
+	if err := auth.SetCredential(auth.CredentialKey(provider, profile), cred); err != nil {
 		fmt.Printf("Failed to save credentials: %v\n", err)
 		os.Exit(1)
 	}
 
-	appCfg, err := loadConfig()
-	if err == nil {
-		appCfg.Providers.OpenAI.AuthMethod = "oauth"
+	if cfgErr == nil {
+		switch provider {
+		case "anthropic":
+			appCfg.Providers.Anthropic.AuthMethod = "oauth"
+		case "openai":
+			appCfg.Providers.OpenAI.AuthMethod = "oauth"
+		}
 		if err := config.SaveConfig(getConfigPath(), appCfg); err != nil {
 			fmt.Printf("Warning: could not update config: %v\n", err)
 		}
@@ -883,14 +959,14 @@ func authLoginOpenAI(useDeviceCode bool) {
 	}
 }
 
-func authLoginPasteToken(provider string) {
+func authLoginPasteToken(provider, profile string) {
 	cred, err := auth.LoginPasteToken(provider, os.Stdin)
 	if err != nil {
 		fmt.Printf("Login failed: %v\n", err)
 		os.Exit(1)
 	}
 
-	if err := auth.SetCredential(provider, cred); err != nil {
+	if err := auth.SetCredential(auth.CredentialKey(provider, profile), cred); err != nil {
 		fmt.Printf("Failed to save credentials: %v\n", err)
 		os.Exit(1)
 	}
@@ -913,6 +989,7 @@ func authLoginPasteToken(provider string) {
 
 func authLogoutCmd() {
 	provider := ""
+	profile := ""
 
 	args := os.Args[3:]
 	for i := 0; i < len(args); i++ {
@@ -922,15 +999,36 @@ func authLogoutCmd() {
 				provider = args[i+1]
 				i++
 			}
+		case "--profile":
+			if i+1 < len(args) {
+				profile = args[i+1]
+				i++
+			}
 		}
 	}
 
 	if provider != "" {
-		if err := auth.DeleteCredential(provider); err != nil {
-			fmt.Printf("Failed to remove credentials: %v\n", err)
-			os.Exit(1)
+		keys := []string{auth.CredentialKey(provider, profile)}
+		if profile == "" {
+			// Without --profile, drop every profile of the provider
+			all, err := auth.ProfileKeys(provider)
+			if err != nil {
+				fmt.Printf("Failed to remove credentials: %v\n", err)
+				os.Exit(1)
+			}
+			keys = append(keys[:0], all...)
+		}
+		for _, key := range keys {
+			if err := auth.DeleteCredential(key); err != nil {
+				fmt.Printf("Failed to remove credentials: %v\n", err)
+				os.Exit(1)
+			}
 		}
 
+		if remaining, _ := auth.ProfileKeys(provider); len(remaining) > 0 {
+			fmt.Printf("Logged out from %s\n", auth.CredentialKey(provider, profile))
+			return
+		}
 		appCfg, err := loadConfig()
 		if err == nil {
 			switch provider {
@@ -966,31 +1064,125 @@ func authStatusCmd() {
 		fmt.Printf("Error loading auth store: %v\n", err)
 		return
 	}
+	health, err := auth.LoadKeyHealth()
+	if err != nil {
+		health = map[string]*auth.KeyHealth{}
+	}
 
 	if len(store.Credentials) == 0 {
 		fmt.Println("No authenticated providers.")
 		fmt.Println("Run: picoclaw auth login --provider <name>")
+	} else {
+		fmt.Println("\nAuthenticated Providers:")
+		fmt.Println("------------------------")
+		names := make([]string, 0, len(store.Credentials))
+		for name := range store.Credentials {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			cred := store.Credentials[name]
+			status := "active"
+			if cred.IsExpired() {
+				status = "expired"
+			} else if cred.NeedsRefresh() {
+				status = "needs refresh"
+			}
+
+			fmt.Printf("  %s:\n", name)
+			fmt.Printf("    Method: %s\n", cred.AuthMethod)
+			fmt.Printf("    Status: %s\n", status)
+			if cred.AccountID != "" {
+				fmt.Printf("    Account: %s\n", cred.AccountID)
+			}
+			if !cred.ExpiresAt.IsZero() {
+				fmt.Printf("    Expires: %s\n", cred.ExpiresAt.Format("2006-01-02 15:04"))
+			}
+			fmt.Printf("    Health: %s\n", keyHealthStatus(health[name]))
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
 		return
 	}
+	printed := false
+	vendors := cfg.Providers.Vendors()
+	names := make([]string, 0, len(vendors))
+	for name := range vendors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		printed = printKeyHealth(name, vendors[name].Keys(), health, printed)
+	}
+	for _, e := range cfg.Providers.List {
+		printed = printKeyHealth(e.Name, e.Keys(), health, printed)
+	}
+}
+
+// printKeyHealth prints the health of a provider's configured API keys
+// when it has more than one, adding the section header on first use.
+func printKeyHealth(provider string, keys []string, health map[string]*auth.KeyHealth, printed bool) bool {
+	if len(keys) < 2 {
+		return printed
+	}
+	if !printed {
+		fmt.Println("\nAPI Keys:")
+		fmt.Println("---------")
+	}
+	fmt.Printf("  %s:\n", provider)
+	for _, key := range keys {
+		fmt.Printf("    %s: %s\n", auth.KeyLabel(key), keyHealthStatus(health[auth.KeyID(provider, key)]))
+	}
+	return true
+}
+
+func keyHealthStatus(h *auth.KeyHealth) string {
+	switch {
+	case h == nil:
+		return "ok"
+	case h.CoolingDown():
+		return fmt.Sprintf("cooling down until %s (%s)", h.CooldownUntil.Format("15:04:05"), h.LastError)
+	case h.Failures > 0:
+		return fmt.Sprintf("ok, %d recent failures (%s)", h.Failures, h.LastError)
+	default:
+		return "ok"
+	}
+}
 
-	fmt.Println("\nAuthenticated Providers:")
-	fmt.Println("------------------------")
-	for provider, cred := range store.Credentials {
-		status := "active"
-		if cred.IsExpired() {
-			status = "expired"
-		} else if cred.NeedsRefresh() {
-			status = "needs refresh"
+func authRotateKeyCmd() {
+	usePassphrase := false
+	for _, arg := range os.Args[3:] {
+		if arg == "--passphrase" {
+			usePassphrase = true
 		}
+	}
 
-		fmt.Printf("  %s:\n", provider)
-		fmt.Printf("    Method: %s\n", cred.AuthMethod)
-		fmt.Printf("    Status: %s\n", status)
-		if cred.AccountID != "" {
-			fmt.Printf("    Account: %s\n", cred.AccountID)
+	passphrase := ""
+	if usePassphrase {
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Print("New passphrase: ")
+		line, _ := reader.ReadString('\n')
+		passphrase = strings.TrimRight(line, "\r\n")
+		fmt.Print("Repeat passphrase: ")
+		line, _ = reader.ReadString('\n')
+		if passphrase == "" || passphrase != strings.TrimRight(line, "\r\n") {
+			fmt.Println("Passphrases are empty or do not match")
+			os.Exit(1)
 		}
-		if !cred.ExpiresAt.IsZero() {
-			fmt.Printf("    Expires: %s\n", cred.ExpiresAt.Format("2006-01-02 15:04"))
+	}
+
+	if err := auth.RotateKey(passphrase); err != nil {
+		fmt.Printf("Failed to rotate key: %v\n", err)
+		os.Exit(1)
+	}
+	if usePassphrase {
+		fmt.Printf("Credentials re-encrypted. Set %s to the new passphrase before starting picoclaw.\n", auth.PassphraseEnv)
+	} else {
+		fmt.Println("Credentials re-encrypted with a new key file.")
+		if os.Getenv(auth.PassphraseEnv) != "" {
+			fmt.Printf("Unset %s, or the next save will switch back to the passphrase.\n", auth.PassphraseEnv)
 		}
 	}
 }
@@ -1027,6 +1219,83 @@ func loadConfig() (*config.Config, error) {
 	return config.LoadConfig(getConfigPath())
 }
 
+func modelsCmd() {
+	if len(os.Args) < 3 {
+		modelsHelp()
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+	pc := cfg.Providers.Ollama
+	ollama := providers.NewOllamaProvider(pc.APIKey, pc.APIBase, pc.Proxy, pc.KeepAlive, pc.NumCtx)
+
+	switch os.Args[2] {
+	case "list":
+		models, err := ollama.ListModels(context.Background())
+		if err != nil {
+			fmt.Printf("Error listing models: %v\n", err)
+			os.Exit(1)
+		}
+		if len(models) == 0 {
+			fmt.Println("No models installed.")
+			return
+		}
+		for _, m := range models {
+			fmt.Printf("  %s\n", m)
+		}
+	case "pull":
+		if len(os.Args) < 4 {
+			fmt.Println("Usage: picoclaw models pull <name>")
+			return
+		}
+		modelsPullCmd(ollama, os.Args[3])
+	default:
+		fmt.Printf("Unknown models command: %s\n", os.Args[2])
+		modelsHelp()
+	}
+}
+
+func modelsHelp() {
+	fmt.Println("\nModels commands (Ollama):")
+	fmt.Println("  list          List models installed on the Ollama server")
+	fmt.Println("  pull <name>   Download a model, showing progress")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  picoclaw models list")
+	fmt.Println("  picoclaw models pull qwen3:8b")
+}
+
+func modelsPullCmd(ollama *providers.OllamaProvider, name string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	lastStatus := ""
+	err := ollama.PullModel(ctx, name, func(p providers.OllamaPullProgress) {
+		if p.Total > 0 {
+			fmt.Printf("\r%s: %d%% (%d/%d MB)", p.Status, p.Completed*100/p.Total, p.Completed>>20, p.Total>>20)
+			lastStatus = p.Status
+			return
+		}
+		if p.Status != lastStatus {
+			if lastStatus != "" {
+				fmt.Println()
+			}
+			fmt.Print(p.Status)
+			lastStatus = p.Status
+		}
+	})
+	fmt.Println()
+	if err != nil {
+		fmt.Printf("Error pulling %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	fmt.Printf("✓ Pulled %s\n", name)
+}
+
 func cronCmd() {
 	if len(os.Args) < 3 {
 		cronHelp()
@@ -1451,7 +1720,11 @@ func pluginCmd() {
 	subcommand := os.Args[2]
 	home, _ := os.UserHomeDir()
 	pluginsDir := filepath.Join(home, ".picoclaw", "plugins")
-	installer := plugins.NewInstaller(pluginsDir)
+	network := config.DefaultConfig().Tools.Network
+	if cfg, err := loadConfig(); err == nil {
+		network = cfg.Tools.Network
+	}
+	installer := plugins.NewInstaller(pluginsDir, network)
 
 	switch subcommand {
 	case "list":
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/logger"
@@ -18,7 +19,12 @@ type ContextBuilder struct {
 	workspace    string
 	skillsLoader *skills.SkillsLoader
 	memory       *MemoryStore
+	shared       *MemoryStore
+	isolateUsers bool                // Load per-sender profile/memory instead of workspace-wide files
 	tools        *tools.ToolRegistry // Direct reference to tool registry
+
+	scopesMu sync.Mutex
+	scopes   map[string]*MemoryStore // Per-user stores, created on first use
 }
 
 func getGlobalConfigDir() string {
@@ -40,7 +46,33 @@ func NewContextBuilder(workspace string) *ContextBuilder {
 		workspace:    workspace,
 		skillsLoader: skills.NewSkillsLoader(workspace, globalSkillsDir, builtinSkillsDir),
 		memory:       NewMemoryStore(workspace),
+		shared:       NewScopedMemoryStore(workspace, SharedMemoryScope),
+		scopes:       make(map[string]*MemoryStore),
+	}
+}
+
+// SetUserIsolation enables per-sender profiles and memory. When enabled,
+// conversations with a known sender only see that sender's USER.md and
+// MEMORY.md plus the shared memory scope.
+func (cb *ContextBuilder) SetUserIsolation(enabled bool) {
+	cb.isolateUsers = enabled
+}
+
+// memoryFor returns the memory store for a user scope, falling back to the
+// workspace-wide memory when isolation is off or the sender is unknown.
+func (cb *ContextBuilder) memoryFor(userScope string) *MemoryStore {
+	if !cb.isolateUsers || userScope == "" || userScope == SharedMemoryScope {
+		return cb.memory
+	}
+
+	cb.scopesMu.Lock()
+	defer cb.scopesMu.Unlock()
+	mem, ok := cb.scopes[userScope]
+	if !ok {
+		mem = NewScopedMemoryStore(cb.workspace, userScope)
+		cb.scopes[userScope] = mem
 	}
+	return mem
 }
 
 // SetToolsRegistry sets the tools registry for dynamic tool summary generation.
@@ -48,28 +80,40 @@ func (cb *ContextBuilder) SetToolsRegistry(registry *tools.ToolRegistry) {
 	cb.tools = registry
 }
 
-func (cb *ContextBuilder) getIdentity() string {
-	now := time.Now().Format("2006-01-02 15:04 (Monday)")
+func (cb *ContextBuilder) getIdentity(mem *MemoryStore) string {
 	workspacePath, _ := filepath.Abs(filepath.Join(cb.workspace))
 	runtime := fmt.Sprintf("%s %s, Go %s", runtime.GOOS, runtime.GOARCH, runtime.Version())
 
 	// Build tools section dynamically
 	toolsSection := cb.buildToolsSection()
 
+	var memoryPaths, memoryRule string
+	if mem.Scope() != "" {
+		// A known sender: point memory writes at their scope instead of
+		// the workspace-wide files
+		userDir, _ := filepath.Abs(mem.Dir())
+		sharedDir, _ := filepath.Abs(cb.shared.Dir())
+		memoryPaths = fmt.Sprintf(`- User Profile: %s/USER.md (current user only)
+- User Memory: %s/MEMORY.md (current user only)
+- User Daily Notes: %s/YYYYMM/YYYYMMDD.md (current user only)
+- Shared Memory: %s/MEMORY.md (visible to every user)`, userDir, userDir, userDir, sharedDir)
+		memoryRule = fmt.Sprintf("When remembering something about the current user, write to %s/MEMORY.md (or their profile at %s/USER.md). Only write to %s/MEMORY.md for facts every user may see. Never copy one user's memory into another user's files.", userDir, userDir, sharedDir)
+	} else {
+		memoryPaths = fmt.Sprintf(`- Memory: %s/memory/MEMORY.md
+- Daily Notes: %s/memory/YYYYMM/YYYYMMDD.md`, workspacePath, workspacePath)
+		memoryRule = fmt.Sprintf("When remembering something, write to %s/memory/MEMORY.md", workspacePath)
+	}
+
 	return fmt.Sprintf(`# picoclaw 🦞
 
 You are picoclaw, a helpful AI assistant.
 
-## Current Time
-%s
-
 ## Runtime
 %s
 
 ## Workspace
 Your workspace is at: %s
-- Memory: %s/memory/MEMORY.md
-- Daily Notes: %s/memory/YYYYMM/YYYYMMDD.md
+%s
 - Skills: %s/skills/{skill-name}/SKILL.md
 
 %s
@@ -80,8 +124,8 @@ Your workspace is at: %s
 
 2. **Be helpful and accurate** - When using tools, briefly explain what you're doing.
 
-3. **Memory** - When remembering something, write to %s/memory/MEMORY.md`,
-		now, runtime, workspacePath, workspacePath, workspacePath, workspacePath, toolsSection, workspacePath)
+3. **Memory** - %s`,
+		runtime, workspacePath, memoryPaths, workspacePath, toolsSection, memoryRule)
 }
 
 func (cb *ContextBuilder) buildToolsSection() string {
@@ -107,13 +151,21 @@ func (cb *ContextBuilder) buildToolsSection() string {
 }
 
 func (cb *ContextBuilder) BuildSystemPrompt() string {
+	return cb.BuildSystemPromptForUser("")
+}
+
+// BuildSystemPromptForUser builds the system prompt for a conversation with
+// the given user scope (a canonical user ID, see identity.Registry). With user isolation enabled, only that
+// user's profile and memory are included, together with the shared memory.
+func (cb *ContextBuilder) BuildSystemPromptForUser(userScope string) string {
 	parts := []string{}
+	mem := cb.memoryFor(userScope)
 
 	// Core identity section
-	parts = append(parts, cb.getIdentity())
+	parts = append(parts, cb.getIdentity(mem))
 
 	// Bootstrap files
-	bootstrapContent := cb.LoadBootstrapFiles()
+	bootstrapContent := cb.loadBootstrapFiles(mem)
 	if bootstrapContent != "" {
 		parts = append(parts, bootstrapContent)
 	}
@@ -129,16 +181,29 @@ The following skills extend your capabilities. To use a skill, read its SKILL.md
 	}
 
 	// Memory context
-	memoryContext := cb.memory.GetMemoryContext()
+	memoryContext := mem.GetMemoryContext()
 	if memoryContext != "" {
 		parts = append(parts, "# Memory\n\n"+memoryContext)
 	}
 
+	// Shared memory is visible to every user once contexts are isolated
+	if mem.Scope() != "" {
+		if shared := cb.shared.ReadLongTerm(); shared != "" {
+			parts = append(parts, "# Shared Memory\n\n"+shared)
+		}
+	}
+
 	// Join with "---" separator
 	return strings.Join(parts, "\n\n---\n\n")
 }
 
 func (cb *ContextBuilder) LoadBootstrapFiles() string {
+	return cb.loadBootstrapFiles(cb.memory)
+}
+
+// loadBootstrapFiles loads the workspace bootstrap files. For a user scope,
+// USER.md comes from that user's profile instead of the workspace-wide file.
+func (cb *ContextBuilder) loadBootstrapFiles(mem *MemoryStore) string {
 	bootstrapFiles := []string{
 		"AGENTS.md",
 		"SOUL.md",
@@ -148,6 +213,12 @@ func (cb *ContextBuilder) LoadBootstrapFiles() string {
 
 	var result string
 	for _, filename := range bootstrapFiles {
+		if filename == "USER.md" && mem.Scope() != "" {
+			if profile := mem.ReadProfile(); profile != "" {
+				result += fmt.Sprintf("## %s\n\n%s\n\n", filename, profile)
+			}
+			continue
+		}
 		filePath := filepath.Join(cb.workspace, filename)
 		if data, err := os.ReadFile(filePath); err == nil {
 			result += fmt.Sprintf("## %s\n\n%s\n\n", filename, string(data))
@@ -157,10 +228,19 @@ func (cb *ContextBuilder) LoadBootstrapFiles() string {
 	return result
 }
 
-func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary string, currentMessage string, media []string, channel, chatID string) []providers.Message {
+func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary string, currentMessage string, media []string, channel, chatID, userScope string) []providers.Message {
 	messages := []providers.Message{}
 
-	systemPrompt := cb.BuildSystemPrompt()
+	systemPrompt := cb.BuildSystemPromptForUser(userScope)
+
+	if summary != "" {
+		systemPrompt += "\n\n## Summary of Previous Conversation\n\n" + summary
+	}
+
+	// Everything above stays the same from turn to turn, so providers can
+	// cache it. Time and session details change and go after it.
+	cachePrefix := len(systemPrompt)
+	systemPrompt += "\n\n## Current Time\n" + time.Now().Format("2006-01-02 15:04 (Monday)")
 
 	// Add Current Session info if provided
 	if channel != "" && chatID != "" {
@@ -185,10 +265,6 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 			"preview": preview,
 		})
 
-	if summary != "" {
-		systemPrompt += "\n\n## Summary of Previous Conversation\n\n" + summary
-	}
-
 	//This fix prevents the session memory from LLM failure due to elimination of toolu_IDs required from LLM
 	// --- INICIO DEL FIX ---
 	//Diegox-17
@@ -201,8 +277,9 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 	// --- FIN DEL FIX ---
 
 	messages = append(messages, providers.Message{
-		Role:    "system",
-		Content: systemPrompt,
+		Role:        "system",
+		Content:     systemPrompt,
+		CachePrefix: cachePrefix,
 	})
 
 	messages = append(messages, history...)
@@ -210,6 +287,7 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 	messages = append(messages, providers.Message{
 		Role:    "user",
 		Content: currentMessage,
+		Media:   media,
 	})
 
 	return messages
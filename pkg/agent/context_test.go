@@ -0,0 +1,27 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildMessages_CachePrefixExcludesVolatileContext(t *testing.T) {
+	workspace := t.TempDir()
+	cb := NewContextBuilder(workspace)
+
+	msgs := cb.BuildMessages(nil, "earlier summary", "hi", nil, "telegram", "42", "")
+	system := msgs[0]
+	if system.CachePrefix <= 0 || system.CachePrefix >= len(system.Content) {
+		t.Fatalf("CachePrefix = %d, content length %d", system.CachePrefix, len(system.Content))
+	}
+	stable, volatile := system.Content[:system.CachePrefix], system.Content[system.CachePrefix:]
+	if !strings.Contains(stable, "earlier summary") {
+		t.Error("summary should be part of the cacheable prefix")
+	}
+	if strings.Contains(stable, "Current Time") || strings.Contains(stable, "Chat ID") {
+		t.Error("time and session details must not be in the cacheable prefix")
+	}
+	if !strings.Contains(volatile, "## Current Time") || !strings.Contains(volatile, "Chat ID: 42") {
+		t.Errorf("volatile part = %q", volatile)
+	}
+}
@@ -8,7 +8,10 @@ package agent
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -20,8 +23,10 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/checkpoint"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/identity"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/session"
@@ -40,7 +45,13 @@ type AgentLoop struct {
 	sessions       *session.SessionManager
 	state          *state.Manager
 	contextBuilder *ContextBuilder
+	identities     *identity.Registry
+	linkedSessions bool // Use "user:<canonical ID>" as session key for linked accounts
+	thinkingBudget int  // Reasoning token budget requested from the model, 0 for the model default
+	showReasoning  bool // Forward model reasoning to the user before the reply
 	tools          *tools.ToolRegistry
+	processes      *tools.ProcessManager // Background processes of the process tool
+	checkpoints    *checkpoint.Store     // Snapshots of changed files for /undo, nil when disabled
 	running        atomic.Bool
 	summarizing    sync.Map // Tracks which sessions are currently being summarized
 	channelManager *channels.Manager
@@ -48,30 +59,52 @@ type AgentLoop struct {
 
 // processOptions configures how a message is processed
 type processOptions struct {
-	SessionKey      string // Session identifier for history/context
-	Channel         string // Target channel for tool execution
-	ChatID          string // Target chat ID for tool execution
-	UserMessage     string // User message content (may include prefix)
-	DefaultResponse string // Response when LLM returns empty
-	EnableSummary   bool   // Whether to trigger summarization
-	SendResponse    bool   // Whether to send response via bus
-	NoHistory       bool   // If true, don't load session history (for heartbeat)
+	SessionKey      string   // Session identifier for history/context
+	Channel         string   // Target channel for tool execution
+	ChatID          string   // Target chat ID for tool execution
+	UserScope       string   // Canonical user ID of the sender for memory scoping, empty for workspace-wide
+	UserMessage     string   // User message content (may include prefix)
+	Media           []string // Local paths of media attached to the user message
+	DefaultResponse string   // Response when LLM returns empty
+	EnableSummary   bool     // Whether to trigger summarization
+	SendResponse    bool     // Whether to send response via bus
+	SendReasoning   bool     // Whether to publish the model's reasoning to the chat ahead of the response
+	NoHistory       bool     // If true, don't load session history (for heartbeat)
 }
 
 // createToolRegistry creates a tool registry with common tools.
 // This is shared between main agent and subagents.
-func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msgBus *bus.MessageBus) *tools.ToolRegistry {
+func createToolRegistry(workspace string, restrict bool, sandboxProfile string, cfg *config.Config, msgBus *bus.MessageBus, processes *tools.ProcessManager, tracker tools.FileTracker) *tools.ToolRegistry {
 	registry := tools.NewToolRegistry()
 
-	// File system tools
+	// File system tools; the ones that change files snapshot them first
+	writeFileTool := tools.NewWriteFileTool(workspace, restrict)
+	editFileTool := tools.NewEditFileTool(workspace, restrict)
+	appendFileTool := tools.NewAppendFileTool(workspace, restrict)
+	applyPatchTool := tools.NewApplyPatchTool(workspace, restrict)
+	if tracker != nil {
+		writeFileTool.SetTracker(tracker)
+		editFileTool.SetTracker(tracker)
+		appendFileTool.SetTracker(tracker)
+		applyPatchTool.SetTracker(tracker)
+	}
 	registry.Register(tools.NewReadFileTool(workspace, restrict))
-	registry.Register(tools.NewWriteFileTool(workspace, restrict))
+	registry.Register(writeFileTool)
 	registry.Register(tools.NewListDirTool(workspace, restrict))
-	registry.Register(tools.NewEditFileTool(workspace, restrict))
-	registry.Register(tools.NewAppendFileTool(workspace, restrict))
+	registry.Register(editFileTool)
+	registry.Register(appendFileTool)
+	registry.Register(applyPatchTool)
+	registry.Register(tools.NewGrepTool(workspace, restrict))
+	registry.Register(tools.NewGlobTool(workspace, restrict))
 
 	// Shell execution
-	registry.Register(tools.NewExecToolWithConfig(workspace, restrict, cfg))
+	execTool := tools.NewExecToolWithConfig(workspace, restrict, cfg)
+	if err := execTool.SetSandboxProfile(sandboxProfile); err != nil {
+		logger.WarnCF("agent", "Using the default sandbox profile", map[string]interface{}{"error": err.Error()})
+	}
+	registry.Register(execTool)
+	registry.Register(tools.NewProcessTool(processes, execTool))
+	registry.Register(tools.NewTerminalTool(processes, execTool))
 
 	if searchTool := tools.NewWebSearchTool(tools.WebSearchToolOptions{
 		BraveAPIKey:          cfg.Tools.Web.Brave.APIKey,
@@ -82,10 +115,15 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 		PerplexityAPIKey:     cfg.Tools.Web.Perplexity.APIKey,
 		PerplexityMaxResults: cfg.Tools.Web.Perplexity.MaxResults,
 		PerplexityEnabled:    cfg.Tools.Web.Perplexity.Enabled,
+		SearXNGBaseURL:       cfg.Tools.Web.SearXNG.BaseURL,
+		SearXNGMaxResults:    cfg.Tools.Web.SearXNG.MaxResults,
+		SearXNGEnabled:       cfg.Tools.Web.SearXNG.Enabled,
+		CachePath:            filepath.Join(workspace, "cache", "web_search.json"),
+		CacheTTL:             time.Duration(cfg.Tools.Web.CacheTTLMinutes) * time.Minute,
 	}); searchTool != nil {
 		registry.Register(searchTool)
 	}
-	registry.Register(tools.NewWebFetchTool(50000))
+	registry.Register(tools.NewWebFetchTool(50000, cfg.Tools.Network))
 
 	// Hardware tools (I2C, SPI) - Linux only, returns error on other platforms
 	registry.Register(tools.NewI2CTool())
@@ -115,12 +153,27 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 
 	restrict := cfg.Agents.Defaults.RestrictToWorkspace
 
+	// Background processes are shared by the agent and its subagents
+	processes := tools.NewProcessManager(&cfg.Tools.Process)
+
+	// So are the checkpoints of the files they change
+	var checkpoints *checkpoint.Store
+	var tracker tools.FileTracker
+	if cfg.Tools.Checkpoints.Enabled {
+		checkpoints = checkpoint.NewStore(workspace, &cfg.Tools.Checkpoints)
+		tracker = checkpoints
+	}
+
 	// Create tool registry for main agent
-	toolsRegistry := createToolRegistry(workspace, restrict, cfg, msgBus)
+	toolsRegistry := createToolRegistry(workspace, restrict, cfg.Agents.Defaults.SandboxProfile, cfg, msgBus, processes, tracker)
 
 	// Create subagent manager with its own tool registry
 	subagentManager := tools.NewSubagentManager(provider, cfg.Agents.Defaults.Model, workspace, msgBus)
-	subagentTools := createToolRegistry(workspace, restrict, cfg, msgBus)
+	subagentProfile := cfg.Agents.Defaults.SubagentSandboxProfile
+	if subagentProfile == "" {
+		subagentProfile = cfg.Agents.Defaults.SandboxProfile
+	}
+	subagentTools := createToolRegistry(workspace, restrict, subagentProfile, cfg, msgBus, processes, tracker)
 	// Subagent doesn't need spawn/subagent tools to avoid recursion
 	subagentManager.SetTools(subagentTools)
 
@@ -140,6 +193,7 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	// Create context builder and set tools registry
 	contextBuilder := NewContextBuilder(workspace)
 	contextBuilder.SetToolsRegistry(toolsRegistry)
+	contextBuilder.SetUserIsolation(cfg.Agents.Defaults.IsolateUsers)
 
 	return &AgentLoop{
 		bus:            msgBus,
@@ -151,7 +205,13 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 		sessions:       sessionsManager,
 		state:          stateManager,
 		contextBuilder: contextBuilder,
+		identities:     identity.NewRegistry(workspace),
+		linkedSessions: cfg.Agents.Defaults.LinkedSessions,
+		thinkingBudget: cfg.Agents.Defaults.ThinkingBudget,
+		showReasoning:  cfg.Agents.Defaults.ShowReasoning,
 		tools:          toolsRegistry,
+		processes:      processes,
+		checkpoints:    checkpoints,
 		summarizing:    sync.Map{},
 	}
 }
@@ -159,6 +219,10 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
 
+	reaperCtx, stopReaper := context.WithCancel(ctx)
+	defer stopReaper()
+	go al.processes.RunReaper(reaperCtx)
+
 	for al.running.Load() {
 		select {
 		case <-ctx.Done():
@@ -171,7 +235,7 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 
 			response, err := al.processMessage(ctx, msg)
 			if err != nil {
-				response = fmt.Sprintf("Error processing message: %v", err)
+				response = formatProcessingError(err)
 			}
 
 			if response != "" {
@@ -210,6 +274,11 @@ func (al *AgentLoop) SetChannelManager(cm *channels.Manager) {
 	al.channelManager = cm
 }
 
+// Identities returns the registry that links channel accounts to canonical user IDs.
+func (al *AgentLoop) Identities() *identity.Registry {
+	return al.identities
+}
+
 // RecordLastChannel records the last active channel for this workspace.
 // This uses the atomic state save mechanism to prevent data loss on crash.
 func (al *AgentLoop) RecordLastChannel(channel string) error {
@@ -274,20 +343,37 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		return al.processSystemMessage(ctx, msg)
 	}
 
+	al.processes.Touch(tools.ProcessSession(msg.Channel, msg.ChatID))
+
 	// Check for commands
 	if response, handled := al.handleCommand(ctx, msg); handled {
 		return response, nil
 	}
 
+	// Cron jobs and direct calls have no real sender to scope memory to
+	userScope := ""
+	sessionKey := msg.SessionKey
+	if msg.SenderID != "cron" {
+		userScope = al.identities.Resolve(msg.Channel, msg.SenderID)
+		if al.linkedSessions && al.identities.IsLinked(msg.Channel, msg.SenderID) {
+			sessionKey = "user:" + userScope
+		}
+	}
+
 	// Process as user message
 	return al.runAgentLoop(ctx, processOptions{
-		SessionKey:      msg.SessionKey,
+		SessionKey:      sessionKey,
 		Channel:         msg.Channel,
 		ChatID:          msg.ChatID,
+		UserScope:       userScope,
 		UserMessage:     msg.Content,
+		Media:           msg.Media,
 		DefaultResponse: "I've completed processing but have no response to give.",
 		EnableSummary:   true,
 		SendResponse:    false,
+		// Run publishes the response of messages from real senders, and the
+		// reasoning goes out on the same bus just before it
+		SendReasoning: msg.SenderID != "cron",
 	})
 }
 
@@ -357,8 +443,11 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		}
 	}
 
-	// 1. Update tool contexts
+	// 1. Update tool contexts and start a checkpoint for the files this turn changes
 	al.updateToolContexts(opts.Channel, opts.ChatID)
+	if al.checkpoints != nil {
+		al.checkpoints.Begin(tools.ProcessSession(opts.Channel, opts.ChatID))
+	}
 
 	// 2. Build messages (skip history for heartbeat)
 	var history []providers.Message
@@ -371,9 +460,10 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		history,
 		summary,
 		opts.UserMessage,
-		nil,
+		opts.Media,
 		opts.Channel,
 		opts.ChatID,
+		opts.UserScope,
 	)
 
 	// 3. Save user message to session
@@ -468,14 +558,21 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 		maxRetries := 2
 		for retry := 0; retry <= maxRetries; retry++ {
 			response, err = al.provider.Chat(ctx, messages, providerToolDefs, al.model, map[string]interface{}{
-				"max_tokens":  8192,
-				"temperature": 0.7,
+				"max_tokens":       8192,
+				"temperature":      0.7,
+				"prompt_cache_key": promptCacheKey(opts.SessionKey),
+				"thinking_budget":  al.thinkingBudget,
 			})
 
 			if err == nil {
 				break // Success
 			}
 
+			// The limiter already waited and retried; compressing history will not help
+			if isProviderUnavailable(err) {
+				break
+			}
+
 			errMsg := strings.ToLower(err.Error())
 			// Check for context window errors (provider specific, but usually contain "token" or "invalid")
 			isContextError := strings.Contains(errMsg, "token") ||
@@ -515,6 +612,7 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 					nil,
 					opts.Channel,
 					opts.ChatID,
+					opts.UserScope,
 				)
 
 				// Important: If we are in the middle of a tool loop (iteration > 1),
@@ -578,6 +676,7 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 					nil,
 					opts.Channel,
 					opts.ChatID,
+					opts.UserScope,
 				)
 
 				continue
@@ -596,6 +695,19 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 			return "", iteration, fmt.Errorf("LLM call failed after retries: %w", err)
 		}
 
+		if u := response.Usage; u != nil {
+			logger.DebugCF("agent", "LLM usage",
+				map[string]interface{}{
+					"iteration":          iteration,
+					"prompt_tokens":      u.PromptTokens,
+					"completion_tokens":  u.CompletionTokens,
+					"cache_read_tokens":  u.CacheReadTokens,
+					"cache_write_tokens": u.CacheWriteTokens,
+				})
+		}
+
+		al.sendReasoning(response.Reasoning, opts)
+
 		// Check if no tool calls - we're done
 		if len(response.ToolCalls) == 0 {
 			finalContent = response.Content
@@ -620,9 +732,12 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 			})
 
 		// Build assistant message with tool calls
+		// Reasoning blocks must be sent back unchanged for the model to continue its thinking
 		assistantMsg := providers.Message{
-			Role:    "assistant",
-			Content: response.Content,
+			Role:            "assistant",
+			Content:         response.Content,
+			Reasoning:       response.Reasoning,
+			ReasoningBlocks: response.ReasoningBlocks,
 		}
 		for _, tc := range response.ToolCalls {
 			argumentsJSON, _ := json.Marshal(tc.Arguments)
@@ -704,6 +819,45 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 	return finalContent, iteration, nil
 }
 
+// isProviderUnavailable reports whether err comes from the provider rate
+// limiter or an open circuit breaker rather than from the request itself.
+func isProviderUnavailable(err error) bool {
+	var rateErr *providers.RateLimitError
+	var circuitErr *providers.CircuitOpenError
+	return errors.As(err, &rateErr) || errors.As(err, &circuitErr)
+}
+
+// formatProcessingError turns an error from processMessage into the reply sent to the user.
+func formatProcessingError(err error) string {
+	var rateErr *providers.RateLimitError
+	if errors.As(err, &rateErr) {
+		return "⏳ " + rateErr.Error()
+	}
+	var circuitErr *providers.CircuitOpenError
+	if errors.As(err, &circuitErr) {
+		return "⚠️ " + circuitErr.Error()
+	}
+	return fmt.Sprintf("Error processing message: %v", err)
+}
+
+// maxReasoningChars caps the reasoning shown to users; long chains of thought are mostly noise in chat.
+const maxReasoningChars = 3500
+
+// sendReasoning forwards the model's reasoning to the user when show_reasoning is enabled.
+// Channels render it as a collapsed or spoiler block where they can.
+func (al *AgentLoop) sendReasoning(reasoning string, opts processOptions) {
+	reasoning = strings.TrimSpace(reasoning)
+	if !al.showReasoning || reasoning == "" || !opts.SendReasoning || constants.IsInternalChannel(opts.Channel) {
+		return
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:   opts.Channel,
+		ChatID:    opts.ChatID,
+		Content:   utils.Truncate(reasoning, maxReasoningChars),
+		Reasoning: true,
+	})
+}
+
 // updateToolContexts updates the context for tools that need channel/chatID info.
 func (al *AgentLoop) updateToolContexts(channel, chatID string) {
 	// Use ContextualTool interface instead of type assertions
@@ -972,6 +1126,14 @@ func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Messa
 	return response.Content, nil
 }
 
+// promptCacheKey derives a stable, opaque cache key from a session key, so
+// requests of one conversation share a provider-side prompt cache without
+// sending channel or user IDs upstream.
+func promptCacheKey(sessionKey string) string {
+	sum := sha256.Sum256([]byte(sessionKey))
+	return "picoclaw-" + hex.EncodeToString(sum[:8])
+}
+
 // estimateTokens estimates the number of tokens in a message list.
 // Uses a safe heuristic of 2.5 characters per token to account for CJK and other
 // overheads better than the previous 3 chars/token.
@@ -984,6 +1146,43 @@ func (al *AgentLoop) estimateTokens(messages []providers.Message) int {
 	return totalChars * 2 / 5
 }
 
+// withDefaultTag adds the ":latest" tag Ollama assumes for untagged models.
+func withDefaultTag(model string) string {
+	if !strings.Contains(model[strings.LastIndex(model, "/")+1:], ":") {
+		return model + ":latest"
+	}
+	return model
+}
+
+// checkModelAvailable reports whether model is served by the provider. When
+// the provider cannot list its models, or listing fails, any model is
+// accepted so /switch keeps working offline.
+func (al *AgentLoop) checkModelAvailable(ctx context.Context, model string) (string, bool) {
+	lister, ok := al.provider.(providers.ModelLister)
+	if !ok {
+		return "", true
+	}
+	models, err := lister.ListModels(ctx)
+	if err != nil || len(models) == 0 {
+		return "", true
+	}
+
+	// Accept "gpt-4o" for a listed "openai/gpt-4o" and the reverse, and
+	// "llama3.2" for Ollama's "llama3.2:latest"
+	tagged := withDefaultTag(model)
+	bare := tagged
+	if idx := strings.Index(tagged, "/"); idx >= 0 {
+		bare = tagged[idx+1:]
+	}
+	for _, m := range models {
+		m = withDefaultTag(m)
+		if m == tagged || m == bare || strings.HasSuffix(m, "/"+tagged) {
+			return "", true
+		}
+	}
+	return fmt.Sprintf("Model %s is not available from this provider. Use /list models to see the available models.", model), false
+}
+
 func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage) (string, bool) {
 	content := strings.TrimSpace(msg.Content)
 	if !strings.HasPrefix(content, "/") {
@@ -1001,13 +1200,22 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 	switch cmd {
 	case "/show":
 		if len(args) < 1 {
-			return "Usage: /show [model|channel]", true
+			return "Usage: /show [model|channel|identity]", true
 		}
 		switch args[0] {
 		case "model":
 			return fmt.Sprintf("Current model: %s", al.model), true
 		case "channel":
 			return fmt.Sprintf("Current channel: %s", msg.Channel), true
+		case "identity":
+			userID := al.identities.Resolve(msg.Channel, msg.SenderID)
+			if userID == "" {
+				return "No user identity on this channel", true
+			}
+			if accounts := al.identities.Accounts(userID); len(accounts) > 0 {
+				return fmt.Sprintf("User ID: %s (linked accounts: %s)", userID, strings.Join(accounts, ", ")), true
+			}
+			return fmt.Sprintf("User ID: %s (not linked)", userID), true
 		default:
 			return fmt.Sprintf("Unknown show target: %s", args[0]), true
 		}
@@ -1018,8 +1226,19 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 		}
 		switch args[0] {
 		case "models":
-			// TODO: Fetch available models dynamically if possible
-			return "Available models: glm-4.7, claude-3-5-sonnet, gpt-4o (configured in config.json/env)", true
+			if lister, ok := al.provider.(providers.ModelLister); ok {
+				models, err := lister.ListModels(ctx)
+				if err != nil && !errors.Is(err, providers.ErrListModelsUnsupported) {
+					return fmt.Sprintf("Failed to list models: %v", err), true
+				}
+				if err == nil {
+					if len(models) == 0 {
+						return "No models available", true
+					}
+					return fmt.Sprintf("Available models: %s", strings.Join(models, ", ")), true
+				}
+			}
+			return fmt.Sprintf("This provider cannot list its models. Current model: %s", al.model), true
 		case "channels":
 			if al.channelManager == nil {
 				return "Channel manager not initialized", true
@@ -1042,6 +1261,9 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 
 		switch target {
 		case "model":
+			if reply, ok := al.checkModelAvailable(ctx, value); !ok {
+				return reply, true
+			}
 			oldModel := al.model
 			al.model = value
 			return fmt.Sprintf("Switched model from %s to %s", oldModel, value), true
@@ -1062,6 +1284,74 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 		default:
 			return fmt.Sprintf("Unknown switch target: %s", target), true
 		}
+
+	case "/link":
+		if len(args) == 0 {
+			code, err := al.identities.IssueCode(msg.Channel, msg.SenderID)
+			if err != nil {
+				return "Account linking is not available on this channel", true
+			}
+			return fmt.Sprintf("Your link code is %s. Send \"/link %s\" from your other account within %d minutes.",
+				code, code, int(identity.CodeTTL.Minutes())), true
+		}
+		userID, err := al.identities.Redeem(args[0], msg.Channel, msg.SenderID)
+		switch {
+		case errors.Is(err, identity.ErrUnknownAccount):
+			return "Account linking is not available on this channel", true
+		case errors.Is(err, identity.ErrInvalidCode):
+			return "Invalid or expired link code. Run /link on your other account to get a new one.", true
+		case errors.Is(err, identity.ErrSameAccount):
+			return "This code was issued to this account. Redeem it from your other account.", true
+		case errors.Is(err, identity.ErrTooManyTries):
+			return fmt.Sprintf("Too many failed link attempts. Try again in %d minutes.", int(identity.CodeTTL.Minutes())), true
+		case err != nil:
+			return fmt.Sprintf("Failed to link accounts: %v", err), true
+		}
+		return fmt.Sprintf("Accounts linked. You are now %s on all linked channels.", userID), true
+
+	case "/unlink":
+		err := al.identities.Unlink(msg.Channel, msg.SenderID)
+		switch {
+		case errors.Is(err, identity.ErrUnknownAccount):
+			return "Account linking is not available on this channel", true
+		case errors.Is(err, identity.ErrNotLinked):
+			return "This account is not linked", true
+		case errors.Is(err, identity.ErrPrimaryAccount):
+			return "This is the primary account. Run /unlink from the other linked accounts instead.", true
+		case err != nil:
+			return fmt.Sprintf("Failed to unlink account: %v", err), true
+		}
+		return "Account unlinked", true
+
+	case "/ps":
+		list := al.processes.List(tools.ProcessSession(msg.Channel, msg.ChatID))
+		if len(list) == 0 {
+			return "No background processes", true
+		}
+		return "Background processes:\n" + tools.FormatProcessList(list, time.Now()), true
+
+	case "/checkpoints":
+		if al.checkpoints == nil {
+			return "Checkpoints are disabled", true
+		}
+		list := al.checkpoints.List(tools.ProcessSession(msg.Channel, msg.ChatID))
+		if len(list) == 0 {
+			return "No checkpoints", true
+		}
+		return "Checkpoints, newest first:\n" + checkpoint.FormatList(list, al.workspace, time.Now()), true
+
+	case "/undo":
+		if al.checkpoints == nil {
+			return "Checkpoints are disabled", true
+		}
+		cp, err := al.checkpoints.Undo(tools.ProcessSession(msg.Channel, msg.ChatID))
+		switch {
+		case errors.Is(err, checkpoint.ErrNoCheckpoint):
+			return "No file changes to undo", true
+		case err != nil:
+			return fmt.Sprintf("Failed to undo: %v", err), true
+		}
+		return fmt.Sprintf("Reverted checkpoint #%d: %s\nFiles marked (new) were deleted.", cp.ID, cp.Describe(al.workspace)), true
 	}
 
 	return "", false
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -624,3 +625,292 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 		t.Errorf("Expected history to be compressed (len < 8), got %d", len(finalHistory))
 	}
 }
+
+// TestLinkCommand verifies /link codes issued on one channel can be redeemed on another
+func TestLinkCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         tmpDir,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+
+	resp, handled := al.handleCommand(context.Background(), bus.InboundMessage{
+		Channel: "telegram", SenderID: "123|alice", ChatID: "123", Content: "/link",
+	})
+	if !handled {
+		t.Fatal("/link should be handled as a command")
+	}
+	fields := strings.Fields(resp)
+	if len(fields) < 5 {
+		t.Fatalf("unexpected /link response: %q", resp)
+	}
+	code := strings.TrimSuffix(fields[4], ".")
+
+	resp, _ = al.handleCommand(context.Background(), bus.InboundMessage{
+		Channel: "slack", SenderID: "U1", ChatID: "C1", Content: "/link " + code,
+	})
+	if !strings.Contains(resp, "telegram_123") {
+		t.Fatalf("unexpected redeem response: %q", resp)
+	}
+	if got := al.Identities().Resolve("slack", "U1"); got != "telegram_123" {
+		t.Errorf("Resolve = %q, want telegram_123", got)
+	}
+
+	resp, _ = al.handleCommand(context.Background(), bus.InboundMessage{
+		Channel: "cli", SenderID: "user", ChatID: "direct", Content: "/link",
+	})
+	if !strings.Contains(resp, "not available") {
+		t.Errorf("internal channel /link response = %q", resp)
+	}
+}
+
+// reasoningMockProvider thinks before one tool call, then answers, recording what it is sent.
+type reasoningMockProvider struct {
+	calls    int
+	messages [][]providers.Message
+	options  map[string]interface{}
+}
+
+func (m *reasoningMockProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	m.calls++
+	m.messages = append(m.messages, messages)
+	m.options = opts
+	if m.calls == 1 {
+		return &providers.LLMResponse{
+			Reasoning:       "List the workspace first.",
+			ReasoningBlocks: []providers.ReasoningBlock{{Type: "thinking", Thinking: "List the workspace first.", Signature: "sig"}},
+			ToolCalls:       []providers.ToolCall{{ID: "call_1", Name: "list_dir", Arguments: map[string]interface{}{"path": "."}}},
+		}, nil
+	}
+	return &providers.LLMResponse{Content: "Done"}, nil
+}
+
+func (m *reasoningMockProvider) GetDefaultModel() string {
+	return "mock-reasoning-model"
+}
+
+// TestAgentLoop_ReasoningRoundTrip verifies thinking blocks are sent back in the tool loop
+// and shown to the user when show_reasoning is on
+func TestAgentLoop_ReasoningRoundTrip(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				ThinkingBudget:    2048,
+				ShowReasoning:     true,
+			},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	provider := &reasoningMockProvider{}
+	al := NewAgentLoop(cfg, msgBus, provider)
+
+	response, err := al.ProcessDirectWithChannel(context.Background(), "What's here?", "test-reasoning", "test", "test-chat")
+	if err != nil {
+		t.Fatalf("ProcessDirectWithChannel() error: %v", err)
+	}
+	if response != "Done" {
+		t.Errorf("response = %q, want Done", response)
+	}
+	if provider.options["thinking_budget"] != 2048 {
+		t.Errorf("thinking_budget option = %v", provider.options["thinking_budget"])
+	}
+
+	second := provider.messages[1]
+	var assistant *providers.Message
+	for i := range second {
+		if second[i].Role == "assistant" && len(second[i].ToolCalls) > 0 {
+			assistant = &second[i]
+		}
+	}
+	if assistant == nil || len(assistant.ReasoningBlocks) != 1 || assistant.ReasoningBlocks[0].Signature != "sig" {
+		t.Fatalf("assistant tool call message = %+v, want reasoning blocks kept", assistant)
+	}
+
+	// Direct calls and cron jobs have no chat to show reasoning in
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	if msg, ok := msgBus.SubscribeOutbound(ctx); ok {
+		t.Errorf("unexpected outbound message for a direct call: %+v", msg)
+	}
+	cancel()
+
+	// Messages from a chat get the reasoning ahead of the response
+	provider.calls = 0
+	response, err = al.processMessage(context.Background(), bus.InboundMessage{
+		Channel: "telegram", SenderID: "123", ChatID: "1", Content: "What's here?", SessionKey: "telegram:1",
+	})
+	if err != nil || response != "Done" {
+		t.Fatalf("processMessage() = %q, %v", response, err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok || !msg.Reasoning || msg.Channel != "telegram" || msg.ChatID != "1" || msg.Content != "List the workspace first." {
+		t.Errorf("outbound = %+v, want reasoning message", msg)
+	}
+}
+
+// listingMockProvider is a mockProvider that reports a fixed model list.
+type listingMockProvider struct {
+	mockProvider
+	models []string
+	err    error
+}
+
+func (m *listingMockProvider) ListModels(ctx context.Context) ([]string, error) {
+	return m.models, m.err
+}
+
+// TestModelCommands verifies /list models and /switch model use the provider's model list
+func TestModelCommands(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "gpt-4o",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := &listingMockProvider{models: []string{"gpt-4o", "openai/gpt-4o-mini", "llama3.2:latest"}}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	command := func(content string) string {
+		resp, _ := al.handleCommand(context.Background(), bus.InboundMessage{Channel: "cli", SenderID: "user", ChatID: "direct", Content: content})
+		return resp
+	}
+
+	if resp := command("/list models"); resp != "Available models: gpt-4o, openai/gpt-4o-mini, llama3.2:latest" {
+		t.Errorf("/list models = %q", resp)
+	}
+	if resp := command("/switch model to gpt-5"); !strings.Contains(resp, "Model gpt-5 is not available") || al.model != "gpt-4o" {
+		t.Errorf("/switch to unknown model = %q, model = %s", resp, al.model)
+	}
+	if command("/switch model to gpt-4o-mini"); al.model != "gpt-4o-mini" {
+		t.Errorf("model = %s, want gpt-4o-mini", al.model)
+	}
+	if command("/switch model to azure/gpt-4o"); al.model != "azure/gpt-4o" {
+		t.Errorf("model = %s, want azure/gpt-4o", al.model)
+	}
+	// Ollama resolves an untagged name to :latest
+	if command("/switch model to llama3.2"); al.model != "llama3.2" {
+		t.Errorf("model = %s, want llama3.2", al.model)
+	}
+	if resp := command("/switch model to llama3.2:1b"); !strings.Contains(resp, "not available") {
+		t.Errorf("/switch to unknown tag = %q", resp)
+	}
+
+	// Without a usable list any model is accepted
+	provider.err = providers.ErrListModelsUnsupported
+	if resp := command("/list models"); !strings.Contains(resp, "cannot list") {
+		t.Errorf("/list models unsupported = %q", resp)
+	}
+	if command("/switch model to gpt-5"); al.model != "gpt-5" {
+		t.Errorf("model = %s, want gpt-5", al.model)
+	}
+}
+
+// TestPsCommand verifies /ps lists the background processes of the current chat
+func TestPsCommand(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	defer al.processes.KillAll()
+	command := func(chatID string) string {
+		resp, _ := al.handleCommand(context.Background(), bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: chatID, Content: "/ps"})
+		return resp
+	}
+
+	if resp := command("1"); resp != "No background processes" {
+		t.Errorf("/ps = %q", resp)
+	}
+	result := al.tools.ExecuteWithContext(context.Background(), "process",
+		map[string]interface{}{"action": "start", "command": "sleep 30"}, "telegram", "1", nil)
+	if result.IsError {
+		t.Fatalf("start: %s", result.ForLLM)
+	}
+	if resp := command("1"); !strings.Contains(resp, "p1  running") || !strings.Contains(resp, "sleep 30") {
+		t.Errorf("/ps = %q", resp)
+	}
+	if resp := command("2"); resp != "No background processes" {
+		t.Errorf("/ps in another chat = %q", resp)
+	}
+}
+
+// TestUndoCommand verifies /undo reverts the file changes of the last turn
+func TestUndoCommand(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:           workspace,
+				RestrictToWorkspace: true,
+				Model:               "test-model",
+				MaxTokens:           4096,
+				MaxToolIterations:   10,
+			},
+		},
+		Tools: config.ToolsConfig{
+			Checkpoints: config.CheckpointConfig{Enabled: true, MaxTurns: 5, MaxStoreMB: 10},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	command := func(content string) string {
+		resp, _ := al.handleCommand(context.Background(), bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: "1", Content: content})
+		return resp
+	}
+	file := filepath.Join(workspace, "notes.md")
+	os.WriteFile(file, []byte("keep me"), 0644)
+
+	if resp := command("/checkpoints"); resp != "No checkpoints" {
+		t.Errorf("/checkpoints = %q", resp)
+	}
+
+	al.checkpoints.Begin(tools.ProcessSession("telegram", "1"))
+	for _, call := range []map[string]interface{}{
+		{"path": "notes.md", "content": "mangled"},
+		{"path": "extra.md", "content": "new"},
+	} {
+		if result := al.tools.ExecuteWithContext(context.Background(), "write_file", call, "telegram", "1", nil); result.IsError {
+			t.Fatalf("write_file: %s", result.ForLLM)
+		}
+	}
+
+	if resp := command("/checkpoints"); !strings.Contains(resp, "notes.md, extra.md (new)") {
+		t.Errorf("/checkpoints = %q", resp)
+	}
+	// Snapshots live outside the workspace and must not turn up in searches
+	if result := al.tools.ExecuteWithContext(context.Background(), "grep", map[string]interface{}{"pattern": "keep me"}, "telegram", "1", nil); result.ForLLM != "No matches found" {
+		t.Errorf("grep found the snapshot: %s", result.ForLLM)
+	}
+	if resp := command("/undo"); !strings.HasPrefix(resp, "Reverted checkpoint #1") {
+		t.Errorf("/undo = %q", resp)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "keep me" {
+		t.Errorf("notes.md = %q after /undo", data)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "extra.md")); !os.IsNotExist(err) {
+		t.Errorf("expected extra.md to be removed by /undo")
+	}
+	if resp := command("/undo"); resp != "No file changes to undo" {
+		t.Errorf("second /undo = %q", resp)
+	}
+}
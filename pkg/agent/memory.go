@@ -10,32 +10,104 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
+// SharedMemoryScope is the memory scope visible to every sender.
+const SharedMemoryScope = "shared"
+
 // MemoryStore manages persistent memory for the agent.
 // - Long-term memory: memory/MEMORY.md
 // - Daily notes: memory/YYYYMM/YYYYMMDD.md
+//
+// Scoped stores keep the same layout under memory/shared/ or
+// memory/users/<scope>/, and user scopes also hold a USER.md profile.
 type MemoryStore struct {
-	workspace  string
-	memoryDir  string
-	memoryFile string
+	workspace   string
+	scope       string
+	memoryDir   string
+	memoryFile  string
+	profileFile string
 }
 
 // NewMemoryStore creates a new MemoryStore with the given workspace path.
 // It ensures the memory directory exists.
 func NewMemoryStore(workspace string) *MemoryStore {
+	return NewScopedMemoryStore(workspace, "")
+}
+
+// NewScopedMemoryStore creates a MemoryStore for the given scope.
+// An empty scope is the workspace-wide memory, SharedMemoryScope is memory
+// shared between all senders, and anything else is a per-user scope such as
+// a canonical user ID from the identity registry.
+func NewScopedMemoryStore(workspace, scope string) *MemoryStore {
 	memoryDir := filepath.Join(workspace, "memory")
-	memoryFile := filepath.Join(memoryDir, "MEMORY.md")
+	switch scope {
+	case "":
+	case SharedMemoryScope:
+		memoryDir = filepath.Join(memoryDir, SharedMemoryScope)
+	default:
+		memoryDir = filepath.Join(memoryDir, "users", sanitizeScope(scope))
+	}
+
+	ms := &MemoryStore{
+		workspace:  workspace,
+		scope:      scope,
+		memoryDir:  memoryDir,
+		memoryFile: filepath.Join(memoryDir, "MEMORY.md"),
+	}
+	if scope != "" && scope != SharedMemoryScope {
+		ms.profileFile = filepath.Join(memoryDir, "USER.md")
+	}
 
 	// Ensure memory directory exists
 	os.MkdirAll(memoryDir, 0755)
 
-	return &MemoryStore{
-		workspace:  workspace,
-		memoryDir:  memoryDir,
-		memoryFile: memoryFile,
+	return ms
+}
+
+// sanitizeScope maps a scope to a single safe path component.
+func sanitizeScope(scope string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, scope)
+	if safe == "" || strings.Trim(safe, ".") == "" {
+		return "_"
+	}
+	return safe
+}
+
+// Scope returns the scope of this store ("" for the workspace-wide memory).
+func (ms *MemoryStore) Scope() string {
+	return ms.scope
+}
+
+// Dir returns the directory holding this store's memory files.
+func (ms *MemoryStore) Dir() string {
+	return ms.memoryDir
+}
+
+// ProfilePath returns the path to the per-user USER.md profile,
+// or "" if this store is not a user scope.
+func (ms *MemoryStore) ProfilePath() string {
+	return ms.profileFile
+}
+
+// ReadProfile reads the per-user profile (USER.md).
+// Returns empty string if the file doesn't exist or this is not a user scope.
+func (ms *MemoryStore) ReadProfile() string {
+	if ms.profileFile == "" {
+		return ""
 	}
+	if data, err := os.ReadFile(ms.profileFile); err == nil {
+		return string(data)
+	}
+	return ""
 }
 
 // getTodayFile returns the path to today's daily note file (memory/YYYYMM/YYYYMMDD.md).
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScopedMemoryStore_Paths(t *testing.T) {
+	workspace := t.TempDir()
+
+	global := NewMemoryStore(workspace)
+	if global.Dir() != filepath.Join(workspace, "memory") {
+		t.Errorf("global dir = %q", global.Dir())
+	}
+	if global.ProfilePath() != "" {
+		t.Errorf("global store should have no profile, got %q", global.ProfilePath())
+	}
+
+	shared := NewScopedMemoryStore(workspace, SharedMemoryScope)
+	if shared.Dir() != filepath.Join(workspace, "memory", "shared") {
+		t.Errorf("shared dir = %q", shared.Dir())
+	}
+
+	user := NewScopedMemoryStore(workspace, "telegram_1")
+	wantDir := filepath.Join(workspace, "memory", "users", "telegram_1")
+	if user.Dir() != wantDir {
+		t.Errorf("user dir = %q, want %q", user.Dir(), wantDir)
+	}
+	if user.ProfilePath() != filepath.Join(wantDir, "USER.md") {
+		t.Errorf("user profile = %q", user.ProfilePath())
+	}
+	if _, err := os.Stat(wantDir); err != nil {
+		t.Errorf("user memory dir not created: %v", err)
+	}
+}
+
+func TestBuildSystemPromptForUser_Isolated(t *testing.T) {
+	workspace := t.TempDir()
+
+	os.WriteFile(filepath.Join(workspace, "USER.md"), []byte("global profile"), 0644)
+	NewMemoryStore(workspace).WriteLongTerm("global memory")
+	NewScopedMemoryStore(workspace, SharedMemoryScope).WriteLongTerm("shared fact")
+
+	alice := NewScopedMemoryStore(workspace, "telegram_alice")
+	alice.WriteLongTerm("alice likes tea")
+	os.WriteFile(alice.ProfilePath(), []byte("alice profile"), 0644)
+	NewScopedMemoryStore(workspace, "telegram_bob").WriteLongTerm("bob likes coffee")
+
+	cb := NewContextBuilder(workspace)
+	cb.SetUserIsolation(true)
+
+	prompt := cb.BuildSystemPromptForUser("telegram_alice")
+	for _, want := range []string{"alice likes tea", "alice profile", "shared fact"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt for alice missing %q", want)
+		}
+	}
+	for _, leaked := range []string{"bob likes coffee", "global memory", "global profile"} {
+		if strings.Contains(prompt, leaked) {
+			t.Errorf("prompt for alice leaked %q", leaked)
+		}
+	}
+	if !strings.Contains(prompt, filepath.Join("users", "telegram_alice")+"/MEMORY.md (current user only)") {
+		t.Error("prompt for alice should point memory writes at her scope")
+	}
+	if cb.memoryFor("telegram_alice") != cb.memoryFor("telegram_alice") {
+		t.Error("expected the store of a scope to be created once")
+	}
+
+	// Unknown senders keep the workspace-wide memory
+	prompt = cb.BuildSystemPromptForUser("")
+	if !strings.Contains(prompt, "global memory") || !strings.Contains(prompt, "global profile") {
+		t.Error("prompt without user scope should include workspace-wide memory and profile")
+	}
+}
+
+func TestBuildSystemPromptForUser_IsolationDisabled(t *testing.T) {
+	workspace := t.TempDir()
+
+	NewMemoryStore(workspace).WriteLongTerm("global memory")
+	NewScopedMemoryStore(workspace, "telegram_alice").WriteLongTerm("alice likes tea")
+
+	cb := NewContextBuilder(workspace)
+
+	prompt := cb.BuildSystemPromptForUser("telegram_alice")
+	if !strings.Contains(prompt, "global memory") {
+		t.Error("expected workspace-wide memory when isolation is disabled")
+	}
+	if strings.Contains(prompt, "alice likes tea") {
+		t.Error("per-user memory should not be loaded when isolation is disabled")
+	}
+}
@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnv names the environment variable holding the auth store
+// passphrase. When it is unset the store is encrypted with a key file.
+const PassphraseEnv = "PICOCLAW_AUTH_PASSPHRASE"
+
+const (
+	sealedVersion = 1
+	kdfKeyFile    = "keyfile"
+	kdfScrypt     = "scrypt"
+	keyFileName   = "auth.key"
+)
+
+// sealedAD binds the ciphertext to its purpose, so a blob encrypted with
+// the same key for something else cannot be passed off as the auth store.
+var sealedAD = []byte("picoclaw auth store v1")
+
+var errWrongKey = errors.New("cannot decrypt auth store: wrong key or passphrase, or the file was copied from another machine")
+
+// sealedStore is the on-disk form of an encrypted auth store.
+type sealedStore struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       string `json:"salt,omitempty"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// machineID returns an identifier of this machine, or "" when the platform
+// has none. Replaced in tests.
+var machineID = func() string {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if data, err := os.ReadFile(path); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+func keyFilePath() string {
+	return filepath.Join(filepath.Dir(authFilePath()), keyFileName)
+}
+
+// isSealed reports whether data is an encrypted store rather than the
+// plain JSON written by older versions.
+func isSealed(data []byte) bool {
+	var probe struct {
+		Ciphertext *string `json:"ciphertext"`
+	}
+	return json.Unmarshal(data, &probe) == nil && probe.Ciphertext != nil
+}
+
+// seal encrypts plain with the passphrase from PassphraseEnv, or with the
+// key file (created on first use) when no passphrase is set.
+func seal(plain []byte) ([]byte, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return sealWithPassphrase(plain, passphrase)
+	}
+	key, err := loadKeyFile(true)
+	if err != nil {
+		return nil, err
+	}
+	return sealWithKey(plain, deriveFileKey(key), kdfKeyFile, nil)
+}
+
+func sealWithPassphrase(plain []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := derivePassphraseKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return sealWithKey(plain, key, kdfScrypt, salt)
+}
+
+func sealWithKey(plain, key []byte, kdf string, salt []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := sealedStore{
+		Version:    sealedVersion,
+		KDF:        kdf,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, plain, sealedAD)),
+	}
+	if salt != nil {
+		sealed.Salt = base64.StdEncoding.EncodeToString(salt)
+	}
+	return json.MarshalIndent(sealed, "", "  ")
+}
+
+// unseal decrypts a store written by seal.
+func unseal(data []byte) ([]byte, error) {
+	var sealed sealedStore
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, err
+	}
+	if sealed.Version != sealedVersion {
+		return nil, fmt.Errorf("unsupported auth store version %d", sealed.Version)
+	}
+
+	var key []byte
+	switch sealed.KDF {
+	case kdfKeyFile:
+		fileKey, err := loadKeyFile(false)
+		if err != nil {
+			return nil, err
+		}
+		key = deriveFileKey(fileKey)
+	case kdfScrypt:
+		passphrase := os.Getenv(PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("auth store is protected by a passphrase; set %s", PassphraseEnv)
+		}
+		salt, err := base64.StdEncoding.DecodeString(sealed.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth store salt: %w", err)
+		}
+		if key, err = derivePassphraseKey(passphrase, salt); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown auth store kdf %q", sealed.KDF)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(sealed.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth store nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(sealed.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth store ciphertext: %w", err)
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid auth store nonce length %d", len(nonce))
+	}
+	plain, err := aead.Open(nil, nonce, ciphertext, sealedAD)
+	if err != nil {
+		return nil, errWrongKey
+	}
+	return plain, nil
+}
+
+// loadKeyFile reads the random key file, creating it when create is set.
+func loadKeyFile(create bool) ([]byte, error) {
+	path := keyFilePath()
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != chacha20poly1305.KeySize {
+			return nil, fmt.Errorf("auth key file %s is corrupt", path)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) || !create {
+		return nil, fmt.Errorf("reading auth key file: %w", err)
+	}
+	key = make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(path, key); err != nil {
+		return nil, fmt.Errorf("writing auth key file: %w", err)
+	}
+	return key, nil
+}
+
+// deriveFileKey mixes the machine ID into the key file, so the key file and
+// store copied together to another machine do not decrypt there. The store
+// also becomes unreadable when the machine ID changes on the same machine,
+// e.g. after a reinstall or when the disk is cloned into a new VM; log in
+// again then, or use a passphrase, which does not depend on the machine.
+func deriveFileKey(fileKey []byte) []byte {
+	key := make([]byte, chacha20poly1305.KeySize)
+	io.ReadFull(hkdf.New(sha256.New, fileKey, []byte(machineID()), sealedAD), key)
+	return key
+}
+
+// passphraseKeys caches scrypt results for the life of the process. The
+// store is read for every provider request, and each derivation costs tens
+// of milliseconds and 32 MB of memory.
+var passphraseKeys = struct {
+	sync.Mutex
+	keys map[[sha256.Size]byte][]byte
+}{keys: make(map[[sha256.Size]byte][]byte)}
+
+func derivePassphraseKey(passphrase string, salt []byte) ([]byte, error) {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte{0})
+	h.Write([]byte(passphrase))
+	var id [sha256.Size]byte
+	h.Sum(id[:0])
+
+	passphraseKeys.Lock()
+	defer passphraseKeys.Unlock()
+	if key, ok := passphraseKeys.keys[id]; ok {
+		return key, nil
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	passphraseKeys.keys[id] = key
+	return key, nil
+}
+
+// RotateKey re-encrypts the auth store under a new key. With a passphrase
+// the key is derived from it (and PassphraseEnv must be set to it from now
+// on); otherwise a new random key file replaces the old one.
+func RotateKey(newPassphrase string) error {
+	store, err := LoadStore()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(store)
+	if err != nil {
+		return err
+	}
+
+	if newPassphrase != "" {
+		data, err := sealWithPassphrase(plain, newPassphrase)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(authFilePath(), data)
+	}
+
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	data, err := sealWithKey(plain, deriveFileKey(key), kdfKeyFile, nil)
+	if err != nil {
+		return err
+	}
+	// Keep the old key until the store written with the new one is in place
+	oldKey, _ := os.ReadFile(keyFilePath())
+	if err := writeFileAtomic(keyFilePath(), key); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(authFilePath(), data); err != nil {
+		if oldKey != nil {
+			writeFileAtomic(keyFilePath(), oldKey)
+		}
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomic writes data with 0600 permissions via a temporary file,
+// so a crash never leaves a truncated store or key behind.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
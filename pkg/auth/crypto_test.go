@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setMachineID(t *testing.T, id string) {
+	orig := machineID
+	machineID = func() string { return id }
+	t.Cleanup(func() { machineID = orig })
+}
+
+func TestStoreEncryptedAtRest(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv(PassphraseEnv, "")
+	setMachineID(t, "machine-a")
+
+	if err := SetCredential("openai", &AuthCredential{AccessToken: "secret-token", Provider: "openai", AuthMethod: "oauth"}); err != nil {
+		t.Fatalf("SetCredential() error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, ".picoclaw", "auth.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret-token")) || !isSealed(data) {
+		t.Fatalf("auth.json is not encrypted: %s", data)
+	}
+	info, err := os.Stat(filepath.Join(tmpDir, ".picoclaw", "auth.key"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("key file = %v, %v", info, err)
+	}
+
+	// The key file is bound to the machine
+	setMachineID(t, "machine-b")
+	if _, err := GetCredential("openai"); err == nil {
+		t.Error("expected decryption to fail on another machine")
+	}
+}
+
+func TestStoreMigratesPlaintext(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv(PassphraseEnv, "")
+	setMachineID(t, "machine-a")
+
+	path := filepath.Join(tmpDir, ".picoclaw", "auth.json")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	plain := `{"credentials": {"anthropic": {"access_token": "old-token", "provider": "anthropic", "auth_method": "token"}}}`
+	if err := os.WriteFile(path, []byte(plain), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cred, err := GetCredential("anthropic")
+	if err != nil || cred == nil || cred.AccessToken != "old-token" {
+		t.Fatalf("GetCredential() = %+v, %v", cred, err)
+	}
+	data, _ := os.ReadFile(path)
+	if !isSealed(data) || bytes.Contains(data, []byte("old-token")) {
+		t.Errorf("store was not migrated: %s", data)
+	}
+	if leftovers, _ := filepath.Glob(path + "*"); len(leftovers) != 1 {
+		t.Errorf("expected the plain store to be replaced, found %v", leftovers)
+	}
+
+	// The migrated store reads back without another migration
+	cred, err = GetCredential("anthropic")
+	if err != nil || cred == nil || cred.AccessToken != "old-token" {
+		t.Fatalf("GetCredential() after migration = %+v, %v", cred, err)
+	}
+}
+
+func TestDeleteAllCredentialsRemovesKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv(PassphraseEnv, "")
+	setMachineID(t, "machine-a")
+
+	if err := SetCredential("openai", &AuthCredential{AccessToken: "secret-token", Provider: "openai"}); err != nil {
+		t.Fatalf("SetCredential() error: %v", err)
+	}
+	if err := DeleteAllCredentials(); err != nil {
+		t.Fatalf("DeleteAllCredentials() error: %v", err)
+	}
+	for _, name := range []string{"auth.json", "auth.key"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, ".picoclaw", name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", name, err)
+		}
+	}
+	// Removing an absent store is not an error
+	if err := DeleteAllCredentials(); err != nil {
+		t.Errorf("second DeleteAllCredentials() error: %v", err)
+	}
+}
+
+func TestStorePassphrase(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv(PassphraseEnv, "correct horse")
+
+	if err := SetCredential("openai", &AuthCredential{AccessToken: "tok", Provider: "openai"}); err != nil {
+		t.Fatalf("SetCredential() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, ".picoclaw", "auth.key")); !os.IsNotExist(err) {
+		t.Error("no key file should be created in passphrase mode")
+	}
+
+	t.Setenv(PassphraseEnv, "")
+	if _, err := LoadStore(); err == nil || !strings.Contains(err.Error(), PassphraseEnv) {
+		t.Errorf("LoadStore() without passphrase error = %v", err)
+	}
+	t.Setenv(PassphraseEnv, "wrong")
+	if _, err := LoadStore(); err == nil {
+		t.Error("expected error for wrong passphrase")
+	}
+	t.Setenv(PassphraseEnv, "correct horse")
+	if cred, err := GetCredential("openai"); err != nil || cred.AccessToken != "tok" {
+		t.Errorf("GetCredential() = %+v, %v", cred, err)
+	}
+
+	// The derived key is cached, so later reads skip scrypt
+	if _, err := LoadStore(); err != nil {
+		t.Fatalf("LoadStore() error: %v", err)
+	}
+	cached, _ := derivePassphraseKey("correct horse", nil)
+	passphraseKeys.Lock()
+	n := len(passphraseKeys.keys)
+	passphraseKeys.Unlock()
+	again, _ := derivePassphraseKey("correct horse", nil)
+	passphraseKeys.Lock()
+	defer passphraseKeys.Unlock()
+	if len(passphraseKeys.keys) != n || !bytes.Equal(cached, again) {
+		t.Error("expected the passphrase key to be cached")
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("HOME", tmpDir)
+	t.Setenv(PassphraseEnv, "")
+	setMachineID(t, "machine-a")
+
+	if err := SetCredential("openai", &AuthCredential{AccessToken: "tok", Provider: "openai"}); err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(tmpDir, ".picoclaw", "auth.key")
+	oldKey, _ := os.ReadFile(keyPath)
+
+	if err := RotateKey(""); err != nil {
+		t.Fatalf("RotateKey() error: %v", err)
+	}
+	newKey, _ := os.ReadFile(keyPath)
+	if bytes.Equal(oldKey, newKey) {
+		t.Error("key file was not replaced")
+	}
+	if cred, err := GetCredential("openai"); err != nil || cred.AccessToken != "tok" {
+		t.Fatalf("GetCredential() after rotation = %+v, %v", cred, err)
+	}
+
+	// Switch to a passphrase
+	if err := RotateKey("s3cret"); err != nil {
+		t.Fatalf("RotateKey(passphrase) error: %v", err)
+	}
+	if _, err := LoadStore(); err == nil {
+		t.Error("expected the store to need the new passphrase")
+	}
+	t.Setenv(PassphraseEnv, "s3cret")
+	if cred, err := GetCredential("openai"); err != nil || cred.AccessToken != "tok" {
+		t.Errorf("GetCredential() with passphrase = %+v, %v", cred, err)
+	}
+}
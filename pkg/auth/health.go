@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// KeyHealth is the last known state of one API key or credential profile.
+// The gateway records it when a key is rate limited or recovers, so that
+// `picoclaw auth status` can show it from another process.
+type KeyHealth struct {
+	Provider      string    `json:"provider"`
+	Label         string    `json:"label"`
+	CooldownUntil time.Time `json:"cooldown_until,omitempty"`
+	Failures      int       `json:"failures,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// CoolingDown reports whether the key is still waiting out a cooldown.
+func (h *KeyHealth) CoolingDown() bool {
+	return time.Now().Before(h.CooldownUntil)
+}
+
+var healthMu sync.Mutex
+
+func healthFilePath() string {
+	return filepath.Join(filepath.Dir(authFilePath()), "credential_health.json")
+}
+
+// KeyID identifies an API key in the health file without storing the key.
+func KeyID(provider, secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return provider + "/" + hex.EncodeToString(sum[:6])
+}
+
+// KeyLabel is a recognizable but harmless name for an API key.
+func KeyLabel(secret string) string {
+	if len(secret) <= 8 {
+		return "key"
+	}
+	return "key …" + secret[len(secret)-4:]
+}
+
+// LoadKeyHealth returns the recorded health by key ID.
+func LoadKeyHealth() (map[string]*KeyHealth, error) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	return loadKeyHealthLocked()
+}
+
+func loadKeyHealthLocked() (map[string]*KeyHealth, error) {
+	health := make(map[string]*KeyHealth)
+	data, err := os.ReadFile(healthFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return health, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &health); err != nil {
+		return nil, err
+	}
+	return health, nil
+}
+
+// RecordKeyHealth stores the health of one key.
+func RecordKeyHealth(id string, h KeyHealth) error {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+
+	health, err := loadKeyHealthLocked()
+	if err != nil {
+		// A corrupt file only holds transient state; start over
+		health = make(map[string]*KeyHealth)
+	}
+	h.UpdatedAt = time.Now()
+	health[id] = &h
+
+	data, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(healthFilePath(), data)
+}
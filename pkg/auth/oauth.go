@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
@@ -19,13 +21,30 @@ import (
 )
 
 type OAuthProviderConfig struct {
+	// Provider names the stored credential; "openai" when empty.
+	Provider   string
 	Issuer     string
 	ClientID   string
 	Scopes     string
 	Originator string
 	Port       int
+	// AuthorizeURL and TokenURL default to Issuer + "/oauth/authorize"
+	// and Issuer + "/oauth/token".
+	AuthorizeURL string
+	TokenURL     string
+	// CallbackPath is the local redirect path, "/auth/callback" by default.
+	CallbackPath string
+	// ManualRedirectURI is a provider page that shows the code for pasting,
+	// used by LoginManualCode on machines without a browser.
+	ManualRedirectURI string
+	// JSONTokenRequest sends token requests as JSON instead of a form.
+	JSONTokenRequest bool
 }
 
+// oauthClient is used for every request to an OAuth server, so a server
+// that stops answering cannot hang a login or a token refresh.
+var oauthClient = &http.Client{Timeout: 30 * time.Second}
+
 func OpenAIOAuthConfig() OAuthProviderConfig {
 	return OAuthProviderConfig{
 		Issuer:     "https://auth.openai.com",
@@ -36,6 +55,59 @@ func OpenAIOAuthConfig() OAuthProviderConfig {
 	}
 }
 
+// AnthropicOAuthConfig logs in with a Claude Pro/Max account through the
+// OAuth app registered under clientID. Anthropic publishes no client ID for
+// third-party tools, so none is built in.
+func AnthropicOAuthConfig(clientID string) OAuthProviderConfig {
+	return OAuthProviderConfig{
+		Provider:          "anthropic",
+		Issuer:            "https://claude.ai",
+		ClientID:          clientID,
+		Scopes:            "org:create_api_key user:profile user:inference",
+		Port:              54545,
+		AuthorizeURL:      "https://claude.ai/oauth/authorize",
+		TokenURL:          "https://console.anthropic.com/v1/oauth/token",
+		CallbackPath:      "/callback",
+		ManualRedirectURI: "https://console.anthropic.com/oauth/code/callback",
+		JSONTokenRequest:  true,
+	}
+}
+
+func (cfg OAuthProviderConfig) provider() string {
+	if cfg.Provider == "" {
+		return "openai"
+	}
+	return cfg.Provider
+}
+
+func (cfg OAuthProviderConfig) authorizeURL() string {
+	if cfg.AuthorizeURL != "" {
+		return cfg.AuthorizeURL
+	}
+	return cfg.Issuer + "/oauth/authorize"
+}
+
+func (cfg OAuthProviderConfig) tokenURL() string {
+	if cfg.TokenURL != "" {
+		return cfg.TokenURL
+	}
+	return cfg.Issuer + "/oauth/token"
+}
+
+func (cfg OAuthProviderConfig) callbackPath() string {
+	if cfg.CallbackPath != "" {
+		return cfg.CallbackPath
+	}
+	return "/auth/callback"
+}
+
+func (cfg OAuthProviderConfig) validate() error {
+	if cfg.ClientID == "" {
+		return fmt.Errorf("no OAuth client ID configured for %s; set providers.%s.oauth_client_id", cfg.provider(), cfg.provider())
+	}
+	return nil
+}
+
 func generateState() (string, error) {
 	buf := make([]byte, 32)
 	if _, err := rand.Read(buf); err != nil {
@@ -44,7 +116,10 @@ func generateState() (string, error) {
 	return hex.EncodeToString(buf), nil
 }
 
-func LoginBrowser(cfg OAuthProviderConfig) (*AuthCredential, error) {
+func LoginBrowser(ctx context.Context, cfg OAuthProviderConfig) (*AuthCredential, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 	pkce, err := GeneratePKCE()
 	if err != nil {
 		return nil, fmt.Errorf("generating PKCE: %w", err)
@@ -55,14 +130,14 @@ func LoginBrowser(cfg OAuthProviderConfig) (*AuthCredential, error) {
 		return nil, fmt.Errorf("generating state: %w", err)
 	}
 
-	redirectURI := fmt.Sprintf("http://localhost:%d/auth/callback", cfg.Port)
+	redirectURI := fmt.Sprintf("http://localhost:%d%s", cfg.Port, cfg.callbackPath())
 
 	authURL := buildAuthorizeURL(cfg, pkce, state, redirectURI)
 
 	resultCh := make(chan callbackResult, 1)
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/auth/callback", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc(cfg.callbackPath(), func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Query().Get("state") != state {
 			resultCh <- callbackResult{err: fmt.Errorf("state mismatch")}
 			http.Error(w, "State mismatch", http.StatusBadRequest)
@@ -101,7 +176,7 @@ func LoginBrowser(cfg OAuthProviderConfig) (*AuthCredential, error) {
 		fmt.Printf("Could not open browser automatically.\nPlease open this URL manually:\n\n%s\n\n", authURL)
 	}
 
-	fmt.Println("If you're running in a headless environment, use: picoclaw auth login --provider openai --device-code")
+	fmt.Printf("If you're running in a headless environment, use: picoclaw auth login --provider %s --device-code\n", cfg.provider())
 	fmt.Println("Waiting for authentication in browser...")
 
 	select {
@@ -109,7 +184,9 @@ func LoginBrowser(cfg OAuthProviderConfig) (*AuthCredential, error) {
 		if result.err != nil {
 			return nil, result.err
 		}
-		return exchangeCodeForTokens(cfg, result.code, pkce.CodeVerifier, redirectURI)
+		return exchangeCode(ctx, cfg, result.code, pkce.CodeVerifier, redirectURI, state)
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	case <-time.After(5 * time.Minute):
 		return nil, fmt.Errorf("authentication timed out after 5 minutes")
 	}
@@ -120,6 +197,48 @@ type callbackResult struct {
 	err  error
 }
 
+// LoginManualCode runs the PKCE flow without a local callback server: the
+// provider shows the authorization code, which the user pastes into r.
+func LoginManualCode(ctx context.Context, cfg OAuthProviderConfig, r io.Reader) (*AuthCredential, error) {
+	if cfg.ManualRedirectURI == "" {
+		return nil, fmt.Errorf("%s does not support pasting an authorization code", cfg.provider())
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	pkce, err := GeneratePKCE()
+	if err != nil {
+		return nil, fmt.Errorf("generating PKCE: %w", err)
+	}
+	state, err := generateState()
+	if err != nil {
+		return nil, fmt.Errorf("generating state: %w", err)
+	}
+
+	authURL := buildAuthorizeURL(cfg, pkce, state, cfg.ManualRedirectURI)
+	fmt.Printf("Open this URL on any device and authorize:\n\n%s\n\n", authURL)
+	fmt.Print("Paste the code shown after authorizing:\n> ")
+
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("reading code: %w", err)
+		}
+		return nil, fmt.Errorf("no input received")
+	}
+
+	// The page shows "<code>#<state>"
+	code, pastedState, _ := strings.Cut(strings.TrimSpace(scanner.Text()), "#")
+	if code == "" {
+		return nil, fmt.Errorf("code cannot be empty")
+	}
+	if pastedState != "" && pastedState != state {
+		return nil, fmt.Errorf("state mismatch")
+	}
+	return exchangeCode(ctx, cfg, code, pkce.CodeVerifier, cfg.ManualRedirectURI, state)
+}
+
 type deviceCodeResponse struct {
 	DeviceAuthID string
 	UserCode     string
@@ -171,16 +290,15 @@ func parseFlexibleInt(raw json.RawMessage) (int, error) {
 	return 0, fmt.Errorf("invalid integer value: %s", string(raw))
 }
 
-func LoginDeviceCode(cfg OAuthProviderConfig) (*AuthCredential, error) {
+func LoginDeviceCode(ctx context.Context, cfg OAuthProviderConfig) (*AuthCredential, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 	reqBody, _ := json.Marshal(map[string]string{
 		"client_id": cfg.ClientID,
 	})
 
-	resp, err := http.Post(
-		cfg.Issuer+"/api/accounts/deviceauth/usercode",
-		"application/json",
-		strings.NewReader(string(reqBody)),
-	)
+	resp, err := postJSON(ctx, cfg.Issuer+"/api/accounts/deviceauth/usercode", reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("requesting device code: %w", err)
 	}
@@ -209,10 +327,12 @@ func LoginDeviceCode(cfg OAuthProviderConfig) (*AuthCredential, error) {
 
 	for {
 		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		case <-deadline:
 			return nil, fmt.Errorf("device code authentication timed out after 15 minutes")
 		case <-ticker.C:
-			cred, err := pollDeviceCode(cfg, deviceResp.DeviceAuthID, deviceResp.UserCode)
+			cred, err := pollDeviceCode(ctx, cfg, deviceResp.DeviceAuthID, deviceResp.UserCode)
 			if err != nil {
 				continue
 			}
@@ -223,17 +343,13 @@ func LoginDeviceCode(cfg OAuthProviderConfig) (*AuthCredential, error) {
 	}
 }
 
-func pollDeviceCode(cfg OAuthProviderConfig, deviceAuthID, userCode string) (*AuthCredential, error) {
+func pollDeviceCode(ctx context.Context, cfg OAuthProviderConfig, deviceAuthID, userCode string) (*AuthCredential, error) {
 	reqBody, _ := json.Marshal(map[string]string{
 		"device_auth_id": deviceAuthID,
 		"user_code":      userCode,
 	})
 
-	resp, err := http.Post(
-		cfg.Issuer+"/api/accounts/deviceauth/token",
-		"application/json",
-		strings.NewReader(string(reqBody)),
-	)
+	resp, err := postJSON(ctx, cfg.Issuer+"/api/accounts/deviceauth/token", reqBody)
 	if err != nil {
 		return nil, err
 	}
@@ -255,22 +371,32 @@ func pollDeviceCode(cfg OAuthProviderConfig, deviceAuthID, userCode string) (*Au
 	}
 
 	redirectURI := cfg.Issuer + "/deviceauth/callback"
-	return exchangeCodeForTokens(cfg, tokenResp.AuthorizationCode, tokenResp.CodeVerifier, redirectURI)
+	return exchangeCodeForTokens(ctx, cfg, tokenResp.AuthorizationCode, tokenResp.CodeVerifier, redirectURI)
 }
 
-func RefreshAccessToken(cred *AuthCredential, cfg OAuthProviderConfig) (*AuthCredential, error) {
+// RefreshAccessToken exchanges the refresh token of cred for new tokens.
+// The client ID the credential was issued to is used when it was recorded.
+func RefreshAccessToken(ctx context.Context, cred *AuthCredential, cfg OAuthProviderConfig) (*AuthCredential, error) {
 	if cred.RefreshToken == "" {
 		return nil, fmt.Errorf("no refresh token available")
 	}
+	if cred.ClientID != "" {
+		cfg.ClientID = cred.ClientID
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 
 	data := url.Values{
 		"client_id":     {cfg.ClientID},
 		"grant_type":    {"refresh_token"},
 		"refresh_token": {cred.RefreshToken},
-		"scope":         {"openid profile email"},
+	}
+	if cfg.provider() == "openai" {
+		data.Set("scope", "openid profile email")
 	}
 
-	resp, err := http.PostForm(cfg.Issuer+"/oauth/token", data)
+	resp, err := postToken(ctx, cfg, data)
 	if err != nil {
 		return nil, fmt.Errorf("refreshing token: %w", err)
 	}
@@ -285,6 +411,7 @@ func RefreshAccessToken(cred *AuthCredential, cfg OAuthProviderConfig) (*AuthCre
 	if err != nil {
 		return nil, err
 	}
+	refreshed.ClientID = cfg.ClientID
 	if refreshed.RefreshToken == "" {
 		refreshed.RefreshToken = cred.RefreshToken
 	}
@@ -300,15 +427,21 @@ func BuildAuthorizeURL(cfg OAuthProviderConfig, pkce PKCECodes, state, redirectU
 
 func buildAuthorizeURL(cfg OAuthProviderConfig, pkce PKCECodes, state, redirectURI string) string {
 	params := url.Values{
-		"response_type":              {"code"},
-		"client_id":                  {cfg.ClientID},
-		"redirect_uri":               {redirectURI},
-		"scope":                      {cfg.Scopes},
-		"code_challenge":             {pkce.CodeChallenge},
-		"code_challenge_method":      {"S256"},
-		"id_token_add_organizations": {"true"},
-		"codex_cli_simplified_flow":  {"true"},
-		"state":                      {state},
+		"response_type":         {"code"},
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {cfg.Scopes},
+		"code_challenge":        {pkce.CodeChallenge},
+		"code_challenge_method": {"S256"},
+		"state":                 {state},
+	}
+	if cfg.provider() == "openai" {
+		params.Set("id_token_add_organizations", "true")
+		params.Set("codex_cli_simplified_flow", "true")
+	}
+	if redirectURI == cfg.ManualRedirectURI {
+		// Ask the provider to show the code instead of redirecting
+		params.Set("code", "true")
 	}
 	if strings.Contains(strings.ToLower(cfg.Issuer), "auth.openai.com") {
 		params.Set("originator", "picoclaw")
@@ -316,10 +449,14 @@ func buildAuthorizeURL(cfg OAuthProviderConfig, pkce PKCECodes, state, redirectU
 	if cfg.Originator != "" {
 		params.Set("originator", cfg.Originator)
 	}
-	return cfg.Issuer + "/oauth/authorize?" + params.Encode()
+	return cfg.authorizeURL() + "?" + params.Encode()
+}
+
+func exchangeCodeForTokens(ctx context.Context, cfg OAuthProviderConfig, code, codeVerifier, redirectURI string) (*AuthCredential, error) {
+	return exchangeCode(ctx, cfg, code, codeVerifier, redirectURI, "")
 }
 
-func exchangeCodeForTokens(cfg OAuthProviderConfig, code, codeVerifier, redirectURI string) (*AuthCredential, error) {
+func exchangeCode(ctx context.Context, cfg OAuthProviderConfig, code, codeVerifier, redirectURI, state string) (*AuthCredential, error) {
 	data := url.Values{
 		"grant_type":    {"authorization_code"},
 		"code":          {code},
@@ -327,8 +464,11 @@ func exchangeCodeForTokens(cfg OAuthProviderConfig, code, codeVerifier, redirect
 		"client_id":     {cfg.ClientID},
 		"code_verifier": {codeVerifier},
 	}
+	if state != "" && cfg.JSONTokenRequest {
+		data.Set("state", state)
+	}
 
-	resp, err := http.PostForm(cfg.Issuer+"/oauth/token", data)
+	resp, err := postToken(ctx, cfg, data)
 	if err != nil {
 		return nil, fmt.Errorf("exchanging code for tokens: %w", err)
 	}
@@ -339,7 +479,39 @@ func exchangeCodeForTokens(cfg OAuthProviderConfig, code, codeVerifier, redirect
 		return nil, fmt.Errorf("token exchange failed: %s", string(body))
 	}
 
-	return parseTokenResponse(body, "openai")
+	cred, err := parseTokenResponse(body, cfg.provider())
+	if err != nil {
+		return nil, err
+	}
+	cred.ClientID = cfg.ClientID
+	return cred, nil
+}
+
+// postToken sends a request to the token endpoint, as a form or as JSON.
+func postToken(ctx context.Context, cfg OAuthProviderConfig, data url.Values) (*http.Response, error) {
+	if cfg.JSONTokenRequest {
+		fields := make(map[string]string, len(data))
+		for k := range data {
+			fields[k] = data.Get(k)
+		}
+		body, _ := json.Marshal(fields)
+		return postJSON(ctx, cfg.tokenURL(), body)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.tokenURL(), strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return oauthClient.Do(req)
+}
+
+func postJSON(ctx context.Context, endpoint string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return oauthClient.Do(req)
 }
 
 func parseTokenResponse(body []byte, provider string) (*AuthCredential, error) {
@@ -348,6 +520,10 @@ func parseTokenResponse(body []byte, provider string) (*AuthCredential, error) {
 		RefreshToken string `json:"refresh_token"`
 		ExpiresIn    int    `json:"expires_in"`
 		IDToken      string `json:"id_token"`
+		// Anthropic returns the account instead of an ID token
+		Account struct {
+			UUID string `json:"uuid"`
+		} `json:"account"`
 	}
 	if err := json.Unmarshal(body, &tokenResp); err != nil {
 		return nil, fmt.Errorf("parsing token response: %w", err)
@@ -377,6 +553,8 @@ func parseTokenResponse(body []byte, provider string) (*AuthCredential, error) {
 	} else if accountID := extractAccountID(tokenResp.IDToken); accountID != "" {
 		// Recent OpenAI OAuth responses may only include chatgpt_account_id in id_token claims.
 		cred.AccountID = accountID
+	} else if tokenResp.Account.UUID != "" {
+		cred.AccountID = tokenResp.Account.UUID
 	}
 
 	return cred, nil
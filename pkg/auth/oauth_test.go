@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 func makeJWTForClaims(t *testing.T, claims map[string]interface{}) string {
@@ -217,7 +219,7 @@ func TestExchangeCodeForTokens(t *testing.T) {
 		Port:     1455,
 	}
 
-	cred, err := exchangeCodeForTokens(cfg, "test-code", "test-verifier", "http://localhost:1455/auth/callback")
+	cred, err := exchangeCodeForTokens(context.Background(), cfg, "test-code", "test-verifier", "http://localhost:1455/auth/callback")
 	if err != nil {
 		t.Fatalf("exchangeCodeForTokens() error: %v", err)
 	}
@@ -261,7 +263,7 @@ func TestRefreshAccessToken(t *testing.T) {
 		AuthMethod:   "oauth",
 	}
 
-	refreshed, err := RefreshAccessToken(cred, cfg)
+	refreshed, err := RefreshAccessToken(context.Background(), cred, cfg)
 	if err != nil {
 		t.Fatalf("RefreshAccessToken() error: %v", err)
 	}
@@ -282,7 +284,7 @@ func TestRefreshAccessTokenNoRefreshToken(t *testing.T) {
 		AuthMethod:  "oauth",
 	}
 
-	_, err := RefreshAccessToken(cred, cfg)
+	_, err := RefreshAccessToken(context.Background(), cred, cfg)
 	if err == nil {
 		t.Error("expected error for missing refresh token")
 	}
@@ -307,7 +309,7 @@ func TestRefreshAccessTokenPreservesRefreshAndAccountID(t *testing.T) {
 		AuthMethod:   "oauth",
 	}
 
-	refreshed, err := RefreshAccessToken(cred, cfg)
+	refreshed, err := RefreshAccessToken(context.Background(), cred, cfg)
 	if err != nil {
 		t.Fatalf("RefreshAccessToken() error: %v", err)
 	}
@@ -371,3 +373,135 @@ func TestParseDeviceCodeResponseInvalidInterval(t *testing.T) {
 		t.Fatal("expected error for invalid interval")
 	}
 }
+
+func TestBuildAuthorizeURLAnthropic(t *testing.T) {
+	cfg := AnthropicOAuthConfig("test-client")
+	pkce := PKCECodes{CodeVerifier: "test-verifier", CodeChallenge: "test-challenge"}
+
+	u := BuildAuthorizeURL(cfg, pkce, "test-state", "http://localhost:54545/callback")
+	parsed, err := url.Parse(u)
+	if err != nil {
+		t.Fatalf("url.Parse() error: %v", err)
+	}
+	if parsed.Host != "claude.ai" || parsed.Path != "/oauth/authorize" {
+		t.Errorf("URL = %s", u)
+	}
+	q := parsed.Query()
+	if q.Get("id_token_add_organizations") != "" || q.Get("codex_cli_simplified_flow") != "" || q.Get("originator") != "" {
+		t.Errorf("OpenAI-only params in Anthropic URL: %s", u)
+	}
+	if q.Get("scope") != cfg.Scopes || q.Get("code") != "" {
+		t.Errorf("query = %v", q)
+	}
+
+	manual, _ := url.Parse(BuildAuthorizeURL(cfg, pkce, "test-state", cfg.ManualRedirectURI))
+	if manual.Query().Get("code") != "true" {
+		t.Error("manual flow should ask for the code to be shown")
+	}
+}
+
+func TestAnthropicTokenRequestsUseJSON(t *testing.T) {
+	var got map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/oauth/token" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "sk-ant-oat-new",
+			"refresh_token": "sk-ant-ort-new",
+			"expires_in":    28800,
+			"account":       map[string]string{"uuid": "acct-uuid"},
+		})
+	}))
+	defer server.Close()
+
+	cfg := AnthropicOAuthConfig("test-client")
+	cfg.TokenURL = server.URL + "/v1/oauth/token"
+
+	cred, err := exchangeCode(context.Background(), cfg, "the-code", "the-verifier", cfg.ManualRedirectURI, "the-state")
+	if err != nil {
+		t.Fatalf("exchangeCode() error: %v", err)
+	}
+	if got["grant_type"] != "authorization_code" || got["code"] != "the-code" || got["state"] != "the-state" || got["code_verifier"] != "the-verifier" {
+		t.Errorf("exchange body = %v", got)
+	}
+	if cred.Provider != "anthropic" || cred.AccountID != "acct-uuid" || cred.AccessToken != "sk-ant-oat-new" || cred.ClientID != "test-client" {
+		t.Errorf("cred = %+v", cred)
+	}
+
+	if _, err := RefreshAccessToken(context.Background(), &AuthCredential{RefreshToken: "sk-ant-ort-old", Provider: "anthropic"}, cfg); err != nil {
+		t.Fatalf("RefreshAccessToken() error: %v", err)
+	}
+	if got["grant_type"] != "refresh_token" || got["refresh_token"] != "sk-ant-ort-old" || got["scope"] != "" {
+		t.Errorf("refresh body = %v", got)
+	}
+
+	// Refreshes use the client the credential was issued to
+	if _, err := RefreshAccessToken(context.Background(), &AuthCredential{RefreshToken: "r", Provider: "anthropic", ClientID: "login-client"}, cfg); err != nil {
+		t.Fatalf("RefreshAccessToken() error: %v", err)
+	}
+	if got["client_id"] != "login-client" {
+		t.Errorf("refresh client_id = %q", got["client_id"])
+	}
+}
+
+func TestAnthropicOAuthRequiresClientID(t *testing.T) {
+	cfg := AnthropicOAuthConfig("")
+	if _, err := LoginManualCode(context.Background(), cfg, strings.NewReader("code\n")); err == nil || !strings.Contains(err.Error(), "oauth_client_id") {
+		t.Errorf("LoginManualCode() error = %v", err)
+	}
+	if _, err := RefreshAccessToken(context.Background(), &AuthCredential{RefreshToken: "r", Provider: "anthropic"}, cfg); err == nil {
+		t.Error("expected error without a client ID")
+	}
+}
+
+func TestTokenRequestHonorsContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := OpenAIOAuthConfig()
+	cfg.TokenURL = server.URL
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := RefreshAccessToken(ctx, &AuthCredential{RefreshToken: "r"}, cfg); err == nil {
+		t.Fatal("expected the request to be cancelled")
+	}
+}
+
+func TestLoginManualCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["code"] != "pasted-code" {
+			http.Error(w, "bad code", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "tok", "expires_in": 3600})
+	}))
+	defer server.Close()
+
+	cfg := AnthropicOAuthConfig("test-client")
+	cfg.TokenURL = server.URL
+
+	cred, err := LoginManualCode(context.Background(), cfg, strings.NewReader("pasted-code\n"))
+	if err != nil {
+		t.Fatalf("LoginManualCode() error: %v", err)
+	}
+	if cred.AccessToken != "tok" || cred.AuthMethod != "oauth" {
+		t.Errorf("cred = %+v", cred)
+	}
+
+	if _, err := LoginManualCode(context.Background(), cfg, strings.NewReader("pasted-code#other-state\n")); err == nil {
+		t.Error("expected state mismatch error")
+	}
+	if _, err := LoginManualCode(context.Background(), OpenAIOAuthConfig(), strings.NewReader("x\n")); err == nil {
+		t.Error("expected error for a provider without a manual redirect")
+	}
+}
@@ -4,7 +4,12 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
 type AuthCredential struct {
@@ -14,6 +19,9 @@ type AuthCredential struct {
 	ExpiresAt    time.Time `json:"expires_at,omitempty"`
 	Provider     string    `json:"provider"`
 	AuthMethod   string    `json:"auth_method"`
+	// ClientID is the OAuth client the tokens were issued to; refreshes
+	// must use the same one.
+	ClientID string `json:"client_id,omitempty"`
 }
 
 type AuthStore struct {
@@ -34,11 +42,16 @@ func (c *AuthCredential) NeedsRefresh() bool {
 	return time.Now().Add(5 * time.Minute).After(c.ExpiresAt)
 }
 
+// migrateWarning is logged once when a plain store cannot be encrypted.
+var migrateWarning sync.Once
+
 func authFilePath() string {
 	home, _ := os.UserHomeDir()
 	return filepath.Join(home, ".picoclaw", "auth.json")
 }
 
+// LoadStore reads the auth store. A plain JSON store written by an older
+// version is encrypted in place the first time it is read.
 func LoadStore() (*AuthStore, error) {
 	path := authFilePath()
 	data, err := os.ReadFile(path)
@@ -49,6 +62,13 @@ func LoadStore() (*AuthStore, error) {
 		return nil, err
 	}
 
+	sealed := isSealed(data)
+	if sealed {
+		if data, err = unseal(data); err != nil {
+			return nil, err
+		}
+	}
+
 	var store AuthStore
 	if err := json.Unmarshal(data, &store); err != nil {
 		return nil, err
@@ -56,23 +76,62 @@ func LoadStore() (*AuthStore, error) {
 	if store.Credentials == nil {
 		store.Credentials = make(map[string]*AuthCredential)
 	}
+	if !sealed {
+		// Best effort: a read-only home still gets its credentials
+		if err := SaveStore(&store); err != nil {
+			migrateWarning.Do(func() {
+				logger.WarnCF("auth", "Failed to encrypt the auth store; credentials stay unencrypted on disk",
+					map[string]interface{}{"path": path, "error": err.Error()})
+			})
+		}
+	}
 	return &store, nil
 }
 
+// SaveStore encrypts and writes the auth store.
 func SaveStore(store *AuthStore) error {
-	path := authFilePath()
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	plain, err := json.Marshal(store)
+	if err != nil {
 		return err
 	}
-
-	data, err := json.MarshalIndent(store, "", "  ")
+	data, err := seal(plain)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0600)
+	return writeFileAtomic(authFilePath(), data)
+}
+
+// CredentialKey returns the store key of a named credential profile. The
+// unnamed profile is stored under the provider name itself.
+func CredentialKey(provider, profile string) string {
+	if profile == "" || profile == "default" {
+		return provider
+	}
+	return provider + ":" + profile
 }
 
+// ProfileKeys returns the store keys of all credential profiles of
+// provider, the unnamed profile first and the rest sorted.
+func ProfileKeys(provider string) ([]string, error) {
+	store, err := LoadStore()
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for key := range store.Credentials {
+		if strings.HasPrefix(key, provider+":") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if _, ok := store.Credentials[provider]; ok {
+		keys = append([]string{provider}, keys...)
+	}
+	return keys, nil
+}
+
+// GetCredential returns the credential stored under provider, which may be
+// a profile key from CredentialKey.
 func GetCredential(provider string) (*AuthCredential, error) {
 	store, err := LoadStore()
 	if err != nil {
@@ -103,10 +162,12 @@ func DeleteCredential(provider string) error {
 	return SaveStore(store)
 }
 
+// DeleteAllCredentials removes the auth store together with its key file.
 func DeleteAllCredentials() error {
-	path := authFilePath()
-	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-		return err
+	for _, path := range []string{authFilePath(), keyFilePath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
 	return nil
 }
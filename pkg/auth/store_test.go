@@ -187,3 +187,40 @@ func TestLoadStoreEmpty(t *testing.T) {
 		t.Errorf("expected empty credentials, got %d", len(store.Credentials))
 	}
 }
+
+func TestProfileKeys(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for _, key := range []string{CredentialKey("anthropic", "work"), CredentialKey("anthropic", "default"), "anthropic-other", "openai"} {
+		if err := SetCredential(key, &AuthCredential{AccessToken: key}); err != nil {
+			t.Fatalf("SetCredential(%q) error: %v", key, err)
+		}
+	}
+
+	keys, err := ProfileKeys("anthropic")
+	if err != nil {
+		t.Fatalf("ProfileKeys() error: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != "anthropic" || keys[1] != "anthropic:work" {
+		t.Errorf("ProfileKeys() = %q, want [anthropic anthropic:work]", keys)
+	}
+}
+
+func TestRecordKeyHealth(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	id := KeyID("groq", "gsk-secret")
+	until := time.Now().Add(time.Minute)
+	if err := RecordKeyHealth(id, KeyHealth{Provider: "groq", Label: KeyLabel("gsk-secret"), CooldownUntil: until, Failures: 1}); err != nil {
+		t.Fatalf("RecordKeyHealth() error: %v", err)
+	}
+
+	health, err := LoadKeyHealth()
+	if err != nil {
+		t.Fatalf("LoadKeyHealth() error: %v", err)
+	}
+	h := health[id]
+	if h == nil || !h.CoolingDown() || h.Label != "key …cret" {
+		t.Errorf("health = %+v", h)
+	}
+}
@@ -17,12 +17,25 @@ type Channel interface {
 	IsAllowed(senderID string) bool
 }
 
+// IdentityResolver maps a channel account to its canonical user ID.
+type IdentityResolver interface {
+	Resolve(channel, senderID string) string
+}
+
+// ReasoningRenderer is implemented by channels that can show model reasoning
+// as a collapsed or spoiler message. Other channels get it as a plain message
+// with a heading.
+type ReasoningRenderer interface {
+	CollapsesReasoning() bool
+}
+
 type BaseChannel struct {
-	config    interface{}
-	bus       *bus.MessageBus
-	running   bool
-	name      string
-	allowList []string
+	config     interface{}
+	bus        *bus.MessageBus
+	running    bool
+	name       string
+	allowList  []string
+	identities IdentityResolver
 }
 
 func NewBaseChannel(name string, config interface{}, bus *bus.MessageBus, allowList []string) *BaseChannel {
@@ -43,11 +56,26 @@ func (c *BaseChannel) IsRunning() bool {
 	return c.running
 }
 
+// SetIdentityResolver lets allow-list entries name canonical user IDs, so an
+// account linked to an allowed user is admitted on this channel too.
+func (c *BaseChannel) SetIdentityResolver(resolver IdentityResolver) {
+	c.identities = resolver
+}
+
+// IsAllowed reports whether the sender is on the allow-list. Once accounts
+// are linked, an entry admits the other accounts only in the canonical
+// user ID form, e.g. "telegram_123456", not as the channel's own ID.
 func (c *BaseChannel) IsAllowed(senderID string) bool {
 	if len(c.allowList) == 0 {
 		return true
 	}
 
+	// Canonical user ID of linked accounts, e.g. "telegram_123456"
+	userID := ""
+	if c.identities != nil {
+		userID = c.identities.Resolve(c.name, senderID)
+	}
+
 	// Extract parts from compound senderID like "123456|username"
 	idPart := senderID
 	userPart := ""
@@ -74,7 +102,8 @@ func (c *BaseChannel) IsAllowed(senderID string) bool {
 			idPart == trimmed ||
 			idPart == allowedID ||
 			(allowedUser != "" && senderID == allowedUser) ||
-			(userPart != "" && (userPart == allowed || userPart == trimmed || userPart == allowedUser)) {
+			(userPart != "" && (userPart == allowed || userPart == trimmed || userPart == allowedUser)) ||
+			(userID != "" && userID == trimmed) {
 			return true
 		}
 	}
@@ -82,8 +111,16 @@ func (c *BaseChannel) IsAllowed(senderID string) bool {
 	return false
 }
 
+// isLinkRedemption reports whether content redeems a link code ("/link
+// <code>"). Such messages get past the allow-list so that a new account can
+// be linked to an allowed one; issuing codes still requires being allowed.
+func isLinkRedemption(content string) bool {
+	fields := strings.Fields(content)
+	return len(fields) == 2 && fields[0] == "/link"
+}
+
 func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []string, metadata map[string]string) {
-	if !c.IsAllowed(senderID) {
+	if !c.IsAllowed(senderID) && !(c.identities != nil && isLinkRedemption(content)) {
 		return
 	}
 
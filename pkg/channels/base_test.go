@@ -1,6 +1,12 @@
 package channels
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
 
 func TestBaseChannelIsAllowed(t *testing.T) {
 	tests := []struct {
@@ -50,3 +56,54 @@ func TestBaseChannelIsAllowed(t *testing.T) {
 		})
 	}
 }
+
+type staticResolver map[string]string
+
+func (r staticResolver) Resolve(channel, senderID string) string {
+	return r[channel+":"+senderID]
+}
+
+func TestBaseChannelIsAllowed_CanonicalUserID(t *testing.T) {
+	ch := NewBaseChannel("slack", nil, nil, []string{"telegram_123456"})
+	if ch.IsAllowed("U0001") {
+		t.Fatal("linked account should be denied without an identity resolver")
+	}
+
+	ch.SetIdentityResolver(staticResolver{"slack:U0001": "telegram_123456"})
+	if !ch.IsAllowed("U0001") {
+		t.Fatal("account linked to an allowed user ID should be allowed")
+	}
+	if ch.IsAllowed("U0002") {
+		t.Fatal("unlinked account should be denied")
+	}
+}
+
+func TestBaseChannelHandleMessage_LinkRedemption(t *testing.T) {
+	mb := bus.NewMessageBus()
+	ch := NewBaseChannel("slack", nil, mb, []string{"telegram_123456"})
+
+	received := func() (string, bool) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		msg, ok := mb.ConsumeInbound(ctx)
+		return msg.Content, ok
+	}
+
+	ch.HandleMessage("U0002", "C1", "/link ABC234", nil, nil)
+	if _, ok := received(); ok {
+		t.Fatal("link redemption should be dropped when linking is not set up")
+	}
+
+	ch.SetIdentityResolver(staticResolver{})
+	ch.HandleMessage("U0002", "C1", "/link ABC234", nil, nil)
+	if content, ok := received(); !ok || content != "/link ABC234" {
+		t.Fatalf("expected the link redemption to reach the agent, got %q", content)
+	}
+
+	for _, content := range []string{"/link", "hello", "/link ABC234 extra"} {
+		ch.HandleMessage("U0002", "C1", content, nil, nil)
+		if got, ok := received(); ok {
+			t.Errorf("message %q from a sender not on the allow-list should be dropped", got)
+		}
+	}
+}
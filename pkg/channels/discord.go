@@ -106,6 +106,11 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 		return fmt.Errorf("channel ID is empty")
 	}
 
+	// Reasoning arrives before the reply, so keep typing and hide it behind spoilers
+	if msg.Reasoning {
+		return c.sendReasoning(ctx, channelID, msg.Content)
+	}
+
 	// Stop typing indicator for this channel
 	c.stopTyping(channelID)
 
@@ -125,6 +130,25 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 	return nil
 }
 
+// CollapsesReasoning reports that reasoning is rendered as spoiler text.
+func (c *DiscordChannel) CollapsesReasoning() bool {
+	return true
+}
+
+func (c *DiscordChannel) sendReasoning(ctx context.Context, channelID, text string) error {
+	// A literal "||" would close the spoiler early
+	text = strings.ReplaceAll(text, "||", "| |")
+	if err := c.sendChunk(ctx, channelID, "💭 **Reasoning**"); err != nil {
+		return err
+	}
+	for _, chunk := range splitMessage(text, 1500) {
+		if err := c.sendChunk(ctx, channelID, "||"+chunk+"||"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // splitMessage splits long messages into chunks, preserving code block integrity
 // Uses natural boundaries (newlines, spaces) and extends messages slightly to avoid breaking code blocks
 func splitMessage(content string, limit int) []string {
@@ -285,6 +285,12 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 				continue
 			}
 
+			if msg.Reasoning {
+				if r, ok := channel.(ReasoningRenderer); !ok || !r.CollapsesReasoning() {
+					msg.Content = "💭 Reasoning:\n" + msg.Content
+				}
+			}
+
 			if err := channel.Send(ctx, msg); err != nil {
 				logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
 					"channel": msg.Channel,
@@ -295,6 +301,19 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 	}
 }
 
+// SetIdentityResolver passes the identity registry to every channel that
+// supports canonical user IDs in its allow-list.
+func (m *Manager) SetIdentityResolver(resolver IdentityResolver) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, channel := range m.channels {
+		if c, ok := channel.(interface{ SetIdentityResolver(IdentityResolver) }); ok {
+			c.SetIdentityResolver(resolver)
+		}
+	}
+}
+
 func (m *Manager) GetChannel(name string) (Channel, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
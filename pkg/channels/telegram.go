@@ -149,6 +149,11 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		return fmt.Errorf("invalid chat ID: %w", err)
 	}
 
+	// Reasoning arrives before the reply, so keep the placeholder and animation for it
+	if msg.Reasoning {
+		return c.sendReasoning(ctx, chatID, msg.Content)
+	}
+
 	// Stop thinking animation
 	if stop, ok := c.stopThinking.Load(msg.ChatID); ok {
 		if cf, ok := stop.(*thinkingCancel); ok && cf != nil {
@@ -186,6 +191,21 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	return nil
 }
 
+// CollapsesReasoning reports that reasoning is rendered as an expandable quote.
+func (c *TelegramChannel) CollapsesReasoning() bool {
+	return true
+}
+
+func (c *TelegramChannel) sendReasoning(ctx context.Context, chatID int64, text string) error {
+	// Escaping can grow the text, so leave room under Telegram's 4096 character limit
+	text = utils.Truncate(text, 3000)
+	tgMsg := tu.Message(tu.ID(chatID), "<b>💭 Reasoning</b>\n<blockquote expandable>"+escapeHTML(text)+"</blockquote>")
+	tgMsg.ParseMode = telego.ModeHTML
+
+	_, err := c.bot.SendMessage(ctx, tgMsg)
+	return err
+}
+
 func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Message) error {
 	if message == nil {
 		return fmt.Errorf("message is nil")
@@ -0,0 +1,376 @@
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// DirName is the store directory in the workspace. It is hidden, and the
+// grep and glob tools skip it, so snapshots do not turn up in searches.
+const DirName = ".checkpoints"
+
+// legacyDirName is where earlier versions kept the store.
+const legacyDirName = "checkpoints"
+
+// maxFileSize is the largest file that is snapshotted.
+const maxFileSize = 10 << 20
+
+// ErrNoCheckpoint is returned by Undo when a chat has no file changes left
+// to revert.
+var ErrNoCheckpoint = errors.New("no file changes to undo")
+
+// Checkpoint holds the files changed in one agent turn of a chat, as they
+// were before the turn changed them.
+type Checkpoint struct {
+	ID      int         `json:"id"`
+	Session string      `json:"session"`
+	Created time.Time   `json:"created"`
+	Files   []FileState `json:"files"`
+}
+
+// FileState is a file before the turn changed it. An empty Hash means the
+// file did not exist.
+type FileState struct {
+	Path string      `json:"path"`
+	Hash string      `json:"hash,omitempty"`
+	Mode os.FileMode `json:"mode,omitempty"`
+	Size int64       `json:"size,omitempty"`
+}
+
+type index struct {
+	NextID      int           `json:"next_id"`
+	Checkpoints []*Checkpoint `json:"checkpoints"`
+}
+
+// Store snapshots files before the agent changes them, one checkpoint per
+// turn and chat. Contents are stored once per SHA-256 under
+// .checkpoints/objects in the workspace.
+type Store struct {
+	dir       string
+	indexFile string
+	maxTurns  int
+	maxBytes  int64
+	mu        sync.Mutex
+	index     index
+	open      map[string]int // Checkpoint ID of the current turn per session
+}
+
+// NewStore opens the checkpoint store of workspace. A store left in
+// checkpoints/ by earlier versions is moved to .checkpoints/ first.
+func NewStore(workspace string, cfg *config.CheckpointConfig) *Store {
+	dir := filepath.Join(workspace, DirName)
+	migrate(filepath.Join(workspace, legacyDirName), dir)
+	s := &Store{
+		dir:       dir,
+		indexFile: filepath.Join(dir, "index.json"),
+		maxTurns:  cfg.MaxTurns,
+		maxBytes:  int64(cfg.MaxStoreMB) << 20,
+		index:     index{NextID: 1},
+		open:      make(map[string]int),
+	}
+	if data, err := os.ReadFile(s.indexFile); err == nil {
+		json.Unmarshal(data, &s.index)
+	}
+	return s
+}
+
+// migrate renames the store at legacy to dir unless dir already exists.
+func migrate(legacy, dir string) {
+	if _, err := os.Stat(filepath.Join(legacy, "index.json")); err != nil {
+		return
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return
+	}
+	if err := os.Rename(legacy, dir); err != nil {
+		logger.WarnCF("checkpoint", "Failed to move the checkpoint store", map[string]interface{}{"from": legacy, "to": dir, "error": err.Error()})
+		return
+	}
+	logger.InfoCF("checkpoint", "Moved the checkpoint store", map[string]interface{}{"from": legacy, "to": dir})
+}
+
+// Begin starts a new turn of session. The first file snapshotted after it
+// opens a new checkpoint.
+func (s *Store) Begin(session string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.open, session)
+}
+
+// Snapshot records path as it is now in the checkpoint of the current turn
+// of session, unless the turn already recorded it.
+func (s *Store) Snapshot(session, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(s.dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := s.find(s.open[session])
+	if cp != nil {
+		for _, f := range cp.Files {
+			if f.Path == path {
+				return nil
+			}
+		}
+	}
+
+	state := FileState{Path: path}
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	case info.IsDir():
+		return nil
+	case info.Size() > maxFileSize:
+		return fmt.Errorf("%s is larger than %d MB and cannot be checkpointed", path, maxFileSize>>20)
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if state.Hash, err = s.store(data); err != nil {
+			return err
+		}
+		state.Mode, state.Size = info.Mode().Perm(), int64(len(data))
+	}
+
+	if cp == nil {
+		cp = &Checkpoint{ID: s.index.NextID, Session: session, Created: time.Now()}
+		s.index.NextID++
+		s.index.Checkpoints = append(s.index.Checkpoints, cp)
+		s.open[session] = cp.ID
+	}
+	cp.Files = append(cp.Files, state)
+	s.prune()
+	return s.save()
+}
+
+// Undo restores the files of the newest checkpoint of session and removes
+// the checkpoint.
+func (s *Store) Undo(session string) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var cp *Checkpoint
+	for i := len(s.index.Checkpoints) - 1; i >= 0; i-- {
+		if s.index.Checkpoints[i].Session == session {
+			cp = s.index.Checkpoints[i]
+			break
+		}
+	}
+	if cp == nil {
+		return nil, ErrNoCheckpoint
+	}
+
+	var errs []error
+	for i := len(cp.Files) - 1; i >= 0; i-- {
+		if err := s.restore(cp.Files[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		// Keep the checkpoint so the undo can be retried
+		return nil, errors.Join(errs...)
+	}
+
+	s.remove(cp)
+	return cp, s.save()
+}
+
+// List returns the checkpoints of session, newest first.
+func (s *Store) List(session string) []Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var list []Checkpoint
+	for i := len(s.index.Checkpoints) - 1; i >= 0; i-- {
+		if cp := s.index.Checkpoints[i]; cp.Session == session {
+			c := *cp
+			c.Files = append([]FileState(nil), cp.Files...)
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+func (s *Store) restore(f FileState) error {
+	if f.Hash == "" {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", f.Path, err)
+		}
+		return nil
+	}
+	data, err := os.ReadFile(s.objectPath(f.Hash))
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot of %s: %w", f.Path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", f.Path, err)
+	}
+	if err := os.WriteFile(f.Path, data, f.Mode); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", f.Path, err)
+	}
+	return os.Chmod(f.Path, f.Mode)
+}
+
+func (s *Store) find(id int) *Checkpoint {
+	for _, cp := range s.index.Checkpoints {
+		if cp.ID == id {
+			return cp
+		}
+	}
+	return nil
+}
+
+func (s *Store) objectPath(hash string) string {
+	return filepath.Join(s.dir, "objects", hash[:2], hash)
+}
+
+// store writes data to the object store and returns its hash.
+func (s *Store) store(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	p := s.objectPath(hash)
+	if _, err := os.Stat(p); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return hash, nil
+}
+
+// prune drops checkpoints beyond the per-session turn limit and then the
+// oldest ones until the stored contents fit the size limit. Must be called
+// with the lock held.
+func (s *Store) prune() {
+	if s.maxTurns > 0 {
+		counts := make(map[string]int)
+		for i := len(s.index.Checkpoints) - 1; i >= 0; i-- {
+			cp := s.index.Checkpoints[i]
+			counts[cp.Session]++
+			if counts[cp.Session] > s.maxTurns {
+				s.remove(cp)
+			}
+		}
+	}
+	if s.maxBytes > 0 {
+		for len(s.index.Checkpoints) > 1 && s.size() > s.maxBytes {
+			s.remove(s.index.Checkpoints[0])
+		}
+	}
+}
+
+// size returns the bytes used by the objects the checkpoints refer to.
+func (s *Store) size() int64 {
+	seen := make(map[string]bool)
+	var total int64
+	for _, cp := range s.index.Checkpoints {
+		for _, f := range cp.Files {
+			if f.Hash != "" && !seen[f.Hash] {
+				seen[f.Hash] = true
+				total += f.Size
+			}
+		}
+	}
+	return total
+}
+
+// remove drops cp and deletes the objects no other checkpoint refers to.
+// Must be called with the lock held.
+func (s *Store) remove(cp *Checkpoint) {
+	for i, c := range s.index.Checkpoints {
+		if c == cp {
+			s.index.Checkpoints = append(s.index.Checkpoints[:i], s.index.Checkpoints[i+1:]...)
+			break
+		}
+	}
+	if s.open[cp.Session] == cp.ID {
+		delete(s.open, cp.Session)
+	}
+
+	used := make(map[string]bool)
+	for _, c := range s.index.Checkpoints {
+		for _, f := range c.Files {
+			used[f.Hash] = true
+		}
+	}
+	for _, f := range cp.Files {
+		if f.Hash != "" && !used[f.Hash] {
+			os.Remove(s.objectPath(f.Hash))
+		}
+	}
+}
+
+// save writes the index with a temp file and rename. Must be called with
+// the lock held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoints: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	tmp := s.indexFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoints: %w", err)
+	}
+	if err := os.Rename(tmp, s.indexFile); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write checkpoints: %w", err)
+	}
+	return nil
+}
+
+// Describe lists the files of cp relative to workspace, marking files the
+// turn created.
+func (cp Checkpoint) Describe(workspace string) string {
+	names := make([]string, 0, len(cp.Files))
+	for _, f := range cp.Files {
+		name := f.Path
+		if rel, err := filepath.Rel(workspace, f.Path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+		if f.Hash == "" {
+			name += " (new)"
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// FormatList renders checkpoints for the /checkpoints command.
+func FormatList(list []Checkpoint, workspace string, now time.Time) string {
+	var sb strings.Builder
+	for _, cp := range list {
+		fmt.Fprintf(&sb, "#%d  %s ago  %s\n", cp.ID, now.Sub(cp.Created).Round(time.Second), cp.Describe(workspace))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
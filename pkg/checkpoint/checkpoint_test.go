@@ -0,0 +1,177 @@
+package checkpoint
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestStore(t *testing.T, maxTurns, maxStoreMB int) (*Store, string) {
+	t.Helper()
+	ws := t.TempDir()
+	return NewStore(ws, &config.CheckpointConfig{Enabled: true, MaxTurns: maxTurns, MaxStoreMB: maxStoreMB}), ws
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestNewStoreMovesLegacyStore(t *testing.T) {
+	s, ws := newTestStore(t, 10, 10)
+	f := filepath.Join(ws, "f.txt")
+	os.WriteFile(f, []byte("v1"), 0644)
+	s.Begin("a")
+	s.Snapshot("a", f)
+	os.WriteFile(f, []byte("v2"), 0644)
+
+	// Earlier versions kept the store in checkpoints/
+	if err := os.Rename(filepath.Join(ws, DirName), filepath.Join(ws, "checkpoints")); err != nil {
+		t.Fatal(err)
+	}
+
+	s = NewStore(ws, &config.CheckpointConfig{MaxTurns: 10})
+	if _, err := os.Stat(filepath.Join(ws, "checkpoints")); !os.IsNotExist(err) {
+		t.Errorf("expected the old store to be moved, got %v", err)
+	}
+	if _, err := s.Undo("a"); err != nil {
+		t.Fatalf("Undo after the move: %v", err)
+	}
+	if got := readFile(t, f); got != "v1" {
+		t.Errorf("f = %q, want v1", got)
+	}
+}
+
+func TestUndoRestoresTurn(t *testing.T) {
+	s, ws := newTestStore(t, 10, 10)
+	existing := filepath.Join(ws, "notes.md")
+	created := filepath.Join(ws, "sub", "new.txt")
+	os.WriteFile(existing, []byte("original"), 0600)
+
+	s.Begin("telegram:1")
+	if err := s.Snapshot("telegram:1", existing); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(existing, []byte("first edit"), 0600)
+	// Only the state before the first change of a turn is kept
+	s.Snapshot("telegram:1", existing)
+	os.WriteFile(existing, []byte("second edit"), 0600)
+	s.Snapshot("telegram:1", created)
+	os.MkdirAll(filepath.Dir(created), 0755)
+	os.WriteFile(created, []byte("new"), 0644)
+
+	list := s.List("telegram:1")
+	if len(list) != 1 || len(list[0].Files) != 2 {
+		t.Fatalf("expected one checkpoint with two files, got %+v", list)
+	}
+	if got := list[0].Describe(ws); got != "notes.md, sub/new.txt (new)" {
+		t.Errorf("Describe = %q", got)
+	}
+
+	cp, err := s.Undo("telegram:1")
+	if err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if cp.ID != list[0].ID {
+		t.Errorf("undid checkpoint %d, want %d", cp.ID, list[0].ID)
+	}
+	if got := readFile(t, existing); got != "original" {
+		t.Errorf("notes.md = %q, want original", got)
+	}
+	if info, _ := os.Stat(existing); info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("expected created file to be removed")
+	}
+	if _, err := s.Undo("telegram:1"); !errors.Is(err, ErrNoCheckpoint) {
+		t.Errorf("expected ErrNoCheckpoint, got %v", err)
+	}
+	// Objects nobody refers to are deleted
+	objects, _ := filepath.Glob(filepath.Join(ws, DirName, "objects", "*", "*"))
+	if len(objects) != 0 {
+		t.Errorf("expected the object store to be empty, got %v", objects)
+	}
+}
+
+func TestTurnsAndSessions(t *testing.T) {
+	s, ws := newTestStore(t, 10, 10)
+	f := filepath.Join(ws, "f.txt")
+	os.WriteFile(f, []byte("v1"), 0644)
+
+	s.Begin("a")
+	s.Snapshot("a", f)
+	os.WriteFile(f, []byte("v2"), 0644)
+	s.Begin("a")
+	s.Snapshot("a", f)
+	os.WriteFile(f, []byte("v3"), 0644)
+	s.Begin("b")
+	s.Snapshot("b", filepath.Join(ws, "other.txt"))
+
+	if n := len(s.List("a")); n != 2 {
+		t.Fatalf("expected 2 checkpoints for a, got %d", n)
+	}
+	if n := len(s.List("b")); n != 1 {
+		t.Fatalf("expected 1 checkpoint for b, got %d", n)
+	}
+
+	// Undo goes back one turn at a time
+	s.Undo("a")
+	if got := readFile(t, f); got != "v2" {
+		t.Errorf("after one undo f = %q, want v2", got)
+	}
+	s.Undo("a")
+	if got := readFile(t, f); got != "v1" {
+		t.Errorf("after two undos f = %q, want v1", got)
+	}
+
+	// The index survives a restart
+	if n := len(NewStore(ws, &config.CheckpointConfig{MaxTurns: 10}).List("b")); n != 1 {
+		t.Errorf("expected 1 checkpoint for b after reload, got %d", n)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	s, ws := newTestStore(t, 2, 1)
+	f := filepath.Join(ws, "f.txt")
+	for i := 0; i < 4; i++ {
+		os.WriteFile(f, []byte{byte('a' + i)}, 0644)
+		s.Begin("a")
+		s.Snapshot("a", f)
+	}
+	list := s.List("a")
+	if len(list) != 2 || list[0].ID != 4 || list[1].ID != 3 {
+		t.Fatalf("expected the newest 2 checkpoints, got %+v", list)
+	}
+
+	// Large snapshots push out the oldest checkpoints to fit max_store_mb
+	big := filepath.Join(ws, "big.bin")
+	for i := 0; i < 3; i++ {
+		os.WriteFile(big, []byte(strings.Repeat(string(rune('x'+i)), 400<<10)), 0644)
+		s.Begin("b")
+		s.Snapshot("b", big)
+	}
+	if size := s.size(); size > 1<<20 {
+		t.Errorf("store holds %d bytes, more than 1 MB", size)
+	}
+	if n := len(s.List("b")); n != 2 {
+		t.Errorf("expected 2 checkpoints for b, got %d", n)
+	}
+}
+
+func TestFormatList(t *testing.T) {
+	now := time.Now()
+	list := []Checkpoint{{ID: 3, Created: now.Add(-90 * time.Second), Files: []FileState{{Path: "/ws/a.go", Hash: "x"}}}}
+	if got := FormatList(list, "/ws", now); got != "#3  1m30s ago  a.go" {
+		t.Errorf("FormatList = %q", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/caarlos0/env/v11"
@@ -66,6 +67,14 @@ type AgentDefaults struct {
 	MaxTokens           int     `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
 	Temperature         float64 `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
 	MaxToolIterations   int     `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	IsolateUsers        bool    `json:"isolate_users" env:"PICOCLAW_AGENTS_DEFAULTS_ISOLATE_USERS"`
+	LinkedSessions      bool    `json:"linked_sessions" env:"PICOCLAW_AGENTS_DEFAULTS_LINKED_SESSIONS"`
+	ThinkingBudget      int     `json:"thinking_budget" env:"PICOCLAW_AGENTS_DEFAULTS_THINKING_BUDGET"`
+	ShowReasoning       bool    `json:"show_reasoning" env:"PICOCLAW_AGENTS_DEFAULTS_SHOW_REASONING"`
+	// SandboxProfile names the tools.exec.sandbox profile of the main agent
+	// and SubagentSandboxProfile that of subagents (the main one if empty).
+	SandboxProfile         string `json:"sandbox_profile,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_SANDBOX_PROFILE"`
+	SubagentSandboxProfile string `json:"subagent_sandbox_profile,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_SUBAGENT_SANDBOX_PROFILE"`
 }
 
 type ChannelsConfig struct {
@@ -191,27 +200,123 @@ type DevicesConfig struct {
 }
 
 type ProvidersConfig struct {
+	// List declares providers by wire protocol. Models are addressed as
+	// "<name>/<model>"; the vendor fields below remain as a compatibility shim.
+	List          []ProviderEntry      `json:"list,omitempty"`
 	Anthropic     ProviderConfig       `json:"anthropic"`
 	OpenAI        OpenAIProviderConfig `json:"openai"`
 	OpenRouter    ProviderConfig       `json:"openrouter"`
 	Groq          ProviderConfig       `json:"groq"`
 	Zhipu         ProviderConfig       `json:"zhipu"`
-	VLLM          ProviderConfig       `json:"vllm"`
-	Gemini        ProviderConfig       `json:"gemini"`
+	VLLM          VLLMProviderConfig   `json:"vllm"`
+	Gemini        GeminiProviderConfig `json:"gemini"`
 	Nvidia        ProviderConfig       `json:"nvidia"`
-	Ollama        ProviderConfig       `json:"ollama"`
+	Ollama        OllamaProviderConfig `json:"ollama"`
 	Moonshot      ProviderConfig       `json:"moonshot"`
 	ShengSuanYun  ProviderConfig       `json:"shengsuanyun"`
 	DeepSeek      ProviderConfig       `json:"deepseek"`
 	GitHubCopilot ProviderConfig       `json:"github_copilot"`
+	Azure         AzureProviderConfig  `json:"azure"`
+	Mock          MockProviderConfig   `json:"mock"`
+	// RateLimit applies to the provider chosen from the vendor fields and to
+	// providers.list entries without their own rate_limit.
+	RateLimit RateLimitConfig `json:"rate_limit"`
+}
+
+// Vendors returns the vendor provider settings by their config name.
+func (p ProvidersConfig) Vendors() map[string]ProviderConfig {
+	return map[string]ProviderConfig{
+		"anthropic":      p.Anthropic,
+		"openai":         p.OpenAI.ProviderConfig,
+		"openrouter":     p.OpenRouter,
+		"groq":           p.Groq,
+		"zhipu":          p.Zhipu,
+		"vllm":           p.VLLM.ProviderConfig,
+		"gemini":         p.Gemini.ProviderConfig,
+		"nvidia":         p.Nvidia,
+		"ollama":         p.Ollama.ProviderConfig,
+		"moonshot":       p.Moonshot,
+		"shengsuanyun":   p.ShengSuanYun,
+		"deepseek":       p.DeepSeek,
+		"github_copilot": p.GitHubCopilot,
+	}
+}
+
+// RateLimitConfig throttles requests to one provider and sets when its
+// circuit breaker opens. Zero values disable a limit or pick the default.
+type RateLimitConfig struct {
+	RequestsPerMinute int `json:"requests_per_minute" env:"PICOCLAW_PROVIDERS_RATE_LIMIT_REQUESTS_PER_MINUTE"`
+	TokensPerMinute   int `json:"tokens_per_minute" env:"PICOCLAW_PROVIDERS_RATE_LIMIT_TOKENS_PER_MINUTE"`
+	FailureThreshold  int `json:"failure_threshold" env:"PICOCLAW_PROVIDERS_RATE_LIMIT_FAILURE_THRESHOLD"` // consecutive failures that open the circuit, default 5
+	CooldownSeconds   int `json:"cooldown_seconds" env:"PICOCLAW_PROVIDERS_RATE_LIMIT_COOLDOWN_SECONDS"`   // time the circuit stays open, default 30
+}
+
+// ProviderEntry is one named endpoint in providers.list.
+type ProviderEntry struct {
+	Name     string            `json:"name"`
+	Protocol string            `json:"protocol"` // openai-chat, openai-responses, anthropic, gemini, ollama or cli
+	APIBase  string            `json:"api_base,omitempty"`
+	APIKey   string            `json:"api_key,omitempty"`
+	APIKeys  []string          `json:"api_keys,omitempty"` // rotated together with APIKey, see ProviderConfig
+	Proxy    string            `json:"proxy,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Models   []string          `json:"models,omitempty"`
+	Command  string            `json:"command,omitempty"` // only for the cli protocol, `claude` (default) or `codex`
+	// PromptCacheKey sends prompt_cache_key with openai-chat requests; enable
+	// it only for servers that accept the field.
+	PromptCacheKey bool `json:"prompt_cache_key,omitempty"`
+	// RateLimit overrides providers.rate_limit for this entry.
+	RateLimit *RateLimitConfig `json:"rate_limit,omitempty"`
+	// ToolProtocols picks how openai-chat models get tools: "native" (the
+	// tools field) or "prompted" (described in the system prompt). Keys are
+	// model IDs, "*" matches any model.
+	ToolProtocols map[string]string `json:"tool_protocols,omitempty"`
+	KeyRotation   string            `json:"key_rotation,omitempty"`
+}
+
+// Keys returns APIKey followed by APIKeys, without blanks or duplicates.
+func (e ProviderEntry) Keys() []string {
+	return uniqueKeys(append([]string{e.APIKey}, e.APIKeys...))
 }
 
 type ProviderConfig struct {
-	APIKey      string `json:"api_key" env:"PICOCLAW_PROVIDERS_{{.Name}}_API_KEY"`
+	APIKey string `json:"api_key" env:"PICOCLAW_PROVIDERS_{{.Name}}_API_KEY"`
+	// APIKeys are extra keys used together with APIKey to spread quota.
+	APIKeys []string `json:"api_keys,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_API_KEYS"`
+	// KeyRotation is "round-robin" (default) to spread requests over the
+	// keys, or "failover" to stay on one key until it is rate limited.
+	KeyRotation string `json:"key_rotation,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_KEY_ROTATION"`
 	APIBase     string `json:"api_base" env:"PICOCLAW_PROVIDERS_{{.Name}}_API_BASE"`
 	Proxy       string `json:"proxy,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_PROXY"`
 	AuthMethod  string `json:"auth_method,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_AUTH_METHOD"`
 	ConnectMode string `json:"connect_mode,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_CONNECT_MODE"` //only for Github Copilot, `stdio` or `grpc`
+	// OAuthClientID is the client ID of an OAuth app registered with the
+	// provider, used by `picoclaw auth login` where no public one exists.
+	OAuthClientID string `json:"oauth_client_id,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_OAUTH_CLIENT_ID"`
+}
+
+// Keys returns APIKey followed by APIKeys, without blanks or duplicates.
+func (c ProviderConfig) Keys() []string {
+	return uniqueKeys(append([]string{c.APIKey}, c.APIKeys...))
+}
+
+// HasAPIKey reports whether any key is configured.
+func (c ProviderConfig) HasAPIKey() bool {
+	return len(c.Keys()) > 0
+}
+
+func uniqueKeys(keys []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		k = strings.TrimSpace(k)
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, k)
+	}
+	return out
 }
 
 type OpenAIProviderConfig struct {
@@ -219,6 +324,57 @@ type OpenAIProviderConfig struct {
 	WebSearch bool `json:"web_search" env:"PICOCLAW_PROVIDERS_OPENAI_WEB_SEARCH"`
 }
 
+// VLLMProviderConfig configures a local OpenAI-compatible server (vLLM,
+// llama.cpp, LM Studio, ...).
+type VLLMProviderConfig struct {
+	ProviderConfig
+	// ToolProtocols marks models served without function calling as
+	// "prompted"; see ProviderEntry.ToolProtocols.
+	ToolProtocols map[string]string `json:"tool_protocols,omitempty"`
+}
+
+type OllamaProviderConfig struct {
+	ProviderConfig
+	// KeepAlive controls how long Ollama keeps the model loaded, e.g. "10m" or "-1".
+	KeepAlive string `json:"keep_alive,omitempty" env:"PICOCLAW_PROVIDERS_OLLAMA_KEEP_ALIVE"`
+	// NumCtx overrides the model's context window size when set.
+	NumCtx int `json:"num_ctx,omitempty" env:"PICOCLAW_PROVIDERS_OLLAMA_NUM_CTX"`
+}
+
+// AzureProviderConfig configures Azure OpenAI, which addresses models by
+// deployment name and authenticates with an api-key or an Entra ID token.
+type AzureProviderConfig struct {
+	Endpoint   string `json:"endpoint" env:"PICOCLAW_PROVIDERS_AZURE_ENDPOINT"` // e.g. https://myresource.openai.azure.com
+	APIKey     string `json:"api_key" env:"PICOCLAW_PROVIDERS_AZURE_API_KEY"`
+	APIVersion string `json:"api_version,omitempty" env:"PICOCLAW_PROVIDERS_AZURE_API_VERSION"`
+	// Deployments maps model names to deployment names; unmapped models are
+	// used as the deployment name.
+	Deployments map[string]string `json:"deployments,omitempty"`
+	// TokenFile holds an Entra ID (AAD) access token, re-read on every
+	// request so an external refresher can rotate it. Used instead of api_key.
+	TokenFile string `json:"token_file,omitempty" env:"PICOCLAW_PROVIDERS_AZURE_TOKEN_FILE"`
+	Proxy     string `json:"proxy,omitempty" env:"PICOCLAW_PROVIDERS_AZURE_PROXY"`
+}
+
+// MockProviderConfig configures the offline mock provider. Without a script
+// it echoes the user's message back.
+type MockProviderConfig struct {
+	// Script is a JSON rules file; relative paths are resolved against the workspace.
+	Script string `json:"script,omitempty" env:"PICOCLAW_PROVIDERS_MOCK_SCRIPT"`
+}
+
+type GeminiProviderConfig struct {
+	ProviderConfig
+	SafetySettings []GeminiSafetySetting `json:"safety_settings,omitempty"`
+}
+
+// GeminiSafetySetting maps to a Gemini API safetySettings entry, e.g.
+// {"category": "HARM_CATEGORY_HARASSMENT", "threshold": "BLOCK_ONLY_HIGH"}.
+type GeminiSafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
 type GatewayConfig struct {
 	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
 	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
@@ -241,10 +397,22 @@ type PerplexityConfig struct {
 	MaxResults int    `json:"max_results" env:"PICOCLAW_TOOLS_WEB_PERPLEXITY_MAX_RESULTS"`
 }
 
+// SearXNGConfig points web_search at a self-hosted SearXNG instance with
+// the JSON format enabled.
+type SearXNGConfig struct {
+	Enabled    bool   `json:"enabled" env:"PICOCLAW_TOOLS_WEB_SEARXNG_ENABLED"`
+	BaseURL    string `json:"base_url" env:"PICOCLAW_TOOLS_WEB_SEARXNG_BASE_URL"`
+	MaxResults int    `json:"max_results" env:"PICOCLAW_TOOLS_WEB_SEARXNG_MAX_RESULTS"`
+}
+
 type WebToolsConfig struct {
 	Brave      BraveConfig      `json:"brave"`
 	DuckDuckGo DuckDuckGoConfig `json:"duckduckgo"`
 	Perplexity PerplexityConfig `json:"perplexity"`
+	SearXNG    SearXNGConfig    `json:"searxng"`
+	// CacheTTLMinutes keeps search results in the workspace for this long
+	// so repeated searches do not call the provider again; 0 disables it.
+	CacheTTLMinutes int `json:"cache_ttl_minutes" env:"PICOCLAW_TOOLS_WEB_CACHE_TTL_MINUTES"`
 }
 
 type CronToolsConfig struct {
@@ -252,14 +420,79 @@ type CronToolsConfig struct {
 }
 
 type ExecConfig struct {
+	// EnableDenyPatterns turns the built-in command policy and the custom
+	// deny patterns on.
 	EnableDenyPatterns bool     `json:"enable_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_ENABLE_DENY_PATTERNS"`
 	CustomDenyPatterns []string `json:"custom_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_CUSTOM_DENY_PATTERNS"`
+	// AllowedCommands, when set, lists the only executables commands may
+	// run; DeniedCommands are never run.
+	AllowedCommands []string          `json:"allowed_commands,omitempty" env:"PICOCLAW_TOOLS_EXEC_ALLOWED_COMMANDS"`
+	DeniedCommands  []string          `json:"denied_commands,omitempty" env:"PICOCLAW_TOOLS_EXEC_DENIED_COMMANDS"`
+	Sandbox         ExecSandboxConfig `json:"sandbox"`
+}
+
+// ProcessConfig limits the background processes started by the process
+// tool.
+type ProcessConfig struct {
+	MaxPerSession int `json:"max_per_session" env:"PICOCLAW_TOOLS_PROCESS_MAX_PER_SESSION"`
+	// BufferKB is the stdout and stderr kept per process; older output is dropped.
+	BufferKB int `json:"buffer_kb" env:"PICOCLAW_TOOLS_PROCESS_BUFFER_KB"`
+	// SessionTimeoutMinutes kills the processes of a chat that has been
+	// idle this long; 0 keeps them until picoclaw exits.
+	SessionTimeoutMinutes int `json:"session_timeout_minutes" env:"PICOCLAW_TOOLS_PROCESS_SESSION_TIMEOUT_MINUTES"`
+}
+
+// ExecSandboxConfig runs exec commands in a kernel sandbox on Linux.
+type ExecSandboxConfig struct {
+	// Mode is "auto" (sandbox when the kernel supports it, otherwise fall
+	// back to the command policy alone), "required" (refuse to run commands
+	// without it) or "off".
+	Mode string `json:"mode" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_MODE"`
+	// Profiles add to or override the built-in "default" and "strict"
+	// profiles; agents pick one with sandbox_profile.
+	Profiles map[string]SandboxProfile `json:"profiles,omitempty"`
+}
+
+// SandboxProfile sets what a sandboxed command may do besides writing to
+// the workspace. Zero limits are unlimited.
+type SandboxProfile struct {
+	Network       bool     `json:"network"`
+	WritablePaths []string `json:"writable_paths,omitempty"`
+	CPUSeconds    int      `json:"cpu_seconds"`
+	MemoryMB      int      `json:"memory_mb"`
+	MaxProcesses  int      `json:"max_processes"`
+}
+
+// CheckpointConfig controls the snapshots of files taken before the file
+// tools change them, which /undo restores.
+type CheckpointConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_CHECKPOINTS_ENABLED"`
+	// MaxTurns is the number of turns with file changes kept per chat.
+	MaxTurns int `json:"max_turns" env:"PICOCLAW_TOOLS_CHECKPOINTS_MAX_TURNS"`
+	// MaxStoreMB caps the stored file contents; the oldest checkpoints are
+	// dropped first.
+	MaxStoreMB int `json:"max_store_mb" env:"PICOCLAW_TOOLS_CHECKPOINTS_MAX_STORE_MB"`
+}
+
+// NetworkConfig controls which addresses tools that fetch URLs may reach.
+// Loopback, private, link-local and cloud metadata addresses are blocked
+// unless listed here.
+type NetworkConfig struct {
+	// AllowedHosts are IP addresses, CIDR ranges or host names, such as
+	// "192.168.1.0/24" or "nas.local".
+	AllowedHosts FlexibleStringSlice `json:"allowed_hosts" env:"PICOCLAW_TOOLS_NETWORK_ALLOWED_HOSTS"`
+	// UseProxy sends requests through the proxy set in HTTP_PROXY and
+	// HTTPS_PROXY. Targets are still checked before they reach the proxy.
+	UseProxy bool `json:"use_proxy" env:"PICOCLAW_TOOLS_NETWORK_USE_PROXY"`
 }
 
 type ToolsConfig struct {
-	Web  WebToolsConfig  `json:"web"`
-	Cron CronToolsConfig `json:"cron"`
-	Exec ExecConfig      `json:"exec"`
+	Web         WebToolsConfig   `json:"web"`
+	Cron        CronToolsConfig  `json:"cron"`
+	Exec        ExecConfig       `json:"exec"`
+	Process     ProcessConfig    `json:"process"`
+	Checkpoints CheckpointConfig `json:"checkpoints"`
+	Network     NetworkConfig    `json:"network"`
 }
 
 func DefaultConfig() *Config {
@@ -273,6 +506,7 @@ func DefaultConfig() *Config {
 				MaxTokens:           8192,
 				Temperature:         0.7,
 				MaxToolIterations:   20,
+				IsolateUsers:        false,
 			},
 		},
 		Channels: ChannelsConfig{
@@ -356,8 +590,8 @@ func DefaultConfig() *Config {
 			OpenRouter:   ProviderConfig{},
 			Groq:         ProviderConfig{},
 			Zhipu:        ProviderConfig{},
-			VLLM:         ProviderConfig{},
-			Gemini:       ProviderConfig{},
+			VLLM:         VLLMProviderConfig{},
+			Gemini:       GeminiProviderConfig{},
 			Nvidia:       ProviderConfig{},
 			Moonshot:     ProviderConfig{},
 			ShengSuanYun: ProviderConfig{},
@@ -382,12 +616,35 @@ func DefaultConfig() *Config {
 					APIKey:     "",
 					MaxResults: 5,
 				},
+				SearXNG: SearXNGConfig{
+					Enabled:    false,
+					BaseURL:    "",
+					MaxResults: 5,
+				},
+				CacheTTLMinutes: 60,
 			},
 			Cron: CronToolsConfig{
 				ExecTimeoutMinutes: 5, // default 5 minutes for LLM operations
 			},
 			Exec: ExecConfig{
 				EnableDenyPatterns: true,
+				Sandbox: ExecSandboxConfig{
+					Mode: "auto",
+				},
+			},
+			Process: ProcessConfig{
+				MaxPerSession:         8,
+				BufferKB:              64,
+				SessionTimeoutMinutes: 60,
+			},
+			Checkpoints: CheckpointConfig{
+				Enabled:    true,
+				MaxTurns:   20,
+				MaxStoreMB: 50,
+			},
+			Network: NetworkConfig{
+				AllowedHosts: FlexibleStringSlice{},
+				UseProxy:     true,
 			},
 		},
 		Heartbeat: HeartbeatConfig{
@@ -446,6 +703,22 @@ func (c *Config) WorkspacePath() string {
 	return expandHome(c.Agents.Defaults.Workspace)
 }
 
+// MockScriptPath returns the mock provider script path, resolving relative
+// paths against the workspace. It is empty when no script is configured.
+func (c *Config) MockScriptPath() string {
+	c.mu.RLock()
+	script := c.Providers.Mock.Script
+	c.mu.RUnlock()
+	if script == "" {
+		return ""
+	}
+	script = expandHome(script)
+	if !filepath.IsAbs(script) {
+		script = filepath.Join(c.WorkspacePath(), script)
+	}
+	return script
+}
+
 func (c *Config) GetAPIKey() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -494,6 +767,11 @@ func (c *Config) GetAPIBase() string {
 	return ""
 }
 
+// ExpandHome replaces a leading "~" in path with the user's home directory.
+func ExpandHome(path string) string {
+	return expandHome(path)
+}
+
 func expandHome(path string) string {
 	if path == "" {
 		return path
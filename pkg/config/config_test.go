@@ -243,3 +243,41 @@ func TestLoadConfig_OpenAIWebSearchCanBeDisabled(t *testing.T) {
 		t.Fatal("OpenAI codex web search should be false when disabled in config file")
 	}
 }
+
+func TestLoadConfig_ProvidersList(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	data := `{"providers":{
+		"list":[{"name":"myvllm","protocol":"openai-chat","api_base":"http://gpu:8000/v1","headers":{"X-Team":"a"},"models":["qwen3"]}],
+		"groq":{"api_key":"gsk_x"}
+	}}`
+	if err := os.WriteFile(configPath, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if len(cfg.Providers.List) != 1 {
+		t.Fatalf("len(Providers.List) = %d, want 1", len(cfg.Providers.List))
+	}
+	e := cfg.Providers.List[0]
+	if e.Name != "myvllm" || e.Protocol != "openai-chat" || e.Headers["X-Team"] != "a" || len(e.Models) != 1 {
+		t.Errorf("entry = %+v", e)
+	}
+	if cfg.Providers.Groq.APIKey != "gsk_x" {
+		t.Error("legacy provider fields should still be read alongside the list")
+	}
+}
+
+func TestProviderConfig_Keys(t *testing.T) {
+	pc := ProviderConfig{APIKey: "a", APIKeys: []string{" b ", "a", "", "c"}}
+	keys := pc.Keys()
+	if len(keys) != 3 || keys[0] != "a" || keys[1] != "b" || keys[2] != "c" {
+		t.Errorf("Keys() = %q, want [a b c]", keys)
+	}
+	if (ProviderConfig{APIKeys: []string{" "}}).HasAPIKey() {
+		t.Error("blank keys should not count")
+	}
+}
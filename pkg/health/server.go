@@ -14,6 +14,7 @@ type Server struct {
 	mu        sync.RWMutex
 	ready     bool
 	checks    map[string]Check
+	checkFns  map[string]func() (bool, string)
 	startTime time.Time
 }
 
@@ -35,6 +36,7 @@ func NewServer(host string, port int) *Server {
 	s := &Server{
 		ready:     false,
 		checks:    make(map[string]Check),
+		checkFns:  make(map[string]func() (bool, string)),
 		startTime: time.Now(),
 	}
 
@@ -90,11 +92,18 @@ func (s *Server) SetReady(ready bool) {
 	s.mu.Unlock()
 }
 
+// RegisterCheck records the result of checkFn now and runs it again on every /ready request.
 func (s *Server) RegisterCheck(name string, checkFn func() (bool, string)) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.checkFns[name] = checkFn
+	s.mu.Unlock()
+	s.runCheck(name, checkFn)
+}
 
+func (s *Server) runCheck(name string, checkFn func() (bool, string)) {
 	status, msg := checkFn()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.checks[name] = Check{
 		Name:      name,
 		Status:    statusString(status),
@@ -119,6 +128,16 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
+	s.mu.RLock()
+	checkFns := make(map[string]func() (bool, string), len(s.checkFns))
+	for k, v := range s.checkFns {
+		checkFns[k] = v
+	}
+	s.mu.RUnlock()
+	for name, fn := range checkFns {
+		s.runCheck(name, fn)
+	}
+
 	s.mu.RLock()
 	ready := s.ready
 	checks := make(map[string]Check)
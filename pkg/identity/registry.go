@@ -0,0 +1,366 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package identity links channel accounts (e.g. a Telegram user and a Slack
+// user) to one canonical user ID.
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// CodeTTL is how long a link code stays valid after it was issued.
+const CodeTTL = 10 * time.Minute
+
+// codeAlphabet avoids characters that are easily confused (0/O, 1/I/L).
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+const codeLength = 6
+
+// Failed redemptions are limited within CodeTTL, so that a pending code
+// cannot be guessed: per sender, across all senders, and per pending code,
+// which is dropped once it has seen maxCodeFailures wrong guesses.
+const (
+	maxSenderFailures = 5
+	maxGlobalFailures = 20
+	maxCodeFailures   = 10
+)
+
+var (
+	ErrUnknownAccount = errors.New("identity: sender cannot be linked on this channel")
+	ErrInvalidCode    = errors.New("identity: invalid or expired link code")
+	ErrSameAccount    = errors.New("identity: link code must be redeemed from a different account")
+	ErrPrimaryAccount = errors.New("identity: cannot unlink the primary account, unlink the other accounts instead")
+	ErrNotLinked      = errors.New("identity: account is not linked")
+	ErrTooManyTries   = errors.New("identity: too many failed link attempts, try again later")
+)
+
+// Normalize returns the normalized account ID for a sender, e.g.
+// "telegram_123456". Compound sender IDs like "123456|username" are reduced
+// to their stable ID part. It returns "" for internal channels and empty
+// senders, which have no user identity.
+func Normalize(channel, senderID string) string {
+	if channel == "" || senderID == "" || constants.IsInternalChannel(channel) {
+		return ""
+	}
+	if idx := strings.Index(senderID, "|"); idx > 0 {
+		senderID = senderID[:idx]
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, channel+"_"+senderID)
+}
+
+type pendingCode struct {
+	account  string
+	expires  time.Time
+	failures int
+}
+
+// registryFile is the on-disk format of the registry.
+type registryFile struct {
+	// Links maps a normalized account ID to its canonical user ID.
+	Links map[string]string `json:"links"`
+}
+
+// Registry maps channel accounts to canonical user IDs.
+// Links are persisted under <workspace>/identity/links.json; pending link
+// codes are kept in memory only.
+type Registry struct {
+	path  string
+	links map[string]string
+	codes map[string]pendingCode
+	// failures holds the times of failed redemptions per account; the ""
+	// key holds those of all accounts.
+	failures map[string][]time.Time
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+// NewRegistry creates a registry backed by the given workspace.
+func NewRegistry(workspace string) *Registry {
+	dir := filepath.Join(workspace, "identity")
+	os.MkdirAll(dir, 0755)
+
+	r := &Registry{
+		path:     filepath.Join(dir, "links.json"),
+		links:    make(map[string]string),
+		codes:    make(map[string]pendingCode),
+		failures: make(map[string][]time.Time),
+		now:      time.Now,
+	}
+	if err := r.load(); err != nil {
+		// Keep the unreadable file instead of overwriting it with the next link
+		fields := map[string]interface{}{"error": err.Error()}
+		if backup := r.path + ".corrupt"; os.Rename(r.path, backup) == nil {
+			fields["backup"] = backup
+		}
+		logger.ErrorCF("identity", "Account links could not be loaded; starting without links", fields)
+	}
+	return r
+}
+
+// Resolve returns the canonical user ID for a sender. Unlinked accounts
+// resolve to their normalized account ID; internal senders resolve to "".
+func (r *Registry) Resolve(channel, senderID string) string {
+	account := Normalize(channel, senderID)
+	if account == "" {
+		return ""
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.resolveLocked(account)
+}
+
+// IsLinked reports whether the sender is linked to at least one other account.
+func (r *Registry) IsLinked(channel, senderID string) bool {
+	account := Normalize(channel, senderID)
+	if account == "" {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.links[account]
+	return ok
+}
+
+// Accounts returns the normalized account IDs linked to a canonical user ID.
+func (r *Registry) Accounts(canonical string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var accounts []string
+	for account, id := range r.links {
+		if id == canonical {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// IssueCode creates a one-time link code for the sender. Redeeming it from
+// another account within CodeTTL links both accounts to this sender's
+// canonical user ID. Issuing a new code invalidates the sender's previous one.
+func (r *Registry) IssueCode(channel, senderID string) (string, error) {
+	account := Normalize(channel, senderID)
+	if account == "" {
+		return "", ErrUnknownAccount
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return "", fmt.Errorf("identity: failed to generate link code: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for c, pending := range r.codes {
+		if pending.account == account || now.After(pending.expires) {
+			delete(r.codes, c)
+		}
+	}
+	r.codes[code] = pendingCode{account: account, expires: now.Add(CodeTTL)}
+
+	return code, nil
+}
+
+// Redeem links the sender to the account that issued code and returns the
+// shared canonical user ID. Accounts already linked to the sender move along
+// with it. After too many failed attempts it returns ErrTooManyTries without
+// looking at code.
+func (r *Registry) Redeem(code, channel, senderID string) (string, error) {
+	account := Normalize(channel, senderID)
+	if account == "" {
+		return "", ErrUnknownAccount
+	}
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if len(r.recentFailures(account, now)) >= maxSenderFailures ||
+		len(r.recentFailures("", now)) >= maxGlobalFailures {
+		return "", ErrTooManyTries
+	}
+
+	pending, ok := r.codes[code]
+	if !ok || now.After(pending.expires) {
+		delete(r.codes, code)
+		r.recordFailure(account, now)
+		return "", ErrInvalidCode
+	}
+	if pending.account == account {
+		return "", ErrSameAccount
+	}
+	delete(r.codes, code)
+
+	canonical := r.resolveLocked(pending.account)
+	previous := r.resolveLocked(account)
+
+	for acc, id := range r.links {
+		if id == previous {
+			r.links[acc] = canonical
+		}
+	}
+	r.links[account] = canonical
+	r.links[pending.account] = canonical
+
+	if err := r.save(); err != nil {
+		return "", err
+	}
+	return canonical, nil
+}
+
+// Unlink detaches the sender from its canonical user ID, so it resolves to
+// its own account ID again. The primary account, whose ID is the canonical
+// ID, cannot be unlinked while other accounts still point at it.
+func (r *Registry) Unlink(channel, senderID string) error {
+	account := Normalize(channel, senderID)
+	if account == "" {
+		return ErrUnknownAccount
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	canonical, ok := r.links[account]
+	if !ok {
+		return ErrNotLinked
+	}
+
+	var others []string
+	for acc, id := range r.links {
+		if id == canonical && acc != account {
+			others = append(others, acc)
+		}
+	}
+	if account == canonical && len(others) > 1 {
+		return ErrPrimaryAccount
+	}
+
+	delete(r.links, account)
+	// A single leftover account is no longer linked to anything
+	if len(others) <= 1 {
+		for _, acc := range others {
+			delete(r.links, acc)
+		}
+	}
+
+	return r.save()
+}
+
+// recentFailures returns the failed redemptions of account within CodeTTL,
+// dropping older ones. Must be called with r.mu held.
+func (r *Registry) recentFailures(account string, now time.Time) []time.Time {
+	times := r.failures[account]
+	for len(times) > 0 && now.Sub(times[0]) > CodeTTL {
+		times = times[1:]
+	}
+	if len(times) == 0 {
+		delete(r.failures, account)
+		return nil
+	}
+	r.failures[account] = times
+	return times
+}
+
+// recordFailure counts a failed redemption against the sender, all senders
+// and every pending code, since any of them may have been the target.
+// Must be called with r.mu held.
+func (r *Registry) recordFailure(account string, now time.Time) {
+	r.failures[account] = append(r.recentFailures(account, now), now)
+	r.failures[""] = append(r.recentFailures("", now), now)
+	for c, pending := range r.codes {
+		pending.failures++
+		if pending.failures >= maxCodeFailures {
+			delete(r.codes, c)
+			logger.WarnCF("identity", "Link code dropped after repeated failed attempts", map[string]interface{}{"account": pending.account})
+			continue
+		}
+		r.codes[c] = pending
+	}
+}
+
+// resolveLocked must be called with r.mu held.
+func (r *Registry) resolveLocked(account string) string {
+	if id, ok := r.links[account]; ok {
+		return id
+	}
+	return account
+}
+
+func (r *Registry) load() error {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("identity: failed to read links: %w", err)
+	}
+
+	var file registryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("identity: failed to parse links: %w", err)
+	}
+	if file.Links != nil {
+		r.links = file.Links
+	}
+	return nil
+}
+
+// save writes the links atomically using temp file + rename.
+// Must be called with r.mu held.
+func (r *Registry) save() error {
+	data, err := json.MarshalIndent(registryFile{Links: r.links}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("identity: failed to marshal links: %w", err)
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("identity: failed to write links: %w", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("identity: failed to save links: %w", err)
+	}
+	return nil
+}
+
+func generateCode() (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := 0; i < codeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,199 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		channel  string
+		senderID string
+		want     string
+	}{
+		{"telegram", "123456", "telegram_123456"},
+		{"telegram", "123456|alice", "telegram_123456"},
+		{"slack", "U01/../x", "slack_U01_.._x"},
+		{"cli", "user", ""},
+		{"telegram", "", ""},
+		{"", "123", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.channel, tt.senderID); got != tt.want {
+			t.Errorf("Normalize(%q, %q) = %q, want %q", tt.channel, tt.senderID, got, tt.want)
+		}
+	}
+}
+
+func TestRegistry_LinkAndResolve(t *testing.T) {
+	workspace := t.TempDir()
+	r := NewRegistry(workspace)
+
+	if got := r.Resolve("slack", "U1"); got != "slack_U1" {
+		t.Fatalf("unlinked Resolve = %q, want slack_U1", got)
+	}
+
+	code, err := r.IssueCode("telegram", "123|alice")
+	if err != nil {
+		t.Fatalf("IssueCode failed: %v", err)
+	}
+	if len(code) != codeLength {
+		t.Fatalf("code length = %d, want %d", len(code), codeLength)
+	}
+
+	if _, err := r.Redeem(code, "telegram", "123"); !errors.Is(err, ErrSameAccount) {
+		t.Fatalf("redeeming own code: err = %v, want ErrSameAccount", err)
+	}
+
+	userID, err := r.Redeem(code, "slack", "U1")
+	if err != nil {
+		t.Fatalf("Redeem failed: %v", err)
+	}
+	if userID != "telegram_123" {
+		t.Fatalf("canonical ID = %q, want telegram_123", userID)
+	}
+	if got := r.Resolve("slack", "U1"); got != "telegram_123" {
+		t.Errorf("linked Resolve = %q, want telegram_123", got)
+	}
+	if !r.IsLinked("slack", "U1") || !r.IsLinked("telegram", "123") {
+		t.Error("both accounts should be linked")
+	}
+
+	if _, err := r.Redeem(code, "discord", "D1"); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("reusing code: err = %v, want ErrInvalidCode", err)
+	}
+
+	// Links survive a restart
+	r2 := NewRegistry(workspace)
+	if got := r2.Resolve("slack", "U1"); got != "telegram_123" {
+		t.Errorf("reloaded Resolve = %q, want telegram_123", got)
+	}
+	accounts := r2.Accounts("telegram_123")
+	if len(accounts) != 2 || accounts[0] != "slack_U1" || accounts[1] != "telegram_123" {
+		t.Errorf("Accounts = %v", accounts)
+	}
+}
+
+func TestRegistry_CodeExpires(t *testing.T) {
+	r := NewRegistry(t.TempDir())
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	code, err := r.IssueCode("telegram", "123")
+	if err != nil {
+		t.Fatalf("IssueCode failed: %v", err)
+	}
+
+	now = now.Add(CodeTTL + time.Second)
+	if _, err := r.Redeem(code, "slack", "U1"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("expired code: err = %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestRegistry_FailedAttemptsAreLimited(t *testing.T) {
+	r := NewRegistry(t.TempDir())
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	code, err := r.IssueCode("telegram", "123")
+	if err != nil {
+		t.Fatalf("IssueCode failed: %v", err)
+	}
+
+	// One sender is stopped after maxSenderFailures wrong guesses, even
+	// when it then sends the right code
+	for i := 0; i < maxSenderFailures; i++ {
+		if _, err := r.Redeem("WRONG1", "slack", "U1"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("guess %d: err = %v, want ErrInvalidCode", i, err)
+		}
+	}
+	if _, err := r.Redeem(code, "slack", "U1"); !errors.Is(err, ErrTooManyTries) {
+		t.Fatalf("err = %v, want ErrTooManyTries", err)
+	}
+
+	// The pending code is dropped after maxCodeFailures guesses from any sender
+	for i := maxSenderFailures; i < maxCodeFailures; i++ {
+		r.Redeem("WRONG1", "discord", fmt.Sprint(i))
+	}
+	if _, err := r.Redeem(code, "slack", "U2"); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("err = %v, want ErrInvalidCode for a dropped code", err)
+	}
+
+	// All senders together are limited to maxGlobalFailures
+	for i := maxCodeFailures + 1; i < maxGlobalFailures; i++ {
+		r.Redeem("WRONG1", "discord", fmt.Sprint(i))
+	}
+	code, _ = r.IssueCode("telegram", "123")
+	if _, err := r.Redeem(code, "slack", "U3"); !errors.Is(err, ErrTooManyTries) {
+		t.Fatalf("err = %v, want ErrTooManyTries across senders", err)
+	}
+
+	// The limits end with CodeTTL
+	now = now.Add(CodeTTL + time.Second)
+	code, _ = r.IssueCode("telegram", "123")
+	if _, err := r.Redeem(code, "slack", "U1"); err != nil {
+		t.Fatalf("Redeem after the limit expired: %v", err)
+	}
+}
+
+func TestRegistry_MergeAndUnlink(t *testing.T) {
+	r := NewRegistry(t.TempDir())
+
+	link := func(fromCh, fromID, toCh, toID string) {
+		t.Helper()
+		code, err := r.IssueCode(fromCh, fromID)
+		if err != nil {
+			t.Fatalf("IssueCode failed: %v", err)
+		}
+		if _, err := r.Redeem(code, toCh, toID); err != nil {
+			t.Fatalf("Redeem failed: %v", err)
+		}
+	}
+
+	link("slack", "U1", "discord", "D1")
+	link("telegram", "123", "slack", "U1")
+
+	// The discord account follows slack into the telegram identity
+	if got := r.Resolve("discord", "D1"); got != "telegram_123" {
+		t.Fatalf("merged Resolve = %q, want telegram_123", got)
+	}
+
+	if err := r.Unlink("telegram", "123"); !errors.Is(err, ErrPrimaryAccount) {
+		t.Fatalf("unlinking primary: err = %v, want ErrPrimaryAccount", err)
+	}
+
+	if err := r.Unlink("discord", "D1"); err != nil {
+		t.Fatalf("Unlink failed: %v", err)
+	}
+	if got := r.Resolve("discord", "D1"); got != "discord_D1" {
+		t.Errorf("unlinked Resolve = %q, want discord_D1", got)
+	}
+
+	if err := r.Unlink("slack", "U1"); err != nil {
+		t.Fatalf("Unlink failed: %v", err)
+	}
+	if r.IsLinked("telegram", "123") {
+		t.Error("primary account should no longer be linked once it is alone")
+	}
+	if err := r.Unlink("slack", "U1"); !errors.Is(err, ErrNotLinked) {
+		t.Errorf("unlinking twice: err = %v, want ErrNotLinked", err)
+	}
+}
+
+func TestRegistry_CorruptFileIsKept(t *testing.T) {
+	workspace := t.TempDir()
+	path := filepath.Join(workspace, "identity", "links.json")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("{not json"), 0644)
+
+	NewRegistry(workspace)
+	data, err := os.ReadFile(path + ".corrupt")
+	if err != nil || string(data) != "{not json" {
+		t.Fatalf("expected the corrupt links file to be kept, got %q, %v", data, err)
+	}
+}
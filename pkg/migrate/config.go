@@ -119,9 +119,9 @@ func ConvertConfig(data map[string]interface{}) (*config.Config, []string, error
 			case "zhipu":
 				cfg.Providers.Zhipu = pc
 			case "vllm":
-				cfg.Providers.VLLM = pc
+				cfg.Providers.VLLM = config.VLLMProviderConfig{ProviderConfig: pc}
 			case "gemini":
-				cfg.Providers.Gemini = pc
+				cfg.Providers.Gemini = config.GeminiProviderConfig{ProviderConfig: pc}
 			}
 		}
 	}
@@ -0,0 +1,257 @@
+// Package netguard provides HTTP clients for fetching URLs that come from
+// the model or from users without reaching the host itself, its LAN or
+// cloud metadata services.
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBlocked is returned when a host resolves only to addresses that are
+// not publicly routable and are not on the allow-list.
+var ErrBlocked = errors.New("private or internal address")
+
+// blockedPrefixes are the ranges not covered by the netip.Addr predicates
+// used in Blocked.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT, Alibaba Cloud metadata
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved and broadcast
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("fec0::/10"),       // deprecated site-local
+}
+
+// Blocked reports whether ip is loopback, private, link-local, multicast or
+// otherwise not publicly routable. IPv4 addresses embedded in IPv6 forms
+// (IPv4-mapped, IPv4-compatible, NAT64 and 6to4) are judged by the IPv4
+// address they carry.
+func Blocked(ip netip.Addr) bool {
+	ip = ip.WithZone("").Unmap()
+	if v4, ok := embeddedIPv4(ip); ok {
+		return Blocked(v4)
+	}
+	if !ip.IsValid() || ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func embeddedIPv4(ip netip.Addr) (netip.Addr, bool) {
+	if !ip.Is6() {
+		return netip.Addr{}, false
+	}
+	b := ip.As16()
+	switch {
+	case isZero(b[:12]): // ::a.b.c.d
+		return netip.AddrFrom4([4]byte{b[12], b[13], b[14], b[15]}), true
+	case b[0] == 0x00 && b[1] == 0x64 && b[2] == 0xff && b[3] == 0x9b && isZero(b[4:12]): // 64:ff9b::a.b.c.d
+		return netip.AddrFrom4([4]byte{b[12], b[13], b[14], b[15]}), true
+	case b[0] == 0x20 && b[1] == 0x02: // 2002:aabb:ccdd::
+		return netip.AddrFrom4([4]byte{b[2], b[3], b[4], b[5]}), true
+	}
+	return netip.Addr{}, false
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Policy decides which addresses outbound requests may connect to. Public
+// addresses are always allowed; private ones only when they are on the
+// allow-list.
+type Policy struct {
+	hosts    map[string]bool
+	prefixes []netip.Prefix
+	dialer   *net.Dialer
+	// proxyFunc picks the proxy for a request, http.ProxyFromEnvironment
+	// unless a test replaces it.
+	proxyFunc func(*http.Request) (*url.URL, error)
+	// proxies holds the addresses of the proxies handed out by proxy, which
+	// come from the environment and may be dialed whatever their address.
+	proxies sync.Map
+}
+
+// NewPolicy returns a policy that additionally allows the given hosts.
+// Entries are IP addresses, CIDR ranges such as 192.168.1.0/24, or host
+// names, which are allowed whatever they resolve to.
+func NewPolicy(allowed []string) *Policy {
+	p := &Policy{
+		hosts:     make(map[string]bool),
+		dialer:    &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		proxyFunc: http.ProxyFromEnvironment,
+	}
+	for _, entry := range allowed {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			p.prefixes = append(p.prefixes, prefix.Masked())
+		} else if ip, err := netip.ParseAddr(strings.Trim(entry, "[]")); err == nil {
+			ip = ip.WithZone("").Unmap()
+			p.prefixes = append(p.prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+		} else if entry != "" {
+			p.hosts[normalizeHost(entry)] = true
+		}
+	}
+	return p
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// Allowed reports whether connections to ip are permitted.
+func (p *Policy) Allowed(ip netip.Addr) bool {
+	if !Blocked(ip) {
+		return true
+	}
+	ip = ip.WithZone("").Unmap()
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// DialContext resolves the host of address itself and connects only to the
+// addresses the policy allows, so that names pointing at internal addresses
+// and DNS answers that change between check and use are both caught.
+func (p *Policy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	hostAllowed := p.hosts[normalizeHost(host)]
+	var lastErr error
+	for _, ip := range ips {
+		if !hostAllowed && !p.Allowed(ip) {
+			if lastErr == nil {
+				lastErr = fmt.Errorf("%w: %s resolves to %s", ErrBlocked, host, ip)
+			}
+			continue
+		}
+		conn, err := p.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no addresses found for %s", host)
+	}
+	return nil, lastErr
+}
+
+func lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{ip}, nil
+	}
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+// proxy returns the proxy from the environment for req. The proxy connects
+// to the target on the client's behalf, so the target is checked here: it
+// must be allow-listed or resolve only to allowed addresses. Names that do
+// not resolve locally are left to the proxy.
+func (p *Policy) proxy(req *http.Request) (*url.URL, error) {
+	proxyURL, err := p.proxyFunc(req)
+	if proxyURL == nil || err != nil {
+		return proxyURL, err
+	}
+	host := req.URL.Hostname()
+	if !p.hosts[normalizeHost(host)] {
+		ips, _ := lookup(req.Context(), host)
+		for _, ip := range ips {
+			if !p.Allowed(ip) {
+				return nil, fmt.Errorf("%w: %s resolves to %s", ErrBlocked, host, ip)
+			}
+		}
+	}
+	p.proxies.Store(proxyAddr(proxyURL), true)
+	return proxyURL, nil
+}
+
+// proxyAddr returns the host:port the transport dials for proxyURL.
+func proxyAddr(proxyURL *url.URL) string {
+	port := proxyURL.Port()
+	if port == "" {
+		port = map[string]string{"https": "443", "socks5": "1080", "socks5h": "1080"}[proxyURL.Scheme]
+	}
+	if port == "" {
+		port = "80"
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// dial connects to proxies handed out by proxy directly and to everything
+// else through DialContext.
+func (p *Policy) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if _, ok := p.proxies.Load(address); ok {
+		return p.dialer.DialContext(ctx, network, address)
+	}
+	return p.DialContext(ctx, network, address)
+}
+
+// Client returns an HTTP client whose connections, including those made
+// for redirects, go through DialContext. With useProxy, requests go through
+// the proxy set in HTTP_PROXY, HTTPS_PROXY and NO_PROXY after their target
+// passed the policy; otherwise proxies are not used.
+func (p *Policy) Client(timeout time.Duration, useProxy bool) *http.Client {
+	var proxy func(*http.Request) (*url.URL, error)
+	if useProxy {
+		proxy = p.proxy
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               proxy,
+			DialContext:         p.dial,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     30 * time.Second,
+			TLSHandshakeTimeout: 15 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return fmt.Errorf("stopped after 5 redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// NewClient is a shorthand for NewPolicy(allowed).Client(timeout, useProxy).
+func NewClient(timeout time.Duration, allowed []string, useProxy bool) *http.Client {
+	return NewPolicy(allowed).Client(timeout, useProxy)
+}
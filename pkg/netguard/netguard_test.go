@@ -0,0 +1,122 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestBlocked(t *testing.T) {
+	blocked := []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.100.100.200", "0.0.0.0", "255.255.255.255", "224.0.0.1",
+		"::1", "::", "fe80::1%eth0", "fd00:ec2::254", "ff02::1",
+		"::ffff:127.0.0.1", "::ffff:169.254.169.254", "::127.0.0.1",
+		"64:ff9b::a9fe:a9fe", "2002:c0a8:0101::1",
+	}
+	for _, s := range blocked {
+		if !Blocked(netip.MustParseAddr(s)) {
+			t.Errorf("expected %s to be blocked", s)
+		}
+	}
+	public := []string{"8.8.8.8", "1.1.1.1", "2606:4700:4700::1111", "::ffff:8.8.8.8", "64:ff9b::808:808"}
+	for _, s := range public {
+		if Blocked(netip.MustParseAddr(s)) {
+			t.Errorf("expected %s to be allowed", s)
+		}
+	}
+}
+
+func TestPolicyAllowList(t *testing.T) {
+	p := NewPolicy([]string{"192.168.1.0/24", "10.0.0.5", "nas.local"})
+	if !p.Allowed(netip.MustParseAddr("192.168.1.20")) || !p.Allowed(netip.MustParseAddr("::ffff:10.0.0.5")) {
+		t.Error("expected allow-listed addresses to be allowed")
+	}
+	if p.Allowed(netip.MustParseAddr("192.168.2.1")) || p.Allowed(netip.MustParseAddr("10.0.0.6")) {
+		t.Error("expected other private addresses to stay blocked")
+	}
+	if !p.hosts["nas.local"] {
+		t.Error("expected host names to be kept")
+	}
+}
+
+func TestClientBlocksLoopbackAndRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	_, err := NewClient(5*time.Second, nil, false).Get(server.URL)
+	if !errors.Is(err, ErrBlocked) {
+		t.Fatalf("expected ErrBlocked, got %v", err)
+	}
+
+	// A redirect to a blocked address is caught at the next connection
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer redirect.Close()
+	_, err = NewClient(5*time.Second, []string{"127.0.0.1"}, false).Get(redirect.URL)
+	if !errors.Is(err, ErrBlocked) {
+		t.Fatalf("expected redirect to be blocked, got %v", err)
+	}
+
+	resp, err := NewClient(5*time.Second, []string{"127.0.0.0/8", "::1"}, false).Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected allow-listed loopback to work: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestDialContextHostName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	port := netip.MustParseAddrPort(server.Listener.Addr().String()).Port()
+	addr := fmt.Sprintf("localhost:%d", port)
+
+	if _, err := NewPolicy(nil).DialContext(context.Background(), "tcp", addr); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("expected localhost to be blocked, got %v", err)
+	}
+	conn, err := NewPolicy([]string{"LOCALHOST"}).DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatalf("expected allow-listed host name to connect: %v", err)
+	}
+	conn.Close()
+}
+
+func TestClientProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("via proxy to " + r.Host))
+	}))
+	defer proxy.Close()
+
+	p := NewPolicy(nil)
+	p.proxyFunc = func(*http.Request) (*url.URL, error) { return url.Parse(proxy.URL) }
+
+	// The proxy itself is on loopback but comes from the environment
+	resp, err := p.Client(5*time.Second, true).Get("http://8.8.8.8/")
+	if err != nil {
+		t.Fatalf("expected the request to go through the proxy: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "via proxy to 8.8.8.8" {
+		t.Errorf("body = %q", body)
+	}
+
+	// Blocked targets are not handed to the proxy
+	if _, err := p.Client(5*time.Second, true).Get("http://169.254.169.254/latest/meta-data/"); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("expected ErrBlocked through the proxy, got %v", err)
+	}
+
+	if p.Client(5*time.Second, false).Transport.(*http.Transport).Proxy != nil {
+		t.Error("expected no proxy without useProxy")
+	}
+}
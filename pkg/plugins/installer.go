@@ -13,16 +13,21 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/netguard"
 )
 
 // Installer 插件安装器
 type Installer struct {
 	pluginsDir string
 	state      *StateStore
+	client     *http.Client
 }
 
 // NewInstaller 创建安装器
-func NewInstaller(pluginsDir string) *Installer {
+// network.AllowedHosts 为允许访问的内网地址，其余私有、回环和链路本地地址均被拒绝
+func NewInstaller(pluginsDir string, network config.NetworkConfig) *Installer {
 	if pluginsDir == "" {
 		home, _ := os.UserHomeDir()
 		pluginsDir = filepath.Join(home, ".picoclaw", "plugins")
@@ -30,6 +35,7 @@ func NewInstaller(pluginsDir string) *Installer {
 	return &Installer{
 		pluginsDir: pluginsDir,
 		state:      NewStateStore(pluginsDir),
+		client:     netguard.NewClient(0, network.AllowedHosts, network.UseProxy),
 	}
 }
 
@@ -55,7 +61,7 @@ func (i *Installer) InstallFromGitHub(ctx context.Context, repo string) error {
 		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := i.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("获取 release 信息失败: %w", err)
 	}
@@ -111,7 +117,7 @@ func (i *Installer) installFromBranch(ctx context.Context, owner, repo, subPath,
 		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := i.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("下载 manifest.json 失败: %w", err)
 	}
@@ -150,7 +156,7 @@ func (i *Installer) downloadAndInstall(ctx context.Context, url, subPath, source
 		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := i.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("下载失败: %w", err)
 	}
@@ -0,0 +1,104 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const azureDefaultAPIVersion = "2024-10-21"
+
+// AzureProvider talks to Azure OpenAI, which serves each model from a named
+// deployment at /openai/deployments/{name}/chat/completions and uses an
+// api-key header (or an Entra ID bearer token) instead of an OpenAI key.
+type AzureProvider struct {
+	*HTTPProvider
+	endpoint    string
+	apiVersion  string
+	deployments map[string]string
+	tokenFile   string
+}
+
+func NewAzureProvider(pc config.AzureProviderConfig) (*AzureProvider, error) {
+	if pc.Endpoint == "" {
+		return nil, fmt.Errorf("azure: endpoint not configured")
+	}
+	if pc.APIKey == "" && pc.TokenFile == "" {
+		return nil, fmt.Errorf("azure: api_key or token_file required")
+	}
+
+	apiVersion := pc.APIVersion
+	if apiVersion == "" {
+		apiVersion = azureDefaultAPIVersion
+	}
+
+	// The embedded provider only builds and sends requests; the endpoint
+	// and credentials are Azure's own.
+	base := NewHTTPProvider(pc.APIKey, "", pc.Proxy)
+	base.promptCacheKey = false
+
+	return &AzureProvider{
+		HTTPProvider: base,
+		endpoint:     strings.TrimRight(pc.Endpoint, "/"),
+		apiVersion:   apiVersion,
+		deployments:  pc.Deployments,
+		tokenFile:    config.ExpandHome(pc.TokenFile),
+	}, nil
+}
+
+func (p *AzureProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	model = strings.TrimPrefix(model, "azure/")
+
+	// Read the token per request so a rotated token is picked up
+	var token string
+	if p.tokenFile != "" {
+		data, err := os.ReadFile(p.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading azure token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	requestBody := p.buildRequestBody(messages, tools, model, options)
+	return p.post(ctx, p.chatURL(model), requestBody, func(req *http.Request) {
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else {
+			req.Header.Set("api-key", p.apiKey)
+		}
+	})
+}
+
+func (p *AzureProvider) GetDefaultModel() string {
+	return ""
+}
+
+// ListModels returns the models mapped in deployments. Azure has no
+// data-plane call listing a resource's deployments.
+func (p *AzureProvider) ListModels(ctx context.Context) ([]string, error) {
+	if len(p.deployments) == 0 {
+		return nil, ErrListModelsUnsupported
+	}
+	models := make([]string, 0, len(p.deployments))
+	for model := range p.deployments {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models, nil
+}
+
+// chatURL returns the chat completions URL of the deployment serving model.
+func (p *AzureProvider) chatURL(model string) string {
+	deployment := model
+	if d, ok := p.deployments[model]; ok && d != "" {
+		deployment = d
+	}
+	return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		p.endpoint, url.PathEscape(deployment), url.QueryEscape(p.apiVersion))
+}
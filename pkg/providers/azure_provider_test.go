@@ -0,0 +1,141 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestAzureProvider_Chat(t *testing.T) {
+	var gotPath, gotVersion, gotKey, gotAuth string
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotVersion = r.URL.Query().Get("api-version")
+		gotKey = r.Header.Get("api-key")
+		gotAuth = r.Header.Get("Authorization")
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &gotBody)
+		w.Write([]byte(`{"choices": [{"message": {"content": "Hello from Azure"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	p, err := NewAzureProvider(config.AzureProviderConfig{
+		Endpoint:    server.URL + "/",
+		APIKey:      "azure-key",
+		Deployments: map[string]string{"gpt-4o": "prod-gpt4o"},
+	})
+	if err != nil {
+		t.Fatalf("NewAzureProvider() error: %v", err)
+	}
+
+	resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "azure/gpt-4o", map[string]interface{}{"prompt_cache_key": "k"})
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if resp.Content != "Hello from Azure" {
+		t.Errorf("Content = %q", resp.Content)
+	}
+	if gotPath != "/openai/deployments/prod-gpt4o/chat/completions" || gotVersion != azureDefaultAPIVersion {
+		t.Errorf("path = %q, api-version = %q", gotPath, gotVersion)
+	}
+	if gotKey != "azure-key" || gotAuth != "" {
+		t.Errorf("api-key = %q, Authorization = %q", gotKey, gotAuth)
+	}
+	if _, ok := gotBody["prompt_cache_key"]; ok {
+		t.Error("prompt_cache_key should not be sent to Azure")
+	}
+
+	// Unmapped models are used as the deployment name
+	if _, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o-mini", nil); err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if gotPath != "/openai/deployments/gpt-4o-mini/chat/completions" {
+		t.Errorf("path = %q", gotPath)
+	}
+}
+
+func TestAzureProvider_TokenFile(t *testing.T) {
+	var gotKey, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("api-key")
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"choices": [{"message": {"content": "ok"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("token-1\n"), 0600)
+
+	p, err := NewAzureProvider(config.AzureProviderConfig{Endpoint: server.URL, TokenFile: tokenFile, APIVersion: "2025-01-01-preview"})
+	if err != nil {
+		t.Fatalf("NewAzureProvider() error: %v", err)
+	}
+	msgs := []Message{{Role: "user", Content: "hi"}}
+	if _, err := p.Chat(context.Background(), msgs, nil, "gpt-4o", nil); err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if gotAuth != "Bearer token-1" || gotKey != "" {
+		t.Errorf("Authorization = %q, api-key = %q", gotAuth, gotKey)
+	}
+
+	// A rotated token is used without restarting
+	os.WriteFile(tokenFile, []byte("token-2"), 0600)
+	p.Chat(context.Background(), msgs, nil, "gpt-4o", nil)
+	if gotAuth != "Bearer token-2" {
+		t.Errorf("Authorization after rotation = %q", gotAuth)
+	}
+}
+
+func TestAzureProvider_ListModels(t *testing.T) {
+	p, _ := NewAzureProvider(config.AzureProviderConfig{Endpoint: "https://res.openai.azure.com", APIKey: "k"})
+	if _, err := p.ListModels(context.Background()); err != ErrListModelsUnsupported {
+		t.Errorf("ListModels() without deployments error = %v", err)
+	}
+
+	p, _ = NewAzureProvider(config.AzureProviderConfig{
+		Endpoint:    "https://res.openai.azure.com",
+		APIKey:      "k",
+		Deployments: map[string]string{"gpt-4o-mini": "mini", "gpt-4o": "prod"},
+	})
+	models, err := p.ListModels(context.Background())
+	if err != nil || len(models) != 2 || models[0] != "gpt-4o" {
+		t.Errorf("ListModels() = %v, %v", models, err)
+	}
+}
+
+func TestCreateProvider_Azure(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Provider = "azure"
+	cfg.Agents.Defaults.Model = "gpt-4o"
+	cfg.Providers.Azure = config.AzureProviderConfig{Endpoint: "https://res.openai.azure.com", APIKey: "k"}
+
+	p, err := CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider() error: %v", err)
+	}
+	if _, ok := p.(*AzureProvider); !ok {
+		t.Fatalf("provider = %T, want *AzureProvider", p)
+	}
+
+	cfg.Agents.Defaults.Provider = ""
+	cfg.Agents.Defaults.Model = "azure/gpt-4o"
+	if p, err = CreateProvider(cfg); err != nil {
+		t.Fatalf("CreateProvider(azure/ prefix) error: %v", err)
+	}
+	if _, ok := p.(*AzureProvider); !ok {
+		t.Fatalf("provider = %T, want *AzureProvider for azure/ model prefix", p)
+	}
+
+	cfg.Providers.Azure.APIKey = ""
+	if _, err := CreateProvider(cfg); err == nil {
+		t.Error("expected error without api_key or token_file")
+	}
+}
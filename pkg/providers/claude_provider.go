@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
@@ -13,6 +16,10 @@ import (
 type ClaudeProvider struct {
 	client      *anthropic.Client
 	tokenSource func() (string, error)
+	// oauth marks tokens from a Claude account login, which the API only
+	// accepts with the OAuth beta header.
+	oauth  bool
+	models modelCache
 }
 
 func NewClaudeProvider(token string) *ClaudeProvider {
@@ -34,6 +41,24 @@ func NewClaudeProviderWithBaseURL(token, baseURL string) *ClaudeProvider {
 	return &ClaudeProvider{client: &client}
 }
 
+// NewClaudeProviderWithAPIKey authenticates with an x-api-key header, as the
+// public Anthropic API and most compatible gateways expect.
+func NewClaudeProviderWithAPIKey(apiKey, baseURL string, httpClient *http.Client, headers map[string]string) *ClaudeProvider {
+	if baseURL == "" {
+		baseURL = "https://api.anthropic.com"
+	}
+	opts := []option.RequestOption{
+		option.WithAPIKey(apiKey),
+		option.WithBaseURL(baseURL),
+		option.WithHTTPClient(httpClient),
+	}
+	for k, v := range headers {
+		opts = append(opts, option.WithHeader(k, v))
+	}
+	client := anthropic.NewClient(opts...)
+	return &ClaudeProvider{client: &client}
+}
+
 func NewClaudeProviderWithTokenSource(token string, tokenSource func() (string, error)) *ClaudeProvider {
 	p := NewClaudeProvider(token)
 	p.tokenSource = tokenSource
@@ -41,13 +66,9 @@ func NewClaudeProviderWithTokenSource(token string, tokenSource func() (string,
 }
 
 func (p *ClaudeProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
-	var opts []option.RequestOption
-	if p.tokenSource != nil {
-		tok, err := p.tokenSource()
-		if err != nil {
-			return nil, fmt.Errorf("refreshing token: %w", err)
-		}
-		opts = append(opts, option.WithAuthToken(tok))
+	opts, err := p.authOptions()
+	if err != nil {
+		return nil, err
 	}
 
 	params, err := buildClaudeParams(messages, tools, model, options)
@@ -55,7 +76,12 @@ func (p *ClaudeProvider) Chat(ctx context.Context, messages []Message, tools []T
 		return nil, err
 	}
 
+	var httpResp *http.Response
+	opts = append(opts, option.WithResponseInto(&httpResp))
 	resp, err := p.client.Messages.New(ctx, params, opts...)
+	if httpResp != nil {
+		observeHeaders(ctx, httpResp.Header)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("claude API call: %w", err)
 	}
@@ -63,6 +89,42 @@ func (p *ClaudeProvider) Chat(ctx context.Context, messages []Message, tools []T
 	return parseClaudeResponse(resp), nil
 }
 
+// authOptions returns the per-request credentials from the token source.
+func (p *ClaudeProvider) authOptions() ([]option.RequestOption, error) {
+	var opts []option.RequestOption
+	if p.tokenSource != nil {
+		tok, err := p.tokenSource()
+		if err != nil {
+			return nil, fmt.Errorf("refreshing token: %w", err)
+		}
+		opts = append(opts, option.WithAuthToken(tok))
+	}
+	if p.oauth {
+		opts = append(opts, option.WithHeaderAdd("anthropic-beta", "oauth-2025-04-20"))
+	}
+	return opts, nil
+}
+
+// ListModels returns the model IDs from the Anthropic Models API.
+func (p *ClaudeProvider) ListModels(ctx context.Context) ([]string, error) {
+	return p.models.get(ctx, func(ctx context.Context) ([]string, error) {
+		opts, err := p.authOptions()
+		if err != nil {
+			return nil, err
+		}
+
+		var ids []string
+		pager := p.client.Models.ListAutoPaging(ctx, anthropic.ModelListParams{Limit: anthropic.Int(1000)}, opts...)
+		for pager.Next() {
+			ids = append(ids, pager.Current().ID)
+		}
+		if err := pager.Err(); err != nil {
+			return nil, fmt.Errorf("claude list models: %w", err)
+		}
+		return ids, nil
+	})
+}
+
 func (p *ClaudeProvider) GetDefaultModel() string {
 	return "claude-sonnet-4-5-20250929"
 }
@@ -70,11 +132,16 @@ func (p *ClaudeProvider) GetDefaultModel() string {
 func buildClaudeParams(messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (anthropic.MessageNewParams, error) {
 	var system []anthropic.TextBlockParam
 	var anthropicMessages []anthropic.MessageParam
+	var volatile []string
 
 	for _, msg := range messages {
 		switch msg.Role {
 		case "system":
-			system = append(system, anthropic.TextBlockParam{Text: msg.Content})
+			stable, rest := splitCachePrefix(msg)
+			system = append(system, anthropic.TextBlockParam{Text: stable})
+			if rest != "" {
+				volatile = append(volatile, rest)
+			}
 		case "user":
 			if msg.ToolCallID != "" {
 				anthropicMessages = append(anthropicMessages,
@@ -87,7 +154,8 @@ func buildClaudeParams(messages []Message, tools []ToolDefinition, model string,
 			}
 		case "assistant":
 			if len(msg.ToolCalls) > 0 {
-				var blocks []anthropic.ContentBlockParamUnion
+				// Signed thinking must precede the tool calls it led to
+				blocks := claudeThinkingBlocks(msg.ReasoningBlocks)
 				if msg.Content != "" {
 					blocks = append(blocks, anthropic.NewTextBlock(msg.Content))
 				}
@@ -124,6 +192,19 @@ func buildClaudeParams(messages []Message, tools []ToolDefinition, model string,
 		}
 	}
 
+	applyClaudeCacheControl(system, anthropicMessages)
+
+	// The volatile end of the system prompt follows the last cache
+	// breakpoint, so it never invalidates the cached prefix. It only
+	// affects the current turn and is not part of the stored history.
+	if tail := strings.Join(volatile, "\n\n"); tail != "" {
+		if n := len(anthropicMessages); n > 0 && anthropicMessages[n-1].Role == anthropic.MessageParamRoleUser {
+			anthropicMessages[n-1].Content = append(anthropicMessages[n-1].Content, anthropic.NewTextBlock(tail))
+		} else {
+			system = append(system, anthropic.TextBlockParam{Text: tail})
+		}
+	}
+
 	maxTokens := int64(4096)
 	if mt, ok := options["max_tokens"].(int); ok {
 		maxTokens = int64(mt)
@@ -139,17 +220,68 @@ func buildClaudeParams(messages []Message, tools []ToolDefinition, model string,
 		params.System = system
 	}
 
-	if temp, ok := options["temperature"].(float64); ok {
+	if budget, ok := options["thinking_budget"].(int); ok && budget >= minClaudeThinkingBudget {
+		// max_tokens covers thinking plus the answer
+		params.Thinking = anthropic.ThinkingConfigParamOfEnabled(int64(budget))
+		params.MaxTokens = maxTokens + int64(budget)
+	} else if temp, ok := options["temperature"].(float64); ok {
+		// Extended thinking only allows the default temperature
 		params.Temperature = anthropic.Float(temp)
 	}
 
 	if len(tools) > 0 {
 		params.Tools = translateToolsForClaude(tools)
+		// Tools come first in Anthropic's cache order
+		if cc := params.Tools[len(params.Tools)-1].GetCacheControl(); cc != nil {
+			*cc = anthropic.NewCacheControlEphemeralParam()
+		}
 	}
 
 	return params, nil
 }
 
+// minClaudeThinkingBudget is the smallest budget_tokens the API accepts.
+const minClaudeThinkingBudget = 1024
+
+func claudeThinkingBlocks(reasoning []ReasoningBlock) []anthropic.ContentBlockParamUnion {
+	var blocks []anthropic.ContentBlockParamUnion
+	for _, rb := range reasoning {
+		switch rb.Type {
+		case "thinking":
+			blocks = append(blocks, anthropic.NewThinkingBlock(rb.Signature, rb.Thinking))
+		case "redacted_thinking":
+			blocks = append(blocks, anthropic.NewRedactedThinkingBlock(rb.Data))
+		}
+	}
+	return blocks
+}
+
+// splitCachePrefix splits a system message into its stable and volatile parts.
+func splitCachePrefix(msg Message) (string, string) {
+	if msg.CachePrefix <= 0 || msg.CachePrefix >= len(msg.Content) {
+		return msg.Content, ""
+	}
+	return msg.Content[:msg.CachePrefix], strings.TrimLeft(msg.Content[msg.CachePrefix:], "\n")
+}
+
+// applyClaudeCacheControl marks the end of the system prompt and the end of
+// the history as cache breakpoints. Together with the tools breakpoint this
+// uses three of the four breakpoints Anthropic allows. Each turn reads the
+// prefix the previous turn wrote and extends it.
+func applyClaudeCacheControl(system []anthropic.TextBlockParam, messages []anthropic.MessageParam) {
+	if n := len(system); n > 0 && system[n-1].Text != "" {
+		system[n-1].CacheControl = anthropic.NewCacheControlEphemeralParam()
+	}
+	if n := len(messages); n > 0 {
+		blocks := messages[n-1].Content
+		if len(blocks) > 0 {
+			if cc := blocks[len(blocks)-1].GetCacheControl(); cc != nil {
+				*cc = anthropic.NewCacheControlEphemeralParam()
+			}
+		}
+	}
+}
+
 func translateToolsForClaude(tools []ToolDefinition) []anthropic.ToolUnionParam {
 	result := make([]anthropic.ToolUnionParam, 0, len(tools))
 	for _, t := range tools {
@@ -179,12 +311,20 @@ func translateToolsForClaude(tools []ToolDefinition) []anthropic.ToolUnionParam
 func parseClaudeResponse(resp *anthropic.Message) *LLMResponse {
 	var content string
 	var toolCalls []ToolCall
+	var reasoning []string
+	var reasoningBlocks []ReasoningBlock
 
 	for _, block := range resp.Content {
 		switch block.Type {
 		case "text":
 			tb := block.AsText()
 			content += tb.Text
+		case "thinking":
+			tb := block.AsThinking()
+			reasoning = append(reasoning, tb.Thinking)
+			reasoningBlocks = append(reasoningBlocks, ReasoningBlock{Type: "thinking", Thinking: tb.Thinking, Signature: tb.Signature})
+		case "redacted_thinking":
+			reasoningBlocks = append(reasoningBlocks, ReasoningBlock{Type: "redacted_thinking", Data: block.AsRedactedThinking().Data})
 		case "tool_use":
 			tu := block.AsToolUse()
 			var args map[string]interface{}
@@ -209,27 +349,57 @@ func parseClaudeResponse(resp *anthropic.Message) *LLMResponse {
 		finishReason = "stop"
 	}
 
+	// input_tokens excludes cached tokens; count them like other providers do
+	promptTokens := resp.Usage.InputTokens + resp.Usage.CacheReadInputTokens + resp.Usage.CacheCreationInputTokens
+
 	return &LLMResponse{
 		Content:      content,
 		ToolCalls:    toolCalls,
 		FinishReason: finishReason,
 		Usage: &UsageInfo{
-			PromptTokens:     int(resp.Usage.InputTokens),
+			PromptTokens:     int(promptTokens),
 			CompletionTokens: int(resp.Usage.OutputTokens),
-			TotalTokens:      int(resp.Usage.InputTokens + resp.Usage.OutputTokens),
+			TotalTokens:      int(promptTokens + resp.Usage.OutputTokens),
+			CacheReadTokens:  int(resp.Usage.CacheReadInputTokens),
+			CacheWriteTokens: int(resp.Usage.CacheCreationInputTokens),
 		},
+		Reasoning:       strings.Join(reasoning, "\n\n"),
+		ReasoningBlocks: reasoningBlocks,
 	}
 }
 
-func createClaudeTokenSource() func() (string, error) {
+// createClaudeTokenSource returns the Anthropic token stored under key (see
+// auth.CredentialKey), refreshing OAuth tokens shortly before they expire.
+// Refreshes are serialized since Anthropic rotates the refresh token on
+// every use.
+func createClaudeTokenSource(key, clientID string) func() (string, error) {
+	var mu sync.Mutex
 	return func() (string, error) {
-		cred, err := auth.GetCredential("anthropic")
+		mu.Lock()
+		defer mu.Unlock()
+
+		cred, err := auth.GetCredential(key)
 		if err != nil {
 			return "", fmt.Errorf("loading auth credentials: %w", err)
 		}
 		if cred == nil {
 			return "", fmt.Errorf("no credentials for anthropic. Run: picoclaw auth login --provider anthropic")
 		}
+
+		if cred.AuthMethod == "oauth" && cred.NeedsRefresh() && cred.RefreshToken != "" {
+			refreshed, err := auth.RefreshAccessToken(context.Background(), cred, claudeOAuthConfig(clientID))
+			if err != nil {
+				return "", fmt.Errorf("refreshing token: %w", err)
+			}
+			if err := auth.SetCredential(key, refreshed); err != nil {
+				return "", fmt.Errorf("saving refreshed token: %w", err)
+			}
+			return refreshed.AccessToken, nil
+		}
+
 		return cred.AccessToken, nil
 	}
 }
+
+// claudeOAuthConfig is replaced in tests.
+var claudeOAuthConfig = auth.AnthropicOAuthConfig
@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	anthropicoption "github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/sipeed/picoclaw/pkg/auth"
 )
 
 func TestBuildClaudeParams_BasicMessage(t *testing.T) {
@@ -102,6 +105,144 @@ func TestBuildClaudeParams_WithTools(t *testing.T) {
 	}
 }
 
+func TestBuildClaudeParams_CacheControl(t *testing.T) {
+	system := "You are helpful\n\n## Current Time\n2026-01-01 10:00"
+	messages := []Message{
+		{Role: "system", Content: system, CachePrefix: len("You are helpful")},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello"},
+		{Role: "user", Content: "Weather?"},
+	}
+	tools := []ToolDefinition{
+		{Type: "function", Function: ToolFunctionDefinition{Name: "a", Parameters: map[string]interface{}{"type": "object"}}},
+		{Type: "function", Function: ToolFunctionDefinition{Name: "b", Parameters: map[string]interface{}{"type": "object"}}},
+	}
+	params, err := buildClaudeParams(messages, tools, "claude-sonnet-4-5-20250929", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("buildClaudeParams() error: %v", err)
+	}
+
+	data, _ := json.Marshal(params)
+	var body struct {
+		System []map[string]interface{} `json:"system"`
+		Tools  []map[string]interface{} `json:"tools"`
+		Msgs   []struct {
+			Content []map[string]interface{} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("unmarshal params: %v", err)
+	}
+
+	if len(body.System) != 1 || body.System[0]["text"] != "You are helpful" || body.System[0]["cache_control"] == nil {
+		t.Errorf("system = %v, want only the stable prefix, cached", body.System)
+	}
+	if body.Tools[0]["cache_control"] != nil || body.Tools[1]["cache_control"] == nil {
+		t.Errorf("tools = %v, want breakpoint on the last tool only", body.Tools)
+	}
+	if body.Msgs[0].Content[0]["cache_control"] != nil {
+		t.Error("earlier history should not carry a breakpoint")
+	}
+	last := body.Msgs[len(body.Msgs)-1].Content
+	if len(last) != 2 || last[0]["cache_control"] == nil {
+		t.Fatalf("last message = %v, want cached text then the volatile tail", last)
+	}
+	if last[1]["text"] != "## Current Time\n2026-01-01 10:00" || last[1]["cache_control"] != nil {
+		t.Errorf("volatile tail = %v", last[1])
+	}
+}
+
+func TestParseClaudeResponse_CacheUsage(t *testing.T) {
+	resp := &anthropic.Message{
+		Usage: anthropic.Usage{
+			InputTokens:              10,
+			OutputTokens:             5,
+			CacheReadInputTokens:     3000,
+			CacheCreationInputTokens: 200,
+		},
+	}
+	u := parseClaudeResponse(resp).Usage
+	if u.PromptTokens != 3210 || u.TotalTokens != 3215 {
+		t.Errorf("PromptTokens/TotalTokens = %d/%d, want 3210/3215", u.PromptTokens, u.TotalTokens)
+	}
+	if u.CacheReadTokens != 3000 || u.CacheWriteTokens != 200 {
+		t.Errorf("cache tokens = %d/%d, want 3000/200", u.CacheReadTokens, u.CacheWriteTokens)
+	}
+}
+
+func TestBuildClaudeParams_ThinkingRoundTrip(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "What's the weather?"},
+		{
+			Role: "assistant",
+			ReasoningBlocks: []ReasoningBlock{
+				{Type: "thinking", Thinking: "Need the weather tool.", Signature: "sig-1"},
+				{Type: "redacted_thinking", Data: "opaque"},
+			},
+			ToolCalls: []ToolCall{{ID: "call_1", Name: "get_weather", Arguments: map[string]interface{}{"city": "SF"}}},
+		},
+		{Role: "tool", Content: "sunny", ToolCallID: "call_1"},
+	}
+	params, err := buildClaudeParams(messages, nil, "claude-sonnet-4-5-20250929", map[string]interface{}{
+		"max_tokens":      1000,
+		"temperature":     0.7,
+		"thinking_budget": 2048,
+	})
+	if err != nil {
+		t.Fatalf("buildClaudeParams() error: %v", err)
+	}
+
+	data, _ := json.Marshal(params.Messages[1])
+	var assistant struct {
+		Content []map[string]interface{} `json:"content"`
+	}
+	json.Unmarshal(data, &assistant)
+	if len(assistant.Content) != 3 {
+		t.Fatalf("assistant content = %s", data)
+	}
+	if assistant.Content[0]["type"] != "thinking" || assistant.Content[0]["signature"] != "sig-1" {
+		t.Errorf("first block = %v, want signed thinking", assistant.Content[0])
+	}
+	if assistant.Content[1]["type"] != "redacted_thinking" || assistant.Content[2]["type"] != "tool_use" {
+		t.Errorf("blocks = %s", data)
+	}
+
+	if params.Thinking.OfEnabled == nil || params.Thinking.OfEnabled.BudgetTokens != 2048 {
+		t.Errorf("Thinking = %+v, want enabled with 2048 tokens", params.Thinking)
+	}
+	if params.MaxTokens != 3048 {
+		t.Errorf("MaxTokens = %d, want budget plus max_tokens", params.MaxTokens)
+	}
+	if params.Temperature.Valid() {
+		t.Error("temperature must not be set with extended thinking")
+	}
+}
+
+func TestParseClaudeResponse_Thinking(t *testing.T) {
+	var resp anthropic.Message
+	if err := json.Unmarshal([]byte(`{
+		"content": [
+			{"type": "thinking", "thinking": "Let me check.", "signature": "sig-1"},
+			{"type": "redacted_thinking", "data": "opaque"},
+			{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "SF"}}
+		],
+		"stop_reason": "tool_use"
+	}`), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	result := parseClaudeResponse(&resp)
+	if result.Reasoning != "Let me check." {
+		t.Errorf("Reasoning = %q", result.Reasoning)
+	}
+	if len(result.ReasoningBlocks) != 2 || result.ReasoningBlocks[0].Signature != "sig-1" || result.ReasoningBlocks[1].Data != "opaque" {
+		t.Errorf("ReasoningBlocks = %+v", result.ReasoningBlocks)
+	}
+	if len(result.ToolCalls) != 1 {
+		t.Errorf("ToolCalls = %+v", result.ToolCalls)
+	}
+}
+
 func TestParseClaudeResponse_TextOnly(t *testing.T) {
 	resp := &anthropic.Message{
 		Content: []anthropic.ContentBlockUnion{},
@@ -194,6 +335,100 @@ func TestClaudeProvider_ChatRoundTrip(t *testing.T) {
 	}
 }
 
+func TestClaudeProvider_ListModels(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": [
+			{"type": "model", "id": "claude-sonnet-4-5-20250929", "display_name": "Claude Sonnet 4.5", "created_at": "2025-09-29T00:00:00Z"},
+			{"type": "model", "id": "claude-haiku-4-5-20251001", "display_name": "Claude Haiku 4.5", "created_at": "2025-10-01T00:00:00Z"}
+		], "has_more": false, "first_id": "claude-sonnet-4-5-20250929", "last_id": "claude-haiku-4-5-20251001"}`))
+	}))
+	defer server.Close()
+
+	provider := NewClaudeProvider("test-token")
+	provider.client = createAnthropicTestClient(server.URL, "test-token")
+
+	for i := 0; i < 2; i++ {
+		models, err := provider.ListModels(t.Context())
+		if err != nil {
+			t.Fatalf("ListModels() error: %v", err)
+		}
+		if len(models) != 2 || models[0] != "claude-haiku-4-5-20251001" {
+			t.Errorf("models = %v", models)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1 (cached)", requests)
+	}
+}
+
+func TestClaudeTokenSource_RefreshesOAuth(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(auth.PassphraseEnv, "")
+
+	refreshes := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshes++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "fresh-token",
+			"refresh_token": "next-refresh",
+			"expires_in":    3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	orig := claudeOAuthConfig
+	claudeOAuthConfig = func(clientID string) auth.OAuthProviderConfig {
+		cfg := auth.AnthropicOAuthConfig(clientID)
+		cfg.TokenURL = tokenServer.URL
+		return cfg
+	}
+	defer func() { claudeOAuthConfig = orig }()
+
+	auth.SetCredential("anthropic", &auth.AuthCredential{
+		AccessToken:  "stale-token",
+		RefreshToken: "old-refresh",
+		ExpiresAt:    time.Now().Add(time.Minute),
+		Provider:     "anthropic",
+		AuthMethod:   "oauth",
+	})
+
+	var gotAuth, gotBeta string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotBeta = r.Header.Get("anthropic-beta")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "msg_1", "type": "message", "role": "assistant", "content": [{"type": "text", "text": "ok"}], "stop_reason": "end_turn", "usage": {"input_tokens": 1, "output_tokens": 1}}`))
+	}))
+	defer server.Close()
+
+	provider := NewClaudeProviderWithTokenSource("stale-token", createClaudeTokenSource("anthropic", "test-client"))
+	provider.client = createAnthropicTestClient(server.URL, "stale-token")
+	provider.oauth = true
+
+	for i := 0; i < 2; i++ {
+		if _, err := provider.Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, "claude-sonnet-4-5-20250929", nil); err != nil {
+			t.Fatalf("Chat() error: %v", err)
+		}
+	}
+	if gotAuth != "Bearer fresh-token" || !strings.Contains(gotBeta, "oauth-2025-04-20") {
+		t.Errorf("Authorization = %q, anthropic-beta = %q", gotAuth, gotBeta)
+	}
+	if refreshes != 1 {
+		t.Errorf("refreshes = %d, want 1", refreshes)
+	}
+	cred, _ := auth.GetCredential("anthropic")
+	if cred.RefreshToken != "next-refresh" {
+		t.Errorf("stored refresh token = %q", cred.RefreshToken)
+	}
+}
+
 func TestClaudeProvider_GetDefaultModel(t *testing.T) {
 	p := NewClaudeProvider("test-token")
 	if got := p.GetDefaultModel(); got != "claude-sonnet-4-5-20250929" {
@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
 	"github.com/openai/openai-go/v3/responses"
+	"github.com/openai/openai-go/v3/shared"
 	"github.com/sipeed/picoclaw/pkg/auth"
 	"github.com/sipeed/picoclaw/pkg/logger"
 )
@@ -22,6 +24,10 @@ type CodexProvider struct {
 	accountID       string
 	tokenSource     func() (string, string, error)
 	enableWebSearch bool
+	// responsesAPI marks a plain OpenAI Responses API endpoint rather than
+	// the ChatGPT Codex backend, so no model fallback or account ID applies.
+	responsesAPI bool
+	models       modelCache
 }
 
 const defaultCodexInstructions = "You are Codex, a coding assistant."
@@ -44,6 +50,26 @@ func NewCodexProvider(token, accountID string) *CodexProvider {
 	}
 }
 
+// NewResponsesProvider creates a provider for any OpenAI Responses API endpoint.
+func NewResponsesProvider(apiKey, apiBase string, httpClient *http.Client, headers map[string]string) *CodexProvider {
+	if apiBase == "" {
+		apiBase = "https://api.openai.com/v1"
+	}
+	opts := []option.RequestOption{
+		option.WithBaseURL(apiBase),
+		option.WithAPIKey(apiKey),
+		option.WithHTTPClient(httpClient),
+	}
+	for k, v := range headers {
+		opts = append(opts, option.WithHeader(k, v))
+	}
+	client := openai.NewClient(opts...)
+	return &CodexProvider{
+		client:       &client,
+		responsesAPI: true,
+	}
+}
+
 func NewCodexProviderWithTokenSource(token, accountID string, tokenSource func() (string, string, error)) *CodexProvider {
 	p := NewCodexProvider(token, accountID)
 	p.tokenSource = tokenSource
@@ -53,7 +79,10 @@ func NewCodexProviderWithTokenSource(token, accountID string, tokenSource func()
 func (p *CodexProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
 	var opts []option.RequestOption
 	accountID := p.accountID
-	resolvedModel, fallbackReason := resolveCodexModel(model)
+	resolvedModel, fallbackReason := model, ""
+	if !p.responsesAPI {
+		resolvedModel, fallbackReason = resolveCodexModel(model)
+	}
 	if fallbackReason != "" {
 		logger.WarnCF("provider.codex", "Requested model is not compatible with Codex backend, using fallback", map[string]interface{}{
 			"requested_model": model,
@@ -73,7 +102,7 @@ func (p *CodexProvider) Chat(ctx context.Context, messages []Message, tools []To
 	}
 	if accountID != "" {
 		opts = append(opts, option.WithHeader("Chatgpt-Account-Id", accountID))
-	} else {
+	} else if !p.responsesAPI {
 		logger.WarnCF("provider.codex", "No account id found for Codex request; backend may reject with 400", map[string]interface{}{
 			"requested_model": model,
 			"resolved_model":  resolvedModel,
@@ -138,6 +167,25 @@ func (p *CodexProvider) Chat(ctx context.Context, messages []Message, tools []To
 	return parseCodexResponse(resp), nil
 }
 
+// ListModels returns the models of a plain Responses API endpoint. The
+// ChatGPT Codex backend has no models endpoint.
+func (p *CodexProvider) ListModels(ctx context.Context) ([]string, error) {
+	if !p.responsesAPI {
+		return nil, ErrListModelsUnsupported
+	}
+	return p.models.get(ctx, func(ctx context.Context) ([]string, error) {
+		var ids []string
+		pager := p.client.Models.ListAutoPaging(ctx)
+		for pager.Next() {
+			ids = append(ids, pager.Current().ID)
+		}
+		if err := pager.Err(); err != nil {
+			return nil, fmt.Errorf("list models: %w", err)
+		}
+		return ids, nil
+	})
+}
+
 func (p *CodexProvider) GetDefaultModel() string {
 	return codexDefaultModel
 }
@@ -272,9 +320,33 @@ func buildCodexParams(messages []Message, tools []ToolDefinition, model string,
 		params.Tools = translateToolsForCodex(tools, enableWebSearch)
 	}
 
+	if budget, ok := options["thinking_budget"].(int); ok && budget > 0 {
+		params.Reasoning = shared.ReasoningParam{
+			Effort:  reasoningEffortForBudget(budget),
+			Summary: shared.ReasoningSummaryAuto,
+		}
+	}
+
+	if key, ok := options["prompt_cache_key"].(string); ok && key != "" {
+		params.PromptCacheKey = openai.Opt(key)
+	}
+
 	return params
 }
 
+// reasoningEffortForBudget maps a thinking token budget onto the coarse
+// effort levels of OpenAI reasoning models.
+func reasoningEffortForBudget(budget int) shared.ReasoningEffort {
+	switch {
+	case budget <= 4096:
+		return shared.ReasoningEffortLow
+	case budget <= 16384:
+		return shared.ReasoningEffortMedium
+	default:
+		return shared.ReasoningEffortHigh
+	}
+}
+
 func resolveCodexToolCall(tc ToolCall) (name string, arguments string, ok bool) {
 	name = tc.Name
 	if name == "" && tc.Function != nil {
@@ -331,9 +403,16 @@ func translateToolsForCodex(tools []ToolDefinition, enableWebSearch bool) []resp
 func parseCodexResponse(resp *responses.Response) *LLMResponse {
 	var content strings.Builder
 	var toolCalls []ToolCall
+	var reasoning []string
 
 	for _, item := range resp.Output {
 		switch item.Type {
+		case "reasoning":
+			for _, sum := range item.Summary {
+				if sum.Text != "" {
+					reasoning = append(reasoning, sum.Text)
+				}
+			}
 		case "message":
 			for _, c := range item.Content {
 				if c.Type == "output_text" {
@@ -367,6 +446,7 @@ func parseCodexResponse(resp *responses.Response) *LLMResponse {
 			PromptTokens:     int(resp.Usage.InputTokens),
 			CompletionTokens: int(resp.Usage.OutputTokens),
 			TotalTokens:      int(resp.Usage.TotalTokens),
+			CacheReadTokens:  int(resp.Usage.InputTokensDetails.CachedTokens),
 		}
 	}
 
@@ -375,12 +455,15 @@ func parseCodexResponse(resp *responses.Response) *LLMResponse {
 		ToolCalls:    toolCalls,
 		FinishReason: finishReason,
 		Usage:        usage,
+		Reasoning:    strings.Join(reasoning, "\n\n"),
 	}
 }
 
-func createCodexTokenSource() func() (string, string, error) {
+// createCodexTokenSource returns the OpenAI token and account stored under
+// key (see auth.CredentialKey), refreshing OAuth tokens before they expire.
+func createCodexTokenSource(key string) func() (string, string, error) {
 	return func() (string, string, error) {
-		cred, err := auth.GetCredential("openai")
+		cred, err := auth.GetCredential(key)
 		if err != nil {
 			return "", "", fmt.Errorf("loading auth credentials: %w", err)
 		}
@@ -390,14 +473,14 @@ func createCodexTokenSource() func() (string, string, error) {
 
 		if cred.AuthMethod == "oauth" && cred.NeedsRefresh() && cred.RefreshToken != "" {
 			oauthCfg := auth.OpenAIOAuthConfig()
-			refreshed, err := auth.RefreshAccessToken(cred, oauthCfg)
+			refreshed, err := auth.RefreshAccessToken(context.Background(), cred, oauthCfg)
 			if err != nil {
 				return "", "", fmt.Errorf("refreshing token: %w", err)
 			}
 			if refreshed.AccountID == "" {
 				refreshed.AccountID = cred.AccountID
 			}
-			if err := auth.SetCredential("openai", refreshed); err != nil {
+			if err := auth.SetCredential(key, refreshed); err != nil {
 				return "", "", fmt.Errorf("saving refreshed token: %w", err)
 			}
 			return refreshed.AccessToken, refreshed.AccountID, nil
@@ -233,6 +233,35 @@ func TestParseCodexResponse_TextOutput(t *testing.T) {
 	}
 }
 
+func TestParseCodexResponse_ReasoningSummary(t *testing.T) {
+	respJSON := `{
+		"id": "resp_test",
+		"object": "response",
+		"status": "completed",
+		"output": [
+			{"id": "rs_1", "type": "reasoning", "summary": [{"type": "summary_text", "text": "Compared both options."}]},
+			{"id": "msg_1", "type": "message", "role": "assistant", "status": "completed", "content": [{"type": "output_text", "text": "Use B."}]}
+		]
+	}`
+
+	var resp responses.Response
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	result := parseCodexResponse(&resp)
+	if result.Content != "Use B." || result.Reasoning != "Compared both options." {
+		t.Errorf("Content/Reasoning = %q/%q", result.Content, result.Reasoning)
+	}
+}
+
+func TestBuildCodexParams_ThinkingBudget(t *testing.T) {
+	params := buildCodexParams([]Message{{Role: "user", Content: "Hi"}}, nil, "o4-mini", map[string]interface{}{"thinking_budget": 8000}, false)
+	if params.Reasoning.Effort != "medium" || params.Reasoning.Summary != "auto" {
+		t.Errorf("Reasoning = %+v", params.Reasoning)
+	}
+}
+
 func TestParseCodexResponse_FunctionCall(t *testing.T) {
 	respJSON := `{
 		"id": "resp_test",
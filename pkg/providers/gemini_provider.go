@@ -0,0 +1,555 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+const geminiDefaultBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// maxGeminiInlineBytes caps inline media; the API rejects requests over 20MB.
+const maxGeminiInlineBytes = 15 * 1024 * 1024
+
+// GeminiProvider talks to the native Gemini generateContent API.
+type GeminiProvider struct {
+	apiKey         string
+	apiBase        string
+	safetySettings []config.GeminiSafetySetting
+	headers        map[string]string
+	httpClient     *http.Client
+	models         modelCache
+}
+
+func NewGeminiProvider(apiKey, apiBase, proxy string, safetySettings []config.GeminiSafetySetting) *GeminiProvider {
+	if apiBase == "" {
+		apiBase = geminiDefaultBaseURL
+	}
+
+	client := &http.Client{
+		Timeout: 120 * time.Second,
+	}
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err == nil {
+			client.Transport = &http.Transport{
+				Proxy: http.ProxyURL(proxyURL),
+			}
+		}
+	}
+
+	return &GeminiProvider{
+		apiKey:         apiKey,
+		apiBase:        strings.TrimRight(apiBase, "/"),
+		safetySettings: safetySettings,
+		httpClient:     client,
+	}
+}
+
+// Gemini request/response wire types. Only the fields picoclaw uses are mapped.
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+	SafetySettings    []geminiSafetySetting   `json:"safetySettings,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+	// ThoughtSignature must be sent back on the part it came with for the
+	// model to keep its reasoning across function calls.
+	ThoughtSignature string `json:"thoughtSignature,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFunctionCall struct {
+	ID   string                 `json:"id,omitempty"`
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string                 `json:"id,omitempty"`
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode string `json:"mode"`
+	} `json:"functionCallingConfig"`
+}
+
+type geminiSafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+type geminiGenerationConfig struct {
+	MaxOutputTokens int                   `json:"maxOutputTokens,omitempty"`
+	Temperature     *float64              `json:"temperature,omitempty"`
+	ThinkingConfig  *geminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+type geminiThinkingConfig struct {
+	ThinkingBudget  int  `json:"thinkingBudget"`
+	IncludeThoughts bool `json:"includeThoughts"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata *struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		TotalTokenCount         int `json:"totalTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+func (p *GeminiProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	model = normalizeGeminiModel(model)
+	if model == "" {
+		model = p.GetDefaultModel()
+	}
+
+	reqBody := buildGeminiRequest(messages, tools, options)
+	for _, s := range p.safetySettings {
+		reqBody.SafetySettings = append(reqBody.SafetySettings, geminiSafetySetting{
+			Category:  s.Category,
+			Threshold: s.Threshold,
+		})
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/models/%s:generateContent", p.apiBase, url.PathEscape(model))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("x-goog-api-key", p.apiKey)
+	}
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	observeHeaders(ctx, resp.Header)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body), Header: resp.Header}
+	}
+
+	return parseGeminiResponse(body)
+}
+
+// ListModels returns the models that support generateContent (models.list).
+func (p *GeminiProvider) ListModels(ctx context.Context) ([]string, error) {
+	return p.models.get(ctx, func(ctx context.Context) ([]string, error) {
+		var names []string
+		pageToken := ""
+		for {
+			var page struct {
+				Models []struct {
+					Name                       string   `json:"name"`
+					SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+				} `json:"models"`
+				NextPageToken string `json:"nextPageToken"`
+			}
+			endpoint := p.apiBase + "/models?pageSize=1000"
+			if pageToken != "" {
+				endpoint += "&pageToken=" + url.QueryEscape(pageToken)
+			}
+			err := getJSON(ctx, p.httpClient, endpoint, func(req *http.Request) {
+				if p.apiKey != "" {
+					req.Header.Set("x-goog-api-key", p.apiKey)
+				}
+				for k, v := range p.headers {
+					req.Header.Set(k, v)
+				}
+			}, &page)
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range page.Models {
+				for _, method := range m.SupportedGenerationMethods {
+					if method == "generateContent" {
+						names = append(names, strings.TrimPrefix(m.Name, "models/"))
+						break
+					}
+				}
+			}
+			if page.NextPageToken == "" {
+				return names, nil
+			}
+			pageToken = page.NextPageToken
+		}
+	})
+}
+
+func (p *GeminiProvider) GetDefaultModel() string {
+	return "gemini-2.5-flash"
+}
+
+// normalizeGeminiModel strips routing prefixes such as "gemini/" or "models/".
+func normalizeGeminiModel(model string) string {
+	for _, prefix := range []string{"gemini/", "google/", "models/"} {
+		model = strings.TrimPrefix(model, prefix)
+	}
+	return model
+}
+
+func buildGeminiRequest(messages []Message, tools []ToolDefinition, options map[string]interface{}) *geminiRequest {
+	req := &geminiRequest{}
+
+	// Gemini matches function responses by name, so remember which tool
+	// each call ID referred to.
+	toolNames := make(map[string]string)
+
+	var systemParts []geminiPart
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				systemParts = append(systemParts, geminiPart{Text: msg.Content})
+			}
+
+		case "user":
+			if msg.ToolCallID != "" {
+				req.appendContent("user", geminiToolResultPart(msg, toolNames))
+				continue
+			}
+			var parts []geminiPart
+			if msg.Content != "" {
+				parts = append(parts, geminiPart{Text: msg.Content})
+			}
+			for _, m := range msg.Media {
+				if blob := loadGeminiBlob(m); blob != nil {
+					parts = append(parts, geminiPart{InlineData: blob})
+				}
+			}
+			req.appendContent("user", parts...)
+
+		case "assistant":
+			var parts []geminiPart
+			if msg.Content != "" {
+				parts = append(parts, geminiPart{Text: msg.Content})
+			}
+			signatures := make(map[string]string)
+			for _, rb := range msg.ReasoningBlocks {
+				if rb.Type == "thought_signature" {
+					signatures[rb.ToolCallID] = rb.Signature
+				}
+			}
+			for _, tc := range msg.ToolCalls {
+				name, args := toolCallNameAndArgs(tc)
+				toolNames[tc.ID] = name
+				parts = append(parts, geminiPart{
+					FunctionCall: &geminiFunctionCall{
+						ID:   tc.ID,
+						Name: name,
+						Args: args,
+					},
+					ThoughtSignature: signatures[tc.ID],
+				})
+			}
+			req.appendContent("model", parts...)
+
+		case "tool":
+			req.appendContent("user", geminiToolResultPart(msg, toolNames))
+		}
+	}
+
+	if len(systemParts) > 0 {
+		req.SystemInstruction = &geminiContent{Parts: systemParts}
+	}
+
+	if len(tools) > 0 {
+		decls := make([]geminiFunctionDeclaration, 0, len(tools))
+		for _, t := range tools {
+			decl := geminiFunctionDeclaration{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+			}
+			if len(t.Function.Parameters) > 0 {
+				decl.Parameters, _ = sanitizeGeminiSchema(t.Function.Parameters).(map[string]interface{})
+			}
+			decls = append(decls, decl)
+		}
+		req.Tools = []geminiTool{{FunctionDeclarations: decls}}
+		req.ToolConfig = &geminiToolConfig{}
+		req.ToolConfig.FunctionCallingConfig.Mode = "AUTO"
+	}
+
+	genCfg := &geminiGenerationConfig{}
+	if maxTokens, ok := options["max_tokens"].(int); ok {
+		genCfg.MaxOutputTokens = maxTokens
+	}
+	if temperature, ok := options["temperature"].(float64); ok {
+		genCfg.Temperature = &temperature
+	}
+	if budget, ok := options["thinking_budget"].(int); ok && budget > 0 {
+		genCfg.ThinkingConfig = &geminiThinkingConfig{ThinkingBudget: budget, IncludeThoughts: true}
+	}
+	if genCfg.MaxOutputTokens > 0 || genCfg.Temperature != nil || genCfg.ThinkingConfig != nil {
+		req.GenerationConfig = genCfg
+	}
+
+	return req
+}
+
+// appendContent adds parts to the conversation, merging consecutive turns of
+// the same role (e.g. several tool results) into one content entry.
+func (r *geminiRequest) appendContent(role string, parts ...geminiPart) {
+	if len(parts) == 0 {
+		return
+	}
+	if n := len(r.Contents); n > 0 && r.Contents[n-1].Role == role {
+		r.Contents[n-1].Parts = append(r.Contents[n-1].Parts, parts...)
+		return
+	}
+	r.Contents = append(r.Contents, geminiContent{Role: role, Parts: parts})
+}
+
+func geminiToolResultPart(msg Message, toolNames map[string]string) geminiPart {
+	name := toolNames[msg.ToolCallID]
+	if name == "" {
+		name = msg.ToolCallID
+	}
+
+	// Structured tool output is passed through as-is, plain text is wrapped
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(msg.Content), &response); err != nil || response == nil {
+		response = map[string]interface{}{"content": msg.Content}
+	}
+
+	return geminiPart{FunctionResponse: &geminiFunctionResponse{
+		ID:       msg.ToolCallID,
+		Name:     name,
+		Response: response,
+	}}
+}
+
+func toolCallNameAndArgs(tc ToolCall) (string, map[string]interface{}) {
+	name := tc.Name
+	if name == "" && tc.Function != nil {
+		name = tc.Function.Name
+	}
+
+	args := tc.Arguments
+	if args == nil && tc.Function != nil && tc.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+			args = map[string]interface{}{"raw": tc.Function.Arguments}
+		}
+	}
+	return name, args
+}
+
+// geminiUnsupportedSchemaKeys are JSON Schema keywords the Gemini API rejects
+// in functionDeclarations.
+var geminiUnsupportedSchemaKeys = map[string]bool{
+	"$schema":              true,
+	"$ref":                 true,
+	"$defs":                true,
+	"$id":                  true,
+	"definitions":          true,
+	"additionalProperties": true,
+	"examples":             true,
+	"const":                true,
+}
+
+// sanitizeGeminiSchema returns a copy of a JSON schema without keywords
+// unsupported by Gemini. Property names are kept even if they collide with a
+// keyword.
+func sanitizeGeminiSchema(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			if geminiUnsupportedSchemaKeys[k] {
+				continue
+			}
+			if k == "properties" {
+				if props, ok := child.(map[string]interface{}); ok {
+					cleaned := make(map[string]interface{}, len(props))
+					for name, prop := range props {
+						cleaned[name] = sanitizeGeminiSchema(prop)
+					}
+					out[k] = cleaned
+					continue
+				}
+			}
+			out[k] = sanitizeGeminiSchema(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, child := range val {
+			out[i] = sanitizeGeminiSchema(child)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// loadGeminiBlob turns a data: URL or a local file path into inline data.
+// Unsupported or unreadable media is skipped.
+func loadGeminiBlob(media string) *geminiBlob {
+	if strings.HasPrefix(media, "data:") {
+		header, data, ok := strings.Cut(strings.TrimPrefix(media, "data:"), ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return nil
+		}
+		return &geminiBlob{MimeType: strings.TrimSuffix(header, ";base64"), Data: data}
+	}
+
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(media)))
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	if !strings.HasPrefix(mimeType, "image/") && !strings.HasPrefix(mimeType, "audio/") &&
+		!strings.HasPrefix(mimeType, "video/") && mimeType != "application/pdf" {
+		return nil
+	}
+
+	info, err := os.Stat(media)
+	if err != nil || info.Size() > maxGeminiInlineBytes {
+		return nil
+	}
+	data, err := os.ReadFile(media)
+	if err != nil {
+		return nil
+	}
+	return &geminiBlob{MimeType: mimeType, Data: base64.StdEncoding.EncodeToString(data)}
+}
+
+func parseGeminiResponse(body []byte) (*LLMResponse, error) {
+	var apiResponse geminiResponse
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if apiResponse.PromptFeedback != nil && apiResponse.PromptFeedback.BlockReason != "" && len(apiResponse.Candidates) == 0 {
+		return nil, fmt.Errorf("gemini blocked the prompt: %s", apiResponse.PromptFeedback.BlockReason)
+	}
+
+	result := &LLMResponse{FinishReason: "stop"}
+	if u := apiResponse.UsageMetadata; u != nil {
+		result.Usage = &UsageInfo{
+			PromptTokens:     u.PromptTokenCount,
+			CompletionTokens: u.CandidatesTokenCount,
+			TotalTokens:      u.TotalTokenCount,
+			CacheReadTokens:  u.CachedContentTokenCount,
+		}
+	}
+
+	if len(apiResponse.Candidates) == 0 {
+		return result, nil
+	}
+
+	candidate := apiResponse.Candidates[0]
+	var content, reasoning strings.Builder
+	for _, part := range candidate.Content.Parts {
+		if part.Thought {
+			reasoning.WriteString(part.Text)
+			continue
+		}
+		if part.FunctionCall != nil {
+			id := part.FunctionCall.ID
+			if id == "" {
+				id = newToolCallID()
+			}
+			args := part.FunctionCall.Args
+			if args == nil {
+				args = map[string]interface{}{}
+			}
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				ID:        id,
+				Name:      part.FunctionCall.Name,
+				Arguments: args,
+			})
+			if part.ThoughtSignature != "" {
+				result.ReasoningBlocks = append(result.ReasoningBlocks, ReasoningBlock{
+					Type:       "thought_signature",
+					Signature:  part.ThoughtSignature,
+					ToolCallID: id,
+				})
+			}
+			continue
+		}
+		content.WriteString(part.Text)
+	}
+	result.Content = content.String()
+	result.Reasoning = reasoning.String()
+
+	switch candidate.FinishReason {
+	case "MAX_TOKENS":
+		result.FinishReason = "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		result.FinishReason = "content_filter"
+	}
+	if len(result.ToolCalls) > 0 {
+		result.FinishReason = "tool_calls"
+	}
+
+	return result, nil
+}
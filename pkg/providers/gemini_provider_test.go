@@ -0,0 +1,346 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestBuildGeminiRequest_SystemAndMessages(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "You are helpful"},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello!"},
+		{Role: "user", Content: "How are you?"},
+	}
+	req := buildGeminiRequest(messages, nil, map[string]interface{}{
+		"max_tokens":  1024,
+		"temperature": 0.5,
+	})
+
+	if req.SystemInstruction == nil || req.SystemInstruction.Parts[0].Text != "You are helpful" {
+		t.Fatalf("SystemInstruction = %+v", req.SystemInstruction)
+	}
+	if len(req.Contents) != 3 {
+		t.Fatalf("len(Contents) = %d, want 3", len(req.Contents))
+	}
+	if req.Contents[1].Role != "model" {
+		t.Errorf("assistant role = %q, want model", req.Contents[1].Role)
+	}
+	if req.GenerationConfig == nil || req.GenerationConfig.MaxOutputTokens != 1024 {
+		t.Errorf("GenerationConfig = %+v", req.GenerationConfig)
+	}
+	if req.GenerationConfig.Temperature == nil || *req.GenerationConfig.Temperature != 0.5 {
+		t.Errorf("Temperature = %v, want 0.5", req.GenerationConfig.Temperature)
+	}
+}
+
+func TestBuildGeminiRequest_ToolCallRoundTrip(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "Weather in SF and NYC?"},
+		{
+			Role: "assistant",
+			ToolCalls: []ToolCall{
+				{ID: "call_1", Name: "get_weather", Arguments: map[string]interface{}{"city": "SF"}},
+				{ID: "call_2", Type: "function", Function: &FunctionCall{Name: "get_weather", Arguments: `{"city":"NYC"}`}},
+			},
+		},
+		{Role: "tool", Content: `{"temp": 72}`, ToolCallID: "call_1"},
+		{Role: "tool", Content: "cloudy", ToolCallID: "call_2"},
+	}
+	req := buildGeminiRequest(messages, nil, nil)
+
+	if len(req.Contents) != 3 {
+		t.Fatalf("len(Contents) = %d, want 3 (tool results merged)", len(req.Contents))
+	}
+
+	calls := req.Contents[1].Parts
+	if len(calls) != 2 || calls[1].FunctionCall == nil || calls[1].FunctionCall.Args["city"] != "NYC" {
+		t.Fatalf("function calls = %+v", calls)
+	}
+
+	results := req.Contents[2].Parts
+	if len(results) != 2 {
+		t.Fatalf("len(function responses) = %d, want 2", len(results))
+	}
+	if results[0].FunctionResponse.Name != "get_weather" {
+		t.Errorf("response name = %q, want get_weather", results[0].FunctionResponse.Name)
+	}
+	if results[0].FunctionResponse.Response["temp"] != float64(72) {
+		t.Errorf("structured response = %v", results[0].FunctionResponse.Response)
+	}
+	if results[1].FunctionResponse.Response["content"] != "cloudy" {
+		t.Errorf("text response = %v", results[1].FunctionResponse.Response)
+	}
+}
+
+func TestBuildGeminiRequest_ToolsSchemaSanitized(t *testing.T) {
+	tools := []ToolDefinition{{
+		Type: "function",
+		Function: ToolFunctionDefinition{
+			Name:        "read_file",
+			Description: "Read a file",
+			Parameters: map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]interface{}{
+					"path":  map[string]interface{}{"type": "string", "$schema": "x"},
+					"const": map[string]interface{}{"type": "string"},
+				},
+				"required": []interface{}{"path"},
+			},
+		},
+	}}
+	req := buildGeminiRequest([]Message{{Role: "user", Content: "hi"}}, tools, nil)
+
+	if len(req.Tools) != 1 || len(req.Tools[0].FunctionDeclarations) != 1 {
+		t.Fatalf("Tools = %+v", req.Tools)
+	}
+	params := req.Tools[0].FunctionDeclarations[0].Parameters
+	if _, ok := params["additionalProperties"]; ok {
+		t.Error("additionalProperties should be stripped")
+	}
+	props := params["properties"].(map[string]interface{})
+	if _, ok := props["path"].(map[string]interface{})["$schema"]; ok {
+		t.Error("nested $schema should be stripped")
+	}
+	if _, ok := props["const"]; !ok {
+		t.Error("property named like a keyword should be kept")
+	}
+	if req.ToolConfig == nil || req.ToolConfig.FunctionCallingConfig.Mode != "AUTO" {
+		t.Errorf("ToolConfig = %+v", req.ToolConfig)
+	}
+}
+
+func TestBuildGeminiRequest_InlineMedia(t *testing.T) {
+	imgPath := filepath.Join(t.TempDir(), "photo.png")
+	if err := os.WriteFile(imgPath, []byte("\x89PNG fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []Message{{
+		Role:    "user",
+		Content: "What is this?",
+		Media:   []string{imgPath, "data:image/jpeg;base64,AAAA", "/nonexistent/file.png", "notes.txt"},
+	}}
+	req := buildGeminiRequest(messages, nil, nil)
+
+	parts := req.Contents[0].Parts
+	if len(parts) != 3 {
+		t.Fatalf("len(parts) = %d, want 3 (text + 2 images)", len(parts))
+	}
+	if parts[1].InlineData == nil || parts[1].InlineData.MimeType != "image/png" {
+		t.Errorf("file inline data = %+v", parts[1].InlineData)
+	}
+	if parts[2].InlineData == nil || parts[2].InlineData.MimeType != "image/jpeg" || parts[2].InlineData.Data != "AAAA" {
+		t.Errorf("data URL inline data = %+v", parts[2].InlineData)
+	}
+}
+
+func TestParseGeminiResponse_FunctionCall(t *testing.T) {
+	body := []byte(`{
+		"candidates": [{
+			"content": {"role": "model", "parts": [
+				{"text": "Checking. "},
+				{"functionCall": {"name": "get_weather", "args": {"city": "SF"}}}
+			]},
+			"finishReason": "STOP"
+		}],
+		"usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 5, "totalTokenCount": 15}
+	}`)
+
+	resp, err := parseGeminiResponse(body)
+	if err != nil {
+		t.Fatalf("parseGeminiResponse() error: %v", err)
+	}
+	if resp.Content != "Checking. " {
+		t.Errorf("Content = %q", resp.Content)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "get_weather" || resp.ToolCalls[0].ID == "" {
+		t.Fatalf("ToolCalls = %+v", resp.ToolCalls)
+	}
+	if resp.ToolCalls[0].Arguments["city"] != "SF" {
+		t.Errorf("Arguments = %v", resp.ToolCalls[0].Arguments)
+	}
+	if resp.FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want tool_calls", resp.FinishReason)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 15 || resp.Usage.PromptTokens != 10 {
+		t.Errorf("Usage = %+v", resp.Usage)
+	}
+}
+
+func TestParseGeminiResponse_Thoughts(t *testing.T) {
+	body := []byte(`{
+		"candidates": [{
+			"content": {"role": "model", "parts": [
+				{"text": "Thinking it over.", "thought": true},
+				{"text": "Answer."}
+			]},
+			"finishReason": "STOP"
+		}]
+	}`)
+
+	resp, err := parseGeminiResponse(body)
+	if err != nil {
+		t.Fatalf("parseGeminiResponse() error: %v", err)
+	}
+	if resp.Content != "Answer." || resp.Reasoning != "Thinking it over." {
+		t.Errorf("Content/Reasoning = %q/%q", resp.Content, resp.Reasoning)
+	}
+
+	req := buildGeminiRequest([]Message{{Role: "user", Content: "hi"}}, nil, map[string]interface{}{"thinking_budget": 2048})
+	if tc := req.GenerationConfig.ThinkingConfig; tc == nil || tc.ThinkingBudget != 2048 || !tc.IncludeThoughts {
+		t.Errorf("ThinkingConfig = %+v", tc)
+	}
+}
+
+func TestGeminiThoughtSignatureRoundTrip(t *testing.T) {
+	body := []byte(`{
+		"candidates": [{
+			"content": {"role": "model", "parts": [
+				{"functionCall": {"name": "get_weather", "args": {"city": "SF"}}, "thoughtSignature": "c2lnLTE="},
+				{"functionCall": {"name": "get_weather", "args": {"city": "NYC"}}}
+			]},
+			"finishReason": "STOP"
+		}]
+	}`)
+
+	resp, err := parseGeminiResponse(body)
+	if err != nil {
+		t.Fatalf("parseGeminiResponse() error: %v", err)
+	}
+	if len(resp.ReasoningBlocks) != 1 || resp.ReasoningBlocks[0].ToolCallID != resp.ToolCalls[0].ID {
+		t.Fatalf("ReasoningBlocks = %+v, want the signature of the first call", resp.ReasoningBlocks)
+	}
+
+	req := buildGeminiRequest([]Message{
+		{Role: "user", Content: "Weather in SF and NYC?"},
+		{Role: "assistant", ToolCalls: resp.ToolCalls, ReasoningBlocks: resp.ReasoningBlocks},
+	}, nil, nil)
+	parts := req.Contents[1].Parts
+	if parts[0].ThoughtSignature != "c2lnLTE=" || parts[1].ThoughtSignature != "" {
+		t.Errorf("signatures = %q, %q; want it back on the first call only", parts[0].ThoughtSignature, parts[1].ThoughtSignature)
+	}
+}
+
+func TestParseGeminiResponse_Blocked(t *testing.T) {
+	if _, err := parseGeminiResponse([]byte(`{"promptFeedback": {"blockReason": "SAFETY"}}`)); err == nil {
+		t.Fatal("expected error for blocked prompt")
+	}
+
+	resp, err := parseGeminiResponse([]byte(`{"candidates": [{"content": {"parts": []}, "finishReason": "SAFETY"}]}`))
+	if err != nil {
+		t.Fatalf("parseGeminiResponse() error: %v", err)
+	}
+	if resp.FinishReason != "content_filter" {
+		t.Errorf("FinishReason = %q, want content_filter", resp.FinishReason)
+	}
+}
+
+func TestGeminiProvider_Chat(t *testing.T) {
+	var gotPath, gotKey string
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotKey = r.Header.Get("x-goog-api-key")
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates": [{"content": {"parts": [{"text": "Hello"}]}, "finishReason": "STOP"}]}`))
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider("test-key", server.URL, "", []config.GeminiSafetySetting{
+		{Category: "HARM_CATEGORY_HARASSMENT", Threshold: "BLOCK_ONLY_HIGH"},
+	})
+	resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "Hi"}}, nil, "gemini/gemini-2.5-pro", nil)
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if resp.Content != "Hello" || resp.FinishReason != "stop" {
+		t.Errorf("response = %+v", resp)
+	}
+	if gotPath != "/models/gemini-2.5-pro:generateContent" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if gotKey != "test-key" {
+		t.Errorf("api key header = %q", gotKey)
+	}
+	safety, _ := gotBody["safetySettings"].([]interface{})
+	if len(safety) != 1 {
+		t.Errorf("safetySettings = %v", gotBody["safetySettings"])
+	}
+}
+
+func TestGeminiProvider_ListModels(t *testing.T) {
+	var gotKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("x-goog-api-key")
+		if r.URL.Query().Get("pageToken") == "" {
+			w.Write([]byte(`{"models": [
+				{"name": "models/gemini-2.5-pro", "supportedGenerationMethods": ["generateContent", "countTokens"]},
+				{"name": "models/text-embedding-004", "supportedGenerationMethods": ["embedContent"]}
+			], "nextPageToken": "p2"}`))
+			return
+		}
+		w.Write([]byte(`{"models": [{"name": "models/gemini-2.5-flash", "supportedGenerationMethods": ["generateContent"]}]}`))
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider("test-key", server.URL, "", nil)
+	models, err := p.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error: %v", err)
+	}
+	if len(models) != 2 || models[0] != "gemini-2.5-flash" || models[1] != "gemini-2.5-pro" {
+		t.Errorf("models = %v", models)
+	}
+	if gotKey != "test-key" {
+		t.Errorf("api key header = %q", gotKey)
+	}
+}
+
+func TestGeminiProvider_ChatError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error": {"message": "bad"}}`))
+	}))
+	defer server.Close()
+
+	p := NewGeminiProvider("test-key", server.URL, "", nil)
+	if _, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "Hi"}}, nil, "gemini-2.5-flash", nil); err == nil {
+		t.Fatal("expected error for non-200 response")
+	}
+}
+
+func TestCreateProvider_GeminiNative(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Provider = "gemini"
+	cfg.Agents.Defaults.Model = "gemini-2.5-flash"
+	cfg.Providers.Gemini.APIKey = "key"
+
+	p, err := CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider() error: %v", err)
+	}
+	if _, ok := p.(*GeminiProvider); !ok {
+		t.Fatalf("provider = %T, want *GeminiProvider", p)
+	}
+
+	cfg.Providers.Gemini.APIBase = "https://generativelanguage.googleapis.com/v1beta/openai/"
+	p, err = CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider() error: %v", err)
+	}
+	if _, ok := p.(*HTTPProvider); !ok {
+		t.Fatalf("provider = %T, want *HTTPProvider for OpenAI-compatible base", p)
+	}
+}
@@ -24,7 +24,15 @@ import (
 type HTTPProvider struct {
 	apiKey     string
 	apiBase    string
+	headers    map[string]string
 	httpClient *http.Client
+	// promptCacheKey sends options["prompt_cache_key"] to endpoints that
+	// accept it, to route requests sharing a prefix to the same cache.
+	promptCacheKey bool
+	// toolProtocols maps model IDs ("*" for any) to ToolProtocolNative or
+	// ToolProtocolPrompted.
+	toolProtocols map[string]string
+	models        modelCache
 }
 
 func NewHTTPProvider(apiKey, apiBase, proxy string) *HTTPProvider {
@@ -42,9 +50,10 @@ func NewHTTPProvider(apiKey, apiBase, proxy string) *HTTPProvider {
 	}
 
 	return &HTTPProvider{
-		apiKey:     apiKey,
-		apiBase:    strings.TrimRight(apiBase, "/"),
-		httpClient: client,
+		apiKey:         apiKey,
+		apiBase:        strings.TrimRight(apiBase, "/"),
+		httpClient:     client,
+		promptCacheKey: supportsPromptCacheKey(apiBase),
 	}
 }
 
@@ -61,9 +70,35 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 		}
 	}
 
+	auth := func(req *http.Request) {
+		if p.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+p.apiKey)
+		}
+	}
+
+	if len(tools) > 0 && toolProtocolFor(p.toolProtocols, model) == ToolProtocolPrompted {
+		requestBody := p.buildRequestBody(toPromptedMessages(messages, tools), nil, model, options)
+		resp, err := p.post(ctx, p.apiBase+"/chat/completions", requestBody, auth)
+		if err != nil {
+			return nil, err
+		}
+		if calls, content := parsePromptedToolCalls(resp.Content, tools); len(calls) > 0 {
+			resp.ToolCalls = calls
+			resp.Content = content
+			resp.FinishReason = "tool_calls"
+		}
+		return resp, nil
+	}
+
+	requestBody := p.buildRequestBody(messages, tools, model, options)
+	return p.post(ctx, p.apiBase+"/chat/completions", requestBody, auth)
+}
+
+// buildRequestBody assembles an OpenAI chat completions request.
+func (p *HTTPProvider) buildRequestBody(messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) map[string]interface{} {
 	requestBody := map[string]interface{}{
 		"model":    model,
-		"messages": messages,
+		"messages": toOpenAIMessages(messages),
 	}
 
 	if len(tools) > 0 {
@@ -90,19 +125,29 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 		}
 	}
 
+	if key, ok := options["prompt_cache_key"].(string); ok && key != "" && p.promptCacheKey {
+		requestBody["prompt_cache_key"] = key
+	}
+
+	return requestBody
+}
+
+// post sends a chat completions request; auth sets the credentials header.
+func (p *HTTPProvider) post(ctx context.Context, endpoint string, requestBody map[string]interface{}, auth func(*http.Request)) (*LLMResponse, error) {
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/chat/completions", bytes.NewReader(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	if p.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	auth(req)
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
 	}
 
 	resp, err := p.httpClient.Do(req)
@@ -110,6 +155,7 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
+	observeHeaders(ctx, resp.Header)
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -117,7 +163,7 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(body))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body), Header: resp.Header}
 	}
 
 	return p.parseResponse(body)
@@ -127,8 +173,10 @@ func (p *HTTPProvider) parseResponse(body []byte) (*LLMResponse, error) {
 	var apiResponse struct {
 		Choices []struct {
 			Message struct {
-				Content   string `json:"content"`
-				ToolCalls []struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+				Reasoning        string `json:"reasoning"`
+				ToolCalls        []struct {
 					ID       string `json:"id"`
 					Type     string `json:"type"`
 					Function *struct {
@@ -139,7 +187,16 @@ func (p *HTTPProvider) parseResponse(body []byte) (*LLMResponse, error) {
 			} `json:"message"`
 			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
-		Usage *UsageInfo `json:"usage"`
+		Usage *struct {
+			PromptTokens        int `json:"prompt_tokens"`
+			CompletionTokens    int `json:"completion_tokens"`
+			TotalTokens         int `json:"total_tokens"`
+			PromptTokensDetails *struct {
+				CachedTokens int `json:"cached_tokens"`
+			} `json:"prompt_tokens_details"`
+			// DeepSeek reports cache hits under its own name
+			PromptCacheHitTokens int `json:"prompt_cache_hit_tokens"`
+		} `json:"usage"`
 	}
 
 	if err := json.Unmarshal(body, &apiResponse); err != nil {
@@ -185,47 +242,274 @@ func (p *HTTPProvider) parseResponse(body []byte) (*LLMResponse, error) {
 		})
 	}
 
+	var usage *UsageInfo
+	if u := apiResponse.Usage; u != nil {
+		usage = &UsageInfo{
+			PromptTokens:     u.PromptTokens,
+			CompletionTokens: u.CompletionTokens,
+			TotalTokens:      u.TotalTokens,
+			CacheReadTokens:  u.PromptCacheHitTokens,
+		}
+		if u.PromptTokensDetails != nil && u.PromptTokensDetails.CachedTokens > 0 {
+			usage.CacheReadTokens = u.PromptTokensDetails.CachedTokens
+		}
+	}
+
+	// DeepSeek and Moonshot use reasoning_content; OpenRouter uses reasoning
+	reasoning := choice.Message.ReasoningContent
+	if reasoning == "" {
+		reasoning = choice.Message.Reasoning
+	}
+
 	return &LLMResponse{
 		Content:      choice.Message.Content,
 		ToolCalls:    toolCalls,
 		FinishReason: choice.FinishReason,
-		Usage:        apiResponse.Usage,
+		Usage:        usage,
+		Reasoning:    reasoning,
 	}, nil
 }
 
+// openaiMessage is the chat completions wire form of a Message.
+type openaiMessage struct {
+	Role             string     `json:"role"`
+	Content          string     `json:"content"`
+	ReasoningContent string     `json:"reasoning_content,omitempty"`
+	ToolCalls        []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID       string     `json:"tool_call_id,omitempty"`
+}
+
+// toOpenAIMessages converts messages to the wire form. Reasoning is only
+// sent back for the current turn's tool loop: thinking models need it there,
+// and reject or ignore it for earlier turns. The volatile end of the system
+// prompt (time, session) moves to the current turn's user message, so the
+// system prompt stays a stable prefix that automatic prompt caching reuses.
+func toOpenAIMessages(messages []Message) []openaiMessage {
+	turnStart := -1
+	for i, msg := range messages {
+		if msg.Role == "user" && msg.ToolCallID == "" {
+			turnStart = i
+		}
+	}
+
+	var volatile []string
+	out := make([]openaiMessage, 0, len(messages))
+	for i, msg := range messages {
+		om := openaiMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			ToolCalls:  msg.ToolCalls,
+			ToolCallID: msg.ToolCallID,
+		}
+		if msg.Role == "system" && turnStart >= 0 {
+			stable, rest := splitCachePrefix(msg)
+			om.Content = stable
+			if rest != "" {
+				volatile = append(volatile, rest)
+			}
+		}
+		if i > turnStart && msg.Role == "assistant" && len(msg.ToolCalls) > 0 {
+			om.ReasoningContent = msg.Reasoning
+		}
+		out = append(out, om)
+	}
+
+	if tail := strings.Join(volatile, "\n\n"); tail != "" {
+		out[turnStart].Content += "\n\n" + tail
+	}
+	return out
+}
+
 func (p *HTTPProvider) GetDefaultModel() string {
 	return ""
 }
 
-func createClaudeAuthProvider() (LLMProvider, error) {
-	cred, err := auth.GetCredential("anthropic")
+// ListModels returns the model IDs reported by the OpenAI-compatible /models endpoint.
+func (p *HTTPProvider) ListModels(ctx context.Context) ([]string, error) {
+	if p.apiBase == "" {
+		return nil, fmt.Errorf("API base not configured")
+	}
+	return p.models.get(ctx, func(ctx context.Context) ([]string, error) {
+		var list struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		}
+		err := getJSON(ctx, p.httpClient, p.apiBase+"/models", func(req *http.Request) {
+			if p.apiKey != "" {
+				req.Header.Set("Authorization", "Bearer "+p.apiKey)
+			}
+			for k, v := range p.headers {
+				req.Header.Set(k, v)
+			}
+		}, &list)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(list.Data))
+		for _, m := range list.Data {
+			ids = append(ids, m.ID)
+		}
+		return ids, nil
+	})
+}
+
+func createClaudeAuthProvider(pc config.ProviderConfig) (LLMProvider, error) {
+	return createProfileProvider("anthropic", pc.KeyRotation, func(key string, cred *auth.AuthCredential) LLMProvider {
+		p := NewClaudeProviderWithTokenSource(cred.AccessToken, createClaudeTokenSource(key, pc.OAuthClientID))
+		p.oauth = cred.AuthMethod == "oauth"
+		return p
+	})
+}
+
+func createCodexAuthProvider(enableWebSearch bool, rotation string) (LLMProvider, error) {
+	return createProfileProvider("openai", rotation, func(key string, cred *auth.AuthCredential) LLMProvider {
+		p := NewCodexProviderWithTokenSource(cred.AccessToken, cred.AccountID, createCodexTokenSource(key))
+		p.enableWebSearch = enableWebSearch
+		return p
+	})
+}
+
+// createProfileProvider builds a provider for each stored credential
+// profile of provider, rotating over them when there are several.
+func createProfileProvider(provider, rotation string, build func(key string, cred *auth.AuthCredential) LLMProvider) (LLMProvider, error) {
+	keys, err := auth.ProfileKeys(provider)
 	if err != nil {
 		return nil, fmt.Errorf("loading auth credentials: %w", err)
 	}
-	if cred == nil {
-		return nil, fmt.Errorf("no credentials for anthropic. Run: picoclaw auth login --provider anthropic")
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no credentials for %s. Run: picoclaw auth login --provider %s", provider, provider)
+	}
+
+	pool := make([]PoolKey, 0, len(keys))
+	for _, key := range keys {
+		cred, err := auth.GetCredential(key)
+		if err != nil {
+			return nil, fmt.Errorf("loading auth credentials: %w", err)
+		}
+		pool = append(pool, PoolKey{ID: key, Label: key, Provider: build(key, cred)})
 	}
-	return NewClaudeProviderWithTokenSource(cred.AccessToken, createClaudeTokenSource()), nil
+	if len(pool) == 1 {
+		return pool[0].Provider, nil
+	}
+	return NewRotatingProvider(provider, rotation, pool), nil
+}
+
+func createGeminiProvider(pc config.GeminiProviderConfig) LLMProvider {
+	if keys := pc.Keys(); len(keys) > 1 {
+		return withKeyRotation("gemini", pc.KeyRotation, keys, func(key string) LLMProvider {
+			return NewGeminiProvider(key, pc.APIBase, pc.Proxy, pc.SafetySettings)
+		})
+	}
+	return NewGeminiProvider(pc.APIKey, pc.APIBase, pc.Proxy, pc.SafetySettings)
+}
+
+func createOllamaProvider(pc config.OllamaProviderConfig) LLMProvider {
+	return NewOllamaProvider(pc.APIKey, pc.APIBase, pc.Proxy, pc.KeepAlive, pc.NumCtx)
 }
 
-func createCodexAuthProvider(enableWebSearch bool) (LLMProvider, error) {
-	cred, err := auth.GetCredential("openai")
+// createVLLMProvider builds the provider for a local OpenAI-compatible
+// server, which may run without an API key; requests then carry no
+// Authorization header.
+func createVLLMProvider(pc config.VLLMProviderConfig) (LLMProvider, error) {
+	keys := pc.Keys()
+	if err := validToolProtocols(pc.ToolProtocols); err != nil {
+		return nil, fmt.Errorf("providers.vllm: %w", err)
+	}
+	if len(keys) > 1 {
+		return withKeyRotation("vllm", pc.KeyRotation, keys, func(key string) LLMProvider {
+			p := NewHTTPProvider(key, pc.APIBase, pc.Proxy)
+			p.toolProtocols = pc.ToolProtocols
+			return p
+		}), nil
+	}
+	p := NewHTTPProvider(pc.APIKey, pc.APIBase, pc.Proxy)
+	p.toolProtocols = pc.ToolProtocols
+	return p, nil
+}
+
+func createAzureProvider(pc config.AzureProviderConfig) (LLMProvider, error) {
+	p, err := NewAzureProvider(pc)
 	if err != nil {
-		return nil, fmt.Errorf("loading auth credentials: %w", err)
+		return nil, err
 	}
-	if cred == nil {
-		return nil, fmt.Errorf("no credentials for openai. Run: picoclaw auth login --provider openai")
+	return p, nil
+}
+
+func createMockProvider(cfg *config.Config) (LLMProvider, error) {
+	p, err := NewMockProviderFromFile(cfg.MockScriptPath())
+	if err != nil {
+		return nil, err
 	}
-	p := NewCodexProviderWithTokenSource(cred.AccessToken, cred.AccountID, createCodexTokenSource())
-	p.enableWebSearch = enableWebSearch
 	return p, nil
 }
 
+// supportsPromptCacheKey reports whether apiBase is known to accept the
+// prompt_cache_key parameter. Other servers may reject unknown fields, so
+// providers.list entries opt in explicitly.
+func supportsPromptCacheKey(apiBase string) bool {
+	u, err := url.Parse(apiBase)
+	return err == nil && u.Hostname() == "api.openai.com"
+}
+
+// isOpenAICompatBase reports whether apiBase points at an OpenAI-compatible
+// endpoint (e.g. Gemini's ".../v1beta/openai"), which HTTPProvider serves.
+func isOpenAICompatBase(apiBase string) bool {
+	return strings.HasSuffix(strings.TrimRight(apiBase, "/"), "/openai")
+}
+
+// CreateProvider builds the provider for the configured model. When
+// providers.list is set, the result is a Registry that routes by model name
+// and falls back to the legacy per-vendor config for anything else.
 func CreateProvider(cfg *config.Config) (LLMProvider, error) {
+	if len(cfg.Providers.List) == 0 {
+		return createLegacyProvider(cfg)
+	}
+
+	// The legacy config may legitimately have nothing set when every model
+	// comes from providers.list.
+	fallback, legacyErr := createLegacyProvider(cfg)
+	if legacyErr == nil {
+		fallback = limitLegacyProvider(fallback, cfg)
+	}
+	registry, err := NewRegistry(cfg.Providers.List, cfg.Agents.Defaults.Provider, cfg.WorkspacePath(), fallback)
+	if err != nil {
+		return nil, err
+	}
+	registry.SetRateLimit(cfg.Providers.RateLimit)
+	if entry, _ := registry.Resolve(cfg.Agents.Defaults.Model); entry == nil && legacyErr != nil {
+		return nil, legacyErr
+	}
+	return registry, nil
+}
+
+// WithRateLimit guards a provider from CreateProvider with the configured
+// rate limiter and circuit breaker. A Registry already guards each entry.
+func WithRateLimit(p LLMProvider, cfg *config.Config) LLMProvider {
+	if _, ok := p.(*Registry); ok {
+		return p
+	}
+	return limitLegacyProvider(p, cfg)
+}
+
+func limitLegacyProvider(p LLMProvider, cfg *config.Config) LLMProvider {
+	name := cfg.Agents.Defaults.Provider
+	if name == "" {
+		name = cfg.Agents.Defaults.Model
+	}
+	return NewLimitedProvider(name, p, cfg.Providers.RateLimit)
+}
+
+// createLegacyProvider resolves the model against the fixed per-vendor
+// fields of ProvidersConfig.
+func createLegacyProvider(cfg *config.Config) (LLMProvider, error) {
 	model := cfg.Agents.Defaults.Model
 	providerName := strings.ToLower(cfg.Agents.Defaults.Provider)
 
 	var apiKey, apiBase, proxy string
+	// keyCfg holds the api_keys and key_rotation of the chosen provider
+	var keyName string
+	var keyCfg config.ProviderConfig
 
 	lowerModel := strings.ToLower(model)
 
@@ -233,40 +517,42 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 	if providerName != "" {
 		switch providerName {
 		case "groq":
-			if cfg.Providers.Groq.APIKey != "" {
-				apiKey = cfg.Providers.Groq.APIKey
+			if cfg.Providers.Groq.HasAPIKey() {
+				apiKey, keyName, keyCfg = cfg.Providers.Groq.APIKey, "groq", cfg.Providers.Groq
 				apiBase = cfg.Providers.Groq.APIBase
 				if apiBase == "" {
 					apiBase = "https://api.groq.com/openai/v1"
 				}
 			}
 		case "openai", "gpt":
-			if cfg.Providers.OpenAI.APIKey != "" || cfg.Providers.OpenAI.AuthMethod != "" {
+			if cfg.Providers.OpenAI.HasAPIKey() || cfg.Providers.OpenAI.AuthMethod != "" {
 				if cfg.Providers.OpenAI.AuthMethod == "codex-cli" {
 					c := NewCodexProviderWithTokenSource("", "", CreateCodexCliTokenSource())
 					c.enableWebSearch = cfg.Providers.OpenAI.WebSearch
 					return c, nil
 				}
 				if cfg.Providers.OpenAI.AuthMethod == "oauth" || cfg.Providers.OpenAI.AuthMethod == "token" {
-					return createCodexAuthProvider(cfg.Providers.OpenAI.WebSearch)
+					return createCodexAuthProvider(cfg.Providers.OpenAI.WebSearch, cfg.Providers.OpenAI.KeyRotation)
 				}
-				apiKey = cfg.Providers.OpenAI.APIKey
+				apiKey, keyName, keyCfg = cfg.Providers.OpenAI.APIKey, "openai", cfg.Providers.OpenAI.ProviderConfig
 				apiBase = cfg.Providers.OpenAI.APIBase
 				if apiBase == "" {
 					apiBase = "https://api.openai.com/v1"
 				}
 			}
 		case "anthropic", "claude":
-			if cfg.Providers.Anthropic.APIKey != "" || cfg.Providers.Anthropic.AuthMethod != "" {
+			if cfg.Providers.Anthropic.HasAPIKey() || cfg.Providers.Anthropic.AuthMethod != "" {
 				if cfg.Providers.Anthropic.AuthMethod == "oauth" || cfg.Providers.Anthropic.AuthMethod == "token" {
-					return createClaudeAuthProvider()
+					return createClaudeAuthProvider(cfg.Providers.Anthropic)
 				}
 				apiBase = cfg.Providers.Anthropic.APIBase
-				return NewClaudeProviderWithBaseURL(cfg.Providers.Anthropic.APIKey, apiBase), nil
+				return withKeyRotation("anthropic", cfg.Providers.Anthropic.KeyRotation, cfg.Providers.Anthropic.Keys(), func(key string) LLMProvider {
+					return NewClaudeProviderWithBaseURL(key, apiBase)
+				}), nil
 			}
 		case "openrouter":
-			if cfg.Providers.OpenRouter.APIKey != "" {
-				apiKey = cfg.Providers.OpenRouter.APIKey
+			if cfg.Providers.OpenRouter.HasAPIKey() {
+				apiKey, keyName, keyCfg = cfg.Providers.OpenRouter.APIKey, "openrouter", cfg.Providers.OpenRouter
 				if cfg.Providers.OpenRouter.APIBase != "" {
 					apiBase = cfg.Providers.OpenRouter.APIBase
 				} else {
@@ -274,29 +560,37 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 				}
 			}
 		case "zhipu", "glm":
-			if cfg.Providers.Zhipu.APIKey != "" {
-				apiKey = cfg.Providers.Zhipu.APIKey
+			if cfg.Providers.Zhipu.HasAPIKey() {
+				apiKey, keyName, keyCfg = cfg.Providers.Zhipu.APIKey, "zhipu", cfg.Providers.Zhipu
 				apiBase = cfg.Providers.Zhipu.APIBase
 				if apiBase == "" {
 					apiBase = "https://open.bigmodel.cn/api/paas/v4"
 				}
 			}
 		case "gemini", "google":
-			if cfg.Providers.Gemini.APIKey != "" {
-				apiKey = cfg.Providers.Gemini.APIKey
-				apiBase = cfg.Providers.Gemini.APIBase
-				if apiBase == "" {
-					apiBase = "https://generativelanguage.googleapis.com/v1beta"
+			if cfg.Providers.Gemini.HasAPIKey() {
+				if !isOpenAICompatBase(cfg.Providers.Gemini.APIBase) {
+					return createGeminiProvider(cfg.Providers.Gemini), nil
 				}
+				apiKey, keyName, keyCfg = cfg.Providers.Gemini.APIKey, "gemini", cfg.Providers.Gemini.ProviderConfig
+				apiBase = cfg.Providers.Gemini.APIBase
+			}
+		case "ollama":
+			// Ollama runs locally without a key, so it is always usable
+			return createOllamaProvider(cfg.Providers.Ollama), nil
+		case "mock":
+			return createMockProvider(cfg)
+		case "azure", "azure-openai":
+			if cfg.Providers.Azure.Endpoint != "" {
+				return createAzureProvider(cfg.Providers.Azure)
 			}
 		case "vllm":
 			if cfg.Providers.VLLM.APIBase != "" {
-				apiKey = cfg.Providers.VLLM.APIKey
-				apiBase = cfg.Providers.VLLM.APIBase
+				return createVLLMProvider(cfg.Providers.VLLM)
 			}
 		case "shengsuanyun":
-			if cfg.Providers.ShengSuanYun.APIKey != "" {
-				apiKey = cfg.Providers.ShengSuanYun.APIKey
+			if cfg.Providers.ShengSuanYun.HasAPIKey() {
+				apiKey, keyName, keyCfg = cfg.Providers.ShengSuanYun.APIKey, "shengsuanyun", cfg.Providers.ShengSuanYun
 				apiBase = cfg.Providers.ShengSuanYun.APIBase
 				if apiBase == "" {
 					apiBase = "https://router.shengsuanyun.com/api/v1"
@@ -315,8 +609,8 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 			}
 			return NewCodexCliProvider(workspace), nil
 		case "deepseek":
-			if cfg.Providers.DeepSeek.APIKey != "" {
-				apiKey = cfg.Providers.DeepSeek.APIKey
+			if cfg.Providers.DeepSeek.HasAPIKey() {
+				apiKey, keyName, keyCfg = cfg.Providers.DeepSeek.APIKey, "deepseek", cfg.Providers.DeepSeek
 				apiBase = cfg.Providers.DeepSeek.APIBase
 				if apiBase == "" {
 					apiBase = "https://api.deepseek.com/v1"
@@ -340,8 +634,14 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 	// Fallback: detect provider from model name
 	if apiKey == "" && apiBase == "" {
 		switch {
-		case (strings.Contains(lowerModel, "kimi") || strings.Contains(lowerModel, "moonshot") || strings.HasPrefix(model, "moonshot/")) && cfg.Providers.Moonshot.APIKey != "":
-			apiKey = cfg.Providers.Moonshot.APIKey
+		case providerName == "" && (model == "mock" || strings.HasPrefix(model, "mock/")):
+			return createMockProvider(cfg)
+
+		case strings.HasPrefix(model, "azure/") && cfg.Providers.Azure.Endpoint != "":
+			return createAzureProvider(cfg.Providers.Azure)
+
+		case (strings.Contains(lowerModel, "kimi") || strings.Contains(lowerModel, "moonshot") || strings.HasPrefix(model, "moonshot/")) && cfg.Providers.Moonshot.HasAPIKey():
+			apiKey, keyName, keyCfg = cfg.Providers.Moonshot.APIKey, "moonshot", cfg.Providers.Moonshot
 			apiBase = cfg.Providers.Moonshot.APIBase
 			proxy = cfg.Providers.Moonshot.Proxy
 			if apiBase == "" {
@@ -349,7 +649,7 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 			}
 
 		case strings.HasPrefix(model, "openrouter/") || strings.HasPrefix(model, "anthropic/") || strings.HasPrefix(model, "openai/") || strings.HasPrefix(model, "meta-llama/") || strings.HasPrefix(model, "deepseek/") || strings.HasPrefix(model, "google/"):
-			apiKey = cfg.Providers.OpenRouter.APIKey
+			apiKey, keyName, keyCfg = cfg.Providers.OpenRouter.APIKey, "openrouter", cfg.Providers.OpenRouter
 			proxy = cfg.Providers.OpenRouter.Proxy
 			if cfg.Providers.OpenRouter.APIBase != "" {
 				apiBase = cfg.Providers.OpenRouter.APIBase
@@ -357,76 +657,67 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 				apiBase = "https://openrouter.ai/api/v1"
 			}
 
-		case (strings.Contains(lowerModel, "claude") || strings.HasPrefix(model, "anthropic/")) && (cfg.Providers.Anthropic.APIKey != "" || cfg.Providers.Anthropic.AuthMethod != ""):
+		case (strings.Contains(lowerModel, "claude") || strings.HasPrefix(model, "anthropic/")) && (cfg.Providers.Anthropic.HasAPIKey() || cfg.Providers.Anthropic.AuthMethod != ""):
 			if cfg.Providers.Anthropic.AuthMethod == "oauth" || cfg.Providers.Anthropic.AuthMethod == "token" {
-				return createClaudeAuthProvider()
+				return createClaudeAuthProvider(cfg.Providers.Anthropic)
 			}
-			apiKey = cfg.Providers.Anthropic.APIKey
+			apiKey, keyName, keyCfg = cfg.Providers.Anthropic.APIKey, "anthropic", cfg.Providers.Anthropic
 			apiBase = cfg.Providers.Anthropic.APIBase
 			proxy = cfg.Providers.Anthropic.Proxy
 			if apiBase == "" {
 				apiBase = "https://api.anthropic.com/v1"
 			}
 
-		case (strings.Contains(lowerModel, "gpt") || strings.HasPrefix(model, "openai/")) && (cfg.Providers.OpenAI.APIKey != "" || cfg.Providers.OpenAI.AuthMethod != ""):
+		case (strings.Contains(lowerModel, "gpt") || strings.HasPrefix(model, "openai/")) && (cfg.Providers.OpenAI.HasAPIKey() || cfg.Providers.OpenAI.AuthMethod != ""):
 			if cfg.Providers.OpenAI.AuthMethod == "oauth" || cfg.Providers.OpenAI.AuthMethod == "token" {
-				return createCodexAuthProvider(cfg.Providers.OpenAI.WebSearch)
+				return createCodexAuthProvider(cfg.Providers.OpenAI.WebSearch, cfg.Providers.OpenAI.KeyRotation)
 			}
-			apiKey = cfg.Providers.OpenAI.APIKey
+			apiKey, keyName, keyCfg = cfg.Providers.OpenAI.APIKey, "openai", cfg.Providers.OpenAI.ProviderConfig
 			apiBase = cfg.Providers.OpenAI.APIBase
 			proxy = cfg.Providers.OpenAI.Proxy
 			if apiBase == "" {
 				apiBase = "https://api.openai.com/v1"
 			}
 
-		case (strings.Contains(lowerModel, "gemini") || strings.HasPrefix(model, "google/")) && cfg.Providers.Gemini.APIKey != "":
-			apiKey = cfg.Providers.Gemini.APIKey
+		case (strings.Contains(lowerModel, "gemini") || strings.HasPrefix(model, "google/")) && cfg.Providers.Gemini.HasAPIKey():
+			if !isOpenAICompatBase(cfg.Providers.Gemini.APIBase) {
+				return createGeminiProvider(cfg.Providers.Gemini), nil
+			}
+			apiKey, keyName, keyCfg = cfg.Providers.Gemini.APIKey, "gemini", cfg.Providers.Gemini.ProviderConfig
 			apiBase = cfg.Providers.Gemini.APIBase
 			proxy = cfg.Providers.Gemini.Proxy
-			if apiBase == "" {
-				apiBase = "https://generativelanguage.googleapis.com/v1beta"
-			}
 
-		case (strings.Contains(lowerModel, "glm") || strings.Contains(lowerModel, "zhipu") || strings.Contains(lowerModel, "zai")) && cfg.Providers.Zhipu.APIKey != "":
-			apiKey = cfg.Providers.Zhipu.APIKey
+		case (strings.Contains(lowerModel, "glm") || strings.Contains(lowerModel, "zhipu") || strings.Contains(lowerModel, "zai")) && cfg.Providers.Zhipu.HasAPIKey():
+			apiKey, keyName, keyCfg = cfg.Providers.Zhipu.APIKey, "zhipu", cfg.Providers.Zhipu
 			apiBase = cfg.Providers.Zhipu.APIBase
 			proxy = cfg.Providers.Zhipu.Proxy
 			if apiBase == "" {
 				apiBase = "https://open.bigmodel.cn/api/paas/v4"
 			}
 
-		case (strings.Contains(lowerModel, "groq") || strings.HasPrefix(model, "groq/")) && cfg.Providers.Groq.APIKey != "":
-			apiKey = cfg.Providers.Groq.APIKey
+		case (strings.Contains(lowerModel, "groq") || strings.HasPrefix(model, "groq/")) && cfg.Providers.Groq.HasAPIKey():
+			apiKey, keyName, keyCfg = cfg.Providers.Groq.APIKey, "groq", cfg.Providers.Groq
 			apiBase = cfg.Providers.Groq.APIBase
 			proxy = cfg.Providers.Groq.Proxy
 			if apiBase == "" {
 				apiBase = "https://api.groq.com/openai/v1"
 			}
 
-		case (strings.Contains(lowerModel, "nvidia") || strings.HasPrefix(model, "nvidia/")) && cfg.Providers.Nvidia.APIKey != "":
-			apiKey = cfg.Providers.Nvidia.APIKey
+		case (strings.Contains(lowerModel, "nvidia") || strings.HasPrefix(model, "nvidia/")) && cfg.Providers.Nvidia.HasAPIKey():
+			apiKey, keyName, keyCfg = cfg.Providers.Nvidia.APIKey, "nvidia", cfg.Providers.Nvidia
 			apiBase = cfg.Providers.Nvidia.APIBase
 			proxy = cfg.Providers.Nvidia.Proxy
 			if apiBase == "" {
 				apiBase = "https://integrate.api.nvidia.com/v1"
 			}
-		case (strings.Contains(lowerModel, "ollama") || strings.HasPrefix(model, "ollama/")) && cfg.Providers.Ollama.APIKey != "":
-			fmt.Println("Ollama provider selected based on model name prefix")
-			apiKey = cfg.Providers.Ollama.APIKey
-			apiBase = cfg.Providers.Ollama.APIBase
-			proxy = cfg.Providers.Ollama.Proxy
-			if apiBase == "" {
-				apiBase = "http://localhost:11434/v1"
-			}
-			fmt.Println("Ollama apiBase:", apiBase)
+		case strings.HasPrefix(model, "ollama/") || (strings.Contains(lowerModel, "ollama") && cfg.Providers.Ollama.APIBase != ""):
+			return createOllamaProvider(cfg.Providers.Ollama), nil
 		case cfg.Providers.VLLM.APIBase != "":
-			apiKey = cfg.Providers.VLLM.APIKey
-			apiBase = cfg.Providers.VLLM.APIBase
-			proxy = cfg.Providers.VLLM.Proxy
+			return createVLLMProvider(cfg.Providers.VLLM)
 
 		default:
-			if cfg.Providers.OpenRouter.APIKey != "" {
-				apiKey = cfg.Providers.OpenRouter.APIKey
+			if cfg.Providers.OpenRouter.HasAPIKey() {
+				apiKey, keyName, keyCfg = cfg.Providers.OpenRouter.APIKey, "openrouter", cfg.Providers.OpenRouter
 				proxy = cfg.Providers.OpenRouter.Proxy
 				if cfg.Providers.OpenRouter.APIBase != "" {
 					apiBase = cfg.Providers.OpenRouter.APIBase
@@ -439,6 +730,11 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 		}
 	}
 
+	keys := keyCfg.Keys()
+	if len(keys) > 0 {
+		apiKey = keys[0]
+	}
+
 	if apiKey == "" && !strings.HasPrefix(model, "bedrock/") {
 		return nil, fmt.Errorf("no API key configured for provider (model: %s)", model)
 	}
@@ -447,5 +743,10 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 		return nil, fmt.Errorf("no API base configured for provider (model: %s)", model)
 	}
 
-	return NewHTTPProvider(apiKey, apiBase, proxy), nil
+	if len(keys) < 2 {
+		return NewHTTPProvider(apiKey, apiBase, proxy), nil
+	}
+	return withKeyRotation(keyName, keyCfg.KeyRotation, keys, func(key string) LLMProvider {
+		return NewHTTPProvider(key, apiBase, proxy)
+	}), nil
 }
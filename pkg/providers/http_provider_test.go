@@ -0,0 +1,149 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPProvider_PromptCacheKey(t *testing.T) {
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		gotBody = nil
+		json.Unmarshal(data, &gotBody)
+		w.Write([]byte(`{
+			"choices": [{"message": {"content": "ok"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 2000, "completion_tokens": 10, "total_tokens": 2010, "prompt_tokens_details": {"cached_tokens": 1536}}
+		}`))
+	}))
+	defer server.Close()
+
+	opts := map[string]interface{}{"prompt_cache_key": "picoclaw-abc"}
+	msgs := []Message{{Role: "user", Content: "hi"}}
+
+	p := NewHTTPProvider("key", server.URL, "")
+	resp, err := p.Chat(context.Background(), msgs, nil, "gpt-4o", opts)
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if _, ok := gotBody["prompt_cache_key"]; ok {
+		t.Error("prompt_cache_key should not be sent to servers that have not opted in")
+	}
+	if resp.Usage == nil || resp.Usage.CacheReadTokens != 1536 || resp.Usage.PromptTokens != 2000 {
+		t.Errorf("Usage = %+v", resp.Usage)
+	}
+
+	p.promptCacheKey = true
+	if _, err := p.Chat(context.Background(), msgs, nil, "gpt-4o", opts); err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if gotBody["prompt_cache_key"] != "picoclaw-abc" {
+		t.Errorf("prompt_cache_key = %v", gotBody["prompt_cache_key"])
+	}
+}
+
+func TestHTTPProvider_ListModels(t *testing.T) {
+	requests := 0
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != "/v1/models" || r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"object": "list", "data": [{"id": "gpt-4o-mini"}, {"id": "gpt-4o"}]}`))
+	}))
+	defer server.Close()
+
+	p := NewHTTPProvider("key", server.URL+"/v1", "")
+	fail = true
+	if _, err := p.ListModels(context.Background()); err == nil {
+		t.Fatal("expected error from failing server")
+	}
+
+	// Failures are not cached; successes are
+	fail = false
+	for i := 0; i < 2; i++ {
+		models, err := p.ListModels(context.Background())
+		if err != nil {
+			t.Fatalf("ListModels() error: %v", err)
+		}
+		if len(models) != 2 || models[0] != "gpt-4o" {
+			t.Errorf("models = %v", models)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+}
+
+func TestSupportsPromptCacheKey(t *testing.T) {
+	if !supportsPromptCacheKey("https://api.openai.com/v1") {
+		t.Error("api.openai.com should support prompt_cache_key")
+	}
+	if supportsPromptCacheKey("http://localhost:8000/v1") {
+		t.Error("unknown servers should not be assumed to support prompt_cache_key")
+	}
+}
+
+func TestHTTPProvider_ReasoningContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices": [{"message": {"content": "4", "reasoning_content": "2+2 is 4"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	resp, err := NewHTTPProvider("key", server.URL, "").Chat(context.Background(), []Message{{Role: "user", Content: "2+2?"}}, nil, "deepseek-reasoner", nil)
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if resp.Content != "4" || resp.Reasoning != "2+2 is 4" {
+		t.Errorf("Content/Reasoning = %q/%q", resp.Content, resp.Reasoning)
+	}
+}
+
+func TestToOpenAIMessages_ReasoningOnlyForCurrentTurn(t *testing.T) {
+	call := []ToolCall{{ID: "call_1", Type: "function", Function: &FunctionCall{Name: "f", Arguments: "{}"}}}
+	out := toOpenAIMessages([]Message{
+		{Role: "user", Content: "first"},
+		{Role: "assistant", Reasoning: "old", ToolCalls: call},
+		{Role: "tool", Content: "r", ToolCallID: "call_1"},
+		{Role: "assistant", Content: "done", Reasoning: "old answer"},
+		{Role: "user", Content: "second"},
+		{Role: "assistant", Reasoning: "new", ToolCalls: call},
+		{Role: "tool", Content: "r", ToolCallID: "call_1"},
+	})
+	if out[1].ReasoningContent != "" || out[3].ReasoningContent != "" {
+		t.Error("reasoning from earlier turns should be dropped")
+	}
+	if out[5].ReasoningContent != "new" {
+		t.Errorf("ReasoningContent = %q, want current tool loop reasoning", out[5].ReasoningContent)
+	}
+}
+
+func TestToOpenAIMessages_VolatileSystemTailMovesToUserTurn(t *testing.T) {
+	system := "You are picoclaw.\n\n## Current Time\n2026-10-18 15:04 (Sunday)"
+	prefix := len("You are picoclaw.")
+	out := toOpenAIMessages([]Message{
+		{Role: "system", Content: system, CachePrefix: prefix},
+		{Role: "user", Content: "earlier"},
+		{Role: "assistant", Content: "ok"},
+		{Role: "user", Content: "what time is it?"},
+	})
+	if out[0].Content != "You are picoclaw." {
+		t.Errorf("system content = %q, want only the stable prefix", out[0].Content)
+	}
+	if out[1].Content != "earlier" {
+		t.Errorf("earlier user message changed: %q", out[1].Content)
+	}
+	if out[3].Content != "what time is it?\n\n## Current Time\n2026-10-18 15:04 (Sunday)" {
+		t.Errorf("current user message = %q", out[3].Content)
+	}
+}
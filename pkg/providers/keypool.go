@@ -0,0 +1,264 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/auth"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Key rotation strategies.
+const (
+	KeyRotationRoundRobin = "round-robin"
+	KeyRotationFailover   = "failover"
+)
+
+const (
+	// keyCooldownBase is how long a key rests after its first quota error
+	// when the provider gives no reset time; it doubles on each repeat.
+	keyCooldownBase = 30 * time.Second
+	keyCooldownMax  = 30 * time.Minute
+)
+
+// PoolKey is one credential of a RotatingProvider.
+type PoolKey struct {
+	ID       string // stable ID for the health file, see auth.KeyID
+	Label    string // shown in logs and auth status
+	Provider LLMProvider
+}
+
+type poolKey struct {
+	PoolKey
+	cooldownUntil time.Time
+	failures      int
+}
+
+// RotatingProvider spreads requests over several credentials of the same
+// provider. A key that hits a rate limit, a quota or an auth error cools
+// down and the request moves on to the next key. When every key is cooling
+// down it fails with a 429 carrying Retry-After, so a LimitedProvider
+// around it waits for the first key to come back.
+type RotatingProvider struct {
+	name     string
+	rotation string
+	now      func() time.Time
+	record   func(id string, h auth.KeyHealth)
+
+	mu   sync.Mutex
+	keys []*poolKey
+	next int
+}
+
+func NewRotatingProvider(name, rotation string, keys []PoolKey) *RotatingProvider {
+	if rotation != KeyRotationFailover {
+		rotation = KeyRotationRoundRobin
+	}
+	r := &RotatingProvider{
+		name:     name,
+		rotation: rotation,
+		now:      time.Now,
+		record: func(id string, h auth.KeyHealth) {
+			if err := auth.RecordKeyHealth(id, h); err != nil {
+				logger.DebugCF("provider.keys", "Could not record key health", map[string]interface{}{"error": err.Error()})
+			}
+		},
+	}
+	for _, k := range keys {
+		r.keys = append(r.keys, &poolKey{PoolKey: k})
+	}
+	return r
+}
+
+// withKeyRotation returns build's provider for a single key, or a
+// RotatingProvider over all keys.
+func withKeyRotation(name, rotation string, keys []string, build func(key string) LLMProvider) LLMProvider {
+	if len(keys) == 1 {
+		return build(keys[0])
+	}
+	pool := make([]PoolKey, 0, len(keys))
+	for _, key := range keys {
+		pool = append(pool, PoolKey{ID: auth.KeyID(name, key), Label: auth.KeyLabel(key), Provider: build(key)})
+	}
+	return NewRotatingProvider(name, rotation, pool)
+}
+
+func (r *RotatingProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	for range r.keys {
+		key, wait := r.pick()
+		if key == nil {
+			return nil, r.exhaustedError(wait)
+		}
+
+		// Rate limit headers describe this key, not the provider as a whole
+		var header http.Header
+		keyCtx := withHeaderObserver(ctx, func(h http.Header) { header = h })
+		resp, err := key.Provider.Chat(keyCtx, messages, tools, model, options)
+		if err == nil {
+			r.recordSuccess(key, header)
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		status, errHeader := errorStatus(err)
+		if !isKeyError(status) {
+			return nil, err
+		}
+		if errHeader != nil {
+			header = errHeader
+		}
+		r.cooldown(key, status, header)
+	}
+
+	_, wait := r.pick()
+	return nil, r.exhaustedError(wait)
+}
+
+func (r *RotatingProvider) GetDefaultModel() string {
+	return r.keys[0].Provider.GetDefaultModel()
+}
+
+// ListModels asks the first key that is not cooling down.
+func (r *RotatingProvider) ListModels(ctx context.Context) ([]string, error) {
+	key, _ := r.pick()
+	if key == nil {
+		key = r.keys[0]
+	}
+	lister, ok := key.Provider.(ModelLister)
+	if !ok {
+		return nil, ErrListModelsUnsupported
+	}
+	return lister.ListModels(ctx)
+}
+
+// pick returns the next usable key, or nil and the time until one is.
+func (r *RotatingProvider) pick() (*poolKey, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	var soonest time.Duration
+	for i := range r.keys {
+		idx := (r.next + i) % len(r.keys)
+		k := r.keys[idx]
+		if wait := k.cooldownUntil.Sub(now); wait > 0 {
+			if soonest == 0 || wait < soonest {
+				soonest = wait
+			}
+			continue
+		}
+		if r.rotation == KeyRotationRoundRobin {
+			r.next = idx + 1
+		} else {
+			r.next = idx
+		}
+		return k, 0
+	}
+	return nil, soonest
+}
+
+func (r *RotatingProvider) cooldown(k *poolKey, status int, header http.Header) {
+	r.mu.Lock()
+	k.failures++
+	wait := keyCooldownBase << (k.failures - 1)
+	if k.failures > 10 || wait > keyCooldownMax {
+		wait = keyCooldownMax
+	}
+	if d, ok := resetHint(header, r.now()); ok && d > 0 {
+		wait = d
+	}
+	k.cooldownUntil = r.now().Add(wait)
+	h := auth.KeyHealth{
+		Provider:      r.name,
+		Label:         k.Label,
+		CooldownUntil: k.cooldownUntil,
+		Failures:      k.failures,
+		LastError:     "HTTP " + strconv.Itoa(status),
+	}
+	r.mu.Unlock()
+
+	logger.WarnCF("provider.keys", "Key cooling down", map[string]interface{}{
+		"provider": r.name,
+		"key":      k.Label,
+		"status":   status,
+		"wait":     wait.String(),
+	})
+	r.record(k.ID, h)
+}
+
+func (r *RotatingProvider) recordSuccess(k *poolKey, header http.Header) {
+	r.mu.Lock()
+	recovered := k.failures > 0
+	k.failures = 0
+	// An exhausted budget on a successful call still rests the key
+	exhausted, hasHint := exhaustedBudget(header, r.now())
+	if hasHint {
+		k.cooldownUntil = r.now().Add(exhausted)
+	}
+	h := auth.KeyHealth{Provider: r.name, Label: k.Label, CooldownUntil: k.cooldownUntil}
+	r.mu.Unlock()
+
+	if recovered {
+		r.record(k.ID, h)
+	}
+}
+
+func (r *RotatingProvider) exhaustedError(wait time.Duration) error {
+	secs := int(wait.Seconds() + 0.999)
+	if secs < 1 {
+		secs = 1
+	}
+	return &APIError{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       fmt.Sprintf("all %d %s keys are rate limited", len(r.keys), r.name),
+		Header:     http.Header{"Retry-After": []string{strconv.Itoa(secs)}},
+	}
+}
+
+// isKeyError reports whether status means this key, rather than the
+// request, is the problem: rate limits, exhausted credit and auth errors.
+func isKeyError(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusPaymentRequired, http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	}
+	return false
+}
+
+// resetHint returns the wait from Retry-After or exhausted x-ratelimit-*
+// headers.
+func resetHint(h http.Header, now time.Time) (time.Duration, bool) {
+	if h == nil {
+		return 0, false
+	}
+	if d, ok := parseRetryAfter(h.Get("Retry-After"), now); ok {
+		return d, true
+	}
+	return exhaustedBudget(h, now)
+}
+
+// exhaustedBudget returns when a request or token budget that reached zero resets.
+func exhaustedBudget(h http.Header, now time.Time) (time.Duration, bool) {
+	if h == nil {
+		return 0, false
+	}
+	var longest time.Duration
+	found := false
+	for _, kind := range []string{"requests", "tokens"} {
+		if firstHeader(h, "x-ratelimit-remaining-"+kind, "anthropic-ratelimit-"+kind+"-remaining") != "0" {
+			continue
+		}
+		reset := firstHeader(h, "x-ratelimit-reset-"+kind, "anthropic-ratelimit-"+kind+"-reset")
+		if d, ok := parseResetHeader(reset, now); ok && d > longest {
+			longest = d
+			found = true
+		}
+	}
+	return longest, found
+}
@@ -0,0 +1,144 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/auth"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func testPool(rotation string, providers ...*scriptedProvider) (*RotatingProvider, *time.Time, map[string]auth.KeyHealth) {
+	keys := make([]PoolKey, len(providers))
+	for i, p := range providers {
+		label := string(rune('a' + i))
+		keys[i] = PoolKey{ID: label, Label: label, Provider: p}
+	}
+	r := NewRotatingProvider("test", rotation, keys)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	recorded := make(map[string]auth.KeyHealth)
+	r.record = func(id string, h auth.KeyHealth) { recorded[id] = h }
+	return r, &now, recorded
+}
+
+func TestRotatingProvider_RoundRobin(t *testing.T) {
+	a, b := &scriptedProvider{}, &scriptedProvider{}
+	r, _, _ := testPool(KeyRotationRoundRobin, a, b)
+
+	for i := 0; i < 4; i++ {
+		if _, err := r.Chat(context.Background(), nil, nil, "m", nil); err != nil {
+			t.Fatalf("Chat() %d error: %v", i, err)
+		}
+	}
+	if a.calls != 2 || b.calls != 2 {
+		t.Errorf("calls = %d, %d, want 2 each", a.calls, b.calls)
+	}
+}
+
+func TestRotatingProvider_FailoverOnRateLimit(t *testing.T) {
+	limited := &APIError{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"60"}}}
+	a := &scriptedProvider{errs: []error{limited}}
+	b := &scriptedProvider{}
+	r, now, recorded := testPool(KeyRotationFailover, a, b)
+
+	if _, err := r.Chat(context.Background(), nil, nil, "m", nil); err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if a.calls != 1 || b.calls != 1 {
+		t.Fatalf("calls = %d, %d, want the request to move to the second key", a.calls, b.calls)
+	}
+	if h := recorded["a"]; h.Failures != 1 || !h.CooldownUntil.Equal(now.Add(time.Minute)) {
+		t.Errorf("recorded health = %+v", h)
+	}
+
+	// Failover stays on the second key, even after the first recovers
+	r.Chat(context.Background(), nil, nil, "m", nil)
+	*now = now.Add(2 * time.Minute)
+	r.Chat(context.Background(), nil, nil, "m", nil)
+	if a.calls != 1 || b.calls != 3 {
+		t.Errorf("calls = %d, %d, want 1, 3", a.calls, b.calls)
+	}
+	if key, _ := r.pick(); key == nil {
+		t.Error("expected the first key to be usable again")
+	}
+}
+
+func TestRotatingProvider_AllKeysLimited(t *testing.T) {
+	limited := &APIError{StatusCode: http.StatusTooManyRequests}
+	a := &scriptedProvider{errs: []error{limited, limited}}
+	b := &scriptedProvider{errs: []error{limited}}
+	r, now, _ := testPool(KeyRotationRoundRobin, a, b)
+
+	// Both keys rest, so the pool answers with a Retry-After for the outer limiter
+	for i := 0; i < 2; i++ {
+		_, err := r.Chat(context.Background(), nil, nil, "m", nil)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Header.Get("Retry-After") != "30" {
+			t.Fatalf("Chat() %d error = %v, want a 429 with Retry-After 30", i, err)
+		}
+	}
+	if a.calls != 1 || b.calls != 1 {
+		t.Errorf("calls = %d, %d, want no calls while cooling down", a.calls, b.calls)
+	}
+
+	// A second failure doubles the cooldown
+	*now = now.Add(30 * time.Second)
+	r.Chat(context.Background(), nil, nil, "m", nil)
+	if until := r.keys[0].cooldownUntil; !until.Equal(now.Add(time.Minute)) {
+		t.Errorf("cooldown until %v, want 1m after %v", until, *now)
+	}
+}
+
+func TestRotatingProvider_KeepsOuterHeaderObserver(t *testing.T) {
+	header := http.Header{"X-Ratelimit-Remaining-Requests": []string{"0"}, "X-Ratelimit-Reset-Requests": []string{"20s"}}
+	r, now, _ := testPool(KeyRotationRoundRobin, &scriptedProvider{header: header}, &scriptedProvider{})
+
+	var outer http.Header
+	ctx := withHeaderObserver(context.Background(), func(h http.Header) { outer = h })
+	if _, err := r.Chat(ctx, nil, nil, "m", nil); err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if outer.Get("X-Ratelimit-Remaining-Requests") != "0" {
+		t.Errorf("outer observer got %v", outer)
+	}
+	if until := r.keys[0].cooldownUntil; !until.Equal(now.Add(20 * time.Second)) {
+		t.Errorf("key cooldown until %v, want 20s after %v", until, *now)
+	}
+}
+
+func TestRotatingProvider_OtherErrorsReturned(t *testing.T) {
+	a := &scriptedProvider{errs: []error{&APIError{StatusCode: http.StatusBadRequest}}}
+	b := &scriptedProvider{}
+	r, _, _ := testPool(KeyRotationRoundRobin, a, b)
+
+	if _, err := r.Chat(context.Background(), nil, nil, "m", nil); err == nil {
+		t.Fatal("expected the request error")
+	}
+	if b.calls != 0 {
+		t.Error("a bad request should not be retried with another key")
+	}
+}
+
+func TestCreateProvider_APIKeys(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Provider = "groq"
+	cfg.Providers.Groq.APIKeys = []string{"gsk-first-key", "gsk-second-key", "gsk-first-key"}
+
+	p, err := CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider() error: %v", err)
+	}
+	r, ok := p.(*RotatingProvider)
+	if !ok || len(r.keys) != 2 || r.keys[0].ID != auth.KeyID("groq", "gsk-first-key") {
+		t.Fatalf("provider = %T %+v", p, p)
+	}
+
+	cfg.Providers.Groq.APIKeys = []string{"gsk-only-key"}
+	if p, err := CreateProvider(cfg); err != nil || p.(*HTTPProvider).apiKey != "gsk-only-key" {
+		t.Errorf("CreateProvider() with one key = %T, %v", p, err)
+	}
+}
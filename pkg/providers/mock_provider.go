@@ -0,0 +1,177 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// MockProvider answers from a local script without any network access. It
+// is meant for demos and for exercising channels and tools offline.
+//
+// A script is a JSON file:
+//
+//	{
+//	  "rules": [
+//	    {"match": "(?i)hello", "reply": "Hi there!"},
+//	    {"match": "(?i)list (\\S+)", "tool_calls": [{"name": "list_dir", "arguments": {"path": "$1"}}], "reply": "Done:\n{{tool_result}}"}
+//	  ],
+//	  "default": "Sorry, no rule matched."
+//	}
+//
+// Rules are tried in order against the latest user message. A rule's tool
+// calls are issued one per turn, then its reply is sent. "$1"-style groups
+// from the match are expanded in replies and string arguments, and
+// {{tool_result}} is replaced with the latest tool output. Messages that
+// match no rule get the default reply, or are echoed back if it is empty.
+type MockProvider struct {
+	rules    []mockRule
+	fallback string
+}
+
+// MockScript is the file format read by NewMockProviderFromFile.
+type MockScript struct {
+	Rules   []MockRule `json:"rules"`
+	Default string     `json:"default,omitempty"`
+}
+
+type MockRule struct {
+	Match     string         `json:"match"`
+	Reply     string         `json:"reply,omitempty"`
+	ToolCalls []MockToolCall `json:"tool_calls,omitempty"`
+}
+
+type MockToolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+type mockRule struct {
+	MockRule
+	re *regexp.Regexp
+}
+
+// NewMockProvider returns a provider for script; a nil script echoes every message.
+func NewMockProvider(script *MockScript) (*MockProvider, error) {
+	p := &MockProvider{}
+	if script == nil {
+		return p, nil
+	}
+	p.fallback = script.Default
+	for i, r := range script.Rules {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("mock rule %d: invalid match %q: %w", i+1, r.Match, err)
+		}
+		p.rules = append(p.rules, mockRule{MockRule: r, re: re})
+	}
+	return p, nil
+}
+
+// NewMockProviderFromFile loads a script; an empty path gives an echo provider.
+func NewMockProviderFromFile(path string) (*MockProvider, error) {
+	if path == "" {
+		return NewMockProvider(nil)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading mock script: %w", err)
+	}
+	var script MockScript
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("parsing mock script %s: %w", path, err)
+	}
+	return NewMockProvider(&script)
+}
+
+func (p *MockProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	// Locate the latest user message and count the tool rounds since it
+	userIdx := -1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" && messages[i].ToolCallID == "" {
+			userIdx = i
+			break
+		}
+	}
+	input := ""
+	step := 0
+	toolResult := ""
+	if userIdx >= 0 {
+		input = messages[userIdx].Content
+		for _, msg := range messages[userIdx+1:] {
+			if msg.Role == "assistant" && len(msg.ToolCalls) > 0 {
+				step++
+			}
+			if msg.Role == "tool" {
+				toolResult = msg.Content
+			}
+		}
+	}
+
+	resp := &LLMResponse{FinishReason: "stop"}
+	rule, groups := p.match(input)
+	switch {
+	case rule == nil && p.fallback != "":
+		resp.Content = p.fallback
+	case rule == nil:
+		resp.Content = input
+	case step < len(rule.ToolCalls):
+		tc := rule.ToolCalls[step]
+		resp.ToolCalls = []ToolCall{{
+			ID:        newToolCallID(),
+			Name:      tc.Name,
+			Arguments: expandMockArgs(tc.Arguments, rule.re, input, groups),
+		}}
+		resp.FinishReason = "tool_calls"
+	default:
+		reply := string(rule.re.ExpandString(nil, rule.Reply, input, groups))
+		resp.Content = strings.ReplaceAll(reply, "{{tool_result}}", toolResult)
+	}
+
+	// Rough estimate so usage reporting has something to show
+	promptChars := 0
+	for _, msg := range messages {
+		promptChars += len(msg.Content)
+	}
+	completionChars := len(resp.Content)
+	for _, tc := range resp.ToolCalls {
+		completionChars += len(tc.Name)
+	}
+	resp.Usage = &UsageInfo{
+		PromptTokens:     promptChars / 4,
+		CompletionTokens: completionChars / 4,
+		TotalTokens:      (promptChars + completionChars) / 4,
+	}
+	return resp, nil
+}
+
+func (p *MockProvider) GetDefaultModel() string {
+	return "mock"
+}
+
+func (p *MockProvider) ListModels(ctx context.Context) ([]string, error) {
+	return []string{"mock"}, nil
+}
+
+func (p *MockProvider) match(input string) (*mockRule, []int) {
+	for i := range p.rules {
+		if groups := p.rules[i].re.FindStringSubmatchIndex(input); groups != nil {
+			return &p.rules[i], groups
+		}
+	}
+	return nil, nil
+}
+
+func expandMockArgs(args map[string]interface{}, re *regexp.Regexp, input string, groups []int) map[string]interface{} {
+	out := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		if s, ok := v.(string); ok {
+			v = string(re.ExpandString(nil, s, input, groups))
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestMockProvider_Echo(t *testing.T) {
+	p, _ := NewMockProvider(nil)
+	resp, err := p.Chat(context.Background(), []Message{
+		{Role: "system", Content: "You are helpful"},
+		{Role: "user", Content: "ping"},
+	}, nil, "mock", nil)
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if resp.Content != "ping" || resp.FinishReason != "stop" {
+		t.Errorf("resp = %+v, want echo", resp)
+	}
+}
+
+func TestMockProvider_ScriptedToolSequence(t *testing.T) {
+	p, err := NewMockProvider(&MockScript{
+		Rules: []MockRule{
+			{Match: `(?i)^hello`, Reply: "Hi there!"},
+			{
+				Match: `(?i)show (\S+)`,
+				ToolCalls: []MockToolCall{
+					{Name: "list_dir", Arguments: map[string]interface{}{"path": "$1"}},
+					{Name: "read_file", Arguments: map[string]interface{}{"path": "$1/README.md", "limit": 10.0}},
+				},
+				Reply: "Contents of $1:\n{{tool_result}}",
+			},
+		},
+		Default: "No rule matched.",
+	})
+	if err != nil {
+		t.Fatalf("NewMockProvider() error: %v", err)
+	}
+	ctx := context.Background()
+
+	if resp, _ := p.Chat(ctx, []Message{{Role: "user", Content: "Hello bot"}}, nil, "mock", nil); resp.Content != "Hi there!" {
+		t.Errorf("Content = %q", resp.Content)
+	}
+	if resp, _ := p.Chat(ctx, []Message{{Role: "user", Content: "weather?"}}, nil, "mock", nil); resp.Content != "No rule matched." {
+		t.Errorf("default Content = %q", resp.Content)
+	}
+
+	messages := []Message{{Role: "user", Content: "show docs"}}
+	for i, want := range []string{"list_dir", "read_file"} {
+		resp, _ := p.Chat(ctx, messages, nil, "mock", nil)
+		if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != want {
+			t.Fatalf("step %d ToolCalls = %+v, want %s", i, resp.ToolCalls, want)
+		}
+		tc := resp.ToolCalls[0]
+		if i == 1 && (tc.Arguments["path"] != "docs/README.md" || tc.Arguments["limit"] != 10.0) {
+			t.Errorf("Arguments = %v", tc.Arguments)
+		}
+		messages = append(messages,
+			Message{Role: "assistant", ToolCalls: []ToolCall{{ID: tc.ID, Name: tc.Name}}},
+			Message{Role: "tool", Content: "result " + want, ToolCallID: tc.ID},
+		)
+	}
+
+	resp, _ := p.Chat(ctx, messages, nil, "mock", nil)
+	if resp.Content != "Contents of docs:\nresult read_file" || len(resp.ToolCalls) != 0 {
+		t.Errorf("final resp = %+v", resp)
+	}
+}
+
+func TestNewMockProvider_InvalidRule(t *testing.T) {
+	if _, err := NewMockProvider(&MockScript{Rules: []MockRule{{Match: "("}}}); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+}
+
+func TestCreateProvider_Mock(t *testing.T) {
+	workspace := t.TempDir()
+	script := `{"rules": [{"match": "status", "reply": "all good"}]}`
+	if err := os.WriteFile(filepath.Join(workspace, "mock.json"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = workspace
+	cfg.Agents.Defaults.Provider = "mock"
+	cfg.Providers.Mock.Script = "mock.json"
+
+	p, err := CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider() error: %v", err)
+	}
+	resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "status?"}}, nil, cfg.Agents.Defaults.Model, nil)
+	if err != nil || resp.Content != "all good" {
+		t.Errorf("Chat() = %+v, %v", resp, err)
+	}
+
+	// No API key is needed when the model names the mock provider
+	cfg = config.DefaultConfig()
+	cfg.Agents.Defaults.Model = "mock"
+	p, err = CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider(model=mock) error: %v", err)
+	}
+	if _, ok := p.(*MockProvider); !ok {
+		t.Errorf("provider = %T, want *MockProvider", p)
+	}
+
+	cfg.Providers.Mock.Script = "/nonexistent/mock.json"
+	if p, err := CreateProvider(cfg); err == nil || p != nil {
+		t.Errorf("expected a nil provider and an error for missing script, got %v, %v", p, err)
+	}
+}
@@ -0,0 +1,83 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// modelListTTL is how long a provider's model list is reused before it is fetched again.
+const modelListTTL = 10 * time.Minute
+
+// ModelLister is implemented by providers that can report the models they serve.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// modelCache remembers the last successful model list of a provider.
+type modelCache struct {
+	mu      sync.Mutex
+	models  []string
+	fetched time.Time
+}
+
+// get returns the cached list, calling fetch when it is missing or stale.
+// Failed fetches are not cached.
+func (c *modelCache) get(ctx context.Context, fetch func(context.Context) ([]string, error)) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.models != nil && time.Since(c.fetched) < modelListTTL {
+		return c.models, nil
+	}
+	models, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(models)
+	if models == nil {
+		models = []string{}
+	}
+	c.models = models
+	c.fetched = time.Now()
+	return models, nil
+}
+
+// reset drops the cached list, e.g. after a model was installed.
+func (c *modelCache) reset() {
+	c.mu.Lock()
+	c.models = nil
+	c.mu.Unlock()
+}
+
+// getJSON fetches endpoint and decodes the JSON response into out.
+func getJSON(ctx context.Context, client *http.Client, endpoint string, setHeaders func(*http.Request), out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	setHeaders(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &APIError{StatusCode: resp.StatusCode, Body: string(body), Header: resp.Header}
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const ollamaDefaultBaseURL = "http://localhost:11434"
+
+// OllamaProvider talks to a local or remote Ollama server via its native /api/chat API.
+type OllamaProvider struct {
+	apiKey     string
+	apiBase    string
+	keepAlive  string
+	numCtx     int
+	headers    map[string]string
+	httpClient *http.Client
+	models     modelCache
+}
+
+func NewOllamaProvider(apiKey, apiBase, proxy, keepAlive string, numCtx int) *OllamaProvider {
+	// Older configs point at the OpenAI-compatible endpoint ("/v1"); the
+	// native API lives at the server root.
+	apiBase = strings.TrimSuffix(strings.TrimRight(apiBase, "/"), "/v1")
+	if apiBase == "" {
+		apiBase = ollamaDefaultBaseURL
+	}
+
+	// Local models can take a while to load and generate, so allow more time
+	// than hosted APIs.
+	client := &http.Client{
+		Timeout: 300 * time.Second,
+	}
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err == nil {
+			client.Transport = &http.Transport{
+				Proxy: http.ProxyURL(proxyURL),
+			}
+		}
+	}
+
+	return &OllamaProvider{
+		apiKey:     apiKey,
+		apiBase:    apiBase,
+		keepAlive:  keepAlive,
+		numCtx:     numCtx,
+		httpClient: client,
+	}
+}
+
+type ollamaChatRequest struct {
+	Model     string                 `json:"model"`
+	Messages  []ollamaMessage        `json:"messages"`
+	Tools     []ToolDefinition       `json:"tools,omitempty"`
+	Stream    bool                   `json:"stream"`
+	KeepAlive string                 `json:"keep_alive,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	Think     bool                   `json:"think,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChatResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+func (p *OllamaProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	model = strings.TrimPrefix(model, "ollama/")
+
+	reqBody := buildOllamaRequest(messages, tools, model, options)
+	reqBody.KeepAlive = p.keepAlive
+	if p.numCtx > 0 {
+		if reqBody.Options == nil {
+			reqBody.Options = map[string]interface{}{}
+		}
+		reqBody.Options["num_ctx"] = p.numCtx
+	}
+
+	body, err := p.post(ctx, "/api/chat", reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseOllamaResponse(body)
+}
+
+func (p *OllamaProvider) GetDefaultModel() string {
+	return ""
+}
+
+// ListModels returns the names of the models installed on the Ollama server (/api/tags).
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]string, error) {
+	return p.models.get(ctx, func(ctx context.Context) ([]string, error) {
+		var tags struct {
+			Models []struct {
+				Name string `json:"name"`
+			} `json:"models"`
+		}
+		if err := getJSON(ctx, p.httpClient, p.apiBase+"/api/tags", p.setHeaders, &tags); err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(tags.Models))
+		for _, m := range tags.Models {
+			names = append(names, m.Name)
+		}
+		return names, nil
+	})
+}
+
+// OllamaPullProgress is one status update streamed by /api/pull.
+type OllamaPullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// PullModel downloads a model on the Ollama server, calling progress for
+// every status update until the pull succeeds or fails.
+func (p *OllamaProvider) PullModel(ctx context.Context, name string, progress func(OllamaPullProgress)) error {
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"model":  strings.TrimPrefix(name, "ollama/"),
+		"stream": true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/api/pull", bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	p.setHeaders(req)
+
+	// Pulls can take much longer than a chat request; rely on ctx instead.
+	client := *p.httpClient
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Body: string(body), Header: resp.Header}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	success := false
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var update OllamaPullProgress
+		if err := json.Unmarshal(line, &update); err != nil {
+			return fmt.Errorf("failed to parse pull progress: %w", err)
+		}
+		if update.Error != "" {
+			return fmt.Errorf("pull failed: %s", update.Error)
+		}
+		if progress != nil {
+			progress(update)
+		}
+		if update.Status == "success" {
+			success = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read pull progress: %w", err)
+	}
+	if !success {
+		return fmt.Errorf("pull ended before completing")
+	}
+	p.models.reset()
+	return nil
+}
+
+func (p *OllamaProvider) post(ctx context.Context, path string, payload interface{}) ([]byte, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+path, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	p.setHeaders(req)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	observeHeaders(ctx, resp.Header)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(body), Header: resp.Header}
+	}
+	return body, nil
+}
+
+func (p *OllamaProvider) setHeaders(req *http.Request) {
+	req.Header.Set("Content-Type", "application/json")
+	// Ollama itself needs no key, but it is often run behind an authenticating proxy
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+}
+
+func buildOllamaRequest(messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) *ollamaChatRequest {
+	req := &ollamaChatRequest{
+		Model:  model,
+		Tools:  tools,
+		Stream: false,
+	}
+
+	// Ollama identifies tool results by tool name rather than call ID
+	toolNames := make(map[string]string)
+
+	for _, msg := range messages {
+		om := ollamaMessage{Role: msg.Role, Content: msg.Content}
+
+		switch msg.Role {
+		case "user":
+			for _, m := range msg.Media {
+				if blob := loadGeminiBlob(m); blob != nil && strings.HasPrefix(blob.MimeType, "image/") {
+					om.Images = append(om.Images, blob.Data)
+				}
+			}
+		case "assistant":
+			for _, tc := range msg.ToolCalls {
+				name, args := toolCallNameAndArgs(tc)
+				toolNames[tc.ID] = name
+				var otc ollamaToolCall
+				otc.Function.Name = name
+				otc.Function.Arguments = args
+				if otc.Function.Arguments == nil {
+					otc.Function.Arguments = map[string]interface{}{}
+				}
+				om.ToolCalls = append(om.ToolCalls, otc)
+			}
+		case "tool":
+			om.ToolName = toolNames[msg.ToolCallID]
+		}
+
+		req.Messages = append(req.Messages, om)
+	}
+
+	// Ollama has no thinking budget, only an on/off switch
+	if budget, ok := options["thinking_budget"].(int); ok && budget > 0 {
+		req.Think = true
+	}
+
+	opts := map[string]interface{}{}
+	if maxTokens, ok := options["max_tokens"].(int); ok {
+		opts["num_predict"] = maxTokens
+	}
+	if temperature, ok := options["temperature"].(float64); ok {
+		opts["temperature"] = temperature
+	}
+	if len(opts) > 0 {
+		req.Options = opts
+	}
+
+	return req
+}
+
+func parseOllamaResponse(body []byte) (*LLMResponse, error) {
+	var apiResponse ollamaChatResponse
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	result := &LLMResponse{
+		Content:      apiResponse.Message.Content,
+		Reasoning:    apiResponse.Message.Thinking,
+		FinishReason: "stop",
+		Usage: &UsageInfo{
+			PromptTokens:     apiResponse.PromptEvalCount,
+			CompletionTokens: apiResponse.EvalCount,
+			TotalTokens:      apiResponse.PromptEvalCount + apiResponse.EvalCount,
+		},
+	}
+	if apiResponse.DoneReason == "length" {
+		result.FinishReason = "length"
+	}
+
+	// Ollama does not assign tool call IDs
+	for _, tc := range apiResponse.Message.ToolCalls {
+		args := tc.Function.Arguments
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			ID:        newToolCallID(),
+			Name:      tc.Function.Name,
+			Arguments: args,
+		})
+	}
+	if len(result.ToolCalls) > 0 {
+		result.FinishReason = "tool_calls"
+	}
+
+	return result, nil
+}
@@ -0,0 +1,181 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestBuildOllamaRequest_ToolRoundTrip(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "You are helpful"},
+		{Role: "user", Content: "Weather in SF?", Media: []string{"data:image/png;base64,AAAA", "data:application/pdf;base64,BBBB"}},
+		{
+			Role: "assistant",
+			ToolCalls: []ToolCall{
+				{ID: "call_1", Type: "function", Function: &FunctionCall{Name: "get_weather", Arguments: `{"city":"SF"}`}},
+			},
+		},
+		{Role: "tool", Content: "sunny", ToolCallID: "call_1"},
+	}
+	req := buildOllamaRequest(messages, nil, "qwen3:8b", map[string]interface{}{"max_tokens": 512})
+
+	if len(req.Messages) != 4 {
+		t.Fatalf("len(Messages) = %d, want 4", len(req.Messages))
+	}
+	if imgs := req.Messages[1].Images; len(imgs) != 1 || imgs[0] != "AAAA" {
+		t.Errorf("Images = %v, want only the image attachment", imgs)
+	}
+	calls := req.Messages[2].ToolCalls
+	if len(calls) != 1 || calls[0].Function.Name != "get_weather" || calls[0].Function.Arguments["city"] != "SF" {
+		t.Fatalf("ToolCalls = %+v", calls)
+	}
+	if req.Messages[3].ToolName != "get_weather" {
+		t.Errorf("tool result ToolName = %q, want get_weather", req.Messages[3].ToolName)
+	}
+	if req.Options["num_predict"] != 512 {
+		t.Errorf("Options = %v", req.Options)
+	}
+}
+
+func TestParseOllamaResponse_ToolCalls(t *testing.T) {
+	body := []byte(`{
+		"message": {"role": "assistant", "content": "", "thinking": "Two cities.", "tool_calls": [
+			{"function": {"name": "get_weather", "arguments": {"city": "SF"}}},
+			{"function": {"name": "get_weather", "arguments": {"city": "NYC"}}}
+		]},
+		"done": true,
+		"done_reason": "stop",
+		"prompt_eval_count": 20,
+		"eval_count": 7
+	}`)
+
+	resp, err := parseOllamaResponse(body)
+	if err != nil {
+		t.Fatalf("parseOllamaResponse() error: %v", err)
+	}
+	if len(resp.ToolCalls) != 2 || resp.ToolCalls[1].Arguments["city"] != "NYC" {
+		t.Fatalf("ToolCalls = %+v", resp.ToolCalls)
+	}
+	if resp.ToolCalls[0].ID == "" || resp.ToolCalls[0].ID == resp.ToolCalls[1].ID {
+		t.Errorf("tool call IDs should be unique, got %q and %q", resp.ToolCalls[0].ID, resp.ToolCalls[1].ID)
+	}
+	if resp.FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want tool_calls", resp.FinishReason)
+	}
+	if resp.Reasoning != "Two cities." {
+		t.Errorf("Reasoning = %q", resp.Reasoning)
+	}
+	if resp.Usage.TotalTokens != 27 {
+		t.Errorf("Usage = %+v", resp.Usage)
+	}
+}
+
+func TestOllamaProvider_Chat(t *testing.T) {
+	var gotPath string
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &gotBody)
+		w.Write([]byte(`{"message": {"role": "assistant", "content": "Hello"}, "done": true}`))
+	}))
+	defer server.Close()
+
+	// A legacy OpenAI-compatible base should be mapped to the native API
+	p := NewOllamaProvider("", server.URL+"/v1", "", "10m", 8192)
+	resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "Hi"}}, nil, "ollama/qwen3:8b", nil)
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if resp.Content != "Hello" {
+		t.Errorf("Content = %q", resp.Content)
+	}
+	if gotPath != "/api/chat" {
+		t.Errorf("path = %q, want /api/chat", gotPath)
+	}
+	if gotBody["model"] != "qwen3:8b" || gotBody["keep_alive"] != "10m" || gotBody["stream"] != false {
+		t.Errorf("request body = %v", gotBody)
+	}
+	opts, _ := gotBody["options"].(map[string]interface{})
+	if opts["num_ctx"] != float64(8192) {
+		t.Errorf("options = %v", gotBody["options"])
+	}
+}
+
+func TestOllamaProvider_ListModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"models": [{"name": "qwen3:8b"}, {"name": "llama3.2:latest"}]}`))
+	}))
+	defer server.Close()
+
+	models, err := NewOllamaProvider("", server.URL, "", "", 0).ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels() error: %v", err)
+	}
+	if len(models) != 2 || models[0] != "llama3.2:latest" || models[1] != "qwen3:8b" {
+		t.Errorf("models = %v", models)
+	}
+}
+
+func TestOllamaProvider_PullModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{\"status\":\"pulling manifest\"}\n"))
+		w.Write([]byte("{\"status\":\"pulling abc\",\"digest\":\"abc\",\"total\":100,\"completed\":50}\n"))
+		w.Write([]byte("{\"status\":\"success\"}\n"))
+	}))
+	defer server.Close()
+
+	var updates []OllamaPullProgress
+	err := NewOllamaProvider("", server.URL, "", "", 0).PullModel(context.Background(), "qwen3:8b", func(p OllamaPullProgress) {
+		updates = append(updates, p)
+	})
+	if err != nil {
+		t.Fatalf("PullModel() error: %v", err)
+	}
+	if len(updates) != 3 || updates[1].Completed != 50 {
+		t.Errorf("updates = %+v", updates)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{\"error\":\"pull model manifest: file does not exist\"}\n"))
+	}))
+	defer failing.Close()
+
+	if err := NewOllamaProvider("", failing.URL, "", "", 0).PullModel(context.Background(), "nope", nil); err == nil {
+		t.Fatal("expected error for failed pull")
+	}
+}
+
+func TestCreateProvider_OllamaNative(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Provider = "ollama"
+	cfg.Agents.Defaults.Model = "qwen3:8b"
+
+	p, err := CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider() error: %v", err)
+	}
+	if _, ok := p.(*OllamaProvider); !ok {
+		t.Fatalf("provider = %T, want *OllamaProvider", p)
+	}
+
+	cfg.Agents.Defaults.Provider = ""
+	cfg.Agents.Defaults.Model = "ollama/qwen3:8b"
+	p, err = CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider() error: %v", err)
+	}
+	if _, ok := p.(*OllamaProvider); !ok {
+		t.Fatalf("provider = %T, want *OllamaProvider for ollama/ model prefix", p)
+	}
+}
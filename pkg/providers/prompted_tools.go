@@ -0,0 +1,308 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Tool protocols for OpenAI-compatible models. Small local models served
+// by vLLM or llama.cpp without a tool parser ignore the tools field, so for
+// them the tools are described in the system prompt and calls are parsed
+// from the reply text.
+const (
+	ToolProtocolNative   = "native"
+	ToolProtocolPrompted = "prompted"
+)
+
+var (
+	xmlToolCallRe   = regexp.MustCompile("(?s)<tool_call>(.*?)</tool_call>")
+	fencedToolRe    = regexp.MustCompile("(?s)```(?:json|tool_call|tool)?[ \\t]*\\n(.*?)```")
+	unclosedXMLCall = regexp.MustCompile("(?s)<tool_call>(.*)$")
+)
+
+// validToolProtocols checks the values of a tool_protocols map.
+func validToolProtocols(protocols map[string]string) error {
+	for model, protocol := range protocols {
+		if protocol != ToolProtocolNative && protocol != ToolProtocolPrompted {
+			return fmt.Errorf("tool_protocols: model %q has unknown protocol %q (want native or prompted)", model, protocol)
+		}
+	}
+	return nil
+}
+
+// toolProtocolFor returns the protocol configured for model, "*" being the
+// default for models not listed.
+func toolProtocolFor(protocols map[string]string, model string) string {
+	if p, ok := protocols[model]; ok {
+		return p
+	}
+	if p, ok := protocols["*"]; ok {
+		return p
+	}
+	return ToolProtocolNative
+}
+
+// buildPromptedToolsPrompt describes tools and the expected call format.
+func buildPromptedToolsPrompt(tools []ToolDefinition) string {
+	var sb strings.Builder
+
+	sb.WriteString("## Tools\n\n")
+	sb.WriteString("You can call the tools below. To call one, reply with ONLY a block like this and nothing after it:\n\n")
+	sb.WriteString("<tool_call>\n{\"name\": \"tool_name\", \"arguments\": {\"param\": \"value\"}}\n</tool_call>\n\n")
+	sb.WriteString("Use one block per call. The result comes back in the next message, starting with \"Tool result\". ")
+	sb.WriteString("When you have what you need, answer normally without a tool_call block.\n\n")
+	sb.WriteString("### Available tools\n\n")
+
+	for _, tool := range tools {
+		if tool.Type != "function" {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("#### %s\n", tool.Function.Name))
+		if tool.Function.Description != "" {
+			sb.WriteString(tool.Function.Description + "\n")
+		}
+		if len(tool.Function.Parameters) > 0 {
+			paramsJSON, _ := json.Marshal(tool.Function.Parameters)
+			sb.WriteString(fmt.Sprintf("Parameters: %s\n", string(paramsJSON)))
+		}
+		sb.WriteString("\n")
+	}
+
+	return strings.TrimSpace(sb.String())
+}
+
+// toPromptedMessages rewrites a conversation for a model without native
+// tool support: the tool descriptions join the system prompt, earlier calls
+// are written out in the call format, and tool results become user messages.
+func toPromptedMessages(messages []Message, tools []ToolDefinition) []Message {
+	toolsPrompt := buildPromptedToolsPrompt(tools)
+	toolNames := make(map[string]string)
+
+	out := make([]Message, 0, len(messages)+1)
+	hasSystem := false
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "system" && !hasSystem:
+			hasSystem = true
+			msg.Content = strings.TrimSpace(msg.Content + "\n\n" + toolsPrompt)
+		case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+			var sb strings.Builder
+			sb.WriteString(msg.Content)
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Name
+				call, _ := json.Marshal(struct {
+					Name      string                 `json:"name"`
+					Arguments map[string]interface{} `json:"arguments"`
+				}{tc.Name, tc.Arguments})
+				if sb.Len() > 0 {
+					sb.WriteString("\n")
+				}
+				sb.WriteString("<tool_call>\n" + string(call) + "\n</tool_call>")
+			}
+			msg = Message{Role: "assistant", Content: sb.String()}
+		case msg.Role == "tool":
+			name := toolNames[msg.ToolCallID]
+			if name == "" {
+				name = "tool"
+			}
+			msg = Message{Role: "user", Content: fmt.Sprintf("Tool result (%s):\n%s", name, msg.Content)}
+		}
+		out = append(out, msg)
+	}
+	if !hasSystem {
+		out = append([]Message{{Role: "system", Content: toolsPrompt}}, out...)
+	}
+	return out
+}
+
+// parsePromptedToolCalls extracts calls to tools written as <tool_call>
+// blocks, fenced JSON or the {"tool_calls": ...} object used by the CLI
+// providers. Calls to unknown tools are left in place, so JSON examples in
+// an answer are not mistaken for calls. It returns the calls and the text
+// with the call blocks removed.
+func parsePromptedToolCalls(text string, tools []ToolDefinition) ([]ToolCall, string) {
+	known := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		known[tool.Function.Name] = true
+	}
+	parse := func(payload string) []ToolCall {
+		var calls []ToolCall
+		for _, tc := range parseToolCallPayload(payload) {
+			if known[tc.Name] {
+				calls = append(calls, tc)
+			}
+		}
+		return calls
+	}
+
+	var calls []ToolCall
+	remaining := text
+
+	for _, re := range []*regexp.Regexp{xmlToolCallRe, fencedToolRe} {
+		remaining = re.ReplaceAllStringFunc(remaining, func(block string) string {
+			parsed := parse(re.FindStringSubmatch(block)[1])
+			if len(parsed) == 0 {
+				return block
+			}
+			calls = append(calls, parsed...)
+			return ""
+		})
+	}
+
+	// Models often stop before writing the closing tag
+	if len(calls) == 0 {
+		if m := unclosedXMLCall.FindStringSubmatchIndex(remaining); m != nil {
+			if parsed := parse(remaining[m[2]:m[3]]); len(parsed) > 0 {
+				calls = parsed
+				remaining = remaining[:m[0]]
+			}
+		}
+	}
+
+	if len(calls) == 0 {
+		if legacy := extractToolCallsFromText(remaining); len(legacy) > 0 && known[legacy[0].Name] {
+			calls = legacy
+			remaining = stripToolCallsFromText(remaining)
+		}
+	}
+
+	for i := range calls {
+		if calls[i].ID == "" {
+			calls[i].ID = newToolCallID()
+		}
+	}
+	return calls, strings.TrimSpace(remaining)
+}
+
+// promptedCall is one call as written by the model. Some models say
+// "parameters" instead of "arguments", or encode the arguments as a string.
+type promptedCall struct {
+	Name       string          `json:"name"`
+	Arguments  json.RawMessage `json:"arguments"`
+	Parameters json.RawMessage `json:"parameters"`
+}
+
+// parseToolCallPayload decodes one call or a list of calls, repairing
+// slightly malformed JSON first if needed.
+func parseToolCallPayload(payload string) []ToolCall {
+	payload = strings.TrimSpace(payload)
+	if payload == "" {
+		return nil
+	}
+
+	var list []promptedCall
+	if !decodeLenient(payload, &list) {
+		var single promptedCall
+		if !decodeLenient(payload, &single) {
+			return nil
+		}
+		list = []promptedCall{single}
+	}
+
+	var calls []ToolCall
+	for _, c := range list {
+		if c.Name == "" {
+			continue
+		}
+		raw := c.Arguments
+		if len(raw) == 0 {
+			raw = c.Parameters
+		}
+		args := make(map[string]interface{})
+		if len(raw) > 0 {
+			var encoded string
+			if json.Unmarshal(raw, &encoded) == nil {
+				raw = json.RawMessage(encoded)
+			}
+			if !decodeLenient(string(raw), &args) {
+				args = map[string]interface{}{"raw": string(raw)}
+			}
+		}
+		calls = append(calls, ToolCall{Name: c.Name, Arguments: args})
+	}
+	return calls
+}
+
+// decodeLenient unmarshals s into v, retrying once with repairJSON.
+func decodeLenient(s string, v interface{}) bool {
+	if json.Unmarshal([]byte(s), v) == nil {
+		return true
+	}
+	return json.Unmarshal([]byte(repairJSON(s)), v) == nil
+}
+
+// repairJSON fixes the mistakes small models make most often: trailing
+// commas, raw newlines inside strings, single-quoted strings and missing
+// closing quotes, brackets or braces at the end.
+func repairJSON(s string) string {
+	var sb strings.Builder
+	var stack []byte
+	var quote byte
+	escaped := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == quote:
+				quote = 0
+				c = '"'
+			case c == '"':
+				// A double quote inside a single-quoted string
+				sb.WriteString(`\"`)
+				continue
+			case c == '\n':
+				sb.WriteString(`\n`)
+				continue
+			case c == '\r':
+				continue
+			case c == '\t':
+				sb.WriteString(`\t`)
+				continue
+			}
+			sb.WriteByte(c)
+			continue
+		}
+
+		switch c {
+		case '"', '\'':
+			quote = c
+			c = '"'
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			trimTrailingComma(&sb)
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+		sb.WriteByte(c)
+	}
+
+	if quote != 0 {
+		sb.WriteByte('"')
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		trimTrailingComma(&sb)
+		sb.WriteByte(stack[i])
+	}
+	return sb.String()
+}
+
+// trimTrailingComma drops a comma (and the whitespace after it) at the end of sb.
+func trimTrailingComma(sb *strings.Builder) {
+	out := sb.String()
+	trimmed := strings.TrimRight(out, " \t\r\n")
+	if strings.HasSuffix(trimmed, ",") {
+		sb.Reset()
+		sb.WriteString(trimmed[:len(trimmed)-1])
+	}
+}
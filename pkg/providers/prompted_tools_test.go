@@ -0,0 +1,188 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+var promptedTestTools = []ToolDefinition{{
+	Type: "function",
+	Function: ToolFunctionDefinition{
+		Name:        "read_file",
+		Description: "Read a file",
+		Parameters:  map[string]interface{}{"type": "object", "properties": map[string]interface{}{"path": map[string]interface{}{"type": "string"}}},
+	},
+}}
+
+func TestParsePromptedToolCalls(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		wantPath    string
+		wantContent string
+	}{
+		{
+			name:        "xml",
+			text:        "Let me look.\n<tool_call>\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"a.txt\"}}\n</tool_call>",
+			wantPath:    "a.txt",
+			wantContent: "Let me look.",
+		},
+		{
+			name:     "fenced json",
+			text:     "```json\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"b.txt\"}}\n```",
+			wantPath: "b.txt",
+		},
+		{
+			name:     "trailing comma and missing braces",
+			text:     "<tool_call>{\"name\": \"read_file\", \"arguments\": {\"path\": \"c.txt\",",
+			wantPath: "c.txt",
+		},
+		{
+			name:     "single quotes and string arguments",
+			text:     "<tool_call>{'name': 'read_file', 'parameters': '{\"path\": \"d.txt\"}'}</tool_call>",
+			wantPath: "d.txt",
+		},
+		{
+			name:     "cli format",
+			text:     `{"tool_calls":[{"id":"call_1","type":"function","function":{"name":"read_file","arguments":"{\"path\":\"e.txt\"}"}}]}`,
+			wantPath: "e.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, content := parsePromptedToolCalls(tt.text, promptedTestTools)
+			if len(calls) != 1 {
+				t.Fatalf("calls = %+v, want 1", calls)
+			}
+			if calls[0].Name != "read_file" || calls[0].Arguments["path"] != tt.wantPath {
+				t.Errorf("call = %+v", calls[0])
+			}
+			if calls[0].ID == "" {
+				t.Error("call ID should be set")
+			}
+			if content != tt.wantContent {
+				t.Errorf("content = %q, want %q", content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestParsePromptedToolCalls_PlainAnswer(t *testing.T) {
+	text := "Use this config:\n```json\n{\"name\": \"server\", \"arguments\": {\"port\": 80}}\n```"
+	calls, content := parsePromptedToolCalls(text, promptedTestTools)
+	if len(calls) != 0 {
+		t.Errorf("calls = %+v, want none for an unknown tool", calls)
+	}
+	if content != text {
+		t.Errorf("content = %q", content)
+	}
+}
+
+func TestRepairJSON(t *testing.T) {
+	tests := map[string]string{
+		`{"a": 1,}`:               `{"a": 1}`,
+		`{"a": [1, 2,], "b": "x"`: `{"a": [1, 2], "b": "x"}`,
+		`{'a': 'it"s'}`:           `{"a": "it\"s"}`,
+		"{\"a\": \"line\nnext\"}": `{"a": "line\nnext"}`,
+		`{"a": "unterminated`:     `{"a": "unterminated"}`,
+	}
+	for in, want := range tests {
+		if got := repairJSON(in); got != want {
+			t.Errorf("repairJSON(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestToPromptedMessages(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "user", Content: "show a.txt"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Name: "read_file", Arguments: map[string]interface{}{"path": "a.txt"}}}},
+		{Role: "tool", Content: "hello", ToolCallID: "call_1"},
+	}
+	out := toPromptedMessages(messages, promptedTestTools)
+
+	if len(out) != 4 {
+		t.Fatalf("len = %d, want 4", len(out))
+	}
+	if !strings.HasPrefix(out[0].Content, "You are helpful.") || !strings.Contains(out[0].Content, "#### read_file") {
+		t.Errorf("system = %q", out[0].Content)
+	}
+	if len(out[2].ToolCalls) != 0 || !strings.Contains(out[2].Content, `<tool_call>`) || !strings.Contains(out[2].Content, `"path":"a.txt"`) {
+		t.Errorf("assistant = %+v", out[2])
+	}
+	if out[3].Role != "user" || out[3].ToolCallID != "" || out[3].Content != "Tool result (read_file):\nhello" {
+		t.Errorf("tool result = %+v", out[3])
+	}
+}
+
+func TestHTTPProvider_PromptedTools(t *testing.T) {
+	var gotBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		gotBody = nil
+		json.Unmarshal(data, &gotBody)
+		w.Write([]byte(`{"choices": [{"message": {"content": "<tool_call>{\"name\": \"read_file\", \"arguments\": {\"path\": \"a.txt\"}}</tool_call>"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	p := NewHTTPProvider("key", server.URL, "")
+	p.toolProtocols = map[string]string{"tiny-llama": ToolProtocolPrompted}
+	messages := []Message{{Role: "user", Content: "show a.txt"}}
+
+	resp, err := p.Chat(context.Background(), messages, promptedTestTools, "tiny-llama", nil)
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if _, ok := gotBody["tools"]; ok {
+		t.Error("tools should not be sent in prompted mode")
+	}
+	sent, _ := gotBody["messages"].([]interface{})
+	if len(sent) != 2 || !strings.Contains(sent[0].(map[string]interface{})["content"].(string), "read_file") {
+		t.Errorf("messages = %v", gotBody["messages"])
+	}
+	if resp.FinishReason != "tool_calls" || len(resp.ToolCalls) != 1 || resp.Content != "" {
+		t.Errorf("resp = %+v", resp)
+	}
+
+	// Other models keep native tools
+	p.Chat(context.Background(), messages, promptedTestTools, "qwen3", nil)
+	if _, ok := gotBody["tools"]; !ok {
+		t.Error("tools should be sent for native models")
+	}
+}
+
+func TestCreateProvider_VLLMToolProtocols(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Provider = "vllm"
+	cfg.Providers.VLLM.APIKey = "local"
+	cfg.Providers.VLLM.APIBase = "http://localhost:8000/v1"
+	cfg.Providers.VLLM.ToolProtocols = map[string]string{"*": "prompted"}
+
+	p, err := CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider() error: %v", err)
+	}
+	if hp, ok := p.(*HTTPProvider); !ok || toolProtocolFor(hp.toolProtocols, "any") != ToolProtocolPrompted {
+		t.Errorf("provider = %T %+v", p, p)
+	}
+
+	// A local server without an API key is accepted
+	cfg.Providers.VLLM.APIKey = ""
+	if hp, err := CreateProvider(cfg); err != nil || hp.(*HTTPProvider).apiKey != "" {
+		t.Errorf("CreateProvider() without key = %v, %v", hp, err)
+	}
+
+	cfg.Providers.VLLM.ToolProtocols = map[string]string{"*": "xml"}
+	if _, err := CreateProvider(cfg); err == nil {
+		t.Error("expected error for unknown tool protocol")
+	}
+}
@@ -0,0 +1,488 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/openai/openai-go/v3"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultCircuitCooldown  = 30 * time.Second
+
+	// maxRateLimitRetries bounds how often a 429 is retried before giving up.
+	maxRateLimitRetries = 3
+	// maxRateLimitWait is the longest a request queues for the limiter; a
+	// longer wait is reported to the user instead.
+	maxRateLimitWait = 60 * time.Second
+)
+
+// Circuit breaker states.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// ErrListModelsUnsupported is returned by ListModels when the wrapped provider cannot list models.
+var ErrListModelsUnsupported = errors.New("provider cannot list models")
+
+// APIError is a non-2xx response from an HTTP provider. Its message keeps
+// the format used before it existed, so logs read the same.
+type APIError struct {
+	StatusCode int
+	Body       string
+	Header     http.Header
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed:\n  Status: %d\n  Body:   %s", e.StatusCode, e.Body)
+}
+
+// RateLimitError reports that a provider is still throttling after the
+// limiter waited and retried. The message is meant to be shown to users.
+type RateLimitError struct {
+	Provider   string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s is rate limiting requests, please try again in %s", e.Provider, formatWait(e.RetryAfter))
+}
+
+// CircuitOpenError reports that requests are paused after repeated provider failures.
+type CircuitOpenError struct {
+	Provider   string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s is temporarily unavailable after repeated failures, please try again in %s", e.Provider, formatWait(e.RetryAfter))
+}
+
+func formatWait(d time.Duration) string {
+	if d < time.Second {
+		d = time.Second
+	}
+	return d.Round(time.Second).String()
+}
+
+// CircuitReporter is implemented by providers guarded by a circuit breaker.
+// Circuits maps each provider name to its breaker state.
+type CircuitReporter interface {
+	Circuits() map[string]string
+}
+
+type headerObserverKey struct{}
+
+// withHeaderObserver lets HTTP providers report response headers, such as
+// x-ratelimit-remaining-*, to the limiter that made the call. An observer
+// already in ctx still gets the headers, so a LimitedProvider around a
+// RotatingProvider keeps seeing them.
+func withHeaderObserver(ctx context.Context, fn func(http.Header)) context.Context {
+	if parent, ok := ctx.Value(headerObserverKey{}).(func(http.Header)); ok {
+		inner := fn
+		fn = func(h http.Header) {
+			inner(h)
+			parent(h)
+		}
+	}
+	return context.WithValue(ctx, headerObserverKey{}, fn)
+}
+
+func observeHeaders(ctx context.Context, h http.Header) {
+	if fn, ok := ctx.Value(headerObserverKey{}).(func(http.Header)); ok && h != nil {
+		fn(h)
+	}
+}
+
+// tokenBucket refills continuously at rate per second up to capacity. Its
+// level may go negative when actual usage exceeds what was available.
+type tokenBucket struct {
+	capacity float64
+	level    float64
+	rate     float64
+	last     time.Time
+}
+
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		level:    float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		last:     now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.level += elapsed * b.rate
+		if b.level > b.capacity {
+			b.level = b.capacity
+		}
+	}
+	b.last = now
+}
+
+// waitFor returns how long until the bucket holds at least n.
+func (b *tokenBucket) waitFor(n float64) time.Duration {
+	if b.level >= n {
+		return 0
+	}
+	return time.Duration((n - b.level) / b.rate * float64(time.Second))
+}
+
+// LimitedProvider wraps a provider with a requests/tokens per minute limiter,
+// honors Retry-After and x-ratelimit-* headers, and stops calling a provider
+// that keeps failing until a cooldown has passed.
+type LimitedProvider struct {
+	name      string
+	provider  LLMProvider
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu           sync.Mutex
+	requests     *tokenBucket
+	tokens       *tokenBucket
+	blockedUntil time.Time
+	state        string
+	failures     int
+	openedAt     time.Time
+	probing      bool
+}
+
+func NewLimitedProvider(name string, provider LLMProvider, cfg config.RateLimitConfig) *LimitedProvider {
+	l := &LimitedProvider{
+		name:      name,
+		provider:  provider,
+		threshold: cfg.FailureThreshold,
+		cooldown:  time.Duration(cfg.CooldownSeconds) * time.Second,
+		now:       time.Now,
+		state:     CircuitClosed,
+	}
+	if l.threshold <= 0 {
+		l.threshold = defaultFailureThreshold
+	}
+	if l.cooldown <= 0 {
+		l.cooldown = defaultCircuitCooldown
+	}
+	now := l.now()
+	l.requests = newTokenBucket(cfg.RequestsPerMinute, now)
+	l.tokens = newTokenBucket(cfg.TokensPerMinute, now)
+	return l
+}
+
+// Unwrap returns the wrapped provider.
+func (l *LimitedProvider) Unwrap() LLMProvider {
+	return l.provider
+}
+
+func (l *LimitedProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	for attempt := 0; ; attempt++ {
+		if err := l.enter(); err != nil {
+			return nil, err
+		}
+		if err := l.acquire(ctx); err != nil {
+			l.abandon()
+			return nil, err
+		}
+
+		resp, err := l.provider.Chat(withHeaderObserver(ctx, l.observe), messages, tools, model, options)
+		if err == nil {
+			l.consumeTokens(resp.Usage)
+			l.recordSuccess()
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			l.abandon()
+			return nil, err
+		}
+
+		status, header := errorStatus(err)
+		if header != nil {
+			l.observe(header)
+		}
+
+		switch {
+		case status == http.StatusTooManyRequests:
+			wait := l.waitTime()
+			if attempt < maxRateLimitRetries && wait <= maxRateLimitWait {
+				logger.WarnCF("provider.ratelimit", "Rate limited, retrying", map[string]interface{}{
+					"provider": l.name,
+					"attempt":  attempt + 1,
+					"wait":     wait.String(),
+				})
+				l.abandon()
+				if wait <= 0 {
+					// No hint from the server; back off a little more each time
+					l.block(time.Duration(attempt+1) * time.Second)
+				}
+				continue
+			}
+			l.recordFailure()
+			return nil, &RateLimitError{Provider: l.name, RetryAfter: wait}
+		case status >= 500 || status == 0:
+			l.recordFailure()
+		default:
+			// The provider answered; a bad request says nothing about its health
+			l.recordSuccess()
+		}
+		return nil, err
+	}
+}
+
+func (l *LimitedProvider) GetDefaultModel() string {
+	return l.provider.GetDefaultModel()
+}
+
+func (l *LimitedProvider) ListModels(ctx context.Context) ([]string, error) {
+	lister, ok := l.provider.(ModelLister)
+	if !ok {
+		return nil, ErrListModelsUnsupported
+	}
+	return lister.ListModels(ctx)
+}
+
+func (l *LimitedProvider) Circuits() map[string]string {
+	return map[string]string{l.name: l.CircuitState()}
+}
+
+// CircuitState returns closed, open or half-open.
+func (l *LimitedProvider) CircuitState() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state == CircuitOpen && !l.now().Before(l.openedAt.Add(l.cooldown)) {
+		return CircuitHalfOpen
+	}
+	return l.state
+}
+
+// enter lets a request through the circuit breaker. Once the cooldown has
+// passed, a single probe request decides whether the circuit closes again.
+func (l *LimitedProvider) enter() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	switch l.state {
+	case CircuitOpen:
+		if reopen := l.openedAt.Add(l.cooldown); now.Before(reopen) {
+			return &CircuitOpenError{Provider: l.name, RetryAfter: reopen.Sub(now)}
+		}
+		l.state = CircuitHalfOpen
+		l.probing = true
+	case CircuitHalfOpen:
+		if l.probing {
+			return &CircuitOpenError{Provider: l.name, RetryAfter: l.cooldown}
+		}
+		l.probing = true
+	}
+	return nil
+}
+
+// abandon releases a half-open probe that ended without a verdict.
+func (l *LimitedProvider) abandon() {
+	l.mu.Lock()
+	l.probing = false
+	l.mu.Unlock()
+}
+
+func (l *LimitedProvider) recordSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state != CircuitClosed {
+		logger.InfoCF("provider.ratelimit", "Circuit closed", map[string]interface{}{"provider": l.name})
+	}
+	l.state = CircuitClosed
+	l.failures = 0
+	l.probing = false
+}
+
+func (l *LimitedProvider) recordFailure() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures++
+	l.probing = false
+	if l.state == CircuitHalfOpen || l.failures >= l.threshold {
+		if l.state != CircuitOpen {
+			logger.WarnCF("provider.ratelimit", "Circuit opened", map[string]interface{}{
+				"provider": l.name,
+				"failures": l.failures,
+				"cooldown": l.cooldown.String(),
+			})
+		}
+		l.state = CircuitOpen
+		l.openedAt = l.now()
+	}
+}
+
+// acquire waits until the request and token buckets and any server-imposed
+// pause allow a request, then takes one request from the bucket.
+func (l *LimitedProvider) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		wait := l.waitLocked()
+		if wait <= 0 && l.requests != nil {
+			l.requests.level--
+		}
+		l.mu.Unlock()
+
+		if wait <= 0 {
+			return nil
+		}
+		if wait > maxRateLimitWait {
+			return &RateLimitError{Provider: l.name, RetryAfter: wait}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (l *LimitedProvider) waitTime() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.waitLocked()
+}
+
+func (l *LimitedProvider) waitLocked() time.Duration {
+	now := l.now()
+	wait := l.blockedUntil.Sub(now)
+	if l.requests != nil {
+		l.requests.refill(now)
+		if w := l.requests.waitFor(1); w > wait {
+			wait = w
+		}
+	}
+	if l.tokens != nil {
+		l.tokens.refill(now)
+		// Token usage is only known afterwards, so wait for the bucket to be
+		// out of debt rather than for a specific amount.
+		if w := l.tokens.waitFor(0); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+func (l *LimitedProvider) consumeTokens(usage *UsageInfo) {
+	if usage == nil || l.tokens == nil {
+		return
+	}
+	l.mu.Lock()
+	l.tokens.refill(l.now())
+	l.tokens.level -= float64(usage.TotalTokens)
+	l.mu.Unlock()
+}
+
+func (l *LimitedProvider) block(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := l.now().Add(d); until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// observe applies Retry-After and exhausted x-ratelimit-* (or Anthropic's
+// anthropic-ratelimit-*) budgets by pausing requests until they reset.
+func (l *LimitedProvider) observe(h http.Header) {
+	if d, ok := parseRetryAfter(h.Get("Retry-After"), l.now()); ok {
+		l.block(d)
+	}
+	for _, kind := range []string{"requests", "tokens"} {
+		remaining := firstHeader(h, "x-ratelimit-remaining-"+kind, "anthropic-ratelimit-"+kind+"-remaining")
+		if remaining != "0" {
+			continue
+		}
+		reset := firstHeader(h, "x-ratelimit-reset-"+kind, "anthropic-ratelimit-"+kind+"-reset")
+		if d, ok := parseResetHeader(reset, l.now()); ok {
+			l.block(d)
+		}
+	}
+}
+
+func firstHeader(h http.Header, keys ...string) string {
+	for _, k := range keys {
+		if v := strings.TrimSpace(h.Get(k)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseRetryAfter accepts delay-seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+// parseResetHeader accepts OpenAI-style durations ("6m0s", "20ms"), plain
+// seconds, or an RFC 3339 timestamp as sent by Anthropic.
+func parseResetHeader(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d, true
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+// errorStatus extracts the HTTP status and headers from provider errors.
+// A zero status means the request never got an HTTP response.
+func errorStatus(err error) (int, http.Header) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode, apiErr.Header
+	}
+	var anthropicErr *anthropic.Error
+	if errors.As(err, &anthropicErr) {
+		return anthropicErr.StatusCode, responseHeader(anthropicErr.Response)
+	}
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		return openaiErr.StatusCode, responseHeader(openaiErr.Response)
+	}
+	return 0, nil
+}
+
+func responseHeader(resp *http.Response) http.Header {
+	if resp == nil {
+		return nil
+	}
+	return resp.Header
+}
@@ -0,0 +1,207 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// scriptedProvider returns the queued errors in order, then succeeds.
+type scriptedProvider struct {
+	errs   []error
+	header http.Header // reported on success
+	calls  int
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	p.calls++
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return nil, err
+	}
+	observeHeaders(ctx, p.header)
+	return &LLMResponse{Content: "ok", Usage: &UsageInfo{TotalTokens: 600}}, nil
+}
+
+func (p *scriptedProvider) GetDefaultModel() string {
+	return ""
+}
+
+func fakeClock(l *LimitedProvider) *time.Time {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	if l.requests != nil {
+		l.requests.last = now
+	}
+	if l.tokens != nil {
+		l.tokens.last = now
+	}
+	return &now
+}
+
+func TestLimitedProvider_TokenBuckets(t *testing.T) {
+	l := NewLimitedProvider("test", &scriptedProvider{}, config.RateLimitConfig{RequestsPerMinute: 2, TokensPerMinute: 1000})
+	now := fakeClock(l)
+
+	for i := 0; i < 2; i++ {
+		if _, err := l.Chat(context.Background(), nil, nil, "m", nil); err != nil {
+			t.Fatalf("Chat() %d error: %v", i, err)
+		}
+	}
+	// Two requests used the request bucket and 1200 tokens put the token bucket in debt
+	if wait := l.waitTime(); wait != 30*time.Second {
+		t.Errorf("wait = %s, want 30s for the next request", wait)
+	}
+
+	*now = now.Add(30 * time.Second)
+	if wait := l.waitTime(); wait != 0 {
+		t.Errorf("wait after refill = %s, want 0", wait)
+	}
+}
+
+func TestLimitedProvider_RetriesRateLimit(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0.05")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error": {"message": "Rate limit reached"}}`))
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"content": "ok"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	l := NewLimitedProvider("test", NewHTTPProvider("key", server.URL, ""), config.RateLimitConfig{})
+	resp, err := l.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o", nil)
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if resp.Content != "ok" || calls.Load() != 2 {
+		t.Errorf("Content = %q after %d calls, want ok after 2", resp.Content, calls.Load())
+	}
+}
+
+func TestLimitedProvider_RateLimitGivesUp(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "120")
+	inner := &scriptedProvider{errs: []error{&APIError{StatusCode: http.StatusTooManyRequests, Header: header}}}
+	l := NewLimitedProvider("openai", inner, config.RateLimitConfig{})
+	fakeClock(l)
+
+	_, err := l.Chat(context.Background(), nil, nil, "m", nil)
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) || rateErr.RetryAfter != 120*time.Second {
+		t.Fatalf("err = %v, want RateLimitError with 120s", err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("calls = %d, want no retry beyond the max wait", inner.calls)
+	}
+}
+
+func TestLimitedProvider_CircuitBreaker(t *testing.T) {
+	failure := &APIError{StatusCode: http.StatusBadGateway}
+	inner := &scriptedProvider{errs: []error{failure, failure, failure}}
+	l := NewLimitedProvider("test", inner, config.RateLimitConfig{FailureThreshold: 2, CooldownSeconds: 10})
+	now := fakeClock(l)
+
+	for i := 0; i < 2; i++ {
+		if _, err := l.Chat(context.Background(), nil, nil, "m", nil); !errors.Is(err, failure) {
+			t.Fatalf("call %d err = %v, want provider error", i, err)
+		}
+	}
+	if got := l.CircuitState(); got != CircuitOpen {
+		t.Fatalf("state = %s, want open", got)
+	}
+
+	var circuitErr *CircuitOpenError
+	if _, err := l.Chat(context.Background(), nil, nil, "m", nil); !errors.As(err, &circuitErr) {
+		t.Fatalf("err = %v, want CircuitOpenError", err)
+	}
+	if inner.calls != 2 {
+		t.Errorf("calls = %d, open circuit should not reach the provider", inner.calls)
+	}
+
+	// A failed probe reopens the circuit, a successful one closes it
+	*now = now.Add(10 * time.Second)
+	if got := l.CircuitState(); got != CircuitHalfOpen {
+		t.Errorf("state after cooldown = %s, want half-open", got)
+	}
+	l.Chat(context.Background(), nil, nil, "m", nil)
+	if got := l.CircuitState(); got != CircuitOpen {
+		t.Errorf("state after failed probe = %s, want open", got)
+	}
+
+	*now = now.Add(10 * time.Second)
+	if _, err := l.Chat(context.Background(), nil, nil, "m", nil); err != nil {
+		t.Fatalf("probe error: %v", err)
+	}
+	if got := l.Circuits()["test"]; got != CircuitClosed {
+		t.Errorf("state after successful probe = %s, want closed", got)
+	}
+}
+
+func TestLimitedProvider_ClientErrorsKeepCircuitClosed(t *testing.T) {
+	badRequest := &APIError{StatusCode: http.StatusBadRequest}
+	l := NewLimitedProvider("test", &scriptedProvider{errs: []error{badRequest, badRequest}}, config.RateLimitConfig{FailureThreshold: 1})
+
+	l.Chat(context.Background(), nil, nil, "m", nil)
+	if got := l.CircuitState(); got != CircuitClosed {
+		t.Errorf("state = %s, want closed after a 400", got)
+	}
+}
+
+func TestLimitedProvider_ObserveHeaders(t *testing.T) {
+	l := NewLimitedProvider("test", &scriptedProvider{}, config.RateLimitConfig{})
+	now := fakeClock(l)
+
+	h := http.Header{}
+	h.Set("x-ratelimit-remaining-requests", "0")
+	h.Set("x-ratelimit-reset-requests", "20s")
+	h.Set("x-ratelimit-remaining-tokens", "5000")
+	h.Set("x-ratelimit-reset-tokens", "6m0s")
+	l.observe(h)
+	if wait := l.waitTime(); wait != 20*time.Second {
+		t.Errorf("wait = %s, want 20s from the exhausted request budget", wait)
+	}
+
+	h = http.Header{}
+	h.Set("anthropic-ratelimit-tokens-remaining", "0")
+	h.Set("anthropic-ratelimit-tokens-reset", now.Add(45*time.Second).Format(time.RFC3339))
+	l.observe(h)
+	if wait := l.waitTime(); wait != 45*time.Second {
+		t.Errorf("wait = %s, want 45s from the Anthropic reset time", wait)
+	}
+}
+
+func TestParseResetHeader(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"1s", time.Second},
+		{"6m0s", 6 * time.Minute},
+		{"20ms", 20 * time.Millisecond},
+		{"7.5", 7500 * time.Millisecond},
+		{"2026-01-01T00:01:00Z", time.Minute},
+	}
+	for _, tt := range tests {
+		if got, ok := parseResetHeader(tt.in, now); !ok || got != tt.want {
+			t.Errorf("parseResetHeader(%q) = %s, %v; want %s", tt.in, got, ok, tt.want)
+		}
+	}
+	if _, ok := parseResetHeader("soon", now); ok {
+		t.Error("parseResetHeader(soon) should fail")
+	}
+	if got, ok := parseRetryAfter("Thu, 01 Jan 2026 00:00:30 GMT", now); !ok || got != 30*time.Second {
+		t.Errorf("parseRetryAfter(date) = %s, %v", got, ok)
+	}
+}
@@ -0,0 +1,256 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Wire protocols accepted in providers.list.
+const (
+	ProtocolOpenAIChat      = "openai-chat"
+	ProtocolOpenAIResponses = "openai-responses"
+	ProtocolAnthropic       = "anthropic"
+	ProtocolGemini          = "gemini"
+	ProtocolOllama          = "ollama"
+	ProtocolCLI             = "cli"
+)
+
+// Registry routes each request to the providers.list entry named by the
+// model string, e.g. "myvllm/qwen3" goes to the entry named "myvllm" with
+// model "qwen3". Models that match no entry go to the fallback provider
+// built from the legacy per-vendor config.
+type Registry struct {
+	entries         []config.ProviderEntry
+	defaultProvider string
+	workspace       string
+	fallback        LLMProvider
+	rateLimit       config.RateLimitConfig
+
+	mu        sync.Mutex
+	providers map[string]LLMProvider
+}
+
+// NewRegistry validates entries and returns a registry over them. fallback may be nil.
+func NewRegistry(entries []config.ProviderEntry, defaultProvider, workspace string, fallback LLMProvider) (*Registry, error) {
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		name := strings.ToLower(e.Name)
+		if name == "" {
+			return nil, fmt.Errorf("providers.list: entry without a name")
+		}
+		if strings.Contains(name, "/") {
+			return nil, fmt.Errorf("providers.list: name %q must not contain '/'", e.Name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("providers.list: duplicate name %q", e.Name)
+		}
+		seen[name] = true
+
+		switch e.Protocol {
+		case ProtocolOpenAIChat:
+			if e.APIBase == "" {
+				return nil, fmt.Errorf("providers.list: %q needs api_base for protocol %s", e.Name, e.Protocol)
+			}
+			if err := validToolProtocols(e.ToolProtocols); err != nil {
+				return nil, fmt.Errorf("providers.list: %q: %w", e.Name, err)
+			}
+		case ProtocolOpenAIResponses, ProtocolAnthropic, ProtocolGemini, ProtocolOllama:
+		case ProtocolCLI:
+			if e.Command != "" && e.Command != "claude" && e.Command != "codex" {
+				return nil, fmt.Errorf("providers.list: %q has unknown cli command %q", e.Name, e.Command)
+			}
+		default:
+			return nil, fmt.Errorf("providers.list: %q has unknown protocol %q", e.Name, e.Protocol)
+		}
+	}
+
+	return &Registry{
+		entries:         entries,
+		defaultProvider: strings.ToLower(defaultProvider),
+		workspace:       workspace,
+		fallback:        fallback,
+		providers:       make(map[string]LLMProvider),
+	}, nil
+}
+
+// SetRateLimit sets the limits for entries that do not configure their own.
+func (r *Registry) SetRateLimit(cfg config.RateLimitConfig) {
+	r.rateLimit = cfg
+}
+
+// Resolve finds the entry serving model and the model ID to send to it.
+// A "<name>/" prefix wins, then an entry listing the model, then the entry
+// named by agents.defaults.provider. It returns nil if no entry matches.
+func (r *Registry) Resolve(model string) (*config.ProviderEntry, string) {
+	if idx := strings.Index(model, "/"); idx > 0 {
+		if e := r.entry(model[:idx]); e != nil {
+			return e, model[idx+1:]
+		}
+	}
+	for i := range r.entries {
+		for _, m := range r.entries[i].Models {
+			if m == model {
+				return &r.entries[i], model
+			}
+		}
+	}
+	if e := r.entry(r.defaultProvider); e != nil {
+		return e, model
+	}
+	return nil, ""
+}
+
+func (r *Registry) entry(name string) *config.ProviderEntry {
+	for i := range r.entries {
+		if strings.EqualFold(r.entries[i].Name, name) {
+			return &r.entries[i]
+		}
+	}
+	return nil
+}
+
+func (r *Registry) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	entry, modelID := r.Resolve(model)
+	if entry == nil {
+		if r.fallback == nil {
+			return nil, fmt.Errorf("no provider configured for model: %s", model)
+		}
+		return r.fallback.Chat(ctx, messages, tools, model, options)
+	}
+	return r.provider(entry).Chat(ctx, messages, tools, modelID, options)
+}
+
+func (r *Registry) GetDefaultModel() string {
+	if e := r.entry(r.defaultProvider); e != nil && len(e.Models) > 0 {
+		return e.Name + "/" + e.Models[0]
+	}
+	if r.fallback != nil {
+		return r.fallback.GetDefaultModel()
+	}
+	return ""
+}
+
+// ListModels returns the configured models of every entry as "<name>/<model>".
+// Entries without a model list are asked directly when their protocol supports it.
+func (r *Registry) ListModels(ctx context.Context) ([]string, error) {
+	var models []string
+	for i := range r.entries {
+		e := &r.entries[i]
+		names := e.Models
+		if len(names) == 0 {
+			if lister, ok := r.provider(e).(ModelLister); ok {
+				// An unreachable server should not hide the other entries
+				names, _ = lister.ListModels(ctx)
+			}
+		}
+		for _, m := range names {
+			models = append(models, e.Name+"/"+m)
+		}
+	}
+	if lister, ok := r.fallback.(ModelLister); ok {
+		if names, err := lister.ListModels(ctx); err == nil {
+			models = append(models, names...)
+		}
+	}
+	sort.Strings(models)
+	return models, nil
+}
+
+// provider returns the cached provider for an entry, creating it on first use.
+func (r *Registry) provider(e *config.ProviderEntry) LLMProvider {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := strings.ToLower(e.Name)
+	if p, ok := r.providers[key]; ok {
+		return p
+	}
+	limits := r.rateLimit
+	if e.RateLimit != nil {
+		limits = *e.RateLimit
+	}
+	p := NewLimitedProvider(e.Name, newEntryProvider(*e, r.workspace), limits)
+	r.providers[key] = p
+	return p
+}
+
+// Circuits reports the breaker state of every entry used so far and of the fallback.
+func (r *Registry) Circuits() map[string]string {
+	circuits := make(map[string]string)
+	if reporter, ok := r.fallback.(CircuitReporter); ok {
+		for name, state := range reporter.Circuits() {
+			circuits[name] = state
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range r.providers {
+		if reporter, ok := p.(CircuitReporter); ok {
+			for name, state := range reporter.Circuits() {
+				circuits[name] = state
+			}
+		}
+	}
+	return circuits
+}
+
+// newEntryProvider builds the provider for an entry already checked by NewRegistry.
+func newEntryProvider(e config.ProviderEntry, workspace string) LLMProvider {
+	if keys := e.Keys(); len(keys) > 1 && e.Protocol != ProtocolCLI {
+		return withKeyRotation(e.Name, e.KeyRotation, keys, func(key string) LLMProvider {
+			single := e
+			single.APIKey, single.APIKeys = key, nil
+			return newEntryProvider(single, workspace)
+		})
+	}
+	switch e.Protocol {
+	case ProtocolOpenAIResponses:
+		return NewResponsesProvider(e.APIKey, e.APIBase, newProxyClient(e.Proxy, 120*time.Second), e.Headers)
+	case ProtocolAnthropic:
+		return NewClaudeProviderWithAPIKey(e.APIKey, e.APIBase, newProxyClient(e.Proxy, 120*time.Second), e.Headers)
+	case ProtocolGemini:
+		p := NewGeminiProvider(e.APIKey, e.APIBase, e.Proxy, nil)
+		p.headers = e.Headers
+		return p
+	case ProtocolOllama:
+		p := NewOllamaProvider(e.APIKey, e.APIBase, e.Proxy, "", 0)
+		p.headers = e.Headers
+		return p
+	case ProtocolCLI:
+		if workspace == "" {
+			workspace = "."
+		}
+		if e.Command == "codex" {
+			return NewCodexCliProvider(workspace)
+		}
+		return NewClaudeCliProvider(workspace)
+	default:
+		p := NewHTTPProvider(e.APIKey, e.APIBase, e.Proxy)
+		p.headers = e.Headers
+		p.promptCacheKey = p.promptCacheKey || e.PromptCacheKey
+		p.toolProtocols = e.ToolProtocols
+		return p
+	}
+}
+
+func newProxyClient(proxy string, timeout time.Duration) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err == nil {
+			client.Transport = &http.Transport{
+				Proxy: http.ProxyURL(proxyURL),
+			}
+		}
+	}
+	return client
+}
@@ -0,0 +1,164 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestRegistry_Resolve(t *testing.T) {
+	r, err := NewRegistry([]config.ProviderEntry{
+		{Name: "myvllm", Protocol: ProtocolOpenAIChat, APIBase: "http://gpu:8000/v1", Models: []string{"qwen3"}},
+		{Name: "local", Protocol: ProtocolOllama},
+	}, "local", "", nil)
+	if err != nil {
+		t.Fatalf("NewRegistry() error: %v", err)
+	}
+
+	tests := []struct {
+		model     string
+		wantEntry string
+		wantModel string
+	}{
+		{"myvllm/qwen3", "myvllm", "qwen3"},
+		{"MyVLLM/org/model", "myvllm", "org/model"},
+		{"qwen3", "myvllm", "qwen3"},
+		{"llama3.2", "local", "llama3.2"},
+		{"meta-llama/llama-3", "local", "meta-llama/llama-3"},
+	}
+	for _, tt := range tests {
+		entry, model := r.Resolve(tt.model)
+		if entry == nil {
+			t.Errorf("Resolve(%q) = nil, want %s", tt.model, tt.wantEntry)
+			continue
+		}
+		if entry.Name != tt.wantEntry || model != tt.wantModel {
+			t.Errorf("Resolve(%q) = (%s, %q), want (%s, %q)", tt.model, entry.Name, model, tt.wantEntry, tt.wantModel)
+		}
+	}
+
+	noDefault, _ := NewRegistry([]config.ProviderEntry{{Name: "local", Protocol: ProtocolOllama}}, "", "", nil)
+	if entry, _ := noDefault.Resolve("gpt-4o"); entry != nil {
+		t.Errorf("Resolve(gpt-4o) = %s, want nil", entry.Name)
+	}
+}
+
+func TestNewRegistry_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []config.ProviderEntry
+	}{
+		{"missing name", []config.ProviderEntry{{Protocol: ProtocolOllama}}},
+		{"slash in name", []config.ProviderEntry{{Name: "a/b", Protocol: ProtocolOllama}}},
+		{"duplicate", []config.ProviderEntry{{Name: "a", Protocol: ProtocolOllama}, {Name: "A", Protocol: ProtocolGemini}}},
+		{"unknown protocol", []config.ProviderEntry{{Name: "a", Protocol: "soap"}}},
+		{"openai-chat without base", []config.ProviderEntry{{Name: "a", Protocol: ProtocolOpenAIChat}}},
+		{"unknown cli command", []config.ProviderEntry{{Name: "a", Protocol: ProtocolCLI, Command: "vim"}}},
+	}
+	for _, tt := range tests {
+		if _, err := NewRegistry(tt.entries, "", "", nil); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestNewEntryProvider_Protocols(t *testing.T) {
+	tests := []struct {
+		entry config.ProviderEntry
+		check func(LLMProvider) bool
+	}{
+		{config.ProviderEntry{Protocol: ProtocolOpenAIChat, APIBase: "http://x"}, func(p LLMProvider) bool { _, ok := p.(*HTTPProvider); return ok }},
+		{config.ProviderEntry{Protocol: ProtocolOpenAIResponses}, func(p LLMProvider) bool { _, ok := p.(*CodexProvider); return ok }},
+		{config.ProviderEntry{Protocol: ProtocolAnthropic}, func(p LLMProvider) bool { _, ok := p.(*ClaudeProvider); return ok }},
+		{config.ProviderEntry{Protocol: ProtocolGemini}, func(p LLMProvider) bool { _, ok := p.(*GeminiProvider); return ok }},
+		{config.ProviderEntry{Protocol: ProtocolOllama}, func(p LLMProvider) bool { _, ok := p.(*OllamaProvider); return ok }},
+		{config.ProviderEntry{Protocol: ProtocolCLI}, func(p LLMProvider) bool { _, ok := p.(*ClaudeCliProvider); return ok }},
+		{config.ProviderEntry{Protocol: ProtocolCLI, Command: "codex"}, func(p LLMProvider) bool { _, ok := p.(*CodexCliProvider); return ok }},
+	}
+	for _, tt := range tests {
+		if p := newEntryProvider(tt.entry, "/tmp"); !tt.check(p) {
+			t.Errorf("protocol %s (command %q) built %T", tt.entry.Protocol, tt.entry.Command, p)
+		}
+	}
+}
+
+func TestRegistry_ChatRoutesWithHeaders(t *testing.T) {
+	var gotModel, gotHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get("X-Team")
+		var body map[string]interface{}
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		gotModel, _ = body["model"].(string)
+		w.Write([]byte(`{"choices": [{"message": {"content": "ok"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	r, err := NewRegistry([]config.ProviderEntry{{
+		Name:     "myvllm",
+		Protocol: ProtocolOpenAIChat,
+		APIBase:  server.URL,
+		Headers:  map[string]string{"X-Team": "research"},
+		Models:   []string{"qwen3"},
+	}}, "", "", nil)
+	if err != nil {
+		t.Fatalf("NewRegistry() error: %v", err)
+	}
+
+	resp, err := r.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "myvllm/qwen3", nil)
+	if err != nil {
+		t.Fatalf("Chat() error: %v", err)
+	}
+	if resp.Content != "ok" {
+		t.Errorf("Content = %q", resp.Content)
+	}
+	if gotModel != "qwen3" {
+		t.Errorf("model sent = %q, want qwen3", gotModel)
+	}
+	if gotHeader != "research" {
+		t.Errorf("X-Team header = %q", gotHeader)
+	}
+
+	if _, err := r.Chat(context.Background(), nil, nil, "unknown-model", nil); err == nil {
+		t.Error("expected error for unresolvable model without fallback")
+	}
+
+	models, _ := r.ListModels(context.Background())
+	if len(models) != 1 || models[0] != "myvllm/qwen3" {
+		t.Errorf("ListModels() = %v", models)
+	}
+}
+
+func TestCreateProvider_ListWithLegacyFallback(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Model = "myvllm/qwen3"
+	cfg.Providers.List = []config.ProviderEntry{{Name: "myvllm", Protocol: ProtocolOpenAIChat, APIBase: "http://gpu:8000/v1"}}
+
+	p, err := CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider() error: %v", err)
+	}
+	if _, ok := p.(*Registry); !ok {
+		t.Fatalf("provider = %T, want *Registry", p)
+	}
+
+	// A model outside the list still needs a usable legacy provider
+	cfg.Agents.Defaults.Model = "gpt-4o"
+	if _, err := CreateProvider(cfg); err == nil {
+		t.Error("expected error when neither the list nor legacy config can serve the model")
+	}
+
+	cfg.Providers.OpenAI.APIKey = "sk-test"
+	p, err = CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider() error: %v", err)
+	}
+	if reg := p.(*Registry); reg.fallback == nil {
+		t.Error("legacy provider should be kept as fallback")
+	}
+}
@@ -3,8 +3,17 @@ package providers
 import (
 	"encoding/json"
 	"strings"
+
+	"github.com/google/uuid"
 )
 
+// newToolCallID returns a unique tool call ID for providers whose APIs do
+// not assign one (Gemini, Ollama). IDs must stay unique across a session,
+// since other providers reject repeated IDs in history.
+func newToolCallID() string {
+	return "call_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:24]
+}
+
 // extractToolCallsFromText parses tool call JSON from response text.
 // Both ClaudeCliProvider and CodexCliProvider use this to extract
 // tool calls that the model outputs in its response text.
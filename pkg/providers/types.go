@@ -20,12 +20,31 @@ type LLMResponse struct {
 	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
 	FinishReason string     `json:"finish_reason"`
 	Usage        *UsageInfo `json:"usage,omitempty"`
+	// Reasoning is the model's thinking or reasoning summary, when exposed.
+	Reasoning string `json:"reasoning,omitempty"`
+	// ReasoningBlocks must be sent back with the tool calls they preceded
+	// (Anthropic rejects tool loops that drop signed thinking blocks).
+	ReasoningBlocks []ReasoningBlock `json:"reasoning_blocks,omitempty"`
+}
+
+// ReasoningBlock is a provider-signed thinking block, kept verbatim.
+type ReasoningBlock struct {
+	Type      string `json:"type"` // "thinking", "redacted_thinking" or "thought_signature"
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+	// ToolCallID is the function call a Gemini thought signature came with.
+	ToolCallID string `json:"tool_call_id,omitempty"`
 }
 
 type UsageInfo struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// Prompt cache activity, included in PromptTokens. Zero when the
+	// provider does not cache or does not report it.
+	CacheReadTokens  int `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
 }
 
 type Message struct {
@@ -33,6 +52,18 @@ type Message struct {
 	Content    string     `json:"content"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// Reasoning and ReasoningBlocks carry an assistant turn's thinking back
+	// to providers that need it within a tool loop.
+	Reasoning       string           `json:"reasoning,omitempty"`
+	ReasoningBlocks []ReasoningBlock `json:"reasoning_blocks,omitempty"`
+	// Media holds local file paths or data: URLs attached to the message.
+	// It is not serialized; providers that accept inline media read it directly.
+	Media []string `json:"-"`
+	// CachePrefix is the byte length of the leading part of a system message
+	// that stays identical across turns; the rest (time, session) changes.
+	// Providers with explicit prompt caching only cache up to it. Zero means
+	// the whole message is stable.
+	CachePrefix int `json:"-"`
 }
 
 type LLMProvider interface {
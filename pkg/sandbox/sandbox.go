@@ -0,0 +1,69 @@
+// Package sandbox runs commands confined by unprivileged Linux kernel
+// features: user, mount, PID, IPC, UTS and optionally network namespaces,
+// a Landlock filesystem ruleset, a seccomp filter and rlimits.
+//
+// The sandbox is set up by the picoclaw binary itself: Command re-executes
+// /proc/self/exe as a helper that confines itself and then execs the real
+// command. Programs using this package must call Init first thing in main.
+package sandbox
+
+import (
+	"errors"
+	"sync"
+)
+
+// helperArg is the first argument of a re-executed sandbox helper.
+const helperArg = "__picoclaw_sandbox"
+
+// helperFailed is the exit code of a helper that could not set up the
+// sandbox, before the command ran.
+const helperFailed = 125
+
+// ErrUnsupported is returned on platforms without a kernel sandbox.
+var ErrUnsupported = errors.New("sandbox is only supported on Linux")
+
+// errNoInit is returned when the running binary did not call Init, so it
+// cannot act as its own helper. This is the case in most test binaries,
+// which would otherwise run their tests again when re-executed.
+var errNoInit = errors.New("sandbox.Init was not called by this binary")
+
+// Spec describes the sandbox of one command.
+type Spec struct {
+	// Workspace is bind-mounted writable; the rest of the filesystem is
+	// read-only and /tmp is a private tmpfs.
+	Workspace string `json:"workspace"`
+	// Writable lists extra directories that stay writable.
+	Writable []string `json:"writable,omitempty"`
+	// Masked directories are hidden behind an empty read-only tmpfs, for
+	// secrets such as the picoclaw config and auth store. Writable
+	// directories beneath them stay visible.
+	Masked []string `json:"masked,omitempty"`
+	// Network keeps the host network; otherwise the command gets its own
+	// network namespace with only a loopback interface.
+	Network bool `json:"network"`
+	// CPUSeconds, MemoryMB and MaxProcesses set RLIMIT_CPU, RLIMIT_AS and
+	// RLIMIT_NPROC. Zero leaves a limit unchanged.
+	CPUSeconds   int `json:"cpu_seconds,omitempty"`
+	MemoryMB     int `json:"memory_mb,omitempty"`
+	MaxProcesses int `json:"max_processes,omitempty"`
+}
+
+var (
+	initialized bool
+
+	probeOnce sync.Once
+	probeErr  error
+)
+
+// Available reports why commands cannot be sandboxed on this machine, or
+// nil when they can. The first call runs a probe command; the result is
+// cached.
+func Available() error {
+	if !initialized {
+		return errNoInit
+	}
+	probeOnce.Do(func() {
+		probeErr = probe()
+	})
+	return probeErr
+}
@@ -0,0 +1,555 @@
+package sandbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	landlockRulePathBeneath = 1
+
+	secbitNoRoot       = 1 << 0
+	secbitNoRootLocked = 1 << 1
+
+	// x32SyscallBit marks x32 ABI syscalls on amd64, which share the
+	// x86_64 audit arch but not its syscall numbers.
+	x32SyscallBit = 0x40000000
+)
+
+// auditArch is the seccomp architecture of each supported GOARCH.
+var auditArch = map[string]uint32{
+	"amd64":   unix.AUDIT_ARCH_X86_64,
+	"arm64":   unix.AUDIT_ARCH_AARCH64,
+	"riscv64": unix.AUDIT_ARCH_RISCV64,
+	"loong64": unix.AUDIT_ARCH_LOONGARCH64,
+}
+
+// deniedSyscalls fail with EPERM in the sandbox: they change mounts or
+// namespaces, reach into other processes or the kernel, or set the clock.
+// clone is checked separately, see seccompFilter.
+var deniedSyscalls = []uintptr{
+	unix.SYS_MOUNT, unix.SYS_UMOUNT2, unix.SYS_PIVOT_ROOT, unix.SYS_FSOPEN, unix.SYS_FSMOUNT,
+	unix.SYS_FSCONFIG, unix.SYS_MOVE_MOUNT, unix.SYS_OPEN_TREE, unix.SYS_MOUNT_SETATTR,
+	unix.SYS_UNSHARE, unix.SYS_SETNS,
+	unix.SYS_PTRACE, unix.SYS_PROCESS_VM_READV, unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_BPF, unix.SYS_PERF_EVENT_OPEN, unix.SYS_USERFAULTFD,
+	unix.SYS_KEYCTL, unix.SYS_ADD_KEY, unix.SYS_REQUEST_KEY,
+	unix.SYS_INIT_MODULE, unix.SYS_FINIT_MODULE, unix.SYS_DELETE_MODULE,
+	unix.SYS_KEXEC_LOAD, unix.SYS_REBOOT,
+	unix.SYS_SWAPON, unix.SYS_SWAPOFF, unix.SYS_ACCT, unix.SYS_QUOTACTL, unix.SYS_SYSLOG,
+	unix.SYS_SETTIMEOFDAY, unix.SYS_CLOCK_SETTIME, unix.SYS_CLOCK_ADJTIME, unix.SYS_ADJTIMEX,
+	unix.SYS_NAME_TO_HANDLE_AT, unix.SYS_OPEN_BY_HANDLE_AT,
+}
+
+// Init runs the sandbox helper when the binary was started as one, and
+// never returns in that case. Call it first thing in main.
+func Init() {
+	initialized = true
+	if len(os.Args) < 2 || os.Args[1] != helperArg {
+		return
+	}
+
+	// Credentials, Landlock and seccomp apply per thread; exec from the
+	// thread that set them up so the command inherits all of them
+	runtime.LockOSThread()
+	if err := runHelper(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		os.Exit(helperFailed)
+	}
+}
+
+// Command returns a command that runs name with arg in the sandbox
+// described by spec. Dir, Env and the standard streams may be set as usual.
+func Command(ctx context.Context, spec Spec, name string, arg ...string) (*exec.Cmd, error) {
+	if !initialized {
+		return nil, errNoInit
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "/proc/self/exe", append([]string{helperArg, string(data), name}, arg...)...)
+	cmd.SysProcAttr = sysProcAttr(spec)
+	return cmd, nil
+}
+
+func sysProcAttr(spec Spec) *syscall.SysProcAttr {
+	flags := syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+	if !spec.Network {
+		flags |= syscall.CLONE_NEWNET
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+	return &syscall.SysProcAttr{
+		Cloneflags:  uintptr(flags),
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}},
+		// Only the helper holds these, inside its own namespaces, to set
+		// up mounts and loopback; it drops them before running the command
+		AmbientCaps: []uintptr{unix.CAP_SYS_ADMIN, unix.CAP_NET_ADMIN, unix.CAP_SETPCAP},
+	}
+}
+
+func probe() error {
+	dir, err := os.MkdirTemp("", "picoclaw-sandbox-probe")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd, err := Command(ctx, Spec{Workspace: dir}, "sh", "-c", "exit 0")
+	if err != nil {
+		return err
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// runHelper confines the current process as described by args[0] and
+// execs the command in args[1:].
+func runHelper(args []string) error {
+	if len(args) < 2 {
+		return errors.New("missing command")
+	}
+	var spec Spec
+	if err := json.Unmarshal([]byte(args[0]), &spec); err != nil {
+		return fmt.Errorf("invalid spec: %w", err)
+	}
+	path, err := exec.LookPath(args[1])
+	if err != nil {
+		return err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	writable := writablePaths(spec)
+	if err := setupMounts(writable, maskedPaths(spec)); err != nil {
+		return fmt.Errorf("mounts: %w", err)
+	}
+	// The old working directory is on the mount that just became read-only
+	if err := unix.Chdir(wd); err != nil {
+		return err
+	}
+	if !spec.Network {
+		if err := loopbackUp(); err != nil {
+			return fmt.Errorf("loopback: %w", err)
+		}
+	}
+	if err := dropCapabilities(); err != nil {
+		return fmt.Errorf("capabilities: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("no_new_privs: %w", err)
+	}
+	if err := applyLandlock(writable); err != nil {
+		return fmt.Errorf("landlock: %w", err)
+	}
+	if err := applySeccomp(); err != nil {
+		return fmt.Errorf("seccomp: %w", err)
+	}
+	if err := setRlimits(spec); err != nil {
+		return fmt.Errorf("rlimits: %w", err)
+	}
+	return unix.Exec(path, args[1:], os.Environ())
+}
+
+// writablePaths resolves the workspace and extra writable directories,
+// creating the workspace and skipping extras that do not exist.
+func writablePaths(spec Spec) []string {
+	var paths []string
+	if spec.Workspace != "" {
+		os.MkdirAll(spec.Workspace, 0755)
+	}
+	for i, p := range append([]string{spec.Workspace}, spec.Writable...) {
+		if p == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err == nil {
+			abs, err = filepath.EvalSymlinks(abs)
+		}
+		if err != nil {
+			if i == 0 {
+				fmt.Fprintf(os.Stderr, "sandbox: workspace %s: %v\n", p, err)
+			}
+			continue
+		}
+		paths = append(paths, abs)
+	}
+	return paths
+}
+
+// maskedPaths resolves the masked directories that exist.
+func maskedPaths(spec Spec) []string {
+	var paths []string
+	for _, p := range spec.Masked {
+		abs, err := filepath.Abs(p)
+		if err == nil {
+			abs, err = filepath.EvalSymlinks(abs)
+		}
+		if err == nil {
+			paths = append(paths, abs)
+		}
+	}
+	return paths
+}
+
+// setupMounts gives the command a private /tmp and /proc, hides the masked
+// directories, bind-mounts the writable directories and makes every other
+// mount read-only.
+func setupMounts(writable, masked []string) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+
+	// Hold the writable directories open, the new /tmp may hide them
+	fds := make([]int, len(writable))
+	for i, p := range writable {
+		fd, err := unix.Open(p, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return err
+		}
+		defer unix.Close(fd)
+		fds[i] = fd
+	}
+	if _, err := os.Stat("/tmp"); err == nil {
+		if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+			return fmt.Errorf("/tmp: %w", err)
+		}
+	}
+	// Writable directories beneath a masked one are recreated in its tmpfs
+	// and bound there below
+	for _, p := range masked {
+		if _, err := os.Stat(p); err != nil {
+			// Under the new /tmp, so hidden already
+			continue
+		}
+		if err := unix.Mount("tmpfs", p, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=0755"); err != nil {
+			return fmt.Errorf("mask %s: %w", p, err)
+		}
+	}
+	for i, p := range writable {
+		os.MkdirAll(p, 0755)
+		if err := unix.Mount("/proc/self/fd/"+strconv.Itoa(fds[i]), p, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind %s: %w", p, err)
+		}
+	}
+	// A writable directory above a masked one, such as a workspace at ~,
+	// brought the masked contents back with it
+	for _, p := range masked {
+		if !beneathAny(p, writable) || containsAny(p, writable) {
+			continue
+		}
+		if err := unix.Mount("tmpfs", p, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC|unix.MS_RDONLY, "mode=0755"); err != nil {
+			return fmt.Errorf("mask %s: %w", p, err)
+		}
+	}
+	// Show only the sandbox's own processes. Container runtimes that mask
+	// parts of /proc forbid a fresh mount; the host one stays then.
+	unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+
+	mounts, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	for _, m := range mounts {
+		if m == "/tmp" || m == "/proc" || strings.HasPrefix(m, "/proc/") || beneathAny(m, writable) {
+			continue
+		}
+		var st unix.Statfs_t
+		if err := unix.Statfs(m, &st); err != nil {
+			continue
+		}
+		err := unix.Mount("", m, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY|lockedFlags(int64(st.Flags)), "")
+		if err != nil && m == "/" {
+			return fmt.Errorf("read-only /: %w", err)
+		}
+	}
+	return nil
+}
+
+// mountPoints lists the mount points of the current mount namespace.
+func mountPoints() ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var points []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 4 {
+			points = append(points, unescapeMountPath(fields[4]))
+		}
+	}
+	return points, scanner.Err()
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for a space) of
+// /proc/self/mountinfo.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func beneathAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny reports whether any of paths is dir or beneath it.
+func containsAny(dir string, paths []string) bool {
+	for _, p := range paths {
+		if beneathAny(p, []string{dir}) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockedFlags returns the mount flags a user namespace may not clear when
+// it remounts a mount inherited from the host.
+func lockedFlags(statfsFlags int64) uintptr {
+	var flags uintptr
+	for st, ms := range map[int64]uintptr{
+		unix.ST_NOSUID:     unix.MS_NOSUID,
+		unix.ST_NODEV:      unix.MS_NODEV,
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if statfsFlags&st != 0 {
+			flags |= ms
+		}
+	}
+	return flags
+}
+
+// loopbackUp brings up lo in a fresh network namespace, so local servers
+// started by the command stay reachable.
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
+
+// dropCapabilities clears every capability of the helper and keeps a
+// command running as uid 0 from regaining them on exec.
+func dropCapabilities() error {
+	if err := unix.Prctl(unix.PR_SET_SECUREBITS, secbitNoRoot|secbitNoRootLocked, 0, 0, 0); err != nil {
+		return err
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return err
+	}
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	return unix.Capset(&hdr, &data[0])
+}
+
+// applyLandlock allows reading and executing everywhere and writing only
+// beneath the writable directories, /tmp and device files. Kernels without
+// Landlock rely on the read-only mounts alone.
+func applyLandlock(writable []string) error {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		if errno == unix.ENOSYS || errno == unix.EOPNOTSUPP {
+			return nil
+		}
+		return errno
+	}
+
+	handled := landlockAccess(int(abi))
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	rulesetFd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return errno
+	}
+	defer unix.Close(int(rulesetFd))
+
+	readExec := uint64(unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR)
+	rules := map[string]uint64{
+		"/":    readExec,
+		"/dev": readExec | unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_TRUNCATE | unix.LANDLOCK_ACCESS_FS_IOCTL_DEV,
+		"/tmp": handled,
+	}
+	for _, p := range writable {
+		rules[p] = handled
+	}
+	for path, access := range rules {
+		fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			continue
+		}
+		rule := unix.LandlockPathBeneathAttr{Allowed_access: access & handled, Parent_fd: int32(fd)}
+		_, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, rulesetFd, landlockRulePathBeneath, uintptr(unsafe.Pointer(&rule)), 0, 0, 0)
+		unix.Close(fd)
+		if errno != 0 {
+			return fmt.Errorf("rule for %s: %w", path, errno)
+		}
+	}
+
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, rulesetFd, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// landlockAccess returns the filesystem rights known to a Landlock ABI.
+func landlockAccess(abi int) uint64 {
+	// ABI 1 covers EXECUTE through MAKE_SYM
+	access := uint64(unix.LANDLOCK_ACCESS_FS_MAKE_SYM<<1 - 1)
+	if abi >= 2 {
+		access |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		access |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	if abi >= 5 {
+		access |= unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+	}
+	return access
+}
+
+func applySeccomp() error {
+	arch, ok := auditArch[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("unsupported architecture %s", runtime.GOARCH)
+	}
+	filter := seccompFilter(arch, deniedSyscalls)
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	return unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0)
+}
+
+// namespaceCloneFlags create namespaces, which clone must not do in the
+// sandbox any more than unshare.
+const namespaceCloneFlags = unix.CLONE_NEWNS | unix.CLONE_NEWCGROUP | unix.CLONE_NEWUTS | unix.CLONE_NEWIPC |
+	unix.CLONE_NEWUSER | unix.CLONE_NEWPID | unix.CLONE_NEWNET
+
+// seccompFilter builds a BPF program that kills syscalls of a foreign
+// architecture and fails the denied ones with EPERM. clone fails with
+// EPERM when it asks for new namespaces. clone3 passes its flags in
+// memory, which seccomp cannot inspect, so it fails with ENOSYS and libc
+// falls back to clone.
+func seccompFilter(arch uint32, denied []uintptr) []unix.SockFilter {
+	n := len(denied)
+	const head = 7
+	allow := head + n
+	cloneFlags := allow + 1
+	noSys := allow + 4
+	deny := allow + 5
+	jump := func(from, to int) uint8 { return uint8(to - from - 1) }
+
+	filter := []unix.SockFilter{
+		bpfStmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 4), // seccomp_data.arch
+		bpfJump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, arch, 1, 0),
+		bpfStmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+		bpfStmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 0), // seccomp_data.nr
+		bpfJump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, x32SyscallBit, jump(4, deny), 0),
+		bpfJump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, unix.SYS_CLONE3, jump(5, noSys), 0),
+		bpfJump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, unix.SYS_CLONE, jump(6, cloneFlags), 0),
+	}
+	for i, nr := range denied {
+		filter = append(filter, bpfJump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr), jump(head+i, deny), 0))
+	}
+	return append(filter,
+		bpfStmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW),
+		// Low 32 bits of seccomp_data.args[0]; every supported
+		// architecture is little-endian
+		bpfStmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 16),
+		bpfJump(unix.BPF_JMP|unix.BPF_JSET|unix.BPF_K, namespaceCloneFlags, jump(cloneFlags+1, deny), 0),
+		bpfStmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW),
+		bpfStmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.ENOSYS)),
+		bpfStmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.EPERM)),
+	)
+}
+
+func bpfStmt(code uint16, k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: code, K: k}
+}
+
+func bpfJump(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
+
+// setRlimits lowers the CPU, address space and process limits. A limit
+// above the current hard limit is capped to it.
+func setRlimits(spec Spec) error {
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_CPU, uint64(spec.CPUSeconds)},
+		{unix.RLIMIT_AS, uint64(spec.MemoryMB) << 20},
+		{unix.RLIMIT_NPROC, uint64(spec.MaxProcesses)},
+	}
+	for _, l := range limits {
+		if l.value == 0 {
+			continue
+		}
+		var cur unix.Rlimit
+		if err := unix.Getrlimit(l.resource, &cur); err != nil {
+			return err
+		}
+		value := min(l.value, cur.Max)
+		if err := unix.Setrlimit(l.resource, &unix.Rlimit{Cur: value, Max: value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
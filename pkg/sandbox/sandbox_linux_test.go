@@ -0,0 +1,198 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestMain(m *testing.M) {
+	Init()
+	os.Exit(m.Run())
+}
+
+func runSandboxed(t *testing.T, spec Spec, script string) (string, error) {
+	t.Helper()
+	if err := Available(); err != nil {
+		t.Skipf("sandbox not available: %v", err)
+	}
+	cmd, err := Command(context.Background(), spec, "sh", "-c", script)
+	if err != nil {
+		t.Fatalf("Command() error: %v", err)
+	}
+	cmd.Dir = spec.Workspace
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestSandbox_Filesystem(t *testing.T) {
+	workspace := t.TempDir()
+	outside := t.TempDir()
+	// A directory on the root filesystem rather than the host /tmp
+	hostDir, err := os.MkdirTemp(".", "sandbox-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(hostDir)
+	hostDir, _ = filepath.Abs(hostDir)
+
+	out, err := runSandboxed(t, Spec{Workspace: workspace}, `
+		echo ok > inside.txt || exit 1
+		echo x > `+hostDir+`/escaped.txt 2>/dev/null && echo host-writable
+		echo x > `+outside+`/escaped.txt 2>/dev/null
+		cat /proc/self/status | grep -q "Seccomp:.*2" || echo no-seccomp
+		exit 0`)
+	if err != nil {
+		t.Fatalf("run error: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "host-writable") || strings.Contains(out, "no-seccomp") {
+		t.Errorf("output = %q", out)
+	}
+	if data, err := os.ReadFile(filepath.Join(workspace, "inside.txt")); err != nil || string(data) != "ok\n" {
+		t.Errorf("workspace file = %q, %v", data, err)
+	}
+	// /tmp is private, so writes to other temp directories stay inside
+	if _, err := os.Stat(filepath.Join(outside, "escaped.txt")); !os.IsNotExist(err) {
+		t.Error("write outside the workspace reached the host")
+	}
+}
+
+func TestSandbox_Limits(t *testing.T) {
+	out, err := runSandboxed(t, Spec{Workspace: t.TempDir(), CPUSeconds: 7, MaxProcesses: 50}, `cat /proc/self/limits`)
+	if err != nil {
+		t.Fatalf("run error: %v\n%s", err, out)
+	}
+	for _, want := range []string{"Max cpu time", "Max processes"} {
+		found := false
+		for _, line := range strings.Split(out, "\n") {
+			if strings.HasPrefix(line, want) {
+				fields := strings.Fields(strings.TrimPrefix(line, want))
+				found = len(fields) > 0 && (fields[0] == "7" || fields[0] == "50")
+			}
+		}
+		if !found {
+			t.Errorf("%s not limited:\n%s", want, out)
+		}
+	}
+}
+
+// runFilter interprets the BPF subset seccompFilter emits.
+func runFilter(t *testing.T, filter []unix.SockFilter, arch, nr uint32, arg0 uint64) uint32 {
+	t.Helper()
+	var acc uint32
+	for pc := 0; pc < len(filter); pc++ {
+		ins := filter[pc]
+		switch ins.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			switch ins.K {
+			case 0:
+				acc = nr
+			case 4:
+				acc = arch
+			case 16:
+				acc = uint32(arg0)
+			default:
+				t.Fatalf("load of offset %d", ins.K)
+			}
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K:
+			pc += int(map[bool]uint8{true: ins.Jt, false: ins.Jf}[acc == ins.K])
+		case unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K:
+			pc += int(map[bool]uint8{true: ins.Jt, false: ins.Jf}[acc >= ins.K])
+		case unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K:
+			pc += int(map[bool]uint8{true: ins.Jt, false: ins.Jf}[acc&ins.K != 0])
+		case unix.BPF_RET | unix.BPF_K:
+			return ins.K
+		default:
+			t.Fatalf("unexpected instruction %#x", ins.Code)
+		}
+	}
+	t.Fatal("filter fell off the end")
+	return 0
+}
+
+func TestSeccompFilter(t *testing.T) {
+	const arch = unix.AUDIT_ARCH_X86_64
+	filter := seccompFilter(arch, deniedSyscalls)
+	eperm := unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+	cases := []struct {
+		name string
+		arch uint32
+		nr   uint32
+		arg0 uint64
+		want uint32
+	}{
+		{"read", arch, unix.SYS_READ, 0, unix.SECCOMP_RET_ALLOW},
+		{"unshare", arch, unix.SYS_UNSHARE, 0, eperm},
+		{"setns", arch, unix.SYS_SETNS, 0, eperm},
+		{"last denied", arch, uint32(deniedSyscalls[len(deniedSyscalls)-1]), 0, eperm},
+		{"x32", arch, x32SyscallBit | unix.SYS_READ, 0, eperm},
+		{"foreign arch", unix.AUDIT_ARCH_I386, unix.SYS_READ, 0, unix.SECCOMP_RET_KILL_PROCESS},
+		{"fork", arch, unix.SYS_CLONE, uint64(unix.SIGCHLD), unix.SECCOMP_RET_ALLOW},
+		{"thread", arch, unix.SYS_CLONE, unix.CLONE_VM | unix.CLONE_THREAD | unix.CLONE_SIGHAND, unix.SECCOMP_RET_ALLOW},
+		{"clone newuser", arch, unix.SYS_CLONE, unix.CLONE_NEWUSER | uint64(unix.SIGCHLD), eperm},
+		{"clone newns", arch, unix.SYS_CLONE, unix.CLONE_NEWNS, eperm},
+		{"clone3", arch, unix.SYS_CLONE3, 0, unix.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS)},
+	}
+	for _, c := range cases {
+		if got := runFilter(t, filter, c.arch, c.nr, c.arg0); got != c.want {
+			t.Errorf("%s: filter returned %#x, want %#x", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSandbox_NoNewNamespaces(t *testing.T) {
+	out, err := runSandboxed(t, Spec{Workspace: t.TempDir()}, `
+		command -v unshare >/dev/null || { echo skip; exit 0; }
+		unshare -U true 2>/dev/null && echo unshare-worked
+		exit 0`)
+	if err != nil {
+		t.Fatalf("run error: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "unshare-worked") {
+		t.Errorf("a new user namespace was created: %q", out)
+	}
+}
+
+func TestSandbox_Masked(t *testing.T) {
+	// Directories on the root filesystem rather than the host /tmp
+	home, err := os.MkdirTemp(".", "sandbox-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	home, _ = filepath.Abs(home)
+	secrets := filepath.Join(home, ".picoclaw")
+	workspace := filepath.Join(secrets, "workspace")
+	os.MkdirAll(workspace, 0755)
+	os.WriteFile(filepath.Join(secrets, "auth.json"), []byte("secret"), 0600)
+
+	spec := Spec{Workspace: workspace, Masked: []string{secrets}}
+	out, err := runSandboxed(t, spec, `
+		cat ../auth.json 2>/dev/null && echo leaked
+		echo ok > inside.txt || echo workspace-hidden
+		touch ../new.txt 2>/dev/null && echo mask-writable
+		exit 0`)
+	if err != nil {
+		t.Fatalf("run error: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "secret") || strings.Contains(out, "leaked") || strings.Contains(out, "workspace-hidden") || strings.Contains(out, "mask-writable") {
+		t.Errorf("output = %q", out)
+	}
+
+	// A workspace above the masked directory does not expose it
+	spec = Spec{Workspace: home, Masked: []string{secrets}}
+	out, err = runSandboxed(t, spec, `cat .picoclaw/auth.json 2>/dev/null && echo leaked; exit 0`)
+	if err != nil || strings.Contains(out, "leaked") {
+		t.Errorf("output = %q, %v", out, err)
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	if got := unescapeMountPath(`/mnt/my\040disk`); got != "/mnt/my disk" {
+		t.Errorf("unescapeMountPath() = %q", got)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"context"
+	"os/exec"
+)
+
+// Init is a no-op on platforms without a kernel sandbox.
+func Init() {
+	initialized = true
+}
+
+// Command is a stub for non-Linux platforms.
+func Command(ctx context.Context, spec Spec, name string, arg ...string) (*exec.Cmd, error) {
+	return nil, ErrUnsupported
+}
+
+func probe() error {
+	return ErrUnsupported
+}
@@ -10,10 +10,14 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/netguard"
 )
 
 type SkillInstaller struct {
 	workspace string
+	client    *http.Client
 }
 
 type AvailableSkill struct {
@@ -30,9 +34,12 @@ type BuiltinSkill struct {
 	Enabled bool   `json:"enabled"`
 }
 
-func NewSkillInstaller(workspace string) *SkillInstaller {
+// NewSkillInstaller creates an installer whose downloads may only reach
+// private, loopback and link-local addresses listed in network.
+func NewSkillInstaller(workspace string, network config.NetworkConfig) *SkillInstaller {
 	return &SkillInstaller{
 		workspace: workspace,
+		client:    netguard.NewClient(15*time.Second, network.AllowedHosts, network.UseProxy),
 	}
 }
 
@@ -45,13 +52,12 @@ func (si *SkillInstaller) InstallFromGitHub(ctx context.Context, repo string) er
 
 	url := fmt.Sprintf("https://raw.githubusercontent.com/%s/main/SKILL.md", repo)
 
-	client := &http.Client{Timeout: 15 * time.Second}
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := client.Do(req)
+	resp, err := si.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to fetch skill: %w", err)
 	}
@@ -95,13 +101,12 @@ func (si *SkillInstaller) Uninstall(skillName string) error {
 func (si *SkillInstaller) ListAvailableSkills(ctx context.Context) ([]AvailableSkill, error) {
 	url := "https://raw.githubusercontent.com/sipeed/picoclaw-skills/main/skills.json"
 
-	client := &http.Client{Timeout: 15 * time.Second}
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := client.Do(req)
+	resp, err := si.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch skills list: %w", err)
 	}
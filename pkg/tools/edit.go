@@ -2,14 +2,17 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 )
 
-// EditFileTool edits a file by replacing old_text with new_text.
-// The old_text must exist exactly in the file.
+// EditFileTool edits a file by replacing old_text with new_text, or by
+// applying a list of such edits in order. Text that is not found exactly
+// is matched line by line ignoring differences in whitespace.
 type EditFileTool struct {
+	fileTracking
 	allowedDir string
 	restrict   bool
 }
@@ -27,7 +30,7 @@ func (t *EditFileTool) Name() string {
 }
 
 func (t *EditFileTool) Description() string {
-	return "Edit a file by replacing old_text with new_text. The old_text must exist exactly in the file."
+	return "Edit a file by replacing old_text with new_text, or make several replacements at once with edits. Each old_text must match one place in the file; if it does not match exactly, lines are compared ignoring whitespace. Either all edits are written or none."
 }
 
 func (t *EditFileTool) Parameters() map[string]interface{} {
@@ -46,8 +49,20 @@ func (t *EditFileTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "The text to replace with",
 			},
+			"edits": map[string]interface{}{
+				"type":        "array",
+				"description": "Several replacements applied in order, instead of old_text and new_text",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"old_text": map[string]interface{}{"type": "string"},
+						"new_text": map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"old_text", "new_text"},
+				},
+			},
 		},
-		"required": []string{"path", "old_text", "new_text"},
+		"required": []string{"path"},
 	}
 }
 
@@ -57,14 +72,9 @@ func (t *EditFileTool) Execute(ctx context.Context, args map[string]interface{})
 		return ErrorResult("path is required")
 	}
 
-	oldText, ok := args["old_text"].(string)
-	if !ok {
-		return ErrorResult("old_text is required")
-	}
-
-	newText, ok := args["new_text"].(string)
-	if !ok {
-		return ErrorResult("new_text is required")
+	edits, err := parseEdits(args)
+	if err != nil {
+		return ErrorResult(err.Error())
 	}
 
 	resolvedPath, err := validatePath(path, t.allowedDir, t.restrict)
@@ -72,8 +82,11 @@ func (t *EditFileTool) Execute(ctx context.Context, args map[string]interface{})
 		return ErrorResult(err.Error())
 	}
 
-	if _, err := os.Stat(resolvedPath); os.IsNotExist(err) {
+	info, err := os.Stat(resolvedPath)
+	if os.IsNotExist(err) {
 		return ErrorResult(fmt.Sprintf("file not found: %s", path))
+	} else if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
 	}
 
 	content, err := os.ReadFile(resolvedPath)
@@ -82,26 +95,164 @@ func (t *EditFileTool) Execute(ctx context.Context, args map[string]interface{})
 	}
 
 	contentStr := string(content)
+	for i, e := range edits {
+		contentStr, err = applyEdit(contentStr, e.oldText, e.newText)
+		if err != nil {
+			if len(edits) > 1 {
+				return ErrorResult(fmt.Sprintf("edit %d of %d: %v. No edits were written", i+1, len(edits), err))
+			}
+			return ErrorResult(err.Error())
+		}
+	}
 
-	if !strings.Contains(contentStr, oldText) {
-		return ErrorResult("old_text not found in file. Make sure it matches exactly")
+	t.track(resolvedPath)
+	if err := os.WriteFile(resolvedPath, []byte(contentStr), info.Mode().Perm()); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to write file: %v", err))
 	}
 
-	count := strings.Count(contentStr, oldText)
-	if count > 1 {
-		return ErrorResult(fmt.Sprintf("old_text appears %d times. Please provide more context to make it unique", count))
+	if len(edits) > 1 {
+		return SilentResult(fmt.Sprintf("File edited: %s (%d edits)", path, len(edits)))
 	}
+	return SilentResult(fmt.Sprintf("File edited: %s", path))
+}
 
-	newContent := strings.Replace(contentStr, oldText, newText, 1)
+type textEdit struct {
+	oldText string
+	newText string
+}
 
-	if err := os.WriteFile(resolvedPath, []byte(newContent), 0644); err != nil {
-		return ErrorResult(fmt.Sprintf("failed to write file: %v", err))
+func parseEdits(args map[string]interface{}) ([]textEdit, error) {
+	if raw, ok := args["edits"].([]interface{}); ok && len(raw) > 0 {
+		edits := make([]textEdit, 0, len(raw))
+		for i, item := range raw {
+			m, _ := item.(map[string]interface{})
+			oldText, ok1 := m["old_text"].(string)
+			newText, ok2 := m["new_text"].(string)
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("edit %d needs old_text and new_text", i+1)
+			}
+			edits = append(edits, textEdit{oldText: oldText, newText: newText})
+		}
+		return edits, nil
 	}
 
-	return SilentResult(fmt.Sprintf("File edited: %s", path))
+	oldText, ok := args["old_text"].(string)
+	if !ok {
+		return nil, errors.New("old_text is required")
+	}
+	newText, ok := args["new_text"].(string)
+	if !ok {
+		return nil, errors.New("new_text is required")
+	}
+	return []textEdit{{oldText: oldText, newText: newText}}, nil
+}
+
+// applyEdit replaces the one occurrence of oldText in content. When there
+// is no exact occurrence, whole lines are matched ignoring whitespace and
+// newText is re-indented to the indentation found in the file.
+func applyEdit(content, oldText, newText string) (string, error) {
+	if oldText == "" {
+		return "", errors.New("old_text must not be empty")
+	}
+	switch count := strings.Count(content, oldText); {
+	case count == 1:
+		return strings.Replace(content, oldText, newText, 1), nil
+	case count > 1:
+		return "", fmt.Errorf("old_text appears %d times. Please provide more context to make it unique", count)
+	}
+
+	want := splitEditLines(oldText)
+	if strings.TrimSpace(oldText) == "" {
+		return "", errors.New("old_text not found in file. Make sure it matches exactly")
+	}
+	lines := strings.Split(content, "\n")
+	matches := findLines(lines, want, true)
+	switch {
+	case len(matches) == 0:
+		return "", errors.New("old_text not found in file, even ignoring whitespace. Make sure it matches exactly")
+	case len(matches) > 1:
+		return "", fmt.Errorf("old_text matches %d places when ignoring whitespace. Please provide more context to make it unique", len(matches))
+	}
+
+	at := matches[0]
+	first := 0
+	for first < len(want)-1 && strings.TrimSpace(want[first]) == "" {
+		first++
+	}
+	replacement := reindent(splitEditLines(newText), leadingSpace(want[first]), leadingSpace(lines[at+first]))
+	out := make([]string, 0, len(lines)-len(want)+len(replacement))
+	out = append(out, lines[:at]...)
+	out = append(out, replacement...)
+	out = append(out, lines[at+len(want):]...)
+	return strings.Join(out, "\n"), nil
+}
+
+// splitEditLines splits text into lines, ignoring one trailing newline.
+func splitEditLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// normalizeSpace collapses whitespace so lines can be compared ignoring
+// indentation and spacing.
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// findLines returns every index at which want occurs in lines, comparing
+// lines exactly or, if loose, with normalizeSpace.
+func findLines(lines, want []string, loose bool) []int {
+	if len(want) == 0 || len(want) > len(lines) {
+		return nil
+	}
+	if loose {
+		lines = normalizeLines(lines)
+		want = normalizeLines(want)
+	}
+	var found []int
+next:
+	for i := 0; i+len(want) <= len(lines); i++ {
+		for j, w := range want {
+			if lines[i+j] != w {
+				continue next
+			}
+		}
+		found = append(found, i)
+	}
+	return found
+}
+
+func normalizeLines(lines []string) []string {
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = normalizeSpace(l)
+	}
+	return out
+}
+
+func leadingSpace(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+// reindent replaces the indentation from with to at the start of lines.
+func reindent(lines []string, from, to string) []string {
+	if from == to {
+		return lines
+	}
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		if strings.TrimSpace(l) != "" && strings.HasPrefix(l, from) {
+			l = to + l[len(from):]
+		}
+		out[i] = l
+	}
+	return out
 }
 
 type AppendFileTool struct {
+	fileTracking
 	workspace string
 	restrict  bool
 }
@@ -151,6 +302,7 @@ func (t *AppendFileTool) Execute(ctx context.Context, args map[string]interface{
 		return ErrorResult(err.Error())
 	}
 
+	t.track(resolvedPath)
 	f, err := os.OpenFile(resolvedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to open file: %v", err))
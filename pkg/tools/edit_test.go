@@ -287,3 +287,74 @@ func TestEditTool_AppendFile_MissingContent(t *testing.T) {
 		t.Errorf("Expected error when content is missing")
 	}
 }
+
+// TestEditTool_EditFile_MultiEdit verifies several edits are applied in order
+func TestEditTool_EditFile_MultiEdit(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	os.WriteFile(testFile, []byte("alpha\nbeta\ngamma\n"), 0644)
+
+	tool := NewEditFileTool(tmpDir, true)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"path": testFile,
+		"edits": []interface{}{
+			map[string]interface{}{"old_text": "alpha", "new_text": "ALPHA"},
+			map[string]interface{}{"old_text": "ALPHA\nbeta", "new_text": "ALPHA\nBETA"},
+		},
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got: %s", result.ForLLM)
+	}
+	content, _ := os.ReadFile(testFile)
+	if string(content) != "ALPHA\nBETA\ngamma\n" {
+		t.Errorf("Unexpected content: %q", content)
+	}
+	if !strings.Contains(result.ForLLM, "2 edits") {
+		t.Errorf("Expected edit count, got: %s", result.ForLLM)
+	}
+}
+
+// TestEditTool_EditFile_MultiEditAtomic verifies a failing edit writes nothing
+func TestEditTool_EditFile_MultiEditAtomic(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	os.WriteFile(testFile, []byte("alpha\nbeta\n"), 0644)
+
+	tool := NewEditFileTool(tmpDir, true)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"path": testFile,
+		"edits": []interface{}{
+			map[string]interface{}{"old_text": "alpha", "new_text": "ALPHA"},
+			map[string]interface{}{"old_text": "delta", "new_text": "DELTA"},
+		},
+	})
+	if !result.IsError || !strings.Contains(result.ForLLM, "edit 2 of 2") {
+		t.Errorf("Expected error for second edit, got: %s", result.ForLLM)
+	}
+	content, _ := os.ReadFile(testFile)
+	if string(content) != "alpha\nbeta\n" {
+		t.Errorf("Expected file to be unchanged, got: %q", content)
+	}
+}
+
+// TestEditTool_EditFile_WhitespaceTolerant verifies matching ignoring whitespace
+func TestEditTool_EditFile_WhitespaceTolerant(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "main.go")
+	os.WriteFile(testFile, []byte("func main() {\n\tif ok {\n\t\trun( x )\n\t}\n}\n"), 0644)
+
+	tool := NewEditFileTool(tmpDir, true)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"path":     testFile,
+		"old_text": "if ok {\n    run(  x )\n}",
+		"new_text": "if ok {\n    run(y)\n}",
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got: %s", result.ForLLM)
+	}
+	content, _ := os.ReadFile(testFile)
+	// The replacement takes the indentation of the file
+	if string(content) != "func main() {\n\tif ok {\n\t    run(y)\n\t}\n}\n" {
+		t.Errorf("Unexpected content: %q", content)
+	}
+}
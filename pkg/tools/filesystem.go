@@ -1,11 +1,18 @@
 package tools
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
 // validatePath ensures the given path is within the workspace if restrict is true.
@@ -77,6 +84,60 @@ func isWithinWorkspace(candidate, workspace string) bool {
 	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
 }
 
+const (
+	maxReadLines = 2000
+	maxReadBytes = 256 << 10
+)
+
+// isBinary reports whether data, the start of a file, looks binary.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+// FileTracker snapshots files before tools change them so the changes can
+// be undone.
+type FileTracker interface {
+	Snapshot(session, path string) error
+}
+
+// fileTracking is embedded by the tools that change files.
+type fileTracking struct {
+	tracker FileTracker
+	mu      sync.RWMutex
+	session string
+}
+
+// SetTracker sets where files are snapshotted before they are changed.
+func (f *fileTracking) SetTracker(tracker FileTracker) {
+	f.tracker = tracker
+}
+
+func (f *fileTracking) SetContext(channel, chatID string) {
+	f.mu.Lock()
+	f.session = ProcessSession(channel, chatID)
+	f.mu.Unlock()
+}
+
+// track snapshots paths before they are changed. A failed snapshot is
+// logged and does not stop the change.
+func (f *fileTracking) track(paths ...string) {
+	if f.tracker == nil {
+		return
+	}
+	f.mu.RLock()
+	session := f.session
+	f.mu.RUnlock()
+	for _, p := range paths {
+		if err := f.tracker.Snapshot(session, p); err != nil {
+			logger.WarnCF("tool", "Failed to checkpoint file",
+				map[string]interface{}{
+					"path":  p,
+					"error": err.Error(),
+				})
+		}
+	}
+}
+
 type ReadFileTool struct {
 	workspace string
 	restrict  bool
@@ -91,7 +152,7 @@ func (t *ReadFileTool) Name() string {
 }
 
 func (t *ReadFileTool) Description() string {
-	return "Read the contents of a file"
+	return "Read the contents of a file. Long files are cut at 2000 lines; use offset and limit to read a range of lines."
 }
 
 func (t *ReadFileTool) Parameters() map[string]interface{} {
@@ -102,6 +163,14 @@ func (t *ReadFileTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Path to the file to read",
 			},
+			"offset": map[string]interface{}{
+				"type":        "integer",
+				"description": "Line number to start reading from, starting at 1",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum number of lines to read, at most 2000",
+			},
 		},
 		"required": []string{"path"},
 	}
@@ -118,15 +187,90 @@ func (t *ReadFileTool) Execute(ctx context.Context, args map[string]interface{})
 		return ErrorResult(err.Error())
 	}
 
-	content, err := os.ReadFile(resolvedPath)
+	f, err := os.Open(resolvedPath)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
 	}
+	defer f.Close()
 
-	return NewToolResult(string(content))
+	r := bufio.NewReader(f)
+	if head, _ := r.Peek(8000); isBinary(head) {
+		size := int64(0)
+		if info, err := f.Stat(); err == nil {
+			size = info.Size()
+		}
+		return ErrorResult(fmt.Sprintf("%s is a binary file (%d bytes); inspect it with exec and a tool such as file or xxd", path, size))
+	}
+
+	offset := max(intArg(args, "offset", 1, math.MaxInt32), 1)
+	limit := intArg(args, "limit", 0, maxReadLines)
+	ranged := offset > 1 || limit > 0
+	if limit == 0 {
+		limit = maxReadLines
+	}
+
+	// Lines are streamed so large logs are never held in memory whole
+	var sb strings.Builder
+	total, shown := 0, 0
+	for {
+		line, err := readLine(r, maxReadBytes+1)
+		if line != "" {
+			total++
+			if total >= offset && shown < limit {
+				if sb.Len()+len(line) > maxReadBytes {
+					if shown == 0 {
+						sb.WriteString(line[:maxReadBytes] + "...\n")
+						shown++
+					}
+					limit = shown
+				} else {
+					sb.WriteString(line)
+					shown++
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
+		}
+	}
+
+	if offset > 1 && offset > total {
+		return ErrorResult(fmt.Sprintf("offset %d is past the end of the file (%d lines)", offset, total))
+	}
+	if shown == 0 {
+		return NewToolResult("")
+	}
+	last := offset + shown - 1
+	if last < total {
+		return NewToolResult(fmt.Sprintf("%s\n[Showing lines %d-%d of %d. Use offset=%d to read more.]", strings.TrimSuffix(sb.String(), "\n"), offset, last, total, last+1))
+	}
+	if ranged {
+		return NewToolResult(fmt.Sprintf("%s\n[Lines %d-%d of %d]", strings.TrimSuffix(sb.String(), "\n"), offset, last, total))
+	}
+	return NewToolResult(sb.String())
+}
+
+// readLine returns the next line of r, keeping at most max bytes of it.
+// The rest of a longer line is skipped, so a file without newlines is
+// never held in memory whole.
+func readLine(r *bufio.Reader, max int) (string, error) {
+	var sb strings.Builder
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if room := max - sb.Len(); room > 0 {
+			sb.Write(chunk[:min(len(chunk), room)])
+		}
+		if err != bufio.ErrBufferFull {
+			return sb.String(), err
+		}
+	}
 }
 
 type WriteFileTool struct {
+	fileTracking
 	workspace string
 	restrict  bool
 }
@@ -176,6 +320,8 @@ func (t *WriteFileTool) Execute(ctx context.Context, args map[string]interface{}
 		return ErrorResult(err.Error())
 	}
 
+	t.track(resolvedPath)
+
 	dir := filepath.Dir(resolvedPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return ErrorResult(fmt.Sprintf("failed to create directory: %v", err))
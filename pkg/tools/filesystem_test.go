@@ -1,7 +1,9 @@
 package tools
 
 import (
+	"bufio"
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -279,3 +281,86 @@ func TestFilesystemTool_ReadFile_RejectsSymlinkEscape(t *testing.T) {
 		t.Fatalf("expected symlink escape error, got: %s", result.ForLLM)
 	}
 }
+
+// TestFilesystemTool_ReadFile_Range verifies offset/limit line ranges
+func TestFilesystemTool_ReadFile_Range(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "log.txt")
+	var sb strings.Builder
+	for i := 1; i <= 10; i++ {
+		sb.WriteString(fmt.Sprintf("line %d\n", i))
+	}
+	os.WriteFile(testFile, []byte(sb.String()), 0644)
+
+	tool := NewReadFileTool(tmpDir, true)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"path":   testFile,
+		"offset": float64(3),
+		"limit":  float64(2),
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got: %s", result.ForLLM)
+	}
+	want := "line 3\nline 4\n[Showing lines 3-4 of 10. Use offset=5 to read more.]"
+	if result.ForLLM != want {
+		t.Errorf("Expected %q, got %q", want, result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": testFile, "offset": float64(9)})
+	if result.ForLLM != "line 9\nline 10\n[Lines 9-10 of 10]" {
+		t.Errorf("Unexpected tail read: %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"path": testFile, "offset": float64(11)})
+	if !result.IsError || !strings.Contains(result.ForLLM, "past the end") {
+		t.Errorf("Expected error for offset past the end, got: %s", result.ForLLM)
+	}
+}
+
+// TestFilesystemTool_ReadFile_Truncates verifies long files are cut off
+func TestFilesystemTool_ReadFile_Truncates(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "big.txt")
+	os.WriteFile(testFile, []byte(strings.Repeat("x\n", maxReadLines+5)), 0644)
+
+	result := NewReadFileTool(tmpDir, true).Execute(context.Background(), map[string]interface{}{"path": testFile})
+	if strings.Count(result.ForLLM, "x\n") != maxReadLines {
+		t.Errorf("Expected %d lines", maxReadLines)
+	}
+	if !strings.Contains(result.ForLLM, fmt.Sprintf("of %d. Use offset=%d", maxReadLines+5, maxReadLines+1)) {
+		t.Errorf("Expected truncation note, got tail: %q", result.ForLLM[len(result.ForLLM)-80:])
+	}
+}
+
+// TestFilesystemTool_ReadFile_LongLine verifies a line longer than the
+// output limit is cut and the lines after it are still counted
+func TestFilesystemTool_ReadFile_LongLine(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "minified.js")
+	os.WriteFile(testFile, []byte(strings.Repeat("y", 3*maxReadBytes)+"\nnext\n"), 0644)
+
+	result := NewReadFileTool(tmpDir, true).Execute(context.Background(), map[string]interface{}{"path": testFile})
+	if result.IsError || !strings.HasPrefix(result.ForLLM, strings.Repeat("y", maxReadBytes)+"...") {
+		t.Fatalf("Expected the line cut at %d bytes, got %d bytes", maxReadBytes, len(result.ForLLM))
+	}
+	if !strings.Contains(result.ForLLM, "of 2. Use offset=2") {
+		t.Errorf("Expected the second line to be counted, got tail: %q", result.ForLLM[len(result.ForLLM)-80:])
+	}
+
+	line, err := readLine(bufio.NewReader(strings.NewReader("abcdef\nz")), 3)
+	if line != "abc" || err != nil {
+		t.Errorf("readLine() = %q, %v", line, err)
+	}
+}
+
+// TestFilesystemTool_ReadFile_Binary verifies binary files are not returned
+func TestFilesystemTool_ReadFile_Binary(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "image.png")
+	os.WriteFile(testFile, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0644)
+
+	result := NewReadFileTool(tmpDir, true).Execute(context.Background(), map[string]interface{}{"path": testFile})
+	if !result.IsError || !strings.Contains(result.ForLLM, "binary file") {
+		t.Errorf("Expected binary file error, got: %s", result.ForLLM)
+	}
+}
@@ -0,0 +1,646 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// filePatch is the change a patch makes to one file.
+type filePatch struct {
+	op     byte // 'A' add, 'D' delete or 'M' modify
+	path   string
+	moveTo string
+	hunks  []*patchHunk
+}
+
+// patchHunk replaces old with new lines. oldStart is the 1-based line of
+// old in the original file, or -1 when the patch does not say.
+type patchHunk struct {
+	header   string
+	anchor   string
+	oldStart int
+	atEOF    bool
+	old      []string
+	new      []string
+	// trailingBlank counts blank lines at the end that had no prefix and
+	// are dropped as they are usually just patch padding
+	trailingBlank int
+	// oldLeft and newLeft count the lines the @@ header of a unified diff
+	// still promises
+	oldLeft, newLeft int
+}
+
+func (h *patchHunk) add(prefix byte, text string) {
+	switch prefix {
+	case ' ':
+		h.old = append(h.old, text)
+		h.new = append(h.new, text)
+		h.oldLeft--
+		h.newLeft--
+	case '-':
+		h.old = append(h.old, text)
+		h.oldLeft--
+	case '+':
+		h.new = append(h.new, text)
+		h.newLeft--
+	}
+}
+
+// counting reports whether the hunk header promises more lines.
+func (h *patchHunk) counting() bool {
+	return h.oldLeft > 0 || h.newLeft > 0
+}
+
+func (h *patchHunk) addLine(line string) bool {
+	if line == "" {
+		h.add(' ', "")
+		h.trailingBlank++
+		return true
+	}
+	switch line[0] {
+	case ' ', '-', '+':
+		h.add(line[0], line[1:])
+		h.trailingBlank = 0
+		return true
+	case '\\':
+		// "\ No newline at end of file"
+		return true
+	}
+	return false
+}
+
+func (h *patchHunk) close() {
+	for ; h.trailingBlank > 0; h.trailingBlank-- {
+		h.old = h.old[:len(h.old)-1]
+		h.new = h.new[:len(h.new)-1]
+	}
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+
+// hunkCount parses a line count of a hunk header, which is 1 when omitted.
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// parsePatch parses a unified diff or a patch envelope between
+// "*** Begin Patch" and "*** End Patch" lines.
+func parsePatch(text string) ([]*filePatch, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	// Drop a surrounding markdown code fence
+	if len(lines) > 1 && strings.HasPrefix(lines[0], "```") && strings.HasPrefix(lines[len(lines)-1], "```") {
+		lines = lines[1 : len(lines)-1]
+	}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "*** Begin Patch" {
+			return parseEnvelope(lines)
+		}
+	}
+	return parseUnifiedDiff(lines)
+}
+
+func parseUnifiedDiff(lines []string) ([]*filePatch, error) {
+	var files []*filePatch
+	var cur *filePatch
+	var hunk *patchHunk
+	closeHunk := func() {
+		if hunk != nil {
+			hunk.close()
+			hunk = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		// Lines the header counts belong to the hunk, even removed or added
+		// lines that look like "--- x" and "+++ y" file headers
+		if hunk != nil && hunk.counting() && hunk.addLine(line) {
+			// A counted blank line is context, not padding
+			hunk.trailingBlank = 0
+			continue
+		}
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			closeHunk()
+			oldPath, newPath := diffPath(line[4:]), diffPath(lines[i+1][4:])
+			i++
+			switch {
+			case oldPath == "/dev/null" && newPath == "/dev/null":
+				return nil, fmt.Errorf("line %d: both sides of the diff are /dev/null", i)
+			case oldPath == "/dev/null":
+				cur = &filePatch{op: 'A', path: newPath}
+			case newPath == "/dev/null":
+				cur = &filePatch{op: 'D', path: oldPath}
+			default:
+				cur = &filePatch{op: 'M', path: oldPath}
+				if newPath != oldPath {
+					cur.moveTo = newPath
+				}
+			}
+			files = append(files, cur)
+			continue
+		}
+		if m := hunkHeader.FindStringSubmatch(line); m != nil {
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: hunk before any --- / +++ file header", i+1)
+			}
+			closeHunk()
+			start, _ := strconv.Atoi(m[1])
+			hunk = &patchHunk{header: m[0], oldStart: start, oldLeft: hunkCount(m[2]), newLeft: hunkCount(m[3])}
+			cur.hunks = append(cur.hunks, hunk)
+			continue
+		}
+		if hunk != nil && hunk.addLine(line) {
+			continue
+		}
+		// Anything else, such as "diff --git" or "index" lines, ends a hunk
+		closeHunk()
+	}
+	closeHunk()
+
+	if len(files) == 0 {
+		return nil, errors.New("no file headers found; expected a unified diff with --- and +++ lines or a *** Begin Patch envelope")
+	}
+	for _, f := range files {
+		if f.op == 'M' && len(f.hunks) == 0 && f.moveTo == "" {
+			return nil, fmt.Errorf("%s: no hunks", f.path)
+		}
+	}
+	return files, nil
+}
+
+// diffPath strips the timestamp and the a/ or b/ prefix from a path in a
+// --- or +++ line.
+func diffPath(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s
+}
+
+func parseEnvelope(lines []string) ([]*filePatch, error) {
+	var files []*filePatch
+	var cur *filePatch
+	var hunk *patchHunk
+	closeHunk := func() {
+		if hunk != nil {
+			hunk.close()
+			hunk = nil
+		}
+	}
+	newFile := func(op byte, path string) {
+		closeHunk()
+		cur = &filePatch{op: op, path: strings.TrimSpace(path)}
+		files = append(files, cur)
+	}
+
+	started := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !started {
+			started = trimmed == "*** Begin Patch"
+			continue
+		}
+		switch {
+		case trimmed == "*** End Patch":
+			closeHunk()
+			if len(files) == 0 {
+				return nil, errors.New("patch contains no files")
+			}
+			return files, nil
+		case strings.HasPrefix(line, "*** Add File: "):
+			newFile('A', line[len("*** Add File: "):])
+		case strings.HasPrefix(line, "*** Delete File: "):
+			newFile('D', line[len("*** Delete File: "):])
+		case strings.HasPrefix(line, "*** Update File: "):
+			newFile('M', line[len("*** Update File: "):])
+		case strings.HasPrefix(line, "*** Move to: "):
+			if cur == nil || cur.op != 'M' {
+				return nil, fmt.Errorf("line %d: *** Move to must follow *** Update File", i+1)
+			}
+			cur.moveTo = strings.TrimSpace(line[len("*** Move to: "):])
+		case trimmed == "*** End of File":
+			if hunk != nil {
+				hunk.atEOF = true
+			}
+		case cur == nil:
+			return nil, fmt.Errorf("line %d: expected *** Add File, *** Update File or *** Delete File, got %q", i+1, line)
+		case cur.op == 'A':
+			if !strings.HasPrefix(line, "+") {
+				return nil, fmt.Errorf("line %d: lines of an added file must start with +, got %q", i+1, line)
+			}
+			if hunk == nil {
+				hunk = &patchHunk{oldStart: -1}
+				cur.hunks = append(cur.hunks, hunk)
+			}
+			hunk.add('+', line[1:])
+		case cur.op == 'D':
+			return nil, fmt.Errorf("line %d: unexpected content after *** Delete File", i+1)
+		case strings.HasPrefix(line, "@@"):
+			closeHunk()
+			hunk = &patchHunk{header: trimmed, anchor: strings.TrimSpace(line[2:]), oldStart: -1}
+			cur.hunks = append(cur.hunks, hunk)
+		default:
+			if hunk == nil {
+				hunk = &patchHunk{oldStart: -1}
+				cur.hunks = append(cur.hunks, hunk)
+			}
+			if !hunk.addLine(line) {
+				return nil, fmt.Errorf("line %d: hunk lines must start with a space, - or +, got %q", i+1, line)
+			}
+		}
+	}
+	return nil, errors.New("missing *** End Patch")
+}
+
+// fileLines holds a file split into lines, remembering line endings.
+type fileLines struct {
+	lines []string
+	eol   bool
+	crlf  bool
+}
+
+func splitFile(content string) fileLines {
+	if content == "" {
+		return fileLines{eol: true}
+	}
+	f := fileLines{eol: strings.HasSuffix(content, "\n"), crlf: strings.Contains(content, "\r\n")}
+	f.lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if f.crlf {
+		for i, l := range f.lines {
+			f.lines[i] = strings.TrimSuffix(l, "\r")
+		}
+	}
+	return f
+}
+
+func (f fileLines) String() string {
+	if len(f.lines) == 0 {
+		return ""
+	}
+	sep := "\n"
+	if f.crlf {
+		sep = "\r\n"
+	}
+	s := strings.Join(f.lines, sep)
+	if f.eol {
+		s += sep
+	}
+	return s
+}
+
+// applyHunks applies hunks to content in order. A hunk is located by exact
+// match first and then ignoring whitespace, preferring the match nearest
+// the line number it names.
+func applyHunks(name, content string, hunks []*patchHunk) (string, error) {
+	f := splitFile(content)
+	pos, delta := 0, 0
+	for i, h := range hunks {
+		start := pos
+		if h.anchor != "" {
+			found := -1
+			for j := pos; j < len(f.lines); j++ {
+				if normalizeSpace(f.lines[j]) == normalizeSpace(h.anchor) {
+					found = j
+					break
+				}
+			}
+			if found < 0 {
+				return "", fmt.Errorf("hunk %d of %d in %s does not apply: context line %q not found", i+1, len(hunks), name, h.anchor)
+			}
+			start = found + 1
+		}
+
+		hint := -1
+		switch {
+		case h.atEOF:
+			hint = len(f.lines) - len(h.old)
+		case h.oldStart >= 0:
+			hint = max(h.oldStart-1, 0) + delta
+			if len(h.old) == 0 {
+				hint = h.oldStart + delta
+			}
+		}
+
+		var at int
+		if len(h.old) == 0 {
+			// A pure insertion goes at its line, after the anchor, or at the end
+			switch {
+			case hint >= 0:
+				at = min(max(hint, start), len(f.lines))
+			case h.anchor != "":
+				at = start
+			default:
+				at = len(f.lines)
+			}
+		} else {
+			at = locateHunk(f.lines, h.old, start, hint)
+			if at < 0 {
+				return "", hunkError(name, i, len(hunks), h, f.lines, start, hint)
+			}
+		}
+
+		out := make([]string, 0, len(f.lines)-len(h.old)+len(h.new))
+		out = append(out, f.lines[:at]...)
+		out = append(out, h.new...)
+		out = append(out, f.lines[at+len(h.old):]...)
+		f.lines = out
+		pos = at + len(h.new)
+		delta += len(h.new) - len(h.old)
+	}
+	return f.String(), nil
+}
+
+func locateHunk(lines, old []string, start, hint int) int {
+	if start > len(lines) {
+		return -1
+	}
+	for _, loose := range []bool{false, true} {
+		matches := findLines(lines[start:], old, loose)
+		if len(matches) == 0 {
+			continue
+		}
+		best := start + matches[0]
+		if hint >= 0 {
+			for _, m := range matches {
+				if abs(start+m-hint) < abs(best-hint) {
+					best = start + m
+				}
+			}
+		}
+		return best
+	}
+	return -1
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// hunkError describes a hunk that did not apply, with the lines it
+// expected and the file around where it should have been.
+func hunkError(name string, i, n int, h *patchHunk, lines []string, start, hint int) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "hunk %d of %d in %s", i+1, n, name)
+	if h.header != "" {
+		fmt.Fprintf(&sb, " (%s)", h.header)
+	}
+	sb.WriteString(" does not apply: these lines were not found")
+	if start > 0 {
+		fmt.Fprintf(&sb, " after line %d", start)
+	}
+	sb.WriteString(":\n")
+	for _, l := range h.old {
+		sb.WriteString("  " + l + "\n")
+	}
+
+	// Show the file where the hunk was expected, or where its first line is
+	around := hint
+	if around < 0 {
+		first := normalizeSpace(h.old[0])
+		for j := start; j < len(lines); j++ {
+			if normalizeSpace(lines[j]) == first {
+				around = j
+				break
+			}
+		}
+	}
+	if around >= 0 && around < len(lines) {
+		from, to := max(around-2, 0), min(around+len(h.old)+2, len(lines))
+		fmt.Fprintf(&sb, "File lines %d-%d:\n", from+1, to)
+		for j := from; j < to; j++ {
+			fmt.Fprintf(&sb, "%5d  %s\n", j+1, lines[j])
+		}
+	}
+	sb.WriteString("Read the file again and regenerate the patch. No files were changed.")
+	return errors.New(sb.String())
+}
+
+// fileChange is the planned final state of one file.
+type fileChange struct {
+	path     string
+	resolved string
+	content  string
+	remove   bool
+	mode     fs.FileMode
+	original []byte // nil when the file did not exist
+	tmp      string
+}
+
+// commitChanges writes all changes or none. New contents go to temporary
+// files first; if a rename or removal then fails, the files already
+// changed are restored.
+func commitChanges(changes []*fileChange) error {
+	cleanup := func() {
+		for _, c := range changes {
+			if c.tmp != "" {
+				os.Remove(c.tmp)
+			}
+		}
+	}
+	for _, c := range changes {
+		if c.remove {
+			continue
+		}
+		dir := filepath.Dir(c.resolved)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			cleanup()
+			return fmt.Errorf("failed to create directory for %s: %w", c.path, err)
+		}
+		tmp, err := os.CreateTemp(dir, ".patch-*")
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to write %s: %w", c.path, err)
+		}
+		c.tmp = tmp.Name()
+		_, err = tmp.WriteString(c.content)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Chmod(c.tmp, c.mode)
+		}
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to write %s: %w", c.path, err)
+		}
+	}
+
+	for i, c := range changes {
+		var err error
+		if c.remove {
+			err = os.Remove(c.resolved)
+		} else {
+			err = os.Rename(c.tmp, c.resolved)
+			c.tmp = ""
+		}
+		if err == nil {
+			continue
+		}
+		for _, done := range changes[:i] {
+			if done.original == nil {
+				os.Remove(done.resolved)
+			} else {
+				os.WriteFile(done.resolved, done.original, done.mode)
+			}
+		}
+		cleanup()
+		return fmt.Errorf("failed to update %s: %w; earlier changes were rolled back", c.path, err)
+	}
+	return nil
+}
+
+// ApplyPatchTool applies unified diffs and patch envelopes to files in
+// the workspace. All files change together or not at all.
+type ApplyPatchTool struct {
+	fileTracking
+	workspace string
+	restrict  bool
+}
+
+func NewApplyPatchTool(workspace string, restrict bool) *ApplyPatchTool {
+	return &ApplyPatchTool{workspace: workspace, restrict: restrict}
+}
+
+func (t *ApplyPatchTool) Name() string {
+	return "apply_patch"
+}
+
+func (t *ApplyPatchTool) Description() string {
+	return "Apply a patch to one or more files: a unified diff (--- a/file, +++ b/file, @@ hunks) or an envelope of *** Begin Patch, *** Add File: / *** Update File: / *** Delete File: / *** Move to: sections and *** End Patch. Either every file is changed or none; failed hunks are reported with the lines around them."
+}
+
+func (t *ApplyPatchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"patch": map[string]interface{}{
+				"type":        "string",
+				"description": "The patch text",
+			},
+		},
+		"required": []string{"patch"},
+	}
+}
+
+func (t *ApplyPatchTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	text, _ := args["patch"].(string)
+	if strings.TrimSpace(text) == "" {
+		return ErrorResult("patch is required")
+	}
+	files, err := parsePatch(text)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("invalid patch: %v", err))
+	}
+
+	// Plan every change in memory first; later sections see the result of
+	// earlier ones on the same file
+	planned := map[string]*fileChange{}
+	var changes []*fileChange
+	current := func(path string) (*fileChange, error) {
+		resolved, err := validatePath(path, t.workspace, t.restrict)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if c, ok := planned[resolved]; ok {
+			return c, nil
+		}
+		c := &fileChange{path: path, resolved: resolved, mode: 0644, remove: true}
+		if info, err := os.Stat(resolved); err == nil {
+			if info.IsDir() {
+				return nil, fmt.Errorf("%s is a directory", path)
+			}
+			data, err := os.ReadFile(resolved)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			c.original, c.content, c.mode, c.remove = data, string(data), info.Mode().Perm(), false
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		planned[resolved] = c
+		changes = append(changes, c)
+		return c, nil
+	}
+
+	var summary []string
+	for _, f := range files {
+		c, err := current(f.path)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		switch f.op {
+		case 'A':
+			if !c.remove {
+				return ErrorResult(fmt.Sprintf("cannot add %s: file already exists", f.path))
+			}
+			var lines []string
+			for _, h := range f.hunks {
+				lines = append(lines, h.new...)
+			}
+			c.content, c.remove = fileLines{lines: lines, eol: true}.String(), false
+			summary = append(summary, "A "+f.path)
+		case 'D':
+			if c.remove {
+				return ErrorResult(fmt.Sprintf("cannot delete %s: file not found", f.path))
+			}
+			c.remove = true
+			summary = append(summary, "D "+f.path)
+		case 'M':
+			if c.remove {
+				return ErrorResult(fmt.Sprintf("cannot update %s: file not found", f.path))
+			}
+			content, err := applyHunks(f.path, c.content, f.hunks)
+			if err != nil {
+				return ErrorResult(err.Error())
+			}
+			c.content = content
+			if f.moveTo == "" {
+				summary = append(summary, fmt.Sprintf("M %s (%d hunks)", f.path, len(f.hunks)))
+				continue
+			}
+			dst, err := current(f.moveTo)
+			if err != nil {
+				return ErrorResult(err.Error())
+			}
+			if !dst.remove {
+				return ErrorResult(fmt.Sprintf("cannot move %s to %s: file already exists", f.path, f.moveTo))
+			}
+			dst.content, dst.mode, dst.remove = c.content, c.mode, false
+			c.remove = true
+			summary = append(summary, fmt.Sprintf("R %s -> %s (%d hunks)", f.path, f.moveTo, len(f.hunks)))
+		}
+	}
+
+	// Files that were planned but end up as they started are left alone
+	var pending []*fileChange
+	for _, c := range changes {
+		if (c.original == nil) == c.remove && (c.remove || c.content == string(c.original)) {
+			continue
+		}
+		pending = append(pending, c)
+		t.track(c.resolved)
+	}
+	if err := commitChanges(pending); err != nil {
+		return ErrorResult(err.Error())
+	}
+	return SilentResult("Patch applied:\n" + strings.Join(summary, "\n"))
+}
@@ -0,0 +1,215 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readTree(t *testing.T, root, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestApplyPatch_UnifiedDiff(t *testing.T) {
+	ws := t.TempDir()
+	writeTree(t, ws, map[string]string{
+		"main.go": "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n\nfunc helper() int {\n\treturn 1\n}\n",
+		"old.txt": "remove me\n",
+	})
+
+	patch := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -5,3 +5,4 @@ import "fmt"
+ func main() {
+ 	fmt.Println("hello")
++	fmt.Println("world")
+ }
+@@ -9,3 +10,3 @@ func main() {
+ func helper() int {
+-	return 1
++	return 2
+ }
+--- /dev/null
++++ b/docs/new.md
+@@ -0,0 +1,2 @@
++# New
++file
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-remove me
+`
+	result := NewApplyPatchTool(ws, true).Execute(context.Background(), map[string]interface{}{"patch": patch})
+	if result.IsError {
+		t.Fatalf("patch failed: %s", result.ForLLM)
+	}
+	want := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n\tfmt.Println(\"world\")\n}\n\nfunc helper() int {\n\treturn 2\n}\n"
+	if got := readTree(t, ws, "main.go"); got != want {
+		t.Errorf("main.go:\n%s", got)
+	}
+	if got := readTree(t, ws, "docs/new.md"); got != "# New\nfile\n" {
+		t.Errorf("docs/new.md: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "old.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected old.txt to be deleted")
+	}
+	for _, line := range []string{"M main.go (2 hunks)", "A docs/new.md", "D old.txt"} {
+		if !strings.Contains(result.ForLLM, line) {
+			t.Errorf("expected %q in summary, got %q", line, result.ForLLM)
+		}
+	}
+}
+
+func TestApplyPatch_HeaderLikeLinesInHunk(t *testing.T) {
+	ws := t.TempDir()
+	writeTree(t, ws, map[string]string{
+		"schema.sql": "-- users\nCREATE TABLE users (id int);\n-- x\nSELECT 1;\n",
+	})
+
+	// Removing "-- x" and adding "++ y" gives lines that read like file headers
+	patch := `--- a/schema.sql
++++ b/schema.sql
+@@ -2,3 +2,3 @@
+ CREATE TABLE users (id int);
+--- x
++++ y
+ SELECT 1;
+`
+	result := NewApplyPatchTool(ws, true).Execute(context.Background(), map[string]interface{}{"patch": patch})
+	if result.IsError {
+		t.Fatalf("patch failed: %s", result.ForLLM)
+	}
+	if got := readTree(t, ws, "schema.sql"); got != "-- users\nCREATE TABLE users (id int);\n++ y\nSELECT 1;\n" {
+		t.Errorf("schema.sql: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "x")); !os.IsNotExist(err) {
+		t.Error("a hunk line was read as a file header")
+	}
+}
+
+func TestApplyPatch_Envelope(t *testing.T) {
+	ws := t.TempDir()
+	writeTree(t, ws, map[string]string{
+		"app.py": "class A:\n    def run(self):\n        return 1\n\nclass B:\n    def run(self):\n        return 1\n",
+		"a.txt":  "moved\n",
+	})
+
+	patch := `*** Begin Patch
+*** Update File: app.py
+@@ class B:
+     def run(self):
+-        return 1
++        return 2
+*** Update File: a.txt
+*** Move to: sub/b.txt
+@@
+-moved
++moved and changed
+*** Add File: notes.txt
++first
++second
+*** End Patch`
+	result := NewApplyPatchTool(ws, true).Execute(context.Background(), map[string]interface{}{"patch": patch})
+	if result.IsError {
+		t.Fatalf("patch failed: %s", result.ForLLM)
+	}
+	// The anchor picks the second of two identical blocks
+	if got := readTree(t, ws, "app.py"); got != "class A:\n    def run(self):\n        return 1\n\nclass B:\n    def run(self):\n        return 2\n" {
+		t.Errorf("app.py:\n%s", got)
+	}
+	if got := readTree(t, ws, "sub/b.txt"); got != "moved and changed\n" {
+		t.Errorf("sub/b.txt: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(ws, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected a.txt to be moved away")
+	}
+	if got := readTree(t, ws, "notes.txt"); got != "first\nsecond\n" {
+		t.Errorf("notes.txt: %q", got)
+	}
+}
+
+func TestApplyPatch_WhitespaceAndOffset(t *testing.T) {
+	ws := t.TempDir()
+	writeTree(t, ws, map[string]string{
+		"f.txt": "header\r\nextra\r\n  value = 1\r\nfooter\r\n",
+	})
+
+	// Wrong line number, indentation and line endings still apply
+	patch := "--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +1,2 @@\n-value = 1\n+  value = 2\n footer\n"
+	result := NewApplyPatchTool(ws, true).Execute(context.Background(), map[string]interface{}{"patch": patch})
+	if result.IsError {
+		t.Fatalf("patch failed: %s", result.ForLLM)
+	}
+	if got := readTree(t, ws, "f.txt"); got != "header\r\nextra\r\n  value = 2\r\nfooter\r\n" {
+		t.Errorf("f.txt: %q", got)
+	}
+}
+
+func TestApplyPatch_FailureIsAtomic(t *testing.T) {
+	ws := t.TempDir()
+	writeTree(t, ws, map[string]string{
+		"a.txt": "one\ntwo\nthree\n",
+		"b.txt": "alpha\nbeta\n",
+	})
+
+	patch := `--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+ one
+-two
++TWO
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,2 @@
+ alpha
+-gamma
++delta
+`
+	result := NewApplyPatchTool(ws, true).Execute(context.Background(), map[string]interface{}{"patch": patch})
+	if !result.IsError {
+		t.Fatalf("expected the patch to fail")
+	}
+	for _, want := range []string{"hunk 1 of 1 in b.txt", "@@ -1,2 +1,2 @@", "  gamma", "1  alpha", "No files were changed"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("expected %q in error, got:\n%s", want, result.ForLLM)
+		}
+	}
+	if got := readTree(t, ws, "a.txt"); got != "one\ntwo\nthree\n" {
+		t.Errorf("a.txt was changed: %q", got)
+	}
+}
+
+func TestApplyPatch_Errors(t *testing.T) {
+	ws := t.TempDir()
+	writeTree(t, ws, map[string]string{"exists.txt": "x\n"})
+	tool := NewApplyPatchTool(ws, true)
+
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{"empty", "", "patch is required"},
+		{"no headers", "just some text\n", "no file headers"},
+		{"add existing", "*** Begin Patch\n*** Add File: exists.txt\n+y\n*** End Patch\n", "already exists"},
+		{"update missing", "--- a/missing.txt\n+++ b/missing.txt\n@@ -1 +1 @@\n-a\n+b\n", "file not found"},
+		{"outside", "--- /dev/null\n+++ b/../escape.txt\n@@ -0,0 +1 @@\n+x\n", "outside the workspace"},
+		{"unterminated", "*** Begin Patch\n*** Add File: new.txt\n+x\n", "missing *** End Patch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tool.Execute(context.Background(), map[string]interface{}{"patch": tt.patch})
+			if !result.IsError || !strings.Contains(result.ForLLM, tt.want) {
+				t.Errorf("expected error containing %q, got %q", tt.want, result.ForLLM)
+			}
+		})
+	}
+}
@@ -0,0 +1,613 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ProcessSession identifies the chat that owns background processes.
+func ProcessSession(channel, chatID string) string {
+	return channel + ":" + chatID
+}
+
+// ProcessInfo describes a background process for listings.
+type ProcessInfo struct {
+	ID       string
+	Command  string
+	PID      int
+	Started  time.Time
+	Running  bool
+	ExitCode int
+	Terminal bool
+}
+
+// Status is "running" or the exit code.
+func (p ProcessInfo) Status() string {
+	if p.Running {
+		return "running"
+	}
+	return fmt.Sprintf("exited (%d)", p.ExitCode)
+}
+
+// ProcessManager tracks the background processes of each chat session.
+// Processes of a session that has been idle for the session timeout are
+// killed by Reap.
+type ProcessManager struct {
+	mu            sync.Mutex
+	nextID        int
+	procs         map[string]*backgroundProcess
+	lastSeen      map[string]time.Time
+	maxPerSession int
+	bufferSize    int
+	idleTimeout   time.Duration
+}
+
+type backgroundProcess struct {
+	id      string
+	session string
+	command string
+	started time.Time
+	cmd     *exec.Cmd
+	cancel  context.CancelFunc
+	stdin   io.WriteCloser
+	stdout  *outputBuffer
+	stderr  *outputBuffer
+	screen  terminalScreen // Set instead of stdout and stderr for terminals
+	done    chan struct{}
+
+	// Set before done is closed
+	exitCode int
+}
+
+func (p *backgroundProcess) running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *backgroundProcess) info() ProcessInfo {
+	info := ProcessInfo{ID: p.id, Command: p.command, Started: p.started, Running: p.running(), Terminal: p.screen != nil}
+	if p.cmd.Process != nil {
+		info.PID = p.cmd.Process.Pid
+	}
+	if !info.Running {
+		info.ExitCode = p.exitCode
+	}
+	return info
+}
+
+// NewProcessManager creates a manager with the limits in cfg; nil uses
+// the defaults.
+func NewProcessManager(cfg *config.ProcessConfig) *ProcessManager {
+	defaults := config.DefaultConfig().Tools.Process
+	if cfg == nil {
+		cfg = &defaults
+	}
+	m := &ProcessManager{
+		procs:         make(map[string]*backgroundProcess),
+		lastSeen:      make(map[string]time.Time),
+		maxPerSession: cfg.MaxPerSession,
+		bufferSize:    cfg.BufferKB * 1024,
+		idleTimeout:   time.Duration(cfg.SessionTimeoutMinutes) * time.Minute,
+	}
+	if m.maxPerSession <= 0 {
+		m.maxPerSession = defaults.MaxPerSession
+	}
+	if m.bufferSize <= 0 {
+		m.bufferSize = defaults.BufferKB * 1024
+	}
+	return m
+}
+
+// Touch records activity in session, postponing the cleanup of its
+// processes.
+func (m *ProcessManager) Touch(session string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastSeen[session] = time.Now()
+}
+
+// Start runs cmd in the background for session. cmd must not have been
+// started and must have been created with ctx, which cancel cancels.
+func (m *ProcessManager) Start(session, command string, cmd *exec.Cmd, cancel context.CancelFunc) (ProcessInfo, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return ProcessInfo{}, err
+	}
+	p := &backgroundProcess{
+		session: session,
+		command: command,
+		cmd:     cmd,
+		cancel:  cancel,
+		stdin:   stdin,
+		stdout:  newOutputBuffer(m.bufferSize),
+		stderr:  newOutputBuffer(m.bufferSize),
+		done:    make(chan struct{}),
+	}
+	cmd.Stdout = p.stdout
+	cmd.Stderr = p.stderr
+	// Grandchildren that keep the pipes open must not block Wait
+	cmd.WaitDelay = time.Second
+	setProcessGroup(cmd)
+	if err := m.launch(p, "p", cmd.Start); err != nil {
+		stdin.Close()
+		return ProcessInfo{}, err
+	}
+
+	go func() {
+		p.finish(cmd.Wait())
+	}()
+	return p.info(), nil
+}
+
+// launch calls start and tracks p under a new ID with prefix, unless its
+// session already runs the maximum number of processes.
+func (m *ProcessManager) launch(p *backgroundProcess, prefix string, start func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	running := 0
+	for _, other := range m.procs {
+		if other.session == p.session && other.running() {
+			running++
+		}
+	}
+	if running >= m.maxPerSession {
+		return fmt.Errorf("this session already has %d running processes; kill one first", running)
+	}
+	if err := start(); err != nil {
+		return err
+	}
+
+	m.nextID++
+	p.id = fmt.Sprintf("%s%d", prefix, m.nextID)
+	p.started = time.Now()
+	m.procs[p.id] = p
+	m.lastSeen[p.session] = p.started
+	m.pruneExited(p.session)
+	return nil
+}
+
+// finish records the result of Wait.
+func (p *backgroundProcess) finish(err error) {
+	p.exitCode = 0
+	if err != nil {
+		p.exitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			p.exitCode = exitErr.ExitCode()
+		}
+	}
+	p.cancel()
+	close(p.done)
+}
+
+// pruneExited forgets the oldest exited processes of session beyond
+// maxPerSession.
+func (m *ProcessManager) pruneExited(session string) {
+	var exited []*backgroundProcess
+	for _, p := range m.procs {
+		if p.session == session && !p.running() {
+			exited = append(exited, p)
+		}
+	}
+	sort.Slice(exited, func(i, j int) bool { return exited[i].started.Before(exited[j].started) })
+	for len(exited) > m.maxPerSession {
+		delete(m.procs, exited[0].id)
+		exited = exited[1:]
+	}
+}
+
+func (m *ProcessManager) get(session, id string) (*backgroundProcess, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.procs[id]
+	if !ok || p.session != session {
+		return nil, fmt.Errorf("no process %q in this session", id)
+	}
+	return p, nil
+}
+
+// List returns the processes of session, oldest first.
+func (m *ProcessManager) List(session string) []ProcessInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []ProcessInfo
+	for _, p := range m.procs {
+		if p.session == session {
+			list = append(list, p.info())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	return list
+}
+
+// Poll returns the output of process id written since the last poll.
+func (m *ProcessManager) Poll(session, id string) (info ProcessInfo, stdout, stderr string, err error) {
+	p, err := m.get(session, id)
+	if err != nil {
+		return ProcessInfo{}, "", "", err
+	}
+	if p.screen != nil {
+		return ProcessInfo{}, "", "", fmt.Errorf("%s is a terminal; read it with the terminal tool", id)
+	}
+	// Read the status first so output written before the exit is included
+	info = p.info()
+	return info, p.stdout.next(), p.stderr.next(), nil
+}
+
+// Write sends input to the stdin of process id, closing it after with eof.
+func (m *ProcessManager) Write(session, id, input string, eof bool) error {
+	p, err := m.get(session, id)
+	if err != nil {
+		return err
+	}
+	if !p.running() {
+		return fmt.Errorf("process %s has exited", id)
+	}
+	if input != "" {
+		n, err := writeInput(p.stdin, input)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("process %s is not reading its stdin; wrote %d of %d bytes", id, n, len(input))
+		}
+		if err != nil {
+			return fmt.Errorf("write to process %s: %w", id, err)
+		}
+	}
+	if eof {
+		return p.stdin.Close()
+	}
+	return nil
+}
+
+// stdinWriteTimeout bounds a write to a process that stops reading its
+// stdin, which would otherwise block once the pipe buffer is full.
+var stdinWriteTimeout = 5 * time.Second
+
+// writeInput writes input to w, giving up after stdinWriteTimeout with
+// os.ErrDeadlineExceeded and the number of bytes written.
+func writeInput(w io.Writer, input string) (int, error) {
+	if f, ok := w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		if f.SetWriteDeadline(time.Now().Add(stdinWriteTimeout)) == nil {
+			defer f.SetWriteDeadline(time.Time{})
+			return io.WriteString(w, input)
+		}
+	}
+
+	// Without deadlines, as for pipes on Windows, the write is left to
+	// finish or fail when the process exits
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := io.WriteString(w, input)
+		done <- result{n, err}
+	}()
+	select {
+	case r := <-done:
+		return r.n, r.err
+	case <-time.After(stdinWriteTimeout):
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+// Kill stops process id and its children and forgets it.
+func (m *ProcessManager) Kill(session, id string) (ProcessInfo, error) {
+	p, err := m.get(session, id)
+	if err != nil {
+		return ProcessInfo{}, err
+	}
+	m.stop(p)
+	m.mu.Lock()
+	delete(m.procs, id)
+	m.mu.Unlock()
+	return p.info(), nil
+}
+
+func (m *ProcessManager) stop(p *backgroundProcess) {
+	if p.running() {
+		killProcessGroup(p.cmd)
+		p.cancel()
+		select {
+		case <-p.done:
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// Reap kills and forgets the processes of sessions idle for longer than
+// the session timeout.
+func (m *ProcessManager) Reap(now time.Time) {
+	if m.idleTimeout <= 0 {
+		return
+	}
+	m.mu.Lock()
+	var expired []*backgroundProcess
+	for id, p := range m.procs {
+		if now.Sub(m.lastSeen[p.session]) > m.idleTimeout {
+			expired = append(expired, p)
+			delete(m.procs, id)
+		}
+	}
+	for session, seen := range m.lastSeen {
+		if now.Sub(seen) > m.idleTimeout {
+			delete(m.lastSeen, session)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, p := range expired {
+		if p.running() {
+			logger.InfoCF("tool", "Killing background process of expired session",
+				map[string]interface{}{"id": p.id, "session": p.session, "command": p.command})
+		}
+		m.stop(p)
+	}
+}
+
+// RunReaper calls Reap every minute until ctx is done, then kills all
+// processes.
+func (m *ProcessManager) RunReaper(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			m.KillAll()
+			return
+		case now := <-ticker.C:
+			m.Reap(now)
+		}
+	}
+}
+
+// KillAll stops every background process.
+func (m *ProcessManager) KillAll() {
+	m.mu.Lock()
+	procs := make([]*backgroundProcess, 0, len(m.procs))
+	for _, p := range m.procs {
+		procs = append(procs, p)
+	}
+	m.procs = make(map[string]*backgroundProcess)
+	m.mu.Unlock()
+
+	for _, p := range procs {
+		m.stop(p)
+	}
+}
+
+// outputBuffer keeps the last size bytes written to it and remembers how
+// far they have been read.
+type outputBuffer struct {
+	mu      sync.Mutex
+	buf     []byte
+	written int64
+	read    int64
+}
+
+func newOutputBuffer(size int) *outputBuffer {
+	return &outputBuffer{buf: make([]byte, size)}
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(p)
+	size := int64(len(b.buf))
+	if int64(n) > size {
+		b.written += int64(n) - size
+		p = p[int64(n)-size:]
+	}
+	for len(p) > 0 {
+		start := b.written % size
+		c := copy(b.buf[start:], p)
+		b.written += int64(c)
+		p = p[c:]
+	}
+	return n, nil
+}
+
+// next returns the output written since the previous call, noting output
+// that was dropped from the buffer in between.
+func (b *outputBuffer) next() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	size := int64(len(b.buf))
+	from := b.read
+	var sb strings.Builder
+	if oldest := b.written - size; from < oldest {
+		fmt.Fprintf(&sb, "... (%d bytes dropped)\n", oldest-from)
+		from = oldest
+	}
+	for from < b.written {
+		start := from % size
+		end := size
+		if rest := b.written - from; rest < end-start {
+			end = start + rest
+		}
+		sb.Write(b.buf[start:end])
+		from += end - start
+	}
+	b.read = b.written
+	return sb.String()
+}
+
+// ProcessTool lets the agent run long-lived commands such as dev servers
+// in the background. Commands go through the same guard and sandbox as
+// the exec tool.
+type ProcessTool struct {
+	manager  *ProcessManager
+	execTool *ExecTool
+	mu       sync.RWMutex
+	session  string
+}
+
+func NewProcessTool(manager *ProcessManager, execTool *ExecTool) *ProcessTool {
+	return &ProcessTool{manager: manager, execTool: execTool}
+}
+
+func (t *ProcessTool) Name() string {
+	return "process"
+}
+
+func (t *ProcessTool) Description() string {
+	return "Manage long-running background processes such as dev servers, log tails or builds that outlive the exec timeout. Start a command, then poll it for new output, write to its stdin or kill it. Processes are killed when the conversation goes idle."
+}
+
+func (t *ProcessTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"start", "list", "poll", "write", "kill"},
+				"description": "start a command, list processes, poll for new stdout/stderr since the last poll, write to stdin, or kill a process",
+			},
+			"command": map[string]interface{}{
+				"type":        "string",
+				"description": "Shell command to start (for start)",
+			},
+			"working_dir": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional working directory (for start)",
+			},
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "Process ID returned by start (for poll, write and kill)",
+			},
+			"input": map[string]interface{}{
+				"type":        "string",
+				"description": "Text to write to stdin; include a trailing newline to send a line (for write)",
+			},
+			"eof": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Close stdin after writing (for write)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *ProcessTool) SetContext(channel, chatID string) {
+	session := ProcessSession(channel, chatID)
+	t.mu.Lock()
+	t.session = session
+	t.mu.Unlock()
+	t.manager.Touch(session)
+}
+
+func (t *ProcessTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	t.mu.RLock()
+	session := t.session
+	t.mu.RUnlock()
+	if session == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+
+	action, _ := args["action"].(string)
+	id, _ := args["id"].(string)
+	switch action {
+	case "start":
+		return t.start(session, args)
+	case "list":
+		return t.list(session)
+	case "poll":
+		info, stdout, stderr, err := t.manager.Poll(session, id)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		return SilentResult(formatProcessOutput(info, stdout, stderr))
+	case "write":
+		input, _ := args["input"].(string)
+		eof, _ := args["eof"].(bool)
+		if err := t.manager.Write(session, id, input, eof); err != nil {
+			return ErrorResult(err.Error())
+		}
+		return SilentResult(fmt.Sprintf("Wrote %d bytes to process %s", len(input), id))
+	case "kill":
+		info, err := t.manager.Kill(session, id)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		return SilentResult(fmt.Sprintf("Killed process %s: %s", info.ID, info.Command))
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *ProcessTool) start(session string, args map[string]interface{}) *ToolResult {
+	command, _ := args["command"].(string)
+	if command == "" {
+		return ErrorResult("command is required for start")
+	}
+	// Background processes outlive the tool call, so they get their own context
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd, err := t.execTool.prepare(ctx, command, t.execTool.workDir(args))
+	if err != nil {
+		cancel()
+		return ErrorResult(err.Error())
+	}
+	info, err := t.manager.Start(session, command, cmd, cancel)
+	if err != nil {
+		cancel()
+		return ErrorResult(err.Error())
+	}
+	return SilentResult(fmt.Sprintf("Started process %s (pid %d). Use poll to read its output.", info.ID, info.PID))
+}
+
+func (t *ProcessTool) list(session string) *ToolResult {
+	list := t.manager.List(session)
+	if len(list) == 0 {
+		return SilentResult("No background processes")
+	}
+	return SilentResult(FormatProcessList(list, time.Now()))
+}
+
+// FormatProcessList renders processes one per line for the agent and
+// the /ps command.
+func FormatProcessList(list []ProcessInfo, now time.Time) string {
+	var sb strings.Builder
+	for _, p := range list {
+		command := p.Command
+		if p.Terminal {
+			command = "[terminal] " + command
+		}
+		fmt.Fprintf(&sb, "%s  %s  %s  %s\n", p.ID, p.Status(), now.Sub(p.Started).Round(time.Second), command)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func formatProcessOutput(info ProcessInfo, stdout, stderr string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Process %s: %s\n", info.ID, info.Status())
+	if stdout == "" && stderr == "" {
+		sb.WriteString("(no new output)")
+	}
+	sb.WriteString(stdout)
+	if stderr != "" {
+		sb.WriteString("\nSTDERR:\n" + stderr)
+	}
+	output := cleanOutput(sb.String())
+	maxLen := 10000
+	if len(output) > maxLen {
+		// Keep the newest output
+		output = fmt.Sprintf("... (truncated, %d earlier chars)\n", len(output)-maxLen) + output[len(output)-maxLen:]
+	}
+	return output
+}
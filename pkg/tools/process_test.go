@@ -0,0 +1,157 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestProcessTool(t *testing.T) (*ProcessTool, *ProcessManager) {
+	t.Helper()
+	manager := NewProcessManager(&config.ProcessConfig{MaxPerSession: 2, BufferKB: 1, SessionTimeoutMinutes: 1})
+	t.Cleanup(manager.KillAll)
+	tool := NewProcessTool(manager, NewExecTool(t.TempDir(), false))
+	tool.SetContext("cli", "direct")
+	return tool, manager
+}
+
+// pollUntil polls process id until its output contains want.
+func pollUntil(t *testing.T, tool *ProcessTool, id, want string) string {
+	t.Helper()
+	var output string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		result := tool.Execute(context.Background(), map[string]interface{}{"action": "poll", "id": id})
+		if result.IsError {
+			t.Fatalf("poll: %s", result.ForLLM)
+		}
+		output += result.ForLLM
+		if strings.Contains(output, want) {
+			return output
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("output %q does not contain %q", output, want)
+	return ""
+}
+
+func TestProcessTool_Lifecycle(t *testing.T) {
+	tool, manager := newTestProcessTool(t)
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "start", "command": "echo ready; while read line; do echo got $line; done"})
+	if result.IsError || !strings.Contains(result.ForLLM, "p1") {
+		t.Fatalf("start: %s", result.ForLLM)
+	}
+	pollUntil(t, tool, "p1", "ready")
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "write", "id": "p1", "input": "hello\n"})
+	if result.IsError {
+		t.Fatalf("write: %s", result.ForLLM)
+	}
+	output := pollUntil(t, tool, "p1", "got hello")
+	if strings.Contains(output, "ready") {
+		t.Errorf("poll repeated old output: %q", output)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "list"})
+	if !strings.Contains(result.ForLLM, "p1  running") {
+		t.Errorf("list = %q", result.ForLLM)
+	}
+
+	// Another chat cannot see the process
+	other := NewProcessTool(manager, tool.execTool)
+	other.SetContext("telegram", "42")
+	if result := other.Execute(ctx, map[string]interface{}{"action": "poll", "id": "p1"}); !result.IsError {
+		t.Error("process visible from another session")
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "kill", "id": "p1"})
+	if result.IsError {
+		t.Fatalf("kill: %s", result.ForLLM)
+	}
+	if list := manager.List(ProcessSession("cli", "direct")); len(list) != 0 {
+		t.Errorf("killed process still listed: %+v", list)
+	}
+}
+
+func TestProcessTool_ExitAndLimits(t *testing.T) {
+	tool, _ := newTestProcessTool(t)
+	ctx := context.Background()
+
+	tool.Execute(ctx, map[string]interface{}{"action": "start", "command": "echo done; exit 3"})
+	pollUntil(t, tool, "p1", "exited (3)")
+
+	for i := 0; i < 2; i++ {
+		if result := tool.Execute(ctx, map[string]interface{}{"action": "start", "command": "sleep 30"}); result.IsError {
+			t.Fatalf("start: %s", result.ForLLM)
+		}
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "start", "command": "sleep 30"}); !result.IsError {
+		t.Error("expected the per-session limit to apply")
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "start", "command": "sudo ls"}); !result.IsError || !strings.Contains(result.ForLLM, "blocked") {
+		t.Errorf("expected the exec guard to apply, got: %s", result.ForLLM)
+	}
+}
+
+func TestProcessTool_WriteToBlockedStdin(t *testing.T) {
+	tool, _ := newTestProcessTool(t)
+	ctx := context.Background()
+	orig := stdinWriteTimeout
+	stdinWriteTimeout = 200 * time.Millisecond
+	defer func() { stdinWriteTimeout = orig }()
+
+	result := tool.Execute(ctx, map[string]interface{}{"action": "start", "command": "sleep 30"})
+	if result.IsError {
+		t.Fatalf("start: %s", result.ForLLM)
+	}
+	// More than a pipe buffer, which sleep never drains
+	input := strings.Repeat("x", 1<<20)
+	start := time.Now()
+	result = tool.Execute(ctx, map[string]interface{}{"action": "write", "id": "p1", "input": input})
+	if !result.IsError || !strings.Contains(result.ForLLM, "not reading its stdin") {
+		t.Errorf("write: %s", result.ForLLM)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("write blocked for %v", elapsed)
+	}
+}
+
+func TestProcessManager_Reap(t *testing.T) {
+	tool, manager := newTestProcessTool(t)
+	tool.Execute(context.Background(), map[string]interface{}{"action": "start", "command": "sleep 30"})
+	session := ProcessSession("cli", "direct")
+
+	manager.Reap(time.Now())
+	if len(manager.List(session)) != 1 {
+		t.Fatal("active session reaped")
+	}
+	manager.Reap(time.Now().Add(2 * time.Minute))
+	if len(manager.List(session)) != 0 {
+		t.Error("idle session not reaped")
+	}
+}
+
+func TestOutputBuffer(t *testing.T) {
+	b := newOutputBuffer(8)
+	b.Write([]byte("abc"))
+	if got := b.next(); got != "abc" {
+		t.Errorf("next() = %q", got)
+	}
+	if got := b.next(); got != "" {
+		t.Errorf("next() = %q, want empty", got)
+	}
+	b.Write([]byte("defghij"))
+	b.Write([]byte("klm"))
+	if got := b.next(); got != "... (2 bytes dropped)\nfghijklm" {
+		t.Errorf("next() = %q", got)
+	}
+	b.Write([]byte("0123456789ab"))
+	if got := b.next(); got != "... (4 bytes dropped)\n456789ab" {
+		t.Errorf("next() = %q", got)
+	}
+}
@@ -0,0 +1,481 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/sipeed/picoclaw/pkg/checkpoint"
+)
+
+const (
+	defaultGrepResults = 100
+	defaultGlobResults = 200
+	maxGrepContext     = 10
+	maxGrepFileSize    = 5 << 20
+	maxGrepLineLength  = 500
+)
+
+// errSearchLimit stops a walk once enough results were found.
+var errSearchLimit = errors.New("search limit reached")
+
+// ignoreRule is one pattern of a .gitignore file.
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreFile holds the rules of the .gitignore in dir, a slash-separated
+// path relative to the search base.
+type ignoreFile struct {
+	dir   string
+	rules []ignoreRule
+}
+
+func parseGitignore(data []byte) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " ")
+		var r ignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		// A slash anywhere but at the end anchors the pattern to the
+		// directory of the .gitignore
+		if strings.Contains(line, "/") {
+			r.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		r.pattern = line
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// match reports whether rel, relative to the search base, is decided by
+// f and if so whether it is ignored. The last matching rule wins.
+func (f ignoreFile) match(rel string, isDir bool) (decided, ignored bool) {
+	sub := rel
+	if f.dir != "" {
+		if !strings.HasPrefix(rel, f.dir+"/") {
+			return false, false
+		}
+		sub = rel[len(f.dir)+1:]
+	}
+	for _, r := range f.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		target := sub
+		if !r.anchored {
+			target = path.Base(sub)
+		}
+		if ok, _ := doublestar.Match(r.pattern, target); ok {
+			decided, ignored = true, !r.negate
+		}
+	}
+	return decided, ignored
+}
+
+// walkFiles calls fn for every regular file under root, skipping .git and
+// checkpoint store directories and paths ignored by .gitignore files. .gitignore files
+// between base and root apply as well.
+func walkFiles(ctx context.Context, base, root string, fn func(path, rel string) error) error {
+	var ignores []ignoreFile
+	load := func(dir string) {
+		data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+		if err != nil {
+			return
+		}
+		rel, _ := filepath.Rel(base, dir)
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		ignores = append(ignores, ignoreFile{dir: rel, rules: parseGitignore(data)})
+	}
+	ignored := func(rel string, isDir bool) bool {
+		result := false
+		for _, f := range ignores {
+			if decided, ign := f.match(rel, isDir); decided {
+				result = ign
+			}
+		}
+		return result
+	}
+	if root != base {
+		paths := []string{root}
+		for dir := filepath.Dir(root); ; dir = filepath.Dir(dir) {
+			paths = append(paths, dir)
+			if dir == base || filepath.Dir(dir) == dir {
+				break
+			}
+		}
+		// Nothing under an ignored directory is searched, even when the
+		// search starts inside it
+		for i := len(paths) - 1; i > 0; i-- {
+			load(paths[i])
+			rel, _ := filepath.Rel(base, paths[i-1])
+			isDir := i > 1
+			if !isDir {
+				if info, err := os.Stat(root); err == nil {
+					isDir = info.IsDir()
+				}
+			}
+			if ignored(filepath.ToSlash(rel), isDir) {
+				return nil
+			}
+		}
+	}
+
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries are skipped rather than ending the search
+			if d != nil && d.IsDir() && p != root {
+				return fs.SkipDir
+			}
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(base, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if p != root && (d.Name() == ".git" || d.Name() == checkpoint.DirName || ignored(rel, true)) {
+				return fs.SkipDir
+			}
+			load(p)
+			return nil
+		}
+		if !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		if p != root && ignored(rel, false) {
+			return nil
+		}
+		return fn(p, rel)
+	})
+}
+
+// searchRoot resolves the path argument of a search tool and returns it
+// with the base that .gitignore files are relative to. Inside the
+// workspace the base is the workspace, and results are shown relative to
+// it; elsewhere they are shown as absolute paths.
+func searchRoot(args map[string]interface{}, workspace string, restrict bool) (root, base string, inWorkspace bool, err error) {
+	p, _ := args["path"].(string)
+	if p == "" {
+		p = "."
+	}
+	root, err = validatePath(p, workspace, restrict)
+	if err != nil {
+		return "", "", false, err
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return "", "", false, err
+	}
+	if workspace != "" {
+		if ws, err := filepath.Abs(workspace); err == nil && isWithinWorkspace(root, ws) {
+			return root, ws, true, nil
+		}
+	}
+	base = root
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		base = filepath.Dir(root)
+	}
+	return root, base, false, nil
+}
+
+// allowedFile rejects symlinks that lead outside the workspace.
+func allowedFile(p, workspace string, restrict bool) bool {
+	if !restrict {
+		return true
+	}
+	if info, err := os.Lstat(p); err == nil && info.Mode()&fs.ModeSymlink == 0 {
+		return true
+	}
+	_, err := validatePath(p, workspace, true)
+	return err == nil
+}
+
+// matchInclude reports whether rel matches include, which matches the
+// file name when it has no slash and the relative path otherwise.
+func matchInclude(include, rel string) bool {
+	if include == "" {
+		return true
+	}
+	target := rel
+	if !strings.Contains(include, "/") {
+		target = path.Base(rel)
+	}
+	ok, _ := doublestar.Match(include, target)
+	return ok
+}
+
+func intArg(args map[string]interface{}, name string, def, max int) int {
+	v, ok := args[name].(float64)
+	if !ok || v < 0 {
+		return def
+	}
+	if int(v) > max {
+		return max
+	}
+	return int(v)
+}
+
+type GrepTool struct {
+	workspace string
+	restrict  bool
+}
+
+func NewGrepTool(workspace string, restrict bool) *GrepTool {
+	return &GrepTool{workspace: workspace, restrict: restrict}
+}
+
+func (t *GrepTool) Name() string {
+	return "grep"
+}
+
+func (t *GrepTool) Description() string {
+	return "Search file contents with a regular expression. Skips binary files, .git and files ignored by .gitignore. Returns matching lines as path:line: text."
+}
+
+func (t *GrepTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"pattern": map[string]interface{}{
+				"type":        "string",
+				"description": "Regular expression (RE2 syntax) to search for",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "File or directory to search, default the workspace",
+			},
+			"include": map[string]interface{}{
+				"type":        "string",
+				"description": "Only search files matching this glob, e.g. '*.go' or 'src/**/*.ts'",
+			},
+			"ignore_case": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Match case-insensitively",
+			},
+			"context": map[string]interface{}{
+				"type":        "integer",
+				"description": "Lines of context to show before and after each match, at most 10",
+			},
+			"max_results": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum number of matching lines, default 100",
+			},
+		},
+		"required": []string{"pattern"},
+	}
+}
+
+func (t *GrepTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	expr, _ := args["pattern"].(string)
+	if expr == "" {
+		return ErrorResult("pattern is required")
+	}
+	if ignoreCase, _ := args["ignore_case"].(bool); ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("invalid pattern: %v", err))
+	}
+	include, _ := args["include"].(string)
+	contextLines := intArg(args, "context", 0, maxGrepContext)
+	maxResults := intArg(args, "max_results", defaultGrepResults, 1000)
+	if maxResults == 0 {
+		maxResults = defaultGrepResults
+	}
+
+	root, base, inWorkspace, err := searchRoot(args, t.workspace, t.restrict)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	var out strings.Builder
+	matches, files := 0, 0
+	err = walkFiles(ctx, base, root, func(p, rel string) error {
+		name := rel
+		if !inWorkspace {
+			name = p
+		}
+		if !matchInclude(include, rel) || !allowedFile(p, t.workspace, t.restrict) {
+			return nil
+		}
+		info, err := os.Stat(p)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxGrepFileSize {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil || isBinary(data) {
+			return nil
+		}
+
+		lines := strings.Split(string(data), "\n")
+		printed := -1 // Last line written for this file
+		found := false
+		for i, line := range lines {
+			if !re.MatchString(line) {
+				continue
+			}
+			if !found {
+				found = true
+				files++
+			}
+			start := max(i-contextLines, printed+1)
+			if contextLines > 0 && printed >= 0 && start > printed+1 {
+				out.WriteString("--\n")
+			}
+			for j := start; j <= min(i+contextLines, len(lines)-1); j++ {
+				sep := "-"
+				if re.MatchString(lines[j]) {
+					sep = ":"
+				}
+				text := strings.TrimRight(lines[j], "\r")
+				if len(text) > maxGrepLineLength {
+					text = text[:maxGrepLineLength] + "..."
+				}
+				fmt.Fprintf(&out, "%s%s%d%s %s\n", name, sep, j+1, sep, text)
+				printed = j
+			}
+			matches++
+			if matches >= maxResults {
+				return errSearchLimit
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errSearchLimit) {
+		return ErrorResult(fmt.Sprintf("search failed: %v", err))
+	}
+
+	if matches == 0 {
+		return SilentResult("No matches found")
+	}
+	summary := fmt.Sprintf("%d matches in %d files", matches, files)
+	if errors.Is(err, errSearchLimit) {
+		summary = fmt.Sprintf("Showing the first %d matches; narrow the search to see more", matches)
+	}
+	return SilentResult(out.String() + "\n" + summary)
+}
+
+type GlobTool struct {
+	workspace string
+	restrict  bool
+}
+
+func NewGlobTool(workspace string, restrict bool) *GlobTool {
+	return &GlobTool{workspace: workspace, restrict: restrict}
+}
+
+func (t *GlobTool) Name() string {
+	return "glob"
+}
+
+func (t *GlobTool) Description() string {
+	return "Find files by name with a glob pattern such as '**/*.go' or 'src/*.ts'. Skips .git and files ignored by .gitignore."
+}
+
+func (t *GlobTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"pattern": map[string]interface{}{
+				"type":        "string",
+				"description": "Glob relative to path; ** matches any number of directories",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Directory to search, default the workspace",
+			},
+			"max_results": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum number of files, default 200",
+			},
+		},
+		"required": []string{"pattern"},
+	}
+}
+
+func (t *GlobTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	pattern, _ := args["pattern"].(string)
+	if pattern == "" {
+		return ErrorResult("pattern is required")
+	}
+	if !doublestar.ValidatePattern(pattern) {
+		return ErrorResult(fmt.Sprintf("invalid pattern: %s", pattern))
+	}
+	maxResults := intArg(args, "max_results", defaultGlobResults, 5000)
+	if maxResults == 0 {
+		maxResults = defaultGlobResults
+	}
+
+	root, base, inWorkspace, err := searchRoot(args, t.workspace, t.restrict)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	var found []string
+	err = walkFiles(ctx, base, root, func(p, rel string) error {
+		fromRoot, _ := filepath.Rel(root, p)
+		if ok, _ := doublestar.Match(pattern, filepath.ToSlash(fromRoot)); !ok {
+			return nil
+		}
+		if !allowedFile(p, t.workspace, t.restrict) {
+			return nil
+		}
+		if !inWorkspace {
+			rel = p
+		}
+		found = append(found, rel)
+		if len(found) >= maxResults {
+			return errSearchLimit
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errSearchLimit) {
+		return ErrorResult(fmt.Sprintf("search failed: %v", err))
+	}
+
+	if len(found) == 0 {
+		return SilentResult("No files found")
+	}
+	sort.Strings(found)
+	result := strings.Join(found, "\n")
+	if errors.Is(err, errSearchLimit) {
+		result += fmt.Sprintf("\n\nShowing the first %d files; narrow the pattern to see more", len(found))
+	}
+	return SilentResult(result)
+}
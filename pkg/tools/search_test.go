@@ -0,0 +1,195 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGlobTool_Gitignore(t *testing.T) {
+	ws := t.TempDir()
+	writeTree(t, ws, map[string]string{
+		".gitignore":              "*.log\n!keep.log\nbuild/\n/top.txt\n",
+		"main.go":                 "package main\n",
+		"top.txt":                 "ignored at the root only\n",
+		"keep.log":                "kept by negation\n",
+		"debug.log":               "ignored\n",
+		"build/out.go":            "ignored dir\n",
+		"src/top.txt":             "not anchored here\n",
+		"src/util.go":             "package src\n",
+		"src/.gitignore":          "gen/\n",
+		"src/gen/types.go":        "ignored by nested gitignore\n",
+		".git/HEAD":               "ref: refs/heads/main\n",
+		".checkpoints/index.json": "{}\n",
+		"docs/build/index.md":     "build/ matches at any depth\n",
+	})
+
+	tool := NewGlobTool(ws, true)
+	result := tool.Execute(context.Background(), map[string]interface{}{"pattern": "**"})
+	if result.IsError {
+		t.Fatalf("glob failed: %s", result.ForLLM)
+	}
+	got := strings.Split(result.ForLLM, "\n")
+	want := []string{".gitignore", "keep.log", "main.go", "src/.gitignore", "src/top.txt", "src/util.go"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"pattern": "**/*.go"})
+	if result.ForLLM != "main.go\nsrc/util.go" {
+		t.Errorf("unexpected **/*.go result: %q", result.ForLLM)
+	}
+
+	// Patterns are relative to path, and .gitignore files above it still apply
+	result = tool.Execute(context.Background(), map[string]interface{}{"pattern": "*.go", "path": "src"})
+	if result.ForLLM != "src/util.go" {
+		t.Errorf("unexpected result under src: %q", result.ForLLM)
+	}
+	result = tool.Execute(context.Background(), map[string]interface{}{"pattern": "*.go", "path": "src/gen"})
+	if result.ForLLM != "No files found" {
+		t.Errorf("expected ignored directory to be empty, got %q", result.ForLLM)
+	}
+}
+
+func TestGlobTool_MaxResults(t *testing.T) {
+	ws := t.TempDir()
+	writeTree(t, ws, map[string]string{"a.txt": "", "b.txt": "", "c.txt": ""})
+
+	result := NewGlobTool(ws, true).Execute(context.Background(), map[string]interface{}{
+		"pattern":     "*.txt",
+		"max_results": float64(2),
+	})
+	if strings.Count(result.ForLLM, ".txt") != 2 || !strings.Contains(result.ForLLM, "Showing the first 2 files") {
+		t.Errorf("expected 2 files and a truncation note, got %q", result.ForLLM)
+	}
+}
+
+func TestGrepTool_Matches(t *testing.T) {
+	ws := t.TempDir()
+	writeTree(t, ws, map[string]string{
+		".gitignore":     "vendor/\n",
+		"a.go":           "package a\n\nfunc Hello() {}\n",
+		"b.txt":          "hello from text\n",
+		"vendor/v.go":    "func Hello() {}\n",
+		"bin/data.bin":   "Hello\x00\x01",
+		"nested/c/c.go":  "// HELLO\n",
+		"nested/c/d.txt": "nothing here\n",
+	})
+	tool := NewGrepTool(ws, true)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"pattern": "Hello"})
+	if result.IsError {
+		t.Fatalf("grep failed: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "a.go:3: func Hello() {}") {
+		t.Errorf("expected match in a.go, got %q", result.ForLLM)
+	}
+	for _, skipped := range []string{"vendor/", "data.bin", "b.txt"} {
+		if strings.Contains(result.ForLLM, skipped) {
+			t.Errorf("expected %s to be skipped, got %q", skipped, result.ForLLM)
+		}
+	}
+	if !strings.Contains(result.ForLLM, "1 matches in 1 files") {
+		t.Errorf("expected summary, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{
+		"pattern":     "hello",
+		"ignore_case": true,
+		"include":     "*.go",
+	})
+	if !strings.Contains(result.ForLLM, "nested/c/c.go:1: // HELLO") || strings.Contains(result.ForLLM, "b.txt") {
+		t.Errorf("unexpected include result: %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"pattern": "absent"})
+	if result.IsError || result.ForLLM != "No matches found" {
+		t.Errorf("expected no matches, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"pattern": "("})
+	if !result.IsError {
+		t.Errorf("expected invalid pattern error")
+	}
+}
+
+func TestGrepTool_Context(t *testing.T) {
+	ws := t.TempDir()
+	writeTree(t, ws, map[string]string{
+		"f.txt": "one\ntwo\nmatch three\nfour\nfive\nsix\nseven\nmatch eight\nnine\n",
+	})
+
+	result := NewGrepTool(ws, true).Execute(context.Background(), map[string]interface{}{
+		"pattern": "match",
+		"context": float64(1),
+	})
+	want := "f.txt-2- two\nf.txt:3: match three\nf.txt-4- four\n--\n" +
+		"f.txt-7- seven\nf.txt:8: match eight\nf.txt-9- nine\n"
+	if !strings.HasPrefix(result.ForLLM, want) {
+		t.Errorf("unexpected context output:\n%s", result.ForLLM)
+	}
+}
+
+func TestGrepTool_MaxResults(t *testing.T) {
+	ws := t.TempDir()
+	writeTree(t, ws, map[string]string{"f.txt": strings.Repeat("x\n", 10)})
+
+	result := NewGrepTool(ws, true).Execute(context.Background(), map[string]interface{}{
+		"pattern":     "x",
+		"max_results": float64(3),
+	})
+	if strings.Count(result.ForLLM, "f.txt:") != 3 || !strings.Contains(result.ForLLM, "Showing the first 3 matches") {
+		t.Errorf("expected 3 matches and a truncation note, got %q", result.ForLLM)
+	}
+}
+
+func TestSearchTools_Restrict(t *testing.T) {
+	ws := t.TempDir()
+	outside := t.TempDir()
+	writeTree(t, ws, map[string]string{"in.txt": "secret inside\n"})
+	writeTree(t, outside, map[string]string{"out.txt": "secret outside\n"})
+	if err := os.Symlink(filepath.Join(outside, "out.txt"), filepath.Join(ws, "link.txt")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	grep := NewGrepTool(ws, true)
+	glob := NewGlobTool(ws, true)
+
+	if result := grep.Execute(context.Background(), map[string]interface{}{"pattern": "secret", "path": outside}); !result.IsError {
+		t.Errorf("expected grep outside the workspace to fail, got %q", result.ForLLM)
+	}
+	if result := glob.Execute(context.Background(), map[string]interface{}{"pattern": "*", "path": "../"}); !result.IsError {
+		t.Errorf("expected glob outside the workspace to fail, got %q", result.ForLLM)
+	}
+
+	// A symlink inside the workspace must not leak the file it points to
+	result := grep.Execute(context.Background(), map[string]interface{}{"pattern": "secret"})
+	if strings.Contains(result.ForLLM, "outside") || !strings.Contains(result.ForLLM, "in.txt:1:") {
+		t.Errorf("unexpected grep result: %q", result.ForLLM)
+	}
+	result = glob.Execute(context.Background(), map[string]interface{}{"pattern": "*.txt"})
+	if result.ForLLM != "in.txt" {
+		t.Errorf("unexpected glob result: %q", result.ForLLM)
+	}
+
+	// Without the restriction outside paths are searched and shown absolute
+	result = NewGrepTool(ws, false).Execute(context.Background(), map[string]interface{}{"pattern": "secret", "path": outside})
+	if !strings.Contains(result.ForLLM, filepath.Join(outside, "out.txt")+":1:") {
+		t.Errorf("expected absolute path outside the workspace, got %q", result.ForLLM)
+	}
+}
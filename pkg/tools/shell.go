@@ -3,68 +3,59 @@ package tools
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/sandbox"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Exec sandbox modes, see config.ExecSandboxConfig.
+const (
+	SandboxAuto     = "auto"
+	SandboxRequired = "required"
+	SandboxOff      = "off"
+)
+
+// builtinSandboxProfiles are available without configuration. "default"
+// keeps the network for package managers and web requests.
+var builtinSandboxProfiles = map[string]config.SandboxProfile{
+	"default": {Network: true, CPUSeconds: 300, MemoryMB: 2048, MaxProcesses: 256},
+	"strict":  {Network: false, CPUSeconds: 60, MemoryMB: 512, MaxProcesses: 64},
+}
+
+var sandboxFallbackOnce sync.Once
+
 type ExecTool struct {
 	workingDir          string
 	timeout             time.Duration
 	denyPatterns        []*regexp.Regexp
+	policy              *commandPolicy
 	allowPatterns       []*regexp.Regexp
 	restrictToWorkspace bool
+	sandboxMode         string
+	sandboxProfiles     map[string]config.SandboxProfile
+	sandboxProfile      config.SandboxProfile
 }
 
-var defaultDenyPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`\brm\s+-[rf]{1,2}\b`),
+// windowsDenyPatterns stand in for the command policy on Windows, where
+// commands run in PowerShell and cannot be parsed as POSIX shell.
+var windowsDenyPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b(rm|remove-item)\s+.*-(r|recurse)\b`),
 	regexp.MustCompile(`\bdel\s+/[fq]\b`),
 	regexp.MustCompile(`\brmdir\s+/s\b`),
-	regexp.MustCompile(`\b(format|mkfs|diskpart)\b\s`), // Match disk wiping commands (must be followed by space/args)
-	regexp.MustCompile(`\bdd\s+if=`),
-	regexp.MustCompile(`>\s*/dev/sd[a-z]\b`), // Block writes to disk devices (but allow /dev/null)
-	regexp.MustCompile(`\b(shutdown|reboot|poweroff)\b`),
-	regexp.MustCompile(`:\(\)\s*\{.*\};\s*:`),
-	regexp.MustCompile(`\$\([^)]+\)`),
-	regexp.MustCompile(`\$\{[^}]+\}`),
-	regexp.MustCompile("`[^`]+`"),
-	regexp.MustCompile(`\|\s*sh\b`),
-	regexp.MustCompile(`\|\s*bash\b`),
-	regexp.MustCompile(`;\s*rm\s+-[rf]`),
-	regexp.MustCompile(`&&\s*rm\s+-[rf]`),
-	regexp.MustCompile(`\|\|\s*rm\s+-[rf]`),
-	regexp.MustCompile(`>\s*/dev/null\s*>&?\s*\d?`),
-	regexp.MustCompile(`<<\s*EOF`),
-	regexp.MustCompile(`\$\(\s*cat\s+`),
-	regexp.MustCompile(`\$\(\s*curl\s+`),
-	regexp.MustCompile(`\$\(\s*wget\s+`),
-	regexp.MustCompile(`\$\(\s*which\s+`),
-	regexp.MustCompile(`\bsudo\b`),
-	regexp.MustCompile(`\bchmod\s+[0-7]{3,4}\b`),
-	regexp.MustCompile(`\bchown\b`),
-	regexp.MustCompile(`\bpkill\b`),
-	regexp.MustCompile(`\bkillall\b`),
-	regexp.MustCompile(`\bkill\s+-[9]\b`),
-	regexp.MustCompile(`\bcurl\b.*\|\s*(sh|bash)`),
-	regexp.MustCompile(`\bwget\b.*\|\s*(sh|bash)`),
-	regexp.MustCompile(`\bnpm\s+install\s+-g\b`),
-	regexp.MustCompile(`\bpip\s+install\s+--user\b`),
-	regexp.MustCompile(`\bapt\s+(install|remove|purge)\b`),
-	regexp.MustCompile(`\byum\s+(install|remove)\b`),
-	regexp.MustCompile(`\bdnf\s+(install|remove)\b`),
-	regexp.MustCompile(`\bdocker\s+run\b`),
-	regexp.MustCompile(`\bdocker\s+exec\b`),
+	regexp.MustCompile(`\b(format|diskpart)\b\s`),
+	regexp.MustCompile(`\b(shutdown|restart-computer|stop-computer)\b`),
+	regexp.MustCompile(`\b(invoke-expression|iex)\b`),
 	regexp.MustCompile(`\bgit\s+push\b`),
-	regexp.MustCompile(`\bgit\s+force\b`),
-	regexp.MustCompile(`\bssh\b.*@`),
-	regexp.MustCompile(`\beval\b`),
-	regexp.MustCompile(`\bsource\s+.*\.sh\b`),
 }
 
 func NewExecTool(workingDir string, restrict bool) *ExecTool {
@@ -73,11 +64,14 @@ func NewExecTool(workingDir string, restrict bool) *ExecTool {
 
 func NewExecToolWithConfig(workingDir string, restrict bool, config *config.Config) *ExecTool {
 	denyPatterns := make([]*regexp.Regexp, 0)
+	var allowedCommands, deniedCommands []string
 
 	enableDenyPatterns := true
 	if config != nil {
 		execConfig := config.Tools.Exec
 		enableDenyPatterns = execConfig.EnableDenyPatterns
+		allowedCommands = execConfig.AllowedCommands
+		deniedCommands = execConfig.DeniedCommands
 		if enableDenyPatterns {
 			if len(execConfig.CustomDenyPatterns) > 0 {
 				fmt.Printf("Using custom deny patterns: %v\n", execConfig.CustomDenyPatterns)
@@ -89,24 +83,42 @@ func NewExecToolWithConfig(workingDir string, restrict bool, config *config.Conf
 					}
 					denyPatterns = append(denyPatterns, re)
 				}
-			} else {
-				denyPatterns = append(denyPatterns, defaultDenyPatterns...)
 			}
 		} else {
-			// If deny patterns are disabled, we won't add any patterns, allowing all commands.
+			// If deny patterns are disabled, only the configured command lists apply.
 			fmt.Println("Warning: deny patterns are disabled. All commands will be allowed.")
 		}
-	} else {
-		denyPatterns = append(denyPatterns, defaultDenyPatterns...)
+	}
+	if enableDenyPatterns && runtime.GOOS == "windows" {
+		denyPatterns = append(denyPatterns, windowsDenyPatterns...)
 	}
 
-	return &ExecTool{
+	tool := &ExecTool{
 		workingDir:          workingDir,
 		timeout:             60 * time.Second,
 		denyPatterns:        denyPatterns,
+		policy:              newCommandPolicy(enableDenyPatterns, allowedCommands, deniedCommands),
 		allowPatterns:       nil,
 		restrictToWorkspace: restrict,
+		sandboxMode:         SandboxAuto,
+		sandboxProfile:      builtinSandboxProfiles["default"],
+	}
+	if config != nil {
+		switch mode := config.Tools.Exec.Sandbox.Mode; mode {
+		case "":
+		case SandboxAuto, SandboxRequired, SandboxOff:
+			tool.sandboxMode = mode
+		default:
+			// Fail closed on a typo such as "requried"
+			fmt.Printf("Unknown exec sandbox mode %q, requiring the sandbox\n", mode)
+			tool.sandboxMode = SandboxRequired
+		}
+		tool.sandboxProfiles = config.Tools.Exec.Sandbox.Profiles
+		if err := tool.SetSandboxProfile(config.Agents.Defaults.SandboxProfile); err != nil {
+			fmt.Printf("%v, using the default profile\n", err)
+		}
 	}
+	return tool
 }
 
 func (t *ExecTool) Name() string {
@@ -140,21 +152,7 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 		return ErrorResult("command is required")
 	}
 
-	cwd := t.workingDir
-	if wd, ok := args["working_dir"].(string); ok && wd != "" {
-		cwd = wd
-	}
-
-	if cwd == "" {
-		wd, err := os.Getwd()
-		if err == nil {
-			cwd = wd
-		}
-	}
-
-	if guardError := t.guardCommand(command, cwd); guardError != "" {
-		return ErrorResult(guardError)
-	}
+	cwd := t.workDir(args)
 
 	// timeout == 0 means no timeout
 	var cmdCtx context.Context
@@ -166,21 +164,16 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 	}
 	defer cancel()
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.CommandContext(cmdCtx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command)
-	} else {
-		cmd = exec.CommandContext(cmdCtx, "sh", "-c", command)
-	}
-	if cwd != "" {
-		cmd.Dir = cwd
+	cmd, err := t.prepare(cmdCtx, command, cwd)
+	if err != nil {
+		return ErrorResult(err.Error())
 	}
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	err = cmd.Run()
 	output := stdout.String()
 	if stderr.Len() > 0 {
 		output += "\nSTDERR:\n" + stderr.String()
@@ -225,13 +218,103 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 	}
 }
 
+// workDir returns the working_dir argument, or the tool's working
+// directory, or the current directory.
+func (t *ExecTool) workDir(args map[string]interface{}) string {
+	cwd := t.workingDir
+	if wd, ok := args["working_dir"].(string); ok && wd != "" {
+		cwd = wd
+	}
+	if cwd == "" {
+		if wd, err := os.Getwd(); err == nil {
+			cwd = wd
+		}
+	}
+	return cwd
+}
+
+// prepare checks command against the guard and builds the process that
+// runs it in cwd, inside the kernel sandbox when enabled.
+func (t *ExecTool) prepare(ctx context.Context, command, cwd string) (*exec.Cmd, error) {
+	sandboxed, err := t.useSandbox()
+	if err != nil {
+		return nil, err
+	}
+
+	if guardError := t.guardCommand(command, cwd); guardError != "" {
+		return nil, errors.New(guardError)
+	}
+
+	var cmd *exec.Cmd
+	switch {
+	case sandboxed:
+		cmd, err = sandbox.Command(ctx, t.sandboxSpec(cwd), "sh", "-c", command)
+		if err != nil {
+			return nil, fmt.Errorf("sandbox: %v", err)
+		}
+	case runtime.GOOS == "windows":
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command)
+	default:
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	if cwd != "" {
+		cmd.Dir = cwd
+	}
+	return cmd, nil
+}
+
+// useSandbox reports whether commands run in the kernel sandbox, or an
+// error when the sandbox is required but unavailable.
+func (t *ExecTool) useSandbox() (bool, error) {
+	if t.sandboxMode == SandboxOff {
+		return false, nil
+	}
+	err := sandbox.Available()
+	if err == nil {
+		return true, nil
+	}
+	if t.sandboxMode == SandboxRequired {
+		return false, fmt.Errorf("exec sandbox is required but unavailable: %v", err)
+	}
+	sandboxFallbackOnce.Do(func() {
+		logger.WarnCF("tool", "Kernel sandbox unavailable, relying on the command policy",
+			map[string]interface{}{"error": err.Error()})
+	})
+	return false, nil
+}
+
+func (t *ExecTool) sandboxSpec(cwd string) sandbox.Spec {
+	workspace := t.workingDir
+	if workspace == "" {
+		workspace = cwd
+	}
+	p := t.sandboxProfile
+	writable := make([]string, 0, len(p.WritablePaths))
+	for _, path := range p.WritablePaths {
+		writable = append(writable, config.ExpandHome(path))
+	}
+	return sandbox.Spec{
+		Workspace:    workspace,
+		Writable:     writable,
+		Masked:       []string{config.ExpandHome("~/.picoclaw")}, // config and auth store
+		Network:      p.Network,
+		CPUSeconds:   p.CPUSeconds,
+		MemoryMB:     p.MemoryMB,
+		MaxProcesses: p.MaxProcesses,
+	}
+}
+
+// guardCommand checks command against the command policy and the deny and
+// allow patterns, and returns why it is blocked or "". Paths outside the
+// working directory are checked in the sandbox too: it only stops writes,
+// and the command could still read anything else on the machine.
 func (t *ExecTool) guardCommand(command, cwd string) string {
 	cmd := strings.TrimSpace(command)
 	lower := strings.ToLower(cmd)
 
 	for _, pattern := range t.denyPatterns {
 		if pattern.MatchString(lower) {
-			return "Command blocked by safety guard (dangerous pattern detected)"
+			return fmt.Sprintf("Command blocked by safety guard (matches deny pattern %s)", pattern)
 		}
 	}
 
@@ -248,36 +331,38 @@ func (t *ExecTool) guardCommand(command, cwd string) string {
 		}
 	}
 
-	if t.restrictToWorkspace {
-		if strings.Contains(cmd, "..\\") || strings.Contains(cmd, "../") {
-			return "Command blocked by safety guard (path traversal detected)"
-		}
-
-		cwdPath, err := filepath.Abs(cwd)
-		if err != nil {
-			return ""
+	checkPaths := t.restrictToWorkspace
+	if runtime.GOOS == "windows" {
+		if checkPaths {
+			return guardWindowsPaths(cmd, cwd)
 		}
+		return ""
+	}
+	if err := t.policy.check(cmd, cwd, checkPaths); err != nil {
+		return fmt.Sprintf("Command blocked by safety guard: %v", err)
+	}
+	return ""
+}
 
-		pathPattern := regexp.MustCompile(`[A-Za-z]:\\[^\\\"']+|/[^\s\"']+`)
-		matches := pathPattern.FindAllString(cmd, -1)
-
-		for _, raw := range matches {
-			p, err := filepath.Abs(raw)
-			if err != nil {
-				continue
-			}
+// guardWindowsPaths rejects PowerShell commands that mention paths outside
+// the working directory.
+func guardWindowsPaths(cmd, cwd string) string {
+	if strings.Contains(cmd, "..\\") || strings.Contains(cmd, "../") {
+		return "Command blocked by safety guard (path traversal detected)"
+	}
 
-			rel, err := filepath.Rel(cwdPath, p)
-			if err != nil {
-				continue
-			}
+	cwdPath, err := filepath.Abs(cwd)
+	if err != nil {
+		return ""
+	}
 
-			if strings.HasPrefix(rel, "..") {
-				return "Command blocked by safety guard (path outside working dir)"
-			}
+	pathPattern := regexp.MustCompile(`[A-Za-z]:\\[^\\\"']+`)
+	for _, raw := range pathPattern.FindAllString(cmd, -1) {
+		rel, err := filepath.Rel(cwdPath, raw)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return "Command blocked by safety guard (path outside working dir)"
 		}
 	}
-
 	return ""
 }
 
@@ -285,6 +370,23 @@ func (t *ExecTool) SetTimeout(timeout time.Duration) {
 	t.timeout = timeout
 }
 
+// SetSandboxProfile selects a configured or built-in sandbox profile; ""
+// is "default".
+func (t *ExecTool) SetSandboxProfile(name string) error {
+	if name == "" {
+		name = "default"
+	}
+	profile, ok := t.sandboxProfiles[name]
+	if !ok {
+		profile, ok = builtinSandboxProfiles[name]
+	}
+	if !ok {
+		return fmt.Errorf("unknown sandbox profile %q", name)
+	}
+	t.sandboxProfile = profile
+	return nil
+}
+
 func (t *ExecTool) SetRestrictToWorkspace(restrict bool) {
 	t.restrictToWorkspace = restrict
 }
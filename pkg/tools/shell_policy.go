@@ -0,0 +1,839 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// commandPolicy decides whether an exec command may run. Commands are
+// parsed as POSIX shell and every simple command, redirection and pipe in
+// the syntax tree is checked, including those inside subshells, command
+// substitutions and sh -c scripts.
+type commandPolicy struct {
+	// builtin enables deniedCommands, argumentRules, pipes into
+	// interpreters and fork bombs.
+	builtin bool
+	// allowed, when non-empty, lists the only executables that may run.
+	allowed map[string]bool
+	// denied maps configured executables to the reason they are denied.
+	denied map[string]string
+}
+
+// deniedCommands never run; the value completes "`name` ...".
+var deniedCommands = map[string]string{
+	"sudo":     "runs commands with elevated privileges",
+	"su":       "runs commands with elevated privileges",
+	"doas":     "runs commands with elevated privileges",
+	"pkexec":   "runs commands with elevated privileges",
+	"shutdown": "stops the machine",
+	"reboot":   "stops the machine",
+	"poweroff": "stops the machine",
+	"halt":     "stops the machine",
+	"mkfs":     "formats a disk",
+	"fdisk":    "partitions a disk",
+	"sfdisk":   "partitions a disk",
+	"parted":   "partitions a disk",
+	"wipefs":   "wipes disk signatures",
+	"pkill":    "kills processes by name",
+	"killall":  "kills processes by name",
+	"chown":    "changes file ownership",
+	"ssh":      "connects to a remote host",
+	"scp":      "copies files to or from a remote host",
+	"sftp":     "copies files to or from a remote host",
+}
+
+// argumentRules check the arguments of a command and describe why they
+// are rejected, or return "".
+var argumentRules = map[string]func(c *policyCheck, args []policyArg) string{
+	"rm":       ruleRemove,
+	"mv":       protectedRule("mv", "moves", "-S", "--suffix"),
+	"truncate": protectedRule("truncate", "truncates", "-s", "--size", "-r", "--reference"),
+	"shred":    protectedRule("shred", "overwrites", "-n", "--iterations", "-s", "--size"),
+	"find":     ruleFind,
+	"dd":       ruleDD,
+	"git":      subcommandRule("git", "publishes commits to a remote repository; ask the user to push", "push"),
+	"docker":   subcommandRule("docker", "starts processes with access to the host", "run", "exec"),
+	"apt":      subcommandRule("apt", "changes system packages", "install", "remove", "purge"),
+	"apt-get":  subcommandRule("apt-get", "changes system packages", "install", "remove", "purge"),
+	"yum":      subcommandRule("yum", "changes system packages", "install", "remove", "erase"),
+	"dnf":      subcommandRule("dnf", "changes system packages", "install", "remove", "erase"),
+	"npm":      ruleGlobalInstall,
+	"pip":      rulePipUser,
+	"pip3":     rulePipUser,
+	"kill":     ruleKill,
+	"chmod":    ruleChmod,
+}
+
+// shells run the script given with -c.
+var shells = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "ash": true,
+}
+
+// interpreters run a program read from stdin when given no script.
+var interpreters = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "ash": true, "fish": true,
+	"python": true, "python2": true, "python3": true, "perl": true, "ruby": true,
+	"node": true, "php": true, "lua": true,
+}
+
+// wrappers run the command that follows their own options.
+var wrappers = map[string]bool{
+	"env": true, "nice": true, "nohup": true, "timeout": true, "time": true,
+	"command": true, "exec": true, "xargs": true, "stdbuf": true, "setsid": true,
+	"ionice": true, "builtin": true, "busybox": true, "toybox": true,
+}
+
+// removers delete the files they are given, see find -exec.
+var removers = map[string]bool{"rm": true, "rmdir": true, "unlink": true, "shred": true}
+
+// pathlessCommands do not open files named by their arguments, so those
+// may be computed at run time even when paths are checked.
+var pathlessCommands = map[string]bool{
+	"echo": true, "printf": true, "test": true, "[": true, "expr": true, "sleep": true,
+	"seq": true, "exit": true, "return": true, "export": true, "kill": true, "wait": true,
+	"shift": true, "true": true, "false": true, "read": true,
+}
+
+// systemDirs and everything beneath them are protected from rm, mv,
+// truncate, shred and redirections whether or not paths are checked
+// against the workspace.
+var systemDirs = []string{
+	"/bin", "/boot", "/dev", "/etc", "/lib", "/lib32", "/lib64", "/libx32", "/opt",
+	"/proc", "/root", "/sbin", "/snap", "/srv", "/sys", "/usr", "/var",
+}
+
+// rootDirs are protected themselves, but not what they contain.
+var rootDirs = map[string]bool{"/": true, "/home": true, "/mnt": true, "/media": true, "/tmp": true}
+
+// safeDevices may be read and written from anywhere.
+var safeDevices = map[string]bool{
+	"/dev/null": true, "/dev/zero": true, "/dev/random": true, "/dev/urandom": true,
+	"/dev/stdin": true, "/dev/stdout": true, "/dev/stderr": true, "/dev/tty": true,
+}
+
+// maxPolicyDepth bounds nested sh -c and eval scripts.
+const maxPolicyDepth = 4
+
+func newCommandPolicy(builtin bool, allowed, denied []string) *commandPolicy {
+	p := &commandPolicy{builtin: builtin, allowed: map[string]bool{}, denied: map[string]string{}}
+	for _, name := range allowed {
+		p.allowed[name] = true
+	}
+	for _, name := range denied {
+		p.denied[name] = "is denied by configuration"
+	}
+	return p
+}
+
+// check parses command and returns an explanation when it may not run.
+// With checkPaths, arguments and redirections must stay inside cwd.
+func (p *commandPolicy) check(command, cwd string, checkPaths bool) error {
+	abs, err := filepath.Abs(cwd)
+	if err != nil {
+		return err
+	}
+	c := &policyCheck{policy: p, cwd: abs, dir: abs, checkPaths: checkPaths}
+	return c.script(command, 0)
+}
+
+// policyArg is one word of a command. Words with expansions other than
+// ~ and $HOME are not literal and keep their source text as value.
+type policyArg struct {
+	value   string
+	literal bool
+}
+
+// policyCheck follows cd through the command in source order: dir is the
+// directory relative paths resolve against, and dirUnknown is set once it
+// was changed to a directory computed at run time.
+type policyCheck struct {
+	policy     *commandPolicy
+	cwd        string
+	dir        string
+	dirUnknown bool
+	checkPaths bool
+}
+
+func (c *policyCheck) script(src string, depth int) error {
+	if depth > maxPolicyDepth {
+		return fmt.Errorf("shell scripts are nested more than %d levels deep", maxPolicyDepth)
+	}
+	file, err := syntax.NewParser().Parse(strings.NewReader(src), "")
+	if err != nil {
+		return fmt.Errorf("cannot parse command: %v", err)
+	}
+
+	var result error
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if result != nil {
+			return false
+		}
+		switch n := node.(type) {
+		case *syntax.CallExpr:
+			if len(n.Args) > 0 {
+				args := make([]policyArg, len(n.Args))
+				for i, w := range n.Args {
+					args[i] = wordArg(w)
+				}
+				result = c.call(args, depth)
+			}
+		case *syntax.Redirect:
+			result = c.redirect(n)
+		case *syntax.BinaryCmd:
+			if n.Op == syntax.Pipe || n.Op == syntax.PipeAll {
+				result = c.pipe(n.Y)
+			}
+		case *syntax.FuncDecl:
+			result = c.funcDecl(n)
+		}
+		return result == nil
+	})
+	return result
+}
+
+// call checks one simple command, after unwrapping env, timeout and
+// similar wrappers.
+func (c *policyCheck) call(args []policyArg, depth int) error {
+	// xargs adds arguments read from stdin, which cannot be checked
+	fromStdin := false
+	for len(args) > 0 {
+		if !args[0].literal {
+			return fmt.Errorf("the command name %s is computed at run time and cannot be checked; write it out literally", args[0].value)
+		}
+		name := filepath.Base(args[0].value)
+		if !wrappers[name] {
+			break
+		}
+		fromStdin = fromStdin || name == "xargs"
+		args = unwrap(name, args[1:])
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	name := filepath.Base(args[0].value)
+	rest := args[1:]
+
+	if name == "cd" || name == "pushd" || name == "popd" {
+		defer c.chdir(name, rest)
+	}
+
+	if fromStdin && c.policy.builtin && removers[name] {
+		return fmt.Errorf("`xargs %s` deletes paths read from stdin, which cannot be checked; name the paths to delete", name)
+	}
+
+	if len(c.policy.allowed) > 0 && !c.policy.allowed[name] {
+		return fmt.Errorf("`%s` is not one of the allowed commands", name)
+	}
+	if reason, ok := c.policy.denied[name]; ok {
+		return fmt.Errorf("`%s` %s", name, reason)
+	}
+	if c.policy.builtin {
+		reason, ok := deniedCommands[name]
+		if !ok && strings.HasPrefix(name, "mkfs.") {
+			reason, ok = deniedCommands["mkfs"], true
+		}
+		if ok {
+			return fmt.Errorf("`%s` %s", name, reason)
+		}
+		if rule := argumentRules[name]; rule != nil {
+			if reason := rule(c, rest); reason != "" {
+				return fmt.Errorf("%s", reason)
+			}
+		}
+	}
+	if name == "find" {
+		if err := c.findExec(rest, depth); err != nil {
+			return err
+		}
+	}
+
+	if shells[name] {
+		if script, ok := shellScript(rest); ok {
+			if !script.literal {
+				return fmt.Errorf("the script passed to `%s -c` is computed at run time and cannot be checked", name)
+			}
+			return c.script(script.value, depth+1)
+		}
+	}
+	if name == "eval" {
+		parts := make([]string, len(rest))
+		for i, arg := range rest {
+			if !arg.literal {
+				return fmt.Errorf("the arguments of `eval` are computed at run time and cannot be checked")
+			}
+			parts[i] = arg.value
+		}
+		return c.script(strings.Join(parts, " "), depth+1)
+	}
+
+	if c.checkPaths {
+		for _, arg := range rest {
+			if !arg.literal {
+				if pathlessCommands[name] {
+					continue
+				}
+				return fmt.Errorf("`%s` argument %s is computed at run time and cannot be checked against the workspace; write the path out literally", name, arg.value)
+			}
+			if p, ok := c.pathArg(arg.value); ok && c.outside(p) {
+				return fmt.Errorf("`%s` accesses %s, outside the workspace", name, p)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *policyCheck) redirect(r *syntax.Redirect) error {
+	var write bool
+	switch r.Op {
+	case syntax.RdrOut, syntax.AppOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll, syntax.RdrInOut:
+		write = true
+	case syntax.RdrIn:
+	default:
+		// Heredocs and file descriptor duplication
+		return nil
+	}
+	if r.Word == nil {
+		return nil
+	}
+	arg := wordArg(r.Word)
+	if !arg.literal {
+		if c.checkPaths {
+			return fmt.Errorf("the redirection target %s is computed at run time and cannot be checked against the workspace; write the path out literally", arg.value)
+		}
+		return nil
+	}
+	p := c.resolve(arg.value)
+	if write && strings.HasPrefix(p, "/dev/") && !isSafeDevice(p) && c.policy.builtin {
+		return fmt.Errorf("the redirection writes to the device %s", p)
+	}
+	if write && c.policy.builtin && protectedPath(p) {
+		return fmt.Errorf("the redirection writes to %s, a system path", p)
+	}
+	if c.checkPaths && c.outside(p) {
+		if write {
+			return fmt.Errorf("the redirection writes to %s, outside the workspace", p)
+		}
+		return fmt.Errorf("the redirection reads %s, outside the workspace", p)
+	}
+	return nil
+}
+
+// pipe rejects pipes into an interpreter that reads its program from
+// stdin, such as curl ... | sh, also when it runs in a subshell or block
+// that inherits the pipe, as in curl ... | (sh).
+func (c *policyCheck) pipe(stmt *syntax.Stmt) error {
+	if !c.policy.builtin || stmt == nil {
+		return nil
+	}
+	var call *syntax.CallExpr
+	switch cmd := stmt.Cmd.(type) {
+	case *syntax.CallExpr:
+		call = cmd
+	case *syntax.Subshell:
+		return c.pipeStmts(cmd.Stmts)
+	case *syntax.Block:
+		return c.pipeStmts(cmd.Stmts)
+	case *syntax.BinaryCmd:
+		return c.pipeStmts([]*syntax.Stmt{cmd.X, cmd.Y})
+	}
+	if call == nil || len(call.Args) == 0 {
+		return nil
+	}
+	args := make([]policyArg, len(call.Args))
+	for i, w := range call.Args {
+		args[i] = wordArg(w)
+	}
+	for len(args) > 0 && args[0].literal && wrappers[filepath.Base(args[0].value)] {
+		args = unwrap(filepath.Base(args[0].value), args[1:])
+	}
+	if len(args) == 0 || !args[0].literal {
+		return nil
+	}
+	name := filepath.Base(args[0].value)
+	if !interpreters[name] {
+		return nil
+	}
+	for _, arg := range args[1:] {
+		if arg.value == "-" || arg.value == "-s" {
+			break
+		}
+		if !strings.HasPrefix(arg.value, "-") {
+			return nil
+		}
+	}
+	return fmt.Errorf("piping into `%s` runs code that is not part of the command; save it to a file and review it first", name)
+}
+
+func (c *policyCheck) pipeStmts(stmts []*syntax.Stmt) error {
+	for _, stmt := range stmts {
+		if err := c.pipe(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// funcDecl rejects functions that call themselves, as in :(){ :|:& };:.
+func (c *policyCheck) funcDecl(fn *syntax.FuncDecl) error {
+	if !c.policy.builtin || fn.Name == nil {
+		return nil
+	}
+	recursive := false
+	syntax.Walk(fn.Body, func(node syntax.Node) bool {
+		if call, ok := node.(*syntax.CallExpr); ok && len(call.Args) > 0 {
+			if arg := wordArg(call.Args[0]); arg.literal && arg.value == fn.Name.Value {
+				recursive = true
+			}
+		}
+		return !recursive
+	})
+	if recursive {
+		return fmt.Errorf("the function `%s` calls itself, which can exhaust the machine's processes", fn.Name.Value)
+	}
+	return nil
+}
+
+// findExec checks the commands run by find -exec and -ok.
+func (c *policyCheck) findExec(args []policyArg, depth int) error {
+	for i := 0; i < len(args); i++ {
+		switch args[i].value {
+		case "-exec", "-execdir", "-ok", "-okdir":
+		default:
+			continue
+		}
+		j := i + 1
+		for j < len(args) && args[j].value != ";" && args[j].value != `\;` && args[j].value != "+" {
+			j++
+		}
+		if err := c.call(args[i+1:j], depth); err != nil {
+			return err
+		}
+		i = j
+	}
+	return nil
+}
+
+// chdir follows cd, pushd and popd to the directory they change to.
+func (c *policyCheck) chdir(name string, args []policyArg) {
+	var target *policyArg
+	for i, arg := range args {
+		if arg.literal && strings.HasPrefix(arg.value, "-") && arg.value != "-" {
+			continue
+		}
+		target = &args[i]
+		break
+	}
+	switch {
+	case name == "popd":
+		c.dirUnknown = true
+	case target == nil:
+		c.dir, c.dirUnknown = config.ExpandHome("~"), false
+	case !target.literal || target.value == "-":
+		c.dirUnknown = true
+	case filepath.IsAbs(config.ExpandHome(target.value)):
+		c.dir, c.dirUnknown = c.resolve(target.value), false
+	default:
+		c.dir = c.resolve(target.value)
+	}
+}
+
+// resolve makes p absolute relative to the current directory.
+func (c *policyCheck) resolve(p string) string {
+	p = config.ExpandHome(p)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(c.dir, p)
+	}
+	return filepath.Clean(p)
+}
+
+// relativeUnknown reports whether p is relative to a directory that was
+// computed at run time.
+func (c *policyCheck) relativeUnknown(p string) bool {
+	return c.dirUnknown && !filepath.IsAbs(config.ExpandHome(p))
+}
+
+// destructiveTarget explains why command may not change target, or
+// returns "". verb completes "`command` ... target".
+func (c *policyCheck) destructiveTarget(command, verb string, target policyArg) string {
+	if !target.literal {
+		return ""
+	}
+	if c.relativeUnknown(target.value) {
+		return fmt.Sprintf("`%s` target %s is relative to a directory changed at run time and cannot be checked", command, target.value)
+	}
+	if p := c.resolve(target.value); protectedPath(p) {
+		return fmt.Sprintf("`%s` %s %s, a system path", command, verb, p)
+	}
+	return ""
+}
+
+// outside reports whether the resolved path p is outside the working
+// directory.
+func (c *policyCheck) outside(p string) bool {
+	if isSafeDevice(p) {
+		return false
+	}
+	rel, err := filepath.Rel(c.cwd, p)
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// pathArg returns the path named by an argument such as /etc/passwd,
+// ../x, ~/.ssh or --file=/etc/x.
+func (c *policyCheck) pathArg(arg string) (string, bool) {
+	if i := strings.Index(arg, "="); i >= 0 {
+		arg = arg[i+1:]
+	}
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, "~") || arg == ".." ||
+		strings.HasPrefix(arg, "../") || strings.Contains(arg, "/../") || strings.HasSuffix(arg, "/..") {
+		return c.resolve(arg), true
+	}
+	return "", false
+}
+
+func ruleRemove(c *policyCheck, args []policyArg) string {
+	recursive, force := false, false
+	var targets []policyArg
+	options := true
+	for _, arg := range args {
+		switch {
+		case options && arg.value == "--":
+			options = false
+		case options && arg.value == "--recursive":
+			recursive = true
+		case options && arg.value == "--force":
+			force = true
+		case options && strings.HasPrefix(arg.value, "-") && !strings.HasPrefix(arg.value, "--"):
+			if strings.ContainsAny(arg.value, "rR") {
+				recursive = true
+			}
+			if strings.Contains(arg.value, "f") {
+				force = true
+			}
+		case options && strings.HasPrefix(arg.value, "--"):
+		default:
+			targets = append(targets, arg)
+		}
+	}
+	if (recursive || force) && len(targets) == 0 {
+		// Only useful with targets added later, e.g. by a wrapper
+		return "`rm` without targets cannot be checked; name the paths to delete"
+	}
+	if !recursive {
+		for _, target := range targets {
+			if reason := c.destructiveTarget("rm", "deletes", target); reason != "" {
+				return reason
+			}
+		}
+		return ""
+	}
+	for _, target := range targets {
+		if !target.literal {
+			return fmt.Sprintf("`rm -r` target %s is computed at run time and cannot be checked", target.value)
+		}
+		if c.relativeUnknown(target.value) {
+			return fmt.Sprintf("`rm -r` target %s is relative to a directory changed at run time and cannot be checked", target.value)
+		}
+		p := c.resolve(target.value)
+		if p == c.cwd {
+			return fmt.Sprintf("`rm -r %s` would delete the whole working directory", target.value)
+		}
+		if c.outside(p) {
+			return fmt.Sprintf("`rm -r` would delete %s, outside the workspace", p)
+		}
+	}
+	return ""
+}
+
+func ruleFind(c *policyCheck, args []policyArg) string {
+	action := ""
+	for i, arg := range args {
+		switch arg.value {
+		case "-delete":
+			action = "-delete"
+		case "-exec", "-execdir", "-ok", "-okdir":
+			if i+1 < len(args) && removers[filepath.Base(args[i+1].value)] {
+				action = arg.value + " " + args[i+1].value
+			}
+		}
+	}
+	if action == "" {
+		return ""
+	}
+	for _, arg := range args {
+		if arg.value == "-H" || arg.value == "-L" || arg.value == "-P" {
+			continue
+		}
+		if strings.HasPrefix(arg.value, "-") || arg.value == "(" || arg.value == "!" {
+			break
+		}
+		if !arg.literal {
+			return fmt.Sprintf("`find %s` start point %s is computed at run time and cannot be checked", action, arg.value)
+		}
+		if c.relativeUnknown(arg.value) {
+			return fmt.Sprintf("`find %s` start point %s is relative to a directory changed at run time and cannot be checked", action, arg.value)
+		}
+		if p := c.resolve(arg.value); c.outside(p) {
+			return fmt.Sprintf("`find %s` would delete files under %s, outside the workspace", action, p)
+		}
+	}
+	return ""
+}
+
+func ruleDD(c *policyCheck, args []policyArg) string {
+	for _, arg := range args {
+		if out, ok := strings.CutPrefix(arg.value, "of="); ok {
+			if p := c.resolve(out); strings.HasPrefix(p, "/dev/") && !isSafeDevice(p) {
+				return fmt.Sprintf("`dd` writes to the device %s", p)
+			}
+		}
+	}
+	return ""
+}
+
+func ruleGlobalInstall(c *policyCheck, args []policyArg) string {
+	if firstOperand(args) == "install" && (hasArg(args, "-g") || hasArg(args, "--global")) {
+		return "`npm install -g` installs packages outside the workspace"
+	}
+	return ""
+}
+
+func rulePipUser(c *policyCheck, args []policyArg) string {
+	if firstOperand(args) == "install" && hasArg(args, "--user") {
+		return "`pip install --user` installs packages outside the workspace"
+	}
+	return ""
+}
+
+func ruleKill(c *policyCheck, args []policyArg) string {
+	for i, arg := range args {
+		if arg.value == "-9" || arg.value == "-KILL" || arg.value == "-SIGKILL" ||
+			(arg.value == "-s" && i+1 < len(args) && strings.TrimPrefix(args[i+1].value, "SIG") == "KILL") {
+			return "`kill -9` force-kills processes; use a plain `kill` instead"
+		}
+	}
+	return ""
+}
+
+func ruleChmod(c *policyCheck, args []policyArg) string {
+	mode := firstOperand(args)
+	if strings.Contains(mode, "+s") || (len(mode) == 4 && strings.Trim(mode, "01234567") == "" && mode[0] != '0') {
+		return fmt.Sprintf("`chmod %s` sets the setuid, setgid or sticky bit", mode)
+	}
+	return ""
+}
+
+// protectedRule rejects command when one of its operands is a system path.
+// valued lists the options whose value is not a target.
+func protectedRule(command, verb string, valued ...string) func(*policyCheck, []policyArg) string {
+	return func(c *policyCheck, args []policyArg) string {
+		options := true
+		for i := 0; i < len(args); i++ {
+			v := args[i].value
+			switch {
+			case options && v == "--":
+				options = false
+				continue
+			case options && strings.HasPrefix(v, "-") && v != "-":
+				for _, opt := range valued {
+					if v == opt {
+						i++
+					}
+				}
+				continue
+			}
+			if reason := c.destructiveTarget(command, verb, args[i]); reason != "" {
+				return reason
+			}
+		}
+		return ""
+	}
+}
+
+// subcommandRule rejects command when its first operand is one of
+// subcommands.
+func subcommandRule(command, reason string, subcommands ...string) func(*policyCheck, []policyArg) string {
+	return func(c *policyCheck, args []policyArg) string {
+		sub := firstOperand(args)
+		for _, s := range subcommands {
+			if sub == s {
+				return fmt.Sprintf("`%s %s` %s", command, sub, reason)
+			}
+		}
+		return ""
+	}
+}
+
+// firstOperand returns the first argument that is not an option, skipping
+// the values of -C and -c as used by git.
+func firstOperand(args []policyArg) string {
+	for i := 0; i < len(args); i++ {
+		v := args[i].value
+		if v == "-C" || v == "-c" {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(v, "-") {
+			return v
+		}
+	}
+	return ""
+}
+
+func hasArg(args []policyArg, value string) bool {
+	for _, arg := range args {
+		if arg.value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// shellScript returns the script of sh -c, given as the argument after
+// an option cluster containing c.
+func shellScript(args []policyArg) (policyArg, bool) {
+	for i, arg := range args {
+		if !strings.HasPrefix(arg.value, "-") || strings.HasPrefix(arg.value, "--") {
+			return policyArg{}, false
+		}
+		if strings.Contains(arg.value, "c") && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return policyArg{}, false
+}
+
+// unwrap returns the command run by a wrapper such as env or timeout.
+func unwrap(wrapper string, args []policyArg) []policyArg {
+	// Options of these wrappers that take a value
+	valued := map[string]bool{
+		"-n": true, "-s": true, "-k": true, "-u": true, "-c": true, "-p": true,
+		"-I": true, "-L": true, "-P": true, "-d": true, "-a": true, "-E": true,
+		"-i": true, "-o": true, "-e": true,
+	}
+	for len(args) > 0 {
+		v := args[0].value
+		switch {
+		case v == "--":
+			return args[1:]
+		case strings.HasPrefix(v, "-"):
+			if valued[v] && wrapper != "env" && wrapper != "command" && wrapper != "exec" {
+				args = args[1:]
+			}
+			args = args[1:]
+		case wrapper == "env" && strings.Contains(v, "="):
+			args = args[1:]
+		case wrapper == "timeout":
+			// The duration
+			return args[1:]
+		default:
+			return args
+		}
+	}
+	return args
+}
+
+func isSafeDevice(p string) bool {
+	return safeDevices[p] || strings.HasPrefix(p, "/dev/fd/")
+}
+
+// protectedPath reports whether the resolved path p is the root, the home
+// directory or a system directory, or lies in a system directory. A glob
+// such as /* is judged by the directory it expands in.
+func protectedPath(p string) bool {
+	if i := strings.IndexAny(p, "*?["); i >= 0 {
+		p = filepath.Dir(p[:i+1])
+	}
+	if isSafeDevice(p) {
+		return false
+	}
+	if rootDirs[p] || p == config.ExpandHome("~") {
+		return true
+	}
+	for _, dir := range systemDirs {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// wordArg converts w to a policyArg, expanding ~ and $HOME.
+func wordArg(w *syntax.Word) policyArg {
+	var sb strings.Builder
+	literal := true
+	for i, part := range w.Parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			v := unescape(p.Value, false)
+			if i == 0 && strings.HasPrefix(p.Value, "~") && (len(v) == 1 || v[1] == '/') {
+				v = config.ExpandHome(v)
+			}
+			sb.WriteString(v)
+		case *syntax.SglQuoted:
+			sb.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			for _, inner := range p.Parts {
+				switch ip := inner.(type) {
+				case *syntax.Lit:
+					sb.WriteString(unescape(ip.Value, true))
+				case *syntax.ParamExp:
+					if !homeParam(ip) {
+						literal = false
+					}
+					sb.WriteString(config.ExpandHome("~"))
+				default:
+					literal = false
+				}
+			}
+		case *syntax.ParamExp:
+			if !homeParam(p) {
+				literal = false
+			}
+			sb.WriteString(config.ExpandHome("~"))
+		default:
+			literal = false
+		}
+	}
+	if !literal {
+		var buf bytes.Buffer
+		syntax.NewPrinter().Print(&buf, w)
+		return policyArg{value: buf.String()}
+	}
+	return policyArg{value: sb.String(), literal: true}
+}
+
+// unescape removes the backslashes the shell removes from a literal, so
+// that \sudo or su\do is checked as sudo. Inside double quotes only $, `,
+// ", \ and newline are escaped.
+func unescape(v string, quoted bool) string {
+	if !strings.Contains(v, `\`) {
+		return v
+	}
+	var sb strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) {
+			next := v[i+1]
+			if next == '\n' {
+				i++
+				continue
+			}
+			if !quoted || strings.IndexByte("$`\"\\", next) >= 0 {
+				sb.WriteByte(next)
+				i++
+				continue
+			}
+		}
+		sb.WriteByte(v[i])
+	}
+	return sb.String()
+}
+
+func homeParam(p *syntax.ParamExp) bool {
+	return p.Param != nil && p.Param.Value == "HOME" && !p.Excl && !p.Length && !p.Width &&
+		p.Index == nil && p.Slice == nil && p.Repl == nil && p.Exp == nil
+}
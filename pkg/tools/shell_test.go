@@ -7,6 +7,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
 )
 
 // TestShellTool_Success verifies successful command execution
@@ -208,3 +210,79 @@ func TestShellTool_RestrictToWorkspace(t *testing.T) {
 		t.Errorf("Expected 'blocked' message for path traversal, got ForLLM: %s, ForUser: %s", result.ForLLM, result.ForUser)
 	}
 }
+
+// TestShellTool_SandboxRequired verifies commands are refused when the
+// sandbox is required but unavailable (test binaries never set it up)
+func TestShellTool_SandboxRequired(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Tools.Exec.Sandbox.Mode = SandboxRequired
+	tool := NewExecToolWithConfig(t.TempDir(), false, cfg)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"command": "echo hi"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "sandbox") {
+		t.Errorf("Expected sandbox error, got: %s", result.ForLLM)
+	}
+}
+
+// TestShellTool_SandboxedGuard verifies the command policy, including the
+// workspace path check, applies whether or not the sandbox is used
+func TestShellTool_SandboxedGuard(t *testing.T) {
+	tool := NewExecTool("", true)
+	if msg := tool.guardCommand("find / -delete", "/tmp"); !strings.Contains(msg, "blocked") {
+		t.Errorf("Policy should apply in the sandbox, got: %q", msg)
+	}
+	// The sandbox only stops writes, so reads outside the workspace are
+	// still refused
+	if msg := tool.guardCommand("cat /etc/hosts", "/tmp"); msg == "" {
+		t.Error("Paths should be checked in the sandbox")
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Tools.Exec.CustomDenyPatterns = []string{`\bdate\b`}
+	tool = NewExecToolWithConfig("", false, cfg)
+	if msg := tool.guardCommand("echo $(date)", "/tmp"); msg == "" {
+		t.Error("Custom patterns should apply in the sandbox")
+	}
+}
+
+// TestShellTool_GuardSystemPaths verifies system paths are protected with
+// and without the workspace restriction
+func TestShellTool_GuardSystemPaths(t *testing.T) {
+	for _, restrict := range []bool{false, true} {
+		tool := NewExecTool("", restrict)
+		for _, command := range []string{
+			`\rm -rf /`,
+			`\sudo ls`,
+			"cd / && rm -rf *",
+			"busybox rm -rf /",
+			"mv / /x",
+			"truncate -s0 /etc/passwd",
+		} {
+			if msg := tool.guardCommand(command, t.TempDir()); !strings.Contains(msg, "blocked") {
+				t.Errorf("restrict=%v: %q allowed", restrict, command)
+			}
+		}
+	}
+}
+
+// TestShellTool_SandboxProfiles verifies profile lookup
+func TestShellTool_SandboxProfiles(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Tools.Exec.Sandbox.Profiles = map[string]config.SandboxProfile{"strict": {MemoryMB: 128}}
+	cfg.Agents.Defaults.SandboxProfile = "strict"
+	tool := NewExecToolWithConfig("/work", false, cfg)
+
+	spec := tool.sandboxSpec("/work")
+	if spec.MemoryMB != 128 || spec.Network || spec.Workspace != "/work" {
+		t.Errorf("Expected the configured strict profile, got: %+v", spec)
+	}
+	if err := tool.SetSandboxProfile("missing"); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+	if err := tool.SetSandboxProfile(""); err != nil || !tool.sandboxProfile.Network || tool.sandboxProfile.MemoryMB != 2048 {
+		t.Errorf("Expected the built-in default profile with network, got: %+v, %v", tool.sandboxProfile, err)
+	}
+	if masked := tool.sandboxSpec("/work").Masked; len(masked) != 1 || filepath.Base(masked[0]) != ".picoclaw" {
+		t.Errorf("Expected ~/.picoclaw to be masked, got: %v", masked)
+	}
+}
@@ -0,0 +1,312 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// terminalKeys maps key names accepted by the send action to the bytes
+// an xterm sends for them.
+var terminalKeys = map[string]string{
+	"Enter":     "\r",
+	"Tab":       "\t",
+	"Escape":    "\x1b",
+	"Esc":       "\x1b",
+	"Backspace": "\x7f",
+	"Space":     " ",
+	"Up":        "\x1b[A",
+	"Down":      "\x1b[B",
+	"Right":     "\x1b[C",
+	"Left":      "\x1b[D",
+	"Home":      "\x1b[H",
+	"End":       "\x1b[F",
+	"PageUp":    "\x1b[5~",
+	"PageDown":  "\x1b[6~",
+	"Delete":    "\x1b[3~",
+	"F1":        "\x1bOP",
+	"F2":        "\x1bOQ",
+	"F3":        "\x1bOR",
+	"F4":        "\x1bOS",
+}
+
+const (
+	defaultTerminalCols = 120
+	defaultTerminalRows = 40
+	maxTerminalWait     = 60 * time.Second
+)
+
+// encodeKeys turns send keys into terminal input. Each key is a name from
+// terminalKeys, C-<letter> for a control character, or literal text.
+func encodeKeys(keys []string) string {
+	var sb strings.Builder
+	for _, key := range keys {
+		if seq, ok := terminalKeys[key]; ok {
+			sb.WriteString(seq)
+			continue
+		}
+		if len(key) == 3 && strings.HasPrefix(key, "C-") {
+			if c := key[2] | 0x20; c >= 'a' && c <= 'z' {
+				sb.WriteByte(c - 'a' + 1)
+				continue
+			}
+		}
+		sb.WriteString(key)
+	}
+	return sb.String()
+}
+
+// terminalScreen is the emulated display of a terminal.
+type terminalScreen interface {
+	// render returns the visible lines without trailing blanks.
+	render() string
+}
+
+// terminal returns terminal id of session.
+func (m *ProcessManager) terminal(session, id string) (*backgroundProcess, error) {
+	p, err := m.get(session, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.screen == nil {
+		return nil, fmt.Errorf("%s is not a terminal; use the process tool", id)
+	}
+	return p, nil
+}
+
+// Snapshot renders the screen of terminal id as plain text.
+func (m *ProcessManager) Snapshot(session, id string) (ProcessInfo, string, error) {
+	p, err := m.terminal(session, id)
+	if err != nil {
+		return ProcessInfo{}, "", err
+	}
+	return p.info(), p.screen.render(), nil
+}
+
+// WaitFor waits until the screen of terminal id matches pattern, the
+// command exits or timeout passes, and returns the last screen.
+func (m *ProcessManager) WaitFor(ctx context.Context, session, id string, pattern *regexp.Regexp, timeout time.Duration) (info ProcessInfo, screen string, matched bool, err error) {
+	p, err := m.terminal(session, id)
+	if err != nil {
+		return ProcessInfo{}, "", false, err
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		// Check the status first so a final screen is not missed
+		running := p.running()
+		screen = p.screen.render()
+		if pattern.MatchString(screen) {
+			return p.info(), screen, true, nil
+		}
+		if !running {
+			return p.info(), screen, false, nil
+		}
+		select {
+		case <-ctx.Done():
+			return p.info(), screen, false, ctx.Err()
+		case <-deadline.C:
+			return p.info(), screen, false, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// TerminalTool gives the agent interactive programs such as REPLs, top or
+// installers that prompt for input, on a pseudo-terminal. Commands go
+// through the same guard and sandbox as the exec tool.
+type TerminalTool struct {
+	manager  *ProcessManager
+	execTool *ExecTool
+	mu       sync.RWMutex
+	session  string
+}
+
+func NewTerminalTool(manager *ProcessManager, execTool *ExecTool) *TerminalTool {
+	return &TerminalTool{manager: manager, execTool: execTool}
+}
+
+func (t *TerminalTool) Name() string {
+	return "terminal"
+}
+
+func (t *TerminalTool) Description() string {
+	return "Run an interactive program (shell, REPL, top, installer prompts) in a terminal. Start it, send keys, take a snapshot of the screen as text, or wait until the screen matches a pattern. Use exec for one-shot commands."
+}
+
+func (t *TerminalTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"start", "send", "snapshot", "wait", "close"},
+				"description": "start a program, send keys, snapshot the screen, wait for a pattern on the screen, or close the terminal",
+			},
+			"command": map[string]interface{}{
+				"type":        "string",
+				"description": "Program to run, e.g. 'bash' or 'python3' (for start)",
+			},
+			"working_dir": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional working directory (for start)",
+			},
+			"cols": map[string]interface{}{
+				"type":        "integer",
+				"description": "Terminal width, default 120 (for start)",
+			},
+			"rows": map[string]interface{}{
+				"type":        "integer",
+				"description": "Terminal height, default 40 (for start)",
+			},
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "Terminal ID returned by start",
+			},
+			"keys": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Keys to send in order: literal text, a key name (Enter, Tab, Escape, Backspace, Space, Up, Down, Left, Right, Home, End, PageUp, PageDown, Delete, F1-F4) or C-<letter> for Ctrl, e.g. [\"ls -la\", \"Enter\"] or [\"C-c\"] (for send)",
+			},
+			"pattern": map[string]interface{}{
+				"type":        "string",
+				"description": "Regular expression to wait for on the screen (for wait)",
+			},
+			"timeout": map[string]interface{}{
+				"type":        "integer",
+				"description": "Seconds to wait, default 10, at most 60 (for wait)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *TerminalTool) SetContext(channel, chatID string) {
+	session := ProcessSession(channel, chatID)
+	t.mu.Lock()
+	t.session = session
+	t.mu.Unlock()
+	t.manager.Touch(session)
+}
+
+func (t *TerminalTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	t.mu.RLock()
+	session := t.session
+	t.mu.RUnlock()
+	if session == "" {
+		return ErrorResult("no session context (channel/chat_id not set). Use this tool in an active conversation.")
+	}
+
+	action, _ := args["action"].(string)
+	id, _ := args["id"].(string)
+	switch action {
+	case "start":
+		return t.start(session, args)
+	case "send":
+		return t.send(session, id, args)
+	case "snapshot":
+		info, screen, err := t.manager.Snapshot(session, id)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		return SilentResult(formatScreen(info, screen))
+	case "wait":
+		return t.wait(ctx, session, id, args)
+	case "close":
+		if _, err := t.manager.terminal(session, id); err != nil {
+			return ErrorResult(err.Error())
+		}
+		info, err := t.manager.Kill(session, id)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		return SilentResult(fmt.Sprintf("Closed terminal %s: %s", info.ID, info.Command))
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *TerminalTool) start(session string, args map[string]interface{}) *ToolResult {
+	command, _ := args["command"].(string)
+	if command == "" {
+		return ErrorResult("command is required for start")
+	}
+	cols, rows := defaultTerminalCols, defaultTerminalRows
+	if v, ok := args["cols"].(float64); ok && v >= 20 && v <= 500 {
+		cols = int(v)
+	}
+	if v, ok := args["rows"].(float64); ok && v >= 5 && v <= 200 {
+		rows = int(v)
+	}
+
+	// Terminals outlive the tool call, so they get their own context
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd, err := t.execTool.prepare(ctx, command, t.execTool.workDir(args))
+	if err != nil {
+		cancel()
+		return ErrorResult(err.Error())
+	}
+	info, err := t.manager.StartTerminal(session, command, cmd, cancel, cols, rows)
+	if err != nil {
+		cancel()
+		return ErrorResult(err.Error())
+	}
+	return SilentResult(fmt.Sprintf("Started terminal %s (%dx%d). Use wait or snapshot to see the screen.", info.ID, cols, rows))
+}
+
+func (t *TerminalTool) send(session, id string, args map[string]interface{}) *ToolResult {
+	raw, _ := args["keys"].([]interface{})
+	keys := make([]string, 0, len(raw))
+	for _, k := range raw {
+		if s, ok := k.(string); ok {
+			keys = append(keys, s)
+		}
+	}
+	if len(keys) == 0 {
+		return ErrorResult("keys is required for send")
+	}
+	if _, err := t.manager.terminal(session, id); err != nil {
+		return ErrorResult(err.Error())
+	}
+	if err := t.manager.Write(session, id, encodeKeys(keys), false); err != nil {
+		return ErrorResult(err.Error())
+	}
+	return SilentResult(fmt.Sprintf("Sent %d keys to terminal %s", len(keys), id))
+}
+
+func (t *TerminalTool) wait(ctx context.Context, session, id string, args map[string]interface{}) *ToolResult {
+	expr, _ := args["pattern"].(string)
+	if expr == "" {
+		return ErrorResult("pattern is required for wait")
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("invalid pattern: %v", err))
+	}
+	timeout := 10 * time.Second
+	if v, ok := args["timeout"].(float64); ok && v > 0 {
+		timeout = time.Duration(v) * time.Second
+	}
+	if timeout > maxTerminalWait {
+		timeout = maxTerminalWait
+	}
+
+	info, screen, matched, err := t.manager.WaitFor(ctx, session, id, pattern, timeout)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	output := formatScreen(info, screen)
+	if !matched {
+		output = fmt.Sprintf("Pattern %q not found", expr) + "\n" + output
+	}
+	return SilentResult(output)
+}
+
+func formatScreen(info ProcessInfo, screen string) string {
+	return fmt.Sprintf("Terminal %s: %s\n%s", info.ID, info.Status(), cleanOutput(screen))
+}
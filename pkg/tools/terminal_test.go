@@ -0,0 +1,64 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEncodeKeys(t *testing.T) {
+	got := encodeKeys([]string{"ls -la", "Enter", "C-c", "Up", "Tab"})
+	if want := "ls -la\r\x03\x1b[A\t"; got != want {
+		t.Errorf("encodeKeys() = %q, want %q", got, want)
+	}
+}
+
+func TestTerminalTool_Interactive(t *testing.T) {
+	manager := NewProcessManager(nil)
+	t.Cleanup(manager.KillAll)
+	tool := NewTerminalTool(manager, NewExecTool(t.TempDir(), false))
+	tool.SetContext("cli", "direct")
+	ctx := context.Background()
+	run := func(args map[string]interface{}) string {
+		t.Helper()
+		result := tool.Execute(ctx, args)
+		if result.IsError {
+			t.Fatalf("%v: %s", args["action"], result.ForLLM)
+		}
+		return result.ForLLM
+	}
+
+	out := run(map[string]interface{}{"action": "start", "command": "sh", "cols": float64(40), "rows": float64(10)})
+	if !strings.Contains(out, "t1") {
+		t.Fatalf("start = %q", out)
+	}
+	// The tty makes read echo input and reports itself as a terminal
+	run(map[string]interface{}{"action": "send", "id": "t1", "keys": []interface{}{"test -t 0 && printf '%s? ' name && read name && echo hi $name", "Enter"}})
+	out = run(map[string]interface{}{"action": "wait", "id": "t1", "pattern": `name\?`, "timeout": float64(5)})
+	if strings.Contains(out, "not found") {
+		t.Fatalf("prompt not shown:\n%s", out)
+	}
+	run(map[string]interface{}{"action": "send", "id": "t1", "keys": []interface{}{"bob", "Enter"}})
+	out = run(map[string]interface{}{"action": "wait", "id": "t1", "pattern": "hi bob", "timeout": float64(5)})
+	if strings.Contains(out, "not found") {
+		t.Fatalf("reply not shown:\n%s", out)
+	}
+
+	// Cursor movement is applied to the screen rather than returned raw
+	run(map[string]interface{}{"action": "send", "id": "t1", "keys": []interface{}{`clear; printf 'abc\033[2Dx\n'`, "Enter"}})
+	out = run(map[string]interface{}{"action": "wait", "id": "t1", "pattern": "(?m)^axc$", "timeout": float64(5)})
+	if strings.Contains(out, "not found") || strings.Contains(out, "\x1b") {
+		t.Fatalf("screen not emulated:\n%q", out)
+	}
+
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "wait", "id": "t1", "pattern": "never", "timeout": float64(1)}); !strings.Contains(result.ForLLM, "not found") {
+		t.Errorf("wait without match = %q", result.ForLLM)
+	}
+
+	run(map[string]interface{}{"action": "close", "id": "t1"})
+	if list := manager.List(ProcessSession("cli", "direct")); len(list) != 0 {
+		t.Errorf("closed terminal still listed: %+v", list)
+	}
+}
@@ -0,0 +1,114 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/hinshun/vt10x"
+)
+
+// StartTerminal runs cmd for session on a pseudo-terminal of cols by rows,
+// whose screen is kept by a VT100 emulator. cmd must have been created
+// with ctx, which cancel cancels.
+func (m *ProcessManager) StartTerminal(session, command string, cmd *exec.Cmd, cancel context.CancelFunc, cols, rows int) (ProcessInfo, error) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, "TERM=xterm")
+
+	p := &backgroundProcess{
+		session: session,
+		command: command,
+		cmd:     cmd,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	var master *os.File
+	var screen vtScreen
+	start := func() error {
+		var err error
+		master, err = pty.StartWithSize(cmd, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+		if errors.Is(err, pty.ErrUnsupported) {
+			return fmt.Errorf("terminals are not supported on this platform")
+		}
+		if err != nil {
+			return err
+		}
+		// The emulator answers terminal queries such as the cursor position
+		screen = vtScreen{vt10x.New(vt10x.WithWriter(master), vt10x.WithSize(cols, rows))}
+		p.screen = screen
+		p.stdin = master
+		return nil
+	}
+	if err := m.launch(p, "t", start); err != nil {
+		return ProcessInfo{}, err
+	}
+
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		copyToScreen(screen, master)
+	}()
+	go func() {
+		err := cmd.Wait()
+		// Let the reader drain what the command wrote before it exited
+		select {
+		case <-readerDone:
+		case <-time.After(time.Second):
+		}
+		master.Close()
+		p.finish(err)
+	}()
+	return p.info(), nil
+}
+
+// copyToScreen feeds terminal output to screen until r fails. The
+// emulator consumes only whole UTF-8 sequences, so the rest is kept for
+// the next read.
+func copyToScreen(screen vtScreen, r *os.File) {
+	buf := make([]byte, 4096)
+	var pending []byte
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			pending = append(pending, buf[:n]...)
+			written, _ := screen.Write(pending)
+			pending = append(pending[:0], pending[written:]...)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// vtScreen renders the screen of a vt10x emulator.
+type vtScreen struct {
+	vt10x.Terminal
+}
+
+func (s vtScreen) render() string {
+	s.Lock()
+	defer s.Unlock()
+	cols, rows := s.Size()
+	lines := make([]string, rows)
+	line := make([]rune, cols)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			c := s.Cell(x, y).Char
+			if c == 0 {
+				c = ' '
+			}
+			line[x] = c
+		}
+		lines[y] = strings.TrimRight(string(line), " ")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
@@ -0,0 +1,12 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// StartTerminal is a stub for Windows, which has no pseudo-terminals.
+func (m *ProcessManager) StartTerminal(session, command string, cmd *exec.Cmd, cancel context.CancelFunc, cols, rows int) (ProcessInfo, error) {
+	return ProcessInfo{}, fmt.Errorf("terminals are not supported on Windows")
+}
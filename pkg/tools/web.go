@@ -1,15 +1,26 @@
 package tools
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"golang.org/x/net/html/charset"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/netguard"
 )
 
 const (
@@ -241,9 +252,79 @@ func (p *PerplexitySearchProvider) Search(ctx context.Context, query string, cou
 	return fmt.Sprintf("Results for: %s (via Perplexity)\n%s", query, searchResp.Choices[0].Message.Content), nil
 }
 
+// SearXNGSearchProvider queries a SearXNG instance through its JSON API,
+// which has to be enabled with "json" in search.formats of its settings.yml.
+type SearXNGSearchProvider struct {
+	baseURL string
+}
+
+func (p *SearXNGSearchProvider) Search(ctx context.Context, query string, count int) (string, error) {
+	searchURL := fmt.Sprintf("%s/search?q=%s&format=json", strings.TrimRight(p.baseURL, "/"), url.QueryEscape(query))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusForbidden {
+		return "", fmt.Errorf("SearXNG refused the JSON format (HTTP 403); add \"json\" to search.formats in its settings.yml")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("SearXNG error (HTTP %d): %s", resp.StatusCode, string(body))
+	}
+
+	var searchResp struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+
+	if err := json.Unmarshal(body, &searchResp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	results := searchResp.Results
+	if len(results) == 0 {
+		return fmt.Sprintf("No results for: %s", query), nil
+	}
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("Results for: %s (via SearXNG)", query))
+	for i, item := range results {
+		if i >= count {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s\n   %s", i+1, item.Title, item.URL))
+		if content := strings.TrimSpace(item.Content); content != "" {
+			lines = append(lines, fmt.Sprintf("   %s", content))
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
 type WebSearchTool struct {
-	provider   SearchProvider
-	maxResults int
+	provider     SearchProvider
+	providerName string
+	maxResults   int
+	cache        *searchCache
 }
 
 type WebSearchToolOptions struct {
@@ -255,25 +336,42 @@ type WebSearchToolOptions struct {
 	PerplexityAPIKey     string
 	PerplexityMaxResults int
 	PerplexityEnabled    bool
+	SearXNGBaseURL       string
+	SearXNGMaxResults    int
+	SearXNGEnabled       bool
+	// CachePath is the file results are cached in for CacheTTL; caching is
+	// off when either is unset.
+	CachePath string
+	CacheTTL  time.Duration
 }
 
 func NewWebSearchTool(opts WebSearchToolOptions) *WebSearchTool {
 	var provider SearchProvider
+	var providerName string
 	maxResults := 5
 
-	// Priority: Perplexity > Brave > DuckDuckGo
+	// Priority: Perplexity > Brave > SearXNG > DuckDuckGo
 	if opts.PerplexityEnabled && opts.PerplexityAPIKey != "" {
 		provider = &PerplexitySearchProvider{apiKey: opts.PerplexityAPIKey}
+		providerName = "perplexity"
 		if opts.PerplexityMaxResults > 0 {
 			maxResults = opts.PerplexityMaxResults
 		}
 	} else if opts.BraveEnabled && opts.BraveAPIKey != "" {
 		provider = &BraveSearchProvider{apiKey: opts.BraveAPIKey}
+		providerName = "brave"
 		if opts.BraveMaxResults > 0 {
 			maxResults = opts.BraveMaxResults
 		}
+	} else if opts.SearXNGEnabled && opts.SearXNGBaseURL != "" {
+		provider = &SearXNGSearchProvider{baseURL: opts.SearXNGBaseURL}
+		providerName = "searxng"
+		if opts.SearXNGMaxResults > 0 {
+			maxResults = opts.SearXNGMaxResults
+		}
 	} else if opts.DuckDuckGoEnabled {
 		provider = &DuckDuckGoSearchProvider{}
+		providerName = "duckduckgo"
 		if opts.DuckDuckGoMaxResults > 0 {
 			maxResults = opts.DuckDuckGoMaxResults
 		}
@@ -281,10 +379,15 @@ func NewWebSearchTool(opts WebSearchToolOptions) *WebSearchTool {
 		return nil
 	}
 
-	return &WebSearchTool{
-		provider:   provider,
-		maxResults: maxResults,
+	tool := &WebSearchTool{
+		provider:     provider,
+		providerName: providerName,
+		maxResults:   maxResults,
+	}
+	if opts.CachePath != "" && opts.CacheTTL > 0 {
+		tool.cache = openSearchCache(opts.CachePath, opts.CacheTTL)
 	}
+	return tool
 }
 
 func (t *WebSearchTool) Name() string {
@@ -327,11 +430,29 @@ func (t *WebSearchTool) Execute(ctx context.Context, args map[string]interface{}
 		}
 	}
 
+	var cacheKey string
+	if t.cache != nil {
+		cacheKey = searchCacheKey(t.providerName, query, count)
+		if result, ok := t.cache.get(cacheKey, time.Now()); ok {
+			logger.DebugCF("tool", "Web search answered from cache", map[string]interface{}{"query": query})
+			return &ToolResult{
+				ForLLM:  result,
+				ForUser: result,
+			}
+		}
+	}
+
 	result, err := t.provider.Search(ctx, query, count)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("search failed: %v", err))
 	}
 
+	if t.cache != nil {
+		if err := t.cache.put(cacheKey, result, time.Now()); err != nil {
+			logger.WarnCF("tool", "Failed to cache web search results", map[string]interface{}{"error": err.Error()})
+		}
+	}
+
 	return &ToolResult{
 		ForLLM:  result,
 		ForUser: result,
@@ -340,14 +461,18 @@ func (t *WebSearchTool) Execute(ctx context.Context, args map[string]interface{}
 
 type WebFetchTool struct {
 	maxChars int
+	client   *http.Client
 }
 
-func NewWebFetchTool(maxChars int) *WebFetchTool {
+// NewWebFetchTool creates a web_fetch tool that refuses to connect to
+// private, loopback and link-local addresses not allowed by network.
+func NewWebFetchTool(maxChars int, network config.NetworkConfig) *WebFetchTool {
 	if maxChars <= 0 {
 		maxChars = 50000
 	}
 	return &WebFetchTool{
 		maxChars: maxChars,
+		client:   netguard.NewClient(60*time.Second, network.AllowedHosts, network.UseProxy),
 	}
 }
 
@@ -356,7 +481,7 @@ func (t *WebFetchTool) Name() string {
 }
 
 func (t *WebFetchTool) Description() string {
-	return "Fetch a URL and extract readable content (HTML to text). Use this to get weather info, news, articles, or any web content."
+	return "Fetch a URL and extract readable content. HTML pages are reduced to their main content as Markdown with links and tables; JSON, plain text and PDF documents are returned as text. Use start_index to read long pages in parts. Use this to get weather info, news, articles, or any web content."
 }
 
 func (t *WebFetchTool) Parameters() map[string]interface{} {
@@ -372,6 +497,11 @@ func (t *WebFetchTool) Parameters() map[string]interface{} {
 				"description": "Maximum characters to extract",
 				"minimum":     100.0,
 			},
+			"start_index": map[string]interface{}{
+				"type":        "integer",
+				"description": "Character to start from, to read the rest of a truncated page",
+				"minimum":     0.0,
+			},
 		},
 		"required": []string{"url"},
 	}
@@ -402,6 +532,10 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{})
 			maxChars = int(mc)
 		}
 	}
+	startIndex := 0
+	if si, ok := args["start_index"].(float64); ok && si > 0 {
+		startIndex = int(si)
+	}
 
 	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	if err != nil {
@@ -410,38 +544,26 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{})
 
 	req.Header.Set("User-Agent", userAgent)
 
-	client := &http.Client{
-		Timeout: 60 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			IdleConnTimeout:     30 * time.Second,
-			DisableCompression:  false,
-			TLSHandshakeTimeout: 15 * time.Second,
-		},
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 5 {
-				return fmt.Errorf("stopped after 5 redirects")
-			}
-			return nil
-		},
+	resp, err := t.client.Do(req)
+	if errors.Is(err, netguard.ErrBlocked) {
+		return ErrorResult(fmt.Sprintf("request blocked: %v. Private, loopback and link-local addresses can only be fetched when listed in tools.network.allowed_hosts", err))
 	}
-
-	resp, err := client.Do(req)
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("request failed: %v", err))
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes))
 	if err != nil {
 		return ErrorResult(fmt.Sprintf("failed to read response: %v", err))
 	}
 
 	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
 
-	var text, extractor string
-
-	if strings.Contains(contentType, "application/json") {
+	var text, title, extractor string
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
 		var jsonData interface{}
 		if err := json.Unmarshal(body, &jsonData); err == nil {
 			formatted, _ := json.MarshalIndent(jsonData, "", "  ")
@@ -451,58 +573,116 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{})
 			text = string(body)
 			extractor = "raw"
 		}
-	} else if strings.Contains(contentType, "text/html") || len(body) > 0 &&
-		(strings.HasPrefix(string(body), "<!DOCTYPE") || strings.HasPrefix(strings.ToLower(string(body)), "<html")) {
-		text = t.extractText(string(body))
+	case mediaType == "application/pdf" || bytes.HasPrefix(body, []byte("%PDF-")):
+		text, err = pdfText(body)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to extract text from PDF: %v", err))
+		}
+		extractor = "pdf"
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml" || looksLikeHTML(body):
+		title, text = htmlToMarkdown(decodeCharset(body, contentType), resp.Request.URL)
+		extractor = "markdown"
+	case strings.HasPrefix(mediaType, "text/"):
+		text = decodeCharset(body, contentType)
 		extractor = "text"
-	} else {
+	case isBinary(body):
+		return ErrorResult(fmt.Sprintf("cannot extract text from %s content", mediaType))
+	default:
 		text = string(body)
 		extractor = "raw"
 	}
 
-	truncated := len(text) > maxChars
-	if truncated {
-		text = text[:maxChars]
+	// Indexes count characters, so pages never split inside one
+	runes := []rune(text)
+	total := len(runes)
+	if startIndex > 0 && startIndex >= total {
+		return ErrorResult(fmt.Sprintf("start_index %d is past the end of the content (%d characters)", startIndex, total))
 	}
+	end := min(startIndex+maxChars, total)
+	text = string(runes[startIndex:end])
+	truncated := end < total
 
 	result := map[string]interface{}{
-		"url":       urlStr,
-		"status":    resp.StatusCode,
-		"extractor": extractor,
-		"truncated": truncated,
-		"length":    len(text),
-		"text":      text,
+		"url":         urlStr,
+		"status":      resp.StatusCode,
+		"extractor":   extractor,
+		"truncated":   truncated,
+		"length":      utf8.RuneCountInString(text),
+		"text":        text,
+		"start_index": startIndex,
+		"total_chars": total,
+	}
+	if title != "" {
+		result["title"] = title
+	}
+	if truncated {
+		result["next_start_index"] = end
 	}
 
 	resultJSON, _ := json.MarshalIndent(result, "", "  ")
 
+	var llm strings.Builder
+	fmt.Fprintf(&llm, "Fetched %s (status %d, extractor: %s, characters %d-%d of %d)\n", urlStr, resp.StatusCode, extractor, startIndex, end, total)
+	if title != "" {
+		fmt.Fprintf(&llm, "Title: %s\n", title)
+	}
+	llm.WriteString("\n" + text)
+	if truncated {
+		fmt.Fprintf(&llm, "\n\n[Content truncated. Call web_fetch with start_index=%d to read more.]", end)
+	}
+
 	return &ToolResult{
-		ForLLM:  fmt.Sprintf("Fetched %d bytes from %s (extractor: %s, truncated: %v)", len(text), urlStr, extractor, truncated),
+		ForLLM:  llm.String(),
 		ForUser: string(resultJSON),
 	}
 }
 
-func (t *WebFetchTool) extractText(htmlContent string) string {
-	re := regexp.MustCompile(`<script[\s\S]*?</script>`)
-	result := re.ReplaceAllLiteralString(htmlContent, "")
-	re = regexp.MustCompile(`<style[\s\S]*?</style>`)
-	result = re.ReplaceAllLiteralString(result, "")
-	re = regexp.MustCompile(`<[^>]+>`)
-	result = re.ReplaceAllLiteralString(result, "")
-
-	result = strings.TrimSpace(result)
-
-	re = regexp.MustCompile(`\s+`)
-	result = re.ReplaceAllLiteralString(result, " ")
-
-	lines := strings.Split(result, "\n")
-	var cleanLines []string
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line != "" {
-			cleanLines = append(cleanLines, line)
-		}
+// maxFetchBytes caps the response body read by web_fetch.
+const maxFetchBytes = 10 << 20
+
+func looksLikeHTML(body []byte) bool {
+	head := strings.ToLower(strings.TrimSpace(string(body[:min(len(body), 512)])))
+	return strings.HasPrefix(head, "<!doctype html") || strings.HasPrefix(head, "<html")
+}
+
+// decodeCharset converts body to UTF-8 using the charset of the Content-Type
+// header or of the document itself.
+func decodeCharset(body []byte, contentType string) string {
+	r, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return string(body)
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return string(body)
 	}
+	return string(decoded)
+}
 
-	return strings.Join(cleanLines, "\n")
+// pdfText extracts the text of every page of a PDF document.
+func pdfText(data []byte) (text string, err error) {
+	// The PDF reader panics on some malformed documents
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed PDF: %v", r)
+		}
+	}()
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	var pages []string
+	for i := 1; i <= r.NumPage(); i++ {
+		pageText, err := r.Page(i).GetPlainText(nil)
+		if err != nil {
+			return "", fmt.Errorf("page %d: %w", i, err)
+		}
+		if pageText = strings.TrimSpace(pageText); pageText != "" {
+			pages = append(pages, pageText)
+		}
+	}
+	if len(pages) == 0 {
+		return "", fmt.Errorf("no text found; the document may contain only scanned images")
+	}
+	return strings.Join(pages, "\n\n"), nil
 }
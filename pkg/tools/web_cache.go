@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSearchCacheEntries caps the cache file; the oldest entries are dropped
+// first.
+const maxSearchCacheEntries = 500
+
+type searchCacheEntry struct {
+	Result  string    `json:"result"`
+	Created time.Time `json:"created"`
+}
+
+// searchCacheFile holds the entries of one cache file. Tools of every agent
+// share one instance per file so their writes do not overwrite each other.
+type searchCacheFile struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]searchCacheEntry
+}
+
+// searchCache keeps web_search results in a JSON file so that repeated
+// searches, from the same chat or from cron jobs, are answered without
+// calling the provider again. Each tool has its own TTL over the shared file.
+type searchCache struct {
+	*searchCacheFile
+	ttl time.Duration
+}
+
+var (
+	searchCachesMu sync.Mutex
+	searchCaches   = make(map[string]*searchCacheFile)
+)
+
+// openSearchCache returns a cache over the file at path whose entries expire
+// after ttl.
+func openSearchCache(path string, ttl time.Duration) *searchCache {
+	searchCachesMu.Lock()
+	defer searchCachesMu.Unlock()
+
+	f, ok := searchCaches[path]
+	if !ok {
+		f = &searchCacheFile{path: path, entries: make(map[string]searchCacheEntry)}
+		if data, err := os.ReadFile(path); err == nil {
+			json.Unmarshal(data, &f.entries)
+		}
+		searchCaches[path] = f
+	}
+	return &searchCache{searchCacheFile: f, ttl: ttl}
+}
+
+// searchCacheKey identifies a search independently of letter case and
+// spacing in the query.
+func searchCacheKey(provider, query string, count int) string {
+	query = strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	return fmt.Sprintf("%s|%d|%s", provider, count, query)
+}
+
+func (c *searchCache) get(key string, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || now.Sub(e.Created) > c.ttl {
+		return "", false
+	}
+	return e.Result, true
+}
+
+func (c *searchCache) put(key, result string, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = searchCacheEntry{Result: result, Created: now}
+	for k, e := range c.entries {
+		if now.Sub(e.Created) > c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	for len(c.entries) > maxSearchCacheEntries {
+		oldest := ""
+		for k, e := range c.entries {
+			if oldest == "" || e.Created.Before(c.entries[oldest].Created) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,556 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	// unlikelyContent matches class and id values of page chrome such as
+	// navigation, comments and ads
+	unlikelyContent = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|foot|header|legends|menu|modal|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|ad-break|agegate|pagination|pager|popup|promo|subscribe|newsletter|navbar|toolbar`)
+	// likelyContent matches class and id values of the main content
+	likelyContent = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow|post|entry|text|blog|story`)
+	// removedTags never hold readable content
+	removedTags = map[atom.Atom]bool{
+		atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+		atom.Svg: true, atom.Iframe: true, atom.Object: true, atom.Embed: true,
+		atom.Form: true, atom.Button: true, atom.Input: true, atom.Select: true,
+		atom.Textarea: true, atom.Link: true, atom.Meta: true, atom.Canvas: true,
+	}
+	// chromeTags hold site navigation rather than content
+	chromeTags = map[atom.Atom]bool{atom.Nav: true, atom.Footer: true, atom.Aside: true, atom.Header: true}
+	blockTags  = map[atom.Atom]bool{
+		atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+		atom.Body: true, atom.Center: true, atom.Dd: true, atom.Details: true, atom.Dialog: true,
+		atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Fieldset: true, atom.Figcaption: true,
+		atom.Figure: true, atom.Footer: true, atom.H1: true, atom.H2: true, atom.H3: true,
+		atom.H4: true, atom.H5: true, atom.H6: true, atom.Header: true, atom.Hgroup: true,
+		atom.Hr: true, atom.Li: true, atom.Main: true, atom.Nav: true, atom.Ol: true,
+		atom.P: true, atom.Pre: true, atom.Section: true, atom.Summary: true, atom.Table: true,
+		atom.Ul: true, atom.Html: true,
+	}
+	spaceRun = regexp.MustCompile(`[ \t\r\n\f]+`)
+	blankRun = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToMarkdown extracts the main content of an HTML page, the way
+// reader views do, and renders it as Markdown with links resolved
+// against base. The page title is returned separately.
+func htmlToMarkdown(page string, base *url.URL) (title, markdown string) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return "", ""
+	}
+	if t := findFirst(doc, atom.Title); t != nil {
+		title = strings.TrimSpace(spaceRun.ReplaceAllString(textContent(t), " "))
+	}
+	body := findFirst(doc, atom.Body)
+	if body == nil {
+		body = doc
+	}
+
+	clean(body, false)
+	w := &markdownWriter{base: base}
+	var parts []string
+	for _, n := range mainContent(body) {
+		parts = append(parts, w.block(n))
+	}
+	markdown = strings.Join(parts, "\n\n")
+
+	lines := strings.Split(markdown, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+	markdown = blankRun.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return title, strings.TrimSpace(markdown)
+}
+
+func findFirst(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findFirst(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func findAll(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && match(n) {
+			found = append(found, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+func attr(n *html.Node, key string) string {
+	v, _ := findAttr(n, key)
+	return v
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(textContent(c))
+	}
+	return sb.String()
+}
+
+// textLength counts the visible characters under n.
+func textLength(n *html.Node) int {
+	return len(strings.TrimSpace(spaceRun.ReplaceAllString(textContent(n), " ")))
+}
+
+// linkDensity is the share of the text of n that is inside links.
+func linkDensity(n *html.Node) float64 {
+	total := textLength(n)
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	for _, a := range findAll(n, func(n *html.Node) bool { return n.DataAtom == atom.A }) {
+		links += textLength(a)
+	}
+	return float64(links) / float64(total)
+}
+
+// clean removes scripts, hidden elements and page chrome below n. Chrome
+// tags are kept inside an article, where they are part of the content.
+func clean(n *html.Node, inArticle bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type != html.ElementNode:
+		case removedTags[c.DataAtom] || hidden(c) || (!inArticle && (chromeTags[c.DataAtom] || unlikely(c))):
+			n.RemoveChild(c)
+		default:
+			clean(c, inArticle || c.DataAtom == atom.Article || c.DataAtom == atom.Main)
+		}
+		c = next
+	}
+}
+
+func hidden(n *html.Node) bool {
+	if _, ok := findAttr(n, "hidden"); ok || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	style := strings.ReplaceAll(strings.ToLower(attr(n, "style")), " ", "")
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+func findAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func unlikely(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Body, atom.Article, atom.Main, atom.A, atom.Table, atom.Tbody, atom.Tr, atom.Td, atom.Th, atom.Pre, atom.Code:
+		return false
+	}
+	if role := attr(n, "role"); role == "navigation" || role == "banner" || role == "contentinfo" || role == "complementary" || role == "dialog" {
+		return true
+	}
+	names := attr(n, "class") + " " + attr(n, "id")
+	return unlikelyContent.MatchString(names) && !likelyContent.MatchString(names)
+}
+
+// classWeight favours elements whose class or id look like content.
+func classWeight(n *html.Node) float64 {
+	weight := 0.0
+	for _, name := range []string{attr(n, "class"), attr(n, "id")} {
+		if name == "" {
+			continue
+		}
+		if unlikelyContent.MatchString(name) {
+			weight -= 25
+		}
+		if likelyContent.MatchString(name) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// mainContent picks the nodes that hold the main content below body: the
+// only <article> or <main> if there is one, or else the element whose
+// paragraphs score highest, with siblings that look like part of it.
+func mainContent(body *html.Node) []*html.Node {
+	for _, a := range []atom.Atom{atom.Article, atom.Main} {
+		found := findAll(body, func(n *html.Node) bool { return n.DataAtom == a })
+		if len(found) == 1 && textLength(found[0]) > 200 {
+			return found
+		}
+	}
+	if main := findAll(body, func(n *html.Node) bool { return attr(n, "role") == "main" }); len(main) == 1 && textLength(main[0]) > 200 {
+		return main
+	}
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			switch n.DataAtom {
+			case atom.Div, atom.Article, atom.Section, atom.Main:
+				scores[n] = 5
+			case atom.Pre, atom.Td, atom.Blockquote:
+				scores[n] = 3
+			case atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+				scores[n] = -3
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+				scores[n] = -5
+			}
+			scores[n] += classWeight(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+	for _, p := range findAll(body, func(n *html.Node) bool {
+		return n.DataAtom == atom.P || n.DataAtom == atom.Pre || n.DataAtom == atom.Td
+	}) {
+		text := strings.TrimSpace(spaceRun.ReplaceAllString(textContent(p), " "))
+		if len(text) < 25 {
+			continue
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+		addScore(p.Parent, score)
+		if p.Parent != nil {
+			addScore(p.Parent.Parent, score/2)
+		}
+	}
+
+	var top *html.Node
+	for _, c := range candidates {
+		scores[c] *= 1 - linkDensity(c)
+		if top == nil || scores[c] > scores[top] {
+			top = c
+		}
+	}
+	if top == nil || top == body {
+		return []*html.Node{body}
+	}
+
+	// Content is often split across sibling elements
+	threshold := math.Max(10, scores[top]*0.2)
+	var nodes []*html.Node
+	for s := top.Parent.FirstChild; s != nil; s = s.NextSibling {
+		if s.Type != html.ElementNode {
+			continue
+		}
+		keep := s == top
+		if score, ok := scores[s]; ok && score >= threshold {
+			keep = true
+		}
+		if s.DataAtom == atom.P && linkDensity(s) < 0.25 && textLength(s) > 80 {
+			keep = true
+		}
+		if keep {
+			nodes = append(nodes, s)
+		}
+	}
+	return nodes
+}
+
+// markdownWriter renders HTML nodes as Markdown.
+type markdownWriter struct {
+	base *url.URL
+}
+
+func isBlock(n *html.Node) bool {
+	return n.Type == html.ElementNode && blockTags[n.DataAtom]
+}
+
+// blocks renders the children of n as Markdown blocks, gathering runs of
+// inline content into paragraphs.
+func (w *markdownWriter) blocks(n *html.Node) []string {
+	var out []string
+	var inline strings.Builder
+	flush := func() {
+		if text := tidyInline(inline.String()); text != "" {
+			out = append(out, text)
+		}
+		inline.Reset()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !isBlock(c) {
+			inline.WriteString(w.inline(c))
+			continue
+		}
+		flush()
+		if b := w.block(c); b != "" {
+			out = append(out, b)
+		}
+	}
+	flush()
+	return out
+}
+
+func (w *markdownWriter) block(n *html.Node) string {
+	if n.Type != html.ElementNode {
+		return tidyInline(w.inline(n))
+	}
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		text := strings.ReplaceAll(w.inlineText(n), "\n", " ")
+		if text == "" {
+			return ""
+		}
+		return strings.Repeat("#", int(n.Data[1]-'0')) + " " + text
+	case atom.P, atom.Dd, atom.Figcaption, atom.Summary:
+		return strings.Join(w.blocks(n), "\n\n")
+	case atom.Dt:
+		if text := w.inlineText(n); text != "" {
+			return "**" + text + "**"
+		}
+		return ""
+	case atom.Pre:
+		return codeBlock(n)
+	case atom.Ul, atom.Ol:
+		return w.list(n)
+	case atom.Blockquote:
+		inner := strings.Join(w.blocks(n), "\n\n")
+		if inner == "" {
+			return ""
+		}
+		return "> " + strings.ReplaceAll(inner, "\n", "\n> ")
+	case atom.Table:
+		return w.table(n)
+	case atom.Hr:
+		return "---"
+	default:
+		return strings.Join(w.blocks(n), "\n\n")
+	}
+}
+
+func (w *markdownWriter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return spaceRun.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		return "\n"
+	case atom.A:
+		text := strings.TrimSpace(w.children(n))
+		href := w.resolve(attr(n, "href"))
+		if text == "" || href == "" {
+			return text
+		}
+		return "[" + text + "](" + href + ")"
+	case atom.Img:
+		alt := strings.TrimSpace(attr(n, "alt"))
+		src := w.resolve(attr(n, "src"))
+		if alt == "" || src == "" {
+			return ""
+		}
+		return "![" + alt + "](" + src + ")"
+	case atom.Strong, atom.B:
+		return wrapInline(w.children(n), "**")
+	case atom.Em, atom.I:
+		return wrapInline(w.children(n), "*")
+	case atom.Del, atom.S, atom.Strike:
+		return wrapInline(w.children(n), "~~")
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		code := strings.TrimSpace(spaceRun.ReplaceAllString(textContent(n), " "))
+		if code == "" {
+			return ""
+		}
+		if strings.Contains(code, "`") {
+			return "`` " + code + " ``"
+		}
+		return "`" + code + "`"
+	}
+	if isBlock(n) {
+		// A block inside inline content, such as a div in a link
+		return " " + strings.Join(w.blocks(n), " ") + " "
+	}
+	return w.children(n)
+}
+
+func (w *markdownWriter) children(n *html.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(w.inline(c))
+	}
+	return sb.String()
+}
+
+// inlineText renders the content of n as one piece of inline Markdown.
+func (w *markdownWriter) inlineText(n *html.Node) string {
+	return tidyInline(w.children(n))
+}
+
+// resolve makes href absolute, dropping script and fragment-only links.
+func (w *markdownWriter) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if w.base != nil {
+		u = w.base.ResolveReference(u)
+	}
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(u.String())
+}
+
+func (w *markdownWriter) list(n *html.Node) string {
+	ordered := n.DataAtom == atom.Ol
+	index := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		index = start
+	}
+	var items []string
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode {
+			continue
+		}
+		marker := "- "
+		if ordered {
+			marker = fmt.Sprintf("%d. ", index)
+			index++
+		}
+		body := strings.Join(w.blocks(li), "\n")
+		if body == "" {
+			continue
+		}
+		// Continuation lines, such as nested lists, line up with the text
+		items = append(items, marker+strings.ReplaceAll(body, "\n", "\n"+strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+func (w *markdownWriter) table(n *html.Node) string {
+	var rows [][]string
+	columns := 0
+	nested := false
+	for _, tr := range findAll(n, func(c *html.Node) bool { return c.DataAtom == atom.Tr }) {
+		if closestTable(tr) != n {
+			nested = true
+			continue
+		}
+		var row []string
+		for c := tr.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom != atom.Td && c.DataAtom != atom.Th {
+				continue
+			}
+			cell := strings.Join(w.blocks(c), " ")
+			cell = strings.ReplaceAll(strings.ReplaceAll(cell, "\n", " "), "|", `\|`)
+			row = append(row, cell)
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+			columns = max(columns, len(row))
+		}
+	}
+	// Tables used for layout read better as plain blocks
+	if nested || columns < 2 || len(rows) == 0 {
+		return strings.Join(w.blocks(n), "\n\n")
+	}
+
+	var sb strings.Builder
+	writeRow := func(row []string) {
+		sb.WriteString("|")
+		for i := 0; i < columns; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			sb.WriteString(" " + cell + " |")
+		}
+		sb.WriteString("\n")
+	}
+	writeRow(rows[0])
+	sb.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func closestTable(n *html.Node) *html.Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.DataAtom == atom.Table {
+			return p
+		}
+	}
+	return nil
+}
+
+func codeBlock(n *html.Node) string {
+	code := strings.Trim(textContent(n), "\n")
+	if strings.TrimSpace(code) == "" {
+		return ""
+	}
+	lang := ""
+	for _, el := range append([]*html.Node{n}, findAll(n, func(c *html.Node) bool { return c.DataAtom == atom.Code })...) {
+		for _, class := range strings.Fields(attr(el, "class")) {
+			if l, ok := strings.CutPrefix(class, "language-"); ok {
+				lang = l
+			} else if l, ok := strings.CutPrefix(class, "lang-"); ok {
+				lang = l
+			}
+		}
+	}
+	fence := "```"
+	if strings.Contains(code, "```") {
+		fence = "~~~"
+	}
+	return fence + lang + "\n" + code + "\n" + fence
+}
+
+func wrapInline(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	// Keep the surrounding spaces outside the markers
+	lead := text[:len(text)-len(strings.TrimLeft(text, " "))]
+	trail := text[len(strings.TrimRight(text, " ")):]
+	return lead + marker + trimmed + marker + trail
+}
+
+// tidyInline trims the spaces around line breaks and at the ends of
+// rendered inline content.
+func tidyInline(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(spaceRun.ReplaceAllString(l, " "))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
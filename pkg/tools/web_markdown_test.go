@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHTMLToMarkdown_Elements(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/page.html")
+	page := `<!DOCTYPE html><html><head><title> Guide </title></head><body>
+<h1>Install</h1>
+<p>Read the <a href="../intro.html">introduction</a> and <a href="#top">skip</a> <b>first</b>, then <code>run</code> it.<br>Second line.</p>
+<ul>
+  <li>One</li>
+  <li>Two
+    <ol start="3"><li>Nested</li></ol>
+  </li>
+</ul>
+<pre><code class="language-sh">make build
+make install</code></pre>
+<table>
+  <tr><th>Name</th><th>Value</th></tr>
+  <tr><td>a|b</td><td><i>1</i></td></tr>
+</table>
+<blockquote><p>Quoted</p></blockquote>
+<img src="/logo.png" alt="Logo">
+</body></html>`
+
+	title, md := htmlToMarkdown(page, base)
+	if title != "Guide" {
+		t.Errorf("title = %q", title)
+	}
+	want := "# Install\n\n" +
+		"Read the [introduction](https://example.com/intro.html) and skip **first**, then `run` it.\nSecond line.\n\n" +
+		"- One\n- Two\n  3. Nested\n\n" +
+		"```sh\nmake build\nmake install\n```\n\n" +
+		"| Name | Value |\n| --- | --- |\n| a\\|b | *1* |\n\n" +
+		"> Quoted\n\n" +
+		"![Logo](https://example.com/logo.png)"
+	if md != want {
+		t.Errorf("markdown:\n%s\n\nwant:\n%s", md, want)
+	}
+}
+
+func TestHTMLToMarkdown_MainContent(t *testing.T) {
+	paragraph := "This paragraph is part of the story, and it is long enough, with commas, to count as content. "
+	page := `<html><body>
+<nav><a href="/">Home</a> <a href="/news">News</a></nav>
+<div class="sidebar"><p>` + strings.Repeat("Sidebar links and promotions. ", 5) + `</p></div>
+<div id="story">
+  <h2>Headline</h2>
+  <p>` + paragraph + `</p>
+  <p>` + paragraph + `</p>
+  <div style="display:none">Hidden text</div>
+  <script>var tracking = 1;</script>
+</div>
+<div class="comments"><p>` + strings.Repeat("A reader comment, with opinions. ", 5) + `</p></div>
+<footer>Copyright</footer>
+</body></html>`
+
+	_, md := htmlToMarkdown(page, nil)
+	if !strings.Contains(md, "## Headline") || strings.Count(md, "part of the story") != 2 {
+		t.Errorf("expected the story, got:\n%s", md)
+	}
+	for _, unwanted := range []string{"Home", "Sidebar", "Hidden", "tracking", "reader comment", "Copyright"} {
+		if strings.Contains(md, unwanted) {
+			t.Errorf("expected %q to be removed, got:\n%s", unwanted, md)
+		}
+	}
+}
+
+func TestHTMLToMarkdown_Article(t *testing.T) {
+	page := `<html><body><header>Site name</header><article><header><h1>Post</h1></header><p>` +
+		strings.Repeat("Article text. ", 20) + `</p></article><aside>Related posts</aside></body></html>`
+
+	_, md := htmlToMarkdown(page, nil)
+	if !strings.HasPrefix(md, "# Post\n\nArticle text.") {
+		t.Errorf("expected the article with its header, got:\n%s", md)
+	}
+	if strings.Contains(md, "Site name") || strings.Contains(md, "Related") {
+		t.Errorf("expected page chrome to be removed, got:\n%s", md)
+	}
+}
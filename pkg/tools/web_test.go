@@ -1,14 +1,24 @@
 package tools
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
 )
 
+// testAllowedHosts lets web_fetch reach the httptest servers on loopback.
+var testAllowedHosts = config.NetworkConfig{AllowedHosts: []string{"127.0.0.1", "::1"}}
+
 // TestWebTool_WebFetch_Success verifies successful URL fetching
 func TestWebTool_WebFetch_Success(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -18,7 +28,7 @@ func TestWebTool_WebFetch_Success(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tool := NewWebFetchTool(50000)
+	tool := NewWebFetchTool(50000, testAllowedHosts)
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": server.URL,
@@ -54,7 +64,7 @@ func TestWebTool_WebFetch_JSON(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tool := NewWebFetchTool(50000)
+	tool := NewWebFetchTool(50000, testAllowedHosts)
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": server.URL,
@@ -75,7 +85,7 @@ func TestWebTool_WebFetch_JSON(t *testing.T) {
 
 // TestWebTool_WebFetch_InvalidURL verifies error handling for invalid URL
 func TestWebTool_WebFetch_InvalidURL(t *testing.T) {
-	tool := NewWebFetchTool(50000)
+	tool := NewWebFetchTool(50000, testAllowedHosts)
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": "not-a-valid-url",
@@ -96,7 +106,7 @@ func TestWebTool_WebFetch_InvalidURL(t *testing.T) {
 
 // TestWebTool_WebFetch_UnsupportedScheme verifies error handling for non-http URLs
 func TestWebTool_WebFetch_UnsupportedScheme(t *testing.T) {
-	tool := NewWebFetchTool(50000)
+	tool := NewWebFetchTool(50000, testAllowedHosts)
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": "ftp://example.com/file.txt",
@@ -117,7 +127,7 @@ func TestWebTool_WebFetch_UnsupportedScheme(t *testing.T) {
 
 // TestWebTool_WebFetch_MissingURL verifies error handling for missing URL
 func TestWebTool_WebFetch_MissingURL(t *testing.T) {
-	tool := NewWebFetchTool(50000)
+	tool := NewWebFetchTool(50000, testAllowedHosts)
 	ctx := context.Background()
 	args := map[string]interface{}{}
 
@@ -145,7 +155,7 @@ func TestWebTool_WebFetch_Truncation(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tool := NewWebFetchTool(1000) // Limit to 1000 chars
+	tool := NewWebFetchTool(1000, testAllowedHosts) // Limit to 1000 chars
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": server.URL,
@@ -210,7 +220,7 @@ func TestWebTool_WebFetch_HTMLExtraction(t *testing.T) {
 	}))
 	defer server.Close()
 
-	tool := NewWebFetchTool(50000)
+	tool := NewWebFetchTool(50000, testAllowedHosts)
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": server.URL,
@@ -236,7 +246,7 @@ func TestWebTool_WebFetch_HTMLExtraction(t *testing.T) {
 
 // TestWebTool_WebFetch_MissingDomain verifies error handling for URL without domain
 func TestWebTool_WebFetch_MissingDomain(t *testing.T) {
-	tool := NewWebFetchTool(50000)
+	tool := NewWebFetchTool(50000, testAllowedHosts)
 	ctx := context.Background()
 	args := map[string]interface{}{
 		"url": "https://",
@@ -254,3 +264,237 @@ func TestWebTool_WebFetch_MissingDomain(t *testing.T) {
 		t.Errorf("Expected domain error message, got ForLLM: %s", result.ForLLM)
 	}
 }
+
+// TestWebTool_WebFetch_Markdown verifies HTML is returned to the LLM as Markdown
+func TestWebTool_WebFetch_Markdown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+		w.Write([]byte("<html><head><title>Caf\xe9</title></head><body><h1>Menu</h1><ul><li><a href=\"/tea\">Tea</a></li></ul></body></html>"))
+	}))
+	defer server.Close()
+
+	result := NewWebFetchTool(50000, testAllowedHosts).Execute(context.Background(), map[string]interface{}{"url": server.URL})
+	if result.IsError {
+		t.Fatalf("Expected success, got: %s", result.ForLLM)
+	}
+	for _, want := range []string{"extractor: markdown", "Title: Café", "# Menu", "- [Tea](" + server.URL + "/tea)"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("Expected ForLLM to contain %q, got: %s", want, result.ForLLM)
+		}
+	}
+}
+
+// TestWebTool_WebFetch_StartIndex verifies long content can be read in pages
+func TestWebTool_WebFetch_StartIndex(t *testing.T) {
+	content := strings.Repeat("a", 150) + strings.Repeat("é", 150)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	tool := NewWebFetchTool(200, testAllowedHosts)
+	result := tool.Execute(context.Background(), map[string]interface{}{"url": server.URL})
+	if !strings.Contains(result.ForLLM, "start_index=200") {
+		t.Errorf("Expected a hint to continue at 200, got: %s", result.ForLLM)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"url": server.URL, "start_index": float64(200)})
+	resultMap := make(map[string]interface{})
+	json.Unmarshal([]byte(result.ForUser), &resultMap)
+	if resultMap["text"] != strings.Repeat("é", 100) || resultMap["truncated"] != false {
+		t.Errorf("Expected the last 100 characters, got: %v", resultMap)
+	}
+	// length counts characters like start_index and total_chars
+	if resultMap["length"] != float64(100) || resultMap["total_chars"] != float64(300) {
+		t.Errorf("Expected length 100 of 300 characters, got: %v, %v", resultMap["length"], resultMap["total_chars"])
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"url": server.URL, "start_index": float64(300)})
+	if !result.IsError {
+		t.Errorf("Expected error for start_index past the end")
+	}
+}
+
+// TestWebTool_WebFetch_PDF verifies text is extracted from PDF documents
+func TestWebTool_WebFetch_PDF(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write(minimalPDF("Hello PDF"))
+	}))
+	defer server.Close()
+
+	result := NewWebFetchTool(50000, testAllowedHosts).Execute(context.Background(), map[string]interface{}{"url": server.URL})
+	if result.IsError {
+		t.Fatalf("Expected success, got: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "extractor: pdf") || !strings.Contains(result.ForLLM, "Hello PDF") {
+		t.Errorf("Expected PDF text, got: %s", result.ForLLM)
+	}
+}
+
+// TestWebTool_WebFetch_Binary verifies binary content is rejected
+func TestWebTool_WebFetch_Binary(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"))
+	}))
+	defer server.Close()
+
+	result := NewWebFetchTool(50000, testAllowedHosts).Execute(context.Background(), map[string]interface{}{"url": server.URL})
+	if !result.IsError || !strings.Contains(result.ForLLM, "image/png") {
+		t.Errorf("Expected error for binary content, got: %s", result.ForLLM)
+	}
+}
+
+// minimalPDF builds a one-page PDF showing text.
+func minimalPDF(text string) []byte {
+	stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// TestWebTool_WebFetch_BlocksPrivateAddresses verifies internal addresses are refused unless allowed
+func TestWebTool_WebFetch_BlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	result := NewWebFetchTool(50000, config.NetworkConfig{}).Execute(context.Background(), map[string]interface{}{"url": server.URL})
+	if !result.IsError || !strings.Contains(result.ForLLM, "request blocked") {
+		t.Errorf("Expected loopback to be blocked, got: %s", result.ForLLM)
+	}
+
+	// Allowing loopback does not extend to a redirect to the metadata service
+	result = NewWebFetchTool(50000, testAllowedHosts).Execute(context.Background(), map[string]interface{}{"url": server.URL})
+	if !result.IsError || !strings.Contains(result.ForLLM, "169.254.169.254") {
+		t.Errorf("Expected redirect to be blocked, got: %s", result.ForLLM)
+	}
+}
+
+// TestWebTool_WebSearch_SearXNG verifies results from a SearXNG JSON API
+func TestWebTool_WebSearch_SearXNG(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" || r.URL.Query().Get("format") != "json" || r.URL.Query().Get("q") != "go generics" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results": [
+			{"title": "Tutorial", "url": "https://go.dev/doc/tutorial/generics", "content": "Getting started with generics"},
+			{"title": "Spec", "url": "https://go.dev/ref/spec", "content": ""},
+			{"title": "Third", "url": "https://example.com/3", "content": "Not shown"}
+		]}`))
+	}))
+	defer server.Close()
+
+	tool := NewWebSearchTool(WebSearchToolOptions{SearXNGEnabled: true, SearXNGBaseURL: server.URL + "/", DuckDuckGoEnabled: true})
+	result := tool.Execute(context.Background(), map[string]interface{}{"query": "go generics", "count": float64(2)})
+	if result.IsError {
+		t.Fatalf("Expected success, got: %s", result.ForLLM)
+	}
+	want := "Results for: go generics (via SearXNG)\n" +
+		"1. Tutorial\n   https://go.dev/doc/tutorial/generics\n   Getting started with generics\n" +
+		"2. Spec\n   https://go.dev/ref/spec"
+	if result.ForLLM != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, result.ForLLM)
+	}
+}
+
+// TestWebTool_WebSearch_SearXNGJSONDisabled verifies the hint when the instance refuses JSON
+func TestWebTool_WebSearch_SearXNGJSONDisabled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	tool := NewWebSearchTool(WebSearchToolOptions{SearXNGEnabled: true, SearXNGBaseURL: server.URL})
+	result := tool.Execute(context.Background(), map[string]interface{}{"query": "test"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "search.formats") {
+		t.Errorf("Expected a hint about search.formats, got: %s", result.ForLLM)
+	}
+}
+
+// TestWebTool_WebSearch_Cache verifies repeated searches are answered from the cache
+func TestWebTool_WebSearch_Cache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(fmt.Sprintf(`{"results": [{"title": "Hit %d", "url": "https://example.com"}]}`, requests)))
+	}))
+	defer server.Close()
+
+	cachePath := filepath.Join(t.TempDir(), "cache", "web_search.json")
+	opts := WebSearchToolOptions{SearXNGEnabled: true, SearXNGBaseURL: server.URL, CachePath: cachePath, CacheTTL: time.Hour}
+	first := NewWebSearchTool(opts).Execute(context.Background(), map[string]interface{}{"query": "Weather  Berlin"})
+	// Another agent's tool shares the cache, and case and spacing do not matter
+	second := NewWebSearchTool(opts).Execute(context.Background(), map[string]interface{}{"query": "weather berlin"})
+	if requests != 1 || second.ForLLM != first.ForLLM {
+		t.Errorf("Expected one request and the same results, got %d requests:\n%s\n%s", requests, first.ForLLM, second.ForLLM)
+	}
+
+	// A different count is a different search
+	NewWebSearchTool(opts).Execute(context.Background(), map[string]interface{}{"query": "weather berlin", "count": float64(3)})
+	if requests != 2 {
+		t.Errorf("Expected a new request for another count, got %d requests", requests)
+	}
+
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Errorf("Expected the cache file to be written: %v", err)
+	}
+}
+
+func TestSearchCache_Expiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web_search.json")
+	c := openSearchCache(path, time.Hour)
+	now := time.Now()
+	c.put("old", "stale", now.Add(-2*time.Hour))
+	c.put("new", "fresh", now)
+
+	if _, ok := c.get("old", now); ok {
+		t.Error("Expected an expired entry to be missed")
+	}
+	if got, ok := c.get("new", now); !ok || got != "fresh" {
+		t.Errorf("Expected the fresh entry, got %q", got)
+	}
+
+	// Expired entries are dropped from the file on the next write
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "stale") {
+		t.Errorf("Expected the expired entry to be removed, got: %s", data)
+	}
+}
+
+func TestSearchCache_TTLPerTool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web_search.json")
+	long := openSearchCache(path, 24*time.Hour)
+	short := openSearchCache(path, time.Minute)
+	now := time.Now()
+	long.put("query", "result", now.Add(-time.Hour))
+
+	if _, ok := short.get("query", now); ok {
+		t.Error("Expected the entry to be expired for the short TTL")
+	}
+	if got, ok := long.get("query", now); !ok || got != "result" {
+		t.Errorf("Expected opening another tool's cache to keep the long TTL, got %q", got)
+	}
+}